@@ -1,23 +1,111 @@
 package config
 
 import (
-	"gorm.io/gorm"
-	"gorm.io/driver/postgres"
-	"os"
+	"fmt"
 	"log"
-	
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
+// Drivers soportados para DB_URL
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
 func ConnectDB() {
 	var err error
-	dsn := os.Getenv("DB_URL")
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, err = OpenDB(os.Getenv("DB_URL"))
 
 	if err != nil {
 		log.Fatal("Failed to connect DB with error: ", err)
 	} else {
-		log.Println("Connected to DB")
+		log.Printf("Connected to DB (%s)\n", DB.Dialector.Name())
+	}
+}
+
+// OpenDB abre la base con el driver que corresponde al esquema del DSN:
+//   - sqlite://ruta/al/archivo.db o sqlite://:memory: usan SQLite (sin cgo)
+//   - postgres://..., postgresql://... o el formato "host=... user=..." usan Postgres
+func OpenDB(dsn string) (*gorm.DB, error) {
+	driver, dsn, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Con TranslateError los dos drivers devuelven gorm.ErrDuplicatedKey al
+	// violar un índice único, lo que los handlers responden como 409
+	gormConfig := &gorm.Config{TranslateError: true}
+
+	if driver == DriverSQLite {
+		db, err := gorm.Open(sqlite.Open(dsn), gormConfig)
+		if err != nil {
+			return nil, err
+		}
+		// Una base en memoria vive mientras viva su conexión; con más de una
+		// conexión cada una vería una base vacía distinta
+		if strings.Contains(dsn, ":memory:") {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return nil, err
+			}
+			sqlDB.SetMaxOpenConns(1)
+		}
+		return db, nil
+	}
+
+	return gorm.Open(postgres.Open(dsn), gormConfig)
+}
+
+// parseDSN devuelve el driver y el DSN tal como lo espera ese driver
+func parseDSN(dsn string) (string, string, error) {
+	scheme, rest, found := strings.Cut(dsn, "://")
+	if !found {
+		// Formato clave=valor de Postgres, el que se usaba hasta ahora
+		return DriverPostgres, dsn, nil
+	}
+
+	switch strings.ToLower(scheme) {
+	case "postgres", "postgresql":
+		return DriverPostgres, dsn, nil
+	case "sqlite", "sqlite3":
+		if rest == "" {
+			return "", "", fmt.Errorf("sqlite DSN without a database path")
+		}
+		return DriverSQLite, sqlitePragmas(rest), nil
+	}
+	return "", "", fmt.Errorf("unsupported database scheme %q", scheme)
+}
+
+// sqlitePragmas agrega las opciones que la app necesita y SQLite no activa por
+// defecto: claves foráneas, espera ante bloqueos y WAL para lecturas concurrentes
+func sqlitePragmas(dsn string) string {
+	path, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		params = url.Values{}
+	}
+
+	pragmas := map[string]string{
+		"foreign_keys": "_pragma=foreign_keys(1)",
+		"busy_timeout": "_pragma=busy_timeout(5000)",
+	}
+	if path != ":memory:" {
+		pragmas["journal_mode"] = "_pragma=journal_mode(WAL)"
+	}
+
+	for name, pragma := range pragmas {
+		if !strings.Contains(query, name) {
+			key, value, _ := strings.Cut(pragma, "=")
+			params.Add(key, value)
+		}
 	}
-}
\ No newline at end of file
+	return path + "?" + params.Encode()
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis queda en nil si no se configuró REDIS_URL; en ese caso los contadores
+// compartidos (intentos de login, rate limit) se guardan en memoria
+var Redis *redis.Client
+
+func ConnectRedis() {
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		log.Println("REDIS_URL not set, using in-memory counters")
+		return
+	}
+
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		log.Fatal("Invalid REDIS_URL: ", err)
+	}
+
+	client := redis.NewClient(options)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Fatal("Failed to connect Redis with error: ", err)
+	}
+
+	Redis = client
+	log.Println("Connected to Redis")
+}
@@ -1,12 +0,0 @@
-package config
-
-import "github.com/lucapierini/project-go-task_manager/models"
-
-func SyncDB() {
-	// DB.AutoMigrate(&models.Project{})
-	// DB.AutoMigrate(&models.Task{})
-	DB.AutoMigrate(&models.User{})
-	DB.AutoMigrate(&models.Role{})
-	DB.AutoMigrate(&models.Project{})
-	DB.AutoMigrate(&models.Task{})
-}
\ No newline at end of file
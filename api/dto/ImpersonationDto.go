@@ -0,0 +1,6 @@
+package dto
+
+// ImpersonationDto: el motivo queda en la auditoría y lo ve el usuario
+type ImpersonationDto struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
@@ -0,0 +1,13 @@
+package dto
+
+type InvitationDto struct {
+	Email       string `json:"email" binding:"required,email"`
+	ProjectRole string `json:"project_role" binding:"omitempty,oneof=member co_owner"`
+}
+
+// AcceptInvitationDto: username y password solo hacen falta si el email todavía no tiene cuenta
+type AcceptInvitationDto struct {
+	Token    string `json:"token" binding:"required"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
@@ -0,0 +1,16 @@
+package dto
+
+type MFACodeDto struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAVerifyDto: segundo paso del login, con un código TOTP o uno de recuperación
+type MFAVerifyDto struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type SecuritySettingsDto struct {
+	RequireAdmin2FA *bool `json:"require_admin_2fa" binding:"required"`
+}
@@ -0,0 +1,8 @@
+package dto
+
+// PersonalAccessTokenDto: sin expires_in_days el token vence a los 90 días
+type PersonalAccessTokenDto struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1,dive,required"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
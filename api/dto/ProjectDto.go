@@ -10,4 +10,8 @@ type ProjectDto struct {
 	OwnerID uint `json:"owner_id" binding:"required"`
 	UsersIds []uint `json:"users_ids"`
 	TasksIds []uint `json:"tasks_ids"`
+}
+
+type ProjectTransferDto struct {
+	ToUserID uint `json:"to_user_id" binding:"required"`
 }
\ No newline at end of file
@@ -5,4 +5,33 @@ type TaskDto struct {
 	Description string `json:"description"`
 	OwnerID     uint   `json:"owner_id" binding:"required"`
 	ProjectID  uint   `json:"project_id"`
-}
\ No newline at end of file
+}
+
+// Operaciones de POST /api/tasks/bulk
+const (
+	BulkCreate   = "create"
+	BulkUpdate   = "update"
+	BulkDelete   = "delete"
+	BulkMove     = "move"
+	BulkReassign = "reassign"
+)
+
+// BulkTaskOperationDto es una operación del lote. Task es la tarea de create y
+// update, ProjectID el destino de move y OwnerID el nuevo dueño de reassign.
+// Version es la ETag leída de la tarea y es obligatoria salvo en create.
+type BulkTaskOperationDto struct {
+	Op        string   `json:"op" binding:"required,oneof=create update delete move reassign"`
+	TaskID    uint     `json:"task_id" binding:"required_unless=Op create"`
+	Version   uint     `json:"version" binding:"required_unless=Op create"`
+	Task      *TaskDto `json:"task" binding:"required_if=Op create,required_if=Op update"`
+	ProjectID uint     `json:"project_id" binding:"required_if=Op move"`
+	OwnerID   uint     `json:"owner_id" binding:"required_if=Op reassign"`
+}
+
+// BulkTaskDto es el cuerpo de POST /api/tasks/bulk. Las operaciones se validan
+// una por una para poder informar el error de cada una.
+type BulkTaskDto struct {
+	// Mode es atomic (todo o nada, por defecto) o best_effort
+	Mode       string                 `json:"mode" binding:"omitempty,oneof=atomic best_effort"`
+	Operations []BulkTaskOperationDto `json:"operations" binding:"required,min=1,max=100"`
+}
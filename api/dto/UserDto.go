@@ -3,6 +3,29 @@ package dto
 type UserDto struct {
     Username string `json:"username" binding:"required"`
     Email    string `json:"email" binding:"required,email"`
-    Password string `json:"password" binding:"required,min=6"`
+    // La longitud y el resto de las reglas las valida la política de contraseñas
+    Password string `json:"password" binding:"required"`
     RoleIds  []uint `json:"role_ids"`
-}
\ No newline at end of file
+    // Locale es el idioma preferido para los mensajes ("en", "es"); vacío usa Accept-Language
+    Locale   string `json:"locale,omitempty"`
+}
+
+// UserUpdateDto es el documento que se modifica con PATCH: la contraseña es
+// opcional y solo se cambia si viene
+type UserUpdateDto struct {
+    Username string `json:"username" binding:"required"`
+    Email    string `json:"email" binding:"required,email"`
+    Password string `json:"password,omitempty"`
+    RoleIds  []uint `json:"role_ids"`
+    Locale   string `json:"locale,omitempty"`
+}
+
+type ChangePasswordDto struct {
+    CurrentPassword string `json:"current_password" binding:"required"`
+    NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// VerificationDto lo usa un administrador para cambiar el estado de verificación de un email
+type VerificationDto struct {
+    Verified *bool `json:"verified" binding:"required"`
+}
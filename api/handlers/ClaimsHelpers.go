@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/models"
+)
+
+// currentClaims devuelve los claims que AuthMiddleware dejó en el contexto
+func currentClaims(c *gin.Context) *models.Claims {
+	userClaims, exists := c.Get("user")
+	if !exists {
+		return nil
+	}
+	return userClaims.(*models.Claims)
+}
+
+func isAdmin(claims *models.Claims) bool {
+	if claims == nil {
+		return false
+	}
+	for _, role := range claims.Roles {
+		if role == "Administrador" {
+			return true
+		}
+	}
+	return false
+}
+
+// actorScope devuelve 0 para los administradores (sin restricciones)
+// o el ID del usuario autenticado para limitar la acción a lo suyo
+func actorScope(c *gin.Context) uint {
+	claims := currentClaims(c)
+	if claims == nil || isAdmin(claims) {
+		return 0
+	}
+	return claims.UserID
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+var (
+	errIfMatchRequired = services.NewError(services.KindPreconditionRequired, "IF_MATCH_REQUIRED", "If-Match header is required, send the ETag returned when the resource was read")
+	errInvalidIfMatch  = services.NewError(services.KindPreconditionFailed, "INVALID_IF_MATCH", "If-Match must be a single strong ETag or *")
+)
+
+// etag arma la ETag fuerte de un recurso a partir de su versión
+func etag(version uint) string {
+	return strconv.Quote(strconv.FormatUint(uint64(version), 10))
+}
+
+// notModified manda la ETag del recurso y responde 304 si coincide con alguna
+// de If-None-Match. Como indica la RFC 9110, acá la comparación es débil: W/"3"
+// equivale a "3".
+func notModified(c *gin.Context, version uint) bool {
+	current := etag(version)
+	c.Header("ETag", current)
+
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion lee de If-Match la versión que el cliente leyó antes de
+// modificar el recurso. Sin el header responde 428 y devuelve false; con *
+// acepta cualquier versión. Solo se admite una única ETag fuerte: una débil
+// (W/), una lista o un valor sin comillas responden 412 INVALID_IF_MATCH, y
+// una ETag fuerte que no es una de nuestras versiones responde 412
+// VERSION_MISMATCH, como una versión vieja.
+func ifMatchVersion(c *gin.Context) (uint, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		abortWithError(c, errIfMatchRequired)
+		return 0, false
+	}
+	if header == "*" {
+		return services.AnyVersion, true
+	}
+
+	tag, err := strconv.Unquote(header)
+	if err != nil || strings.HasPrefix(header, "W/") {
+		abortWithError(c, errInvalidIfMatch)
+		return 0, false
+	}
+	version, err := strconv.ParseUint(tag, 10, 32)
+	if err != nil || version == 0 {
+		abortWithError(c, services.ErrVersionMismatch)
+		return 0, false
+	}
+	return uint(version), true
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/middlewares"
+)
+
+// newETagTestRouter expone ifMatchVersion y notModified sobre un recurso en la versión 3
+func newETagTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middlewares.ErrorHandler())
+	router.GET("/resource", func(c *gin.Context) {
+		if notModified(c, 3) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"version": 3})
+	})
+	router.PUT("/resource", func(c *gin.Context) {
+		version, ok := ifMatchVersion(c)
+		if !ok {
+			return
+		}
+		c.String(http.StatusOK, strconv.FormatUint(uint64(version), 10))
+	})
+	return router
+}
+
+func serveWithHeader(router *gin.Engine, method string, name string, value string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, "/resource", nil)
+	if value != "" {
+		request.Header.Set(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	router := newETagTestRouter()
+	tests := []struct {
+		name    string
+		ifMatch string
+		status  int
+		code    string
+		body    string
+	}{
+		{name: "missing header", status: http.StatusPreconditionRequired, code: "IF_MATCH_REQUIRED"},
+		{name: "strong etag", ifMatch: `"3"`, status: http.StatusOK, body: "3"},
+		{name: "any version", ifMatch: "*", status: http.StatusOK, body: "0"},
+		{name: "weak etag", ifMatch: `W/"3"`, status: http.StatusPreconditionFailed, code: "INVALID_IF_MATCH"},
+		{name: "unquoted etag", ifMatch: "3", status: http.StatusPreconditionFailed, code: "INVALID_IF_MATCH"},
+		{name: "list of etags", ifMatch: `"2", "3"`, status: http.StatusPreconditionFailed, code: "INVALID_IF_MATCH"},
+		{name: "foreign etag", ifMatch: `"abc"`, status: http.StatusPreconditionFailed, code: "VERSION_MISMATCH"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := serveWithHeader(router, http.MethodPut, "If-Match", tt.ifMatch)
+			if recorder.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, recorder.Code, recorder.Body)
+			}
+			if tt.code != "" && decodeProblemCode(t, recorder) != tt.code {
+				t.Fatalf("expected %s, got %s", tt.code, recorder.Body)
+			}
+			if tt.body != "" && recorder.Body.String() != tt.body {
+				t.Fatalf("expected version %s, got %s", tt.body, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	router := newETagTestRouter()
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		status      int
+	}{
+		{name: "no header", status: http.StatusOK},
+		{name: "current etag", ifNoneMatch: `"3"`, status: http.StatusNotModified},
+		{name: "weak comparison", ifNoneMatch: `W/"3"`, status: http.StatusNotModified},
+		{name: "one of a list", ifNoneMatch: `"1", "3"`, status: http.StatusNotModified},
+		{name: "any", ifNoneMatch: "*", status: http.StatusNotModified},
+		{name: "old etag", ifNoneMatch: `"2"`, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := serveWithHeader(router, http.MethodGet, "If-None-Match", tt.ifNoneMatch)
+			if recorder.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, recorder.Code, recorder.Body)
+			}
+			if etag := recorder.Header().Get("ETag"); etag != `"3"` {
+				t.Fatalf("expected the ETag header \"3\", got %q", etag)
+			}
+			if tt.status == http.StatusNotModified && recorder.Body.Len() != 0 {
+				t.Fatalf("a 304 must not have a body, got %s", recorder.Body)
+			}
+		})
+	}
+}
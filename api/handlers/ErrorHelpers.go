@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+var (
+	errMalformedJSON = services.NewError(services.KindValidation, "MALFORMED_JSON", "request body is not valid JSON")
+	errRouteNotFound = services.NewError(services.KindNotFound, "ROUTE_NOT_FOUND", "route not found")
+)
+
+// Los errores de validación nombran los campos como en el JSON y no como en el struct
+func init() {
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// abortWithError deja err para que lo responda middlewares.ErrorHandler; los
+// errores que no son de dominio se responden como error interno
+func abortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// bindJSON lee el body en obj y lo valida; si falla responde 400 con el
+// detalle de cada campo y devuelve false
+func bindJSON(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return false
+	}
+	return true
+}
+
+// requestLanguage es el idioma de los mensajes que eligió middlewares.Language
+func requestLanguage(c *gin.Context) string {
+	return c.GetString("language")
+}
+
+// RouteNotFound responde las rutas que no existen con el mismo formato que el resto de los errores
+func RouteNotFound(c *gin.Context) {
+	abortWithError(c, errRouteNotFound)
+}
+
+// invalidRequest traduce un error al leer o validar el body a un error de
+// validación con un FieldError por campo
+func invalidRequest(err error) *services.Error {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]services.FieldError, len(validationErrs))
+		for i, fieldErr := range validationErrs {
+			fields[i] = services.FieldError{
+				Field:   fieldPath(fieldErr),
+				Code:    fieldErr.Tag(),
+				Param:   fieldErr.Param(),
+				Message: validationMessage(fieldErr),
+			}
+		}
+		return services.ErrInvalidRequest.WithFields(fields...).Wrap(err)
+	case errors.As(err, &typeErr):
+		return services.ErrInvalidRequest.WithFields(services.FieldError{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Param:   typeErr.Type.String(),
+			Message: "must be of type " + typeErr.Type.String(),
+		}).Wrap(err)
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return errMalformedJSON.Wrap(err)
+	}
+
+	// DisallowUnknownFields no tiene un tipo de error propio
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return services.ErrInvalidRequest.WithFields(services.FieldError{
+			Field:   strings.Trim(field, `"`),
+			Code:    "unknown",
+			Message: "is not a known field",
+		}).Wrap(err)
+	}
+	return services.ErrInvalidRequest.Wrap(err)
+}
+
+// fieldPath arma la ruta del campo sin el nombre del struct raíz, por ejemplo operations[0].task.name
+func fieldPath(fieldErr validator.FieldError) string {
+	if _, path, ok := strings.Cut(fieldErr.Namespace(), "."); ok {
+		return path
+	}
+	return fieldErr.Field()
+}
+
+// validationMessage describe la regla que no se cumple
+func validationMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required", "required_if", "required_unless", "required_with", "required_without":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min", "gte":
+		return "must be at least " + fieldErr.Param()
+	case "max", "lte":
+		return "must be at most " + fieldErr.Param()
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fieldErr.Param()), ", ")
+	}
+	return "is invalid"
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+var errNotImpersonating = services.NewError(services.KindValidation, "NOT_IMPERSONATING", "not an impersonation token")
+
+type ImpersonationHandler struct {
+	impersonationService services.ImpersonationInterface
+}
+
+func NewImpersonationHandler(impersonationService services.ImpersonationInterface) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		impersonationService: impersonationService,
+	}
+}
+
+func (h *ImpersonationHandler) Impersonate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		abortWithError(c, services.InvalidParam("userId"))
+		return
+	}
+
+	var impersonationDto dto.ImpersonationDto
+	if !bindJSON(c, &impersonationDto) {
+		return
+	}
+
+	impersonation, token, err := h.impersonationService.StartImpersonation(c.Request.Context(), currentClaims(c).UserID, uint(id), impersonationDto.Reason, c.ClientIP())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"access_token":  token,
+		"expires_in":    int(time.Until(impersonation.ExpiresAt).Seconds()),
+		"impersonation": impersonation,
+	})
+}
+
+// EndOwnImpersonation lo usa el administrador con el token de suplantación para terminarla
+func (h *ImpersonationHandler) EndOwnImpersonation(c *gin.Context) {
+	claims := currentClaims(c)
+	if claims.Act == nil {
+		abortWithError(c, errNotImpersonating)
+		return
+	}
+
+	if err := h.impersonationService.EndImpersonation(c.Request.Context(), claims.Act.ImpersonationID); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation ended"})
+}
+
+func (h *ImpersonationHandler) EndImpersonation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("impersonationId"), 10, 32)
+	if err != nil {
+		abortWithError(c, services.InvalidParam("impersonationId"))
+		return
+	}
+
+	if err := h.impersonationService.EndImpersonation(c.Request.Context(), uint(id)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation ended"})
+}
+
+// ListImpersonations lista todas (admin) o las del usuario de la ruta
+func (h *ImpersonationHandler) ListImpersonations(c *gin.Context) {
+	var userId uint64
+	if param := c.Param("userId"); param != "" {
+		var err error
+		userId, err = strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			abortWithError(c, services.InvalidParam("userId"))
+			return
+		}
+	}
+
+	impersonations, err := h.impersonationService.ListImpersonations(c.Request.Context(), uint(userId))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"impersonations": impersonations})
+}
+
+func (h *ImpersonationHandler) GetImpersonation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("impersonationId"), 10, 32)
+	if err != nil {
+		abortWithError(c, services.InvalidParam("impersonationId"))
+		return
+	}
+
+	impersonation, err := h.impersonationService.GetImpersonation(c.Request.Context(), uint(id))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, impersonation)
+}
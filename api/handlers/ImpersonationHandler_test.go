@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/middlewares"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+type impersonationTestEnv struct {
+	store         *repositories.MemoryStore
+	service       *services.ImpersonationService
+	router        *gin.Engine
+	admin         models.User
+	user          models.User
+	impersonation *models.Impersonation
+	token         string
+}
+
+func newImpersonationTestEnv(t *testing.T) *impersonationTestEnv {
+	t.Helper()
+	t.Setenv("SIGNING_KEY_ENCRYPTION_KEY", testEncryptionKey)
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	store := repositories.NewMemoryStore()
+	roles := map[string]models.Role{}
+	for _, name := range []string{"Administrador", "Usuario"} {
+		role := models.Role{Name: name}
+		if err := store.Roles().Create(ctx, &role); err != nil {
+			t.Fatalf("creating role %s: %v", name, err)
+		}
+		roles[name] = role
+	}
+	if err := services.LoadSigningKeys(ctx, store); err != nil {
+		t.Fatalf("loading signing keys: %v", err)
+	}
+
+	admin := models.User{Username: "admin", Email: "admin@example.com", Password: "$2a$10$admin-bcrypt-hash", EmailVerified: true,
+		AuthProvider: models.AuthProviderLocal, Roles: []models.Role{roles["Administrador"], roles["Usuario"]}}
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "$2a$10$alice-bcrypt-hash", EmailVerified: true,
+		AuthProvider: models.AuthProviderLocal, Roles: []models.Role{roles["Usuario"]}}
+	for _, u := range []*models.User{&admin, &user} {
+		if err := store.Users().Create(ctx, u); err != nil {
+			t.Fatalf("creating user %s: %v", u.Username, err)
+		}
+	}
+
+	service := services.NewImpersonationService(store)
+	impersonation, token, err := service.StartImpersonation(ctx, admin.ID, user.ID, "support ticket", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("StartImpersonation: %v", err)
+	}
+
+	authenticator := middlewares.NewAuthenticator(services.NewTokenService(store), services.NewPersonalAccessTokenService(store), service)
+	handler := NewImpersonationHandler(service)
+	router := gin.New()
+	router.Use(middlewares.ErrorHandler())
+	router.GET("/api/users/:userId/impersonations", authenticator.Require("Usuario"), handler.ListImpersonations)
+	router.GET("/api/admin/impersonations/", authenticator.Require("Administrador"), handler.ListImpersonations)
+
+	return &impersonationTestEnv{store: store, service: service, router: router, admin: admin, user: user, impersonation: impersonation, token: token}
+}
+
+func (e *impersonationTestEnv) get(path string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.Header.Set("Authorization", "Bearer "+e.token)
+	recorder := httptest.NewRecorder()
+	e.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestListUserImpersonationsHidesAdminAccount(t *testing.T) {
+	env := newImpersonationTestEnv(t)
+
+	recorder := env.get("/api/users/" + strconv.Itoa(int(env.user.ID)) + "/impersonations")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	if strings.Contains(strings.ToLower(recorder.Body.String()), "password") {
+		t.Fatalf("the response must not contain a password key: %s", recorder.Body)
+	}
+
+	var response struct {
+		Impersonations []struct {
+			Admin map[string]interface{} `json:"admin"`
+		} `json:"impersonations"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || len(response.Impersonations) != 1 {
+		t.Fatalf("unexpected body %s (%v)", recorder.Body, err)
+	}
+	admin := response.Impersonations[0].Admin
+	if len(admin) != 2 || admin["username"] != "admin" || admin["id"] != float64(env.admin.ID) {
+		t.Fatalf("expected only the admin id and username, got %v", admin)
+	}
+}
+
+func TestRejectedImpersonatedRequestIsRecorded(t *testing.T) {
+	env := newImpersonationTestEnv(t)
+
+	// El usuario suplantado no es administrador: el pedido se corta en Require
+	recorder := env.get("/api/admin/impersonations/")
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	impersonation, err := env.service.GetImpersonation(context.Background(), env.impersonation.ID)
+	if err != nil {
+		t.Fatalf("GetImpersonation: %v", err)
+	}
+	if len(impersonation.Requests) != 1 || impersonation.Requests[0].Status != http.StatusForbidden ||
+		impersonation.Requests[0].Path != "/api/admin/impersonations/" {
+		t.Fatalf("expected the rejected request to be recorded, got %+v", impersonation.Requests)
+	}
+}
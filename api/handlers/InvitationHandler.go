@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+type InvitationHandler struct {
+	invitationService services.InvitationInterface
+	tokenService      services.TokenInterface
+}
+
+func NewInvitationHandler(invitationService services.InvitationInterface, tokenService services.TokenInterface) *InvitationHandler {
+	return &InvitationHandler{
+		invitationService: invitationService,
+		tokenService:      tokenService,
+	}
+}
+
+func (h *InvitationHandler) CreateInvitation(c *gin.Context) {
+	idProject, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("projectId"))
+		return
+	}
+
+	var invitationDto dto.InvitationDto
+	if !bindJSON(c, &invitationDto) {
+		return
+	}
+
+	invitation, err := h.invitationService.CreateInvitation(c.Request.Context(), uint(idProject), invitationDto, currentClaims(c).UserID, actorScope(c))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invitation": invitation,
+	})
+}
+
+func (h *InvitationHandler) ListInvitations(c *gin.Context) {
+	idProject, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("projectId"))
+		return
+	}
+
+	invitations, err := h.invitationService.ListInvitations(c.Request.Context(), uint(idProject))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invitations": invitations,
+	})
+}
+
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+	idProject, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("projectId"))
+		return
+	}
+
+	idInvitation, err := strconv.Atoi(c.Param("invitationId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("invitationId"))
+		return
+	}
+
+	if err := h.invitationService.RevokeInvitation(c.Request.Context(), uint(idProject), uint(idInvitation)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Invitation revoked successfully",
+	})
+}
+
+func (h *InvitationHandler) AcceptInvitation(c *gin.Context) {
+	var acceptDto dto.AcceptInvitationDto
+	if !bindJSON(c, &acceptDto) {
+		return
+	}
+
+	user, project, created, err := h.invitationService.AcceptInvitation(c.Request.Context(), acceptDto)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	response := gin.H{
+		"user":    user,
+		"project": project,
+	}
+
+	// Solo se entregan tokens si la cuenta se creó con la invitación;
+	// una cuenta existente tiene que iniciar sesión como siempre
+	if created {
+		tokens, err := h.tokenService.GenerateTokenPair(c.Request.Context(), user)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		response["access_token"] = tokens.AccessToken
+		response["refresh_token"] = tokens.RefreshToken
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+// JWKSHandler publica las claves públicas para que otros servicios verifiquen nuestros tokens
+func JWKSHandler(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, services.JWKS())
+}
+
+// RotateSigningKeyHandler fuerza una rotación, por ejemplo si una clave se vio comprometida
+func RotateSigningKeyHandler(c *gin.Context) {
+	key, err := services.RotateSigningKey(c.Request.Context())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Signing key rotated",
+		"kid":       key.KID,
+		"algorithm": key.Algorithm,
+	})
+}
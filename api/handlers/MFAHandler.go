@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+type MFAHandler struct {
+	mfaService     services.MFAInterface
+	settingService services.SettingInterface
+	tokenService   services.TokenInterface
+	loginGuard     *services.LoginGuard
+}
+
+func NewMFAHandler(mfaService services.MFAInterface, settingService services.SettingInterface, tokenService services.TokenInterface, loginGuard *services.LoginGuard) *MFAHandler {
+	return &MFAHandler{
+		mfaService:     mfaService,
+		settingService: settingService,
+		tokenService:   tokenService,
+		loginGuard:     loginGuard,
+	}
+}
+
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	secret, uri, err := h.mfaService.BeginEnrollment(c.Request.Context(), currentClaims(c).UserID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": uri,
+	})
+}
+
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	var codeDto dto.MFACodeDto
+	if !bindJSON(c, &codeDto) {
+		return
+	}
+
+	user, codes, err := h.mfaService.ConfirmEnrollment(c.Request.Context(), currentClaims(c).UserID, codeDto.Code)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	// Tokens nuevos: los anteriores pueden estar limitados a completar el alta de 2FA
+	tokens, err := h.tokenService.GenerateTokenPair(c.Request.Context(), user)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+		"access_token":   tokens.AccessToken,
+		"refresh_token":  tokens.RefreshToken,
+	})
+}
+
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var codeDto dto.MFACodeDto
+	if !bindJSON(c, &codeDto) {
+		return
+	}
+
+	if err := h.mfaService.Disable(c.Request.Context(), currentClaims(c).UserID, codeDto.Code); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var codeDto dto.MFACodeDto
+	if !bindJSON(c, &codeDto) {
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(c.Request.Context(), currentClaims(c).UserID, codeDto.Code)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// Verify es el segundo paso del login para usuarios con 2FA
+func (h *MFAHandler) Verify(c *gin.Context) {
+	var verifyDto dto.MFAVerifyDto
+	if !bindJSON(c, &verifyDto) {
+		return
+	}
+
+	// Los códigos se cuentan como intentos de login para que no se puedan adivinar
+	claims, err := services.ValidateToken(verifyDto.MFAToken)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	accountKey := services.MFAKey(claims.UserID)
+	if retryAfter, err := h.loginGuard.Check(c.Request.Context(), accountKey, c.ClientIP()); err != nil {
+		respondTooManyAttempts(c, retryAfter)
+		return
+	}
+
+	user, err := h.mfaService.VerifyLogin(c.Request.Context(), verifyDto.MFAToken, verifyDto.Code, verifyDto.RecoveryCode)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidMFACode) {
+			h.loginGuard.RegisterFailure(c.Request.Context(), accountKey, c.ClientIP())
+		}
+		abortWithError(c, err)
+		return
+	}
+	h.loginGuard.RegisterSuccess(c.Request.Context(), accountKey, c.ClientIP())
+
+	tokens, err := h.tokenService.GenerateTokenPair(c.Request.Context(), user)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"user":          user,
+	})
+}
+
+func (h *MFAHandler) ResetUserMFA(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		abortWithError(c, services.InvalidParam("userId"))
+		return
+	}
+
+	if err := h.mfaService.ResetForUser(c.Request.Context(), uint(id)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset for user"})
+}
+
+func (h *MFAHandler) GetSecuritySettings(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"require_admin_2fa": h.settingService.GetBool(c.Request.Context(), services.SettingRequireAdmin2FA, false),
+	})
+}
+
+func (h *MFAHandler) UpdateSecuritySettings(c *gin.Context) {
+	var settingsDto dto.SecuritySettingsDto
+	if !bindJSON(c, &settingsDto) {
+		return
+	}
+
+	if err := h.settingService.SetBool(c.Request.Context(), services.SettingRequireAdmin2FA, *settingsDto.RequireAdmin2FA); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"require_admin_2fa": *settingsDto.RequireAdmin2FA,
+	})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+const oidcStateCookie = "oidc_state"
+
+var (
+	errSSOUnavailable   = services.NewError(services.KindBadGateway, "SSO_UNAVAILABLE", "failed to start single sign-on")
+	errSSOProviderError = services.NewError(services.KindUnauthorized, "SSO_PROVIDER_ERROR", "the identity provider rejected the login")
+)
+
+type OIDCHandler struct {
+	oidcService  services.OIDCInterface
+	tokenService services.TokenInterface
+}
+
+func NewOIDCHandler(oidcService services.OIDCInterface, tokenService services.TokenInterface) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService:  oidcService,
+		tokenService: tokenService,
+	}
+}
+
+// Login redirige al proveedor OIDC y deja el state firmado en una cookie
+func (h *OIDCHandler) Login(c *gin.Context) {
+	if !h.oidcService.Enabled() {
+		abortWithError(c, services.ErrOIDCDisabled)
+		return
+	}
+
+	authURL, stateToken, err := h.oidcService.BeginLogin(c.Request.Context())
+	if err != nil {
+		abortWithError(c, errSSOUnavailable.Wrap(err))
+		return
+	}
+
+	secure := strings.HasPrefix(c.Request.Header.Get("X-Forwarded-Proto"), "https") || c.Request.TLS != nil
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, stateToken, 600, "/api/auth/oidc", "", secure, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if !h.oidcService.Enabled() {
+		abortWithError(c, services.ErrOIDCDisabled)
+		return
+	}
+
+	// El state solo sirve una vez
+	stateToken, _ := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/api/auth/oidc", "", false, true)
+
+	if providerError := c.Query("error"); providerError != "" {
+		// El error del proveedor va aparte del detalle, que se traduce
+		abortWithError(c, errSSOProviderError.With("provider_error", providerError).With("provider_description", c.Query("error_description")))
+		return
+	}
+
+	user, err := h.oidcService.CompleteLogin(c.Request.Context(), c.Query("code"), c.Query("state"), stateToken)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	// Igual que en el login con contraseña, con 2FA activo falta el segundo paso
+	if user.TOTPEnabled {
+		mfaToken, err := h.tokenService.GenerateMFAPendingToken(c.Request.Context(), user)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
+		return
+	}
+
+	tokens, err := h.tokenService.GenerateTokenPair(c.Request.Context(), user)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"user":          user,
+	})
+}
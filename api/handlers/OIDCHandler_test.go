@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/lucapierini/project-go-task_manager/middlewares"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+const (
+	testOIDCClientID = "task-manager"
+	testOIDCKeyID    = "test-key"
+	// testEncryptionKey son 32 bytes en base64 para SIGNING_KEY_ENCRYPTION_KEY
+	testEncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+)
+
+// fakeOIDCProvider sirve discovery, JWKS y token como un proveedor OIDC real;
+// identity son los claims que devuelve en el id_token del próximo login
+type fakeOIDCProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	identity map[string]interface{}
+
+	nonce         string
+	codeChallenge string
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	provider := &fakeOIDCProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]interface{}{
+			"issuer":                                provider.server.URL,
+			"authorization_endpoint":                provider.server.URL + "/authorize",
+			"token_endpoint":                        provider.server.URL + "/token",
+			"jwks_uri":                              provider.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": testOIDCKeyID,
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", provider.token(t))
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+// token canjea el código solo si el code_verifier corresponde al challenge del login
+func (p *fakeOIDCProvider) token(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("code") != "valid-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != p.codeChallenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   p.server.URL,
+			"aud":   testOIDCClientID,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": p.nonce,
+		}
+		for name, value := range p.identity {
+			claims[name] = value
+		}
+		idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		idToken.Header["kid"] = testOIDCKeyID
+		signed, err := idToken.SignedString(p.key)
+		if err != nil {
+			t.Errorf("signing id token: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeTestJSON(w, map[string]interface{}{
+			"access_token": "provider-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     signed,
+		})
+	}
+}
+
+func writeTestJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+type oidcTestEnv struct {
+	store    *repositories.MemoryStore
+	provider *fakeOIDCProvider
+	router   *gin.Engine
+}
+
+func newOIDCTestEnv(t *testing.T, requireVerifiedEmail bool) *oidcTestEnv {
+	t.Helper()
+	t.Setenv("SIGNING_KEY_ENCRYPTION_KEY", testEncryptionKey)
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	store := repositories.NewMemoryStore()
+	for _, name := range []string{"Administrador", "Usuario"} {
+		if err := store.Roles().Create(ctx, &models.Role{Name: name}); err != nil {
+			t.Fatalf("creating role %s: %v", name, err)
+		}
+	}
+	if err := services.LoadSigningKeys(ctx, store); err != nil {
+		t.Fatalf("loading signing keys: %v", err)
+	}
+
+	provider := newFakeOIDCProvider(t)
+	oidcService := services.NewOIDCService(store, services.OIDCConfig{
+		Issuer:               provider.server.URL,
+		ClientID:             testOIDCClientID,
+		ClientSecret:         "secret",
+		RedirectURL:          "http://localhost/api/auth/oidc/callback",
+		RoleMapping:          "task-admins:Administrador",
+		RequireVerifiedEmail: requireVerifiedEmail,
+	})
+	handler := NewOIDCHandler(oidcService, services.NewTokenService(store))
+
+	router := gin.New()
+	router.Use(middlewares.ErrorHandler())
+	router.GET("/api/auth/oidc/login", handler.Login)
+	router.GET("/api/auth/oidc/callback", handler.Callback)
+	return &oidcTestEnv{store: store, provider: provider, router: router}
+}
+
+// login recorre Login y Callback como lo haría el navegador; el proveedor
+// devuelve identity en el id_token
+func (e *oidcTestEnv) login(t *testing.T, identity map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	e.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("login: expected 302, got %d: %s", recorder.Code, recorder.Body)
+	}
+	authURL, err := url.Parse(recorder.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect: %v", err)
+	}
+	query := authURL.Query()
+	e.provider.nonce = query.Get("nonce")
+	e.provider.codeChallenge = query.Get("code_challenge")
+	e.provider.identity = identity
+
+	callback := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?code=valid-code&state="+url.QueryEscape(query.Get("state")), nil)
+	for _, cookie := range recorder.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	recorder = httptest.NewRecorder()
+	e.router.ServeHTTP(recorder, callback)
+	return recorder
+}
+
+func (e *oidcTestEnv) createUser(t *testing.T, user *models.User) {
+	t.Helper()
+	if err := e.store.Users().Create(context.Background(), user); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+}
+
+func decodeProblemCode(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	t.Helper()
+	var problem struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("invalid error body %q: %v", recorder.Body, err)
+	}
+	return problem.Code
+}
+
+func TestOIDCCallbackCreatesUserWithMappedRoles(t *testing.T) {
+	env := newOIDCTestEnv(t, true)
+
+	recorder := env.login(t, map[string]interface{}{
+		"sub":                "subject-1",
+		"email":              "Alice@Example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"groups":             []string{"task-admins"},
+	})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("callback: expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	var response struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.AccessToken == "" {
+		t.Fatalf("expected an access token, got %s", recorder.Body)
+	}
+
+	user, err := env.store.Users().FindByExternalSubject(context.Background(), models.AuthProviderOIDC, "subject-1")
+	if err != nil {
+		t.Fatalf("user was not provisioned: %v", err)
+	}
+	if user.Email != "alice@example.com" || user.Username != "alice" || !user.EmailVerified {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	roles := map[string]bool{}
+	for _, role := range user.Roles {
+		roles[role.Name] = true
+	}
+	if !roles["Usuario"] || !roles["Administrador"] {
+		t.Fatalf("expected the default and mapped roles, got %+v", user.Roles)
+	}
+}
+
+func TestOIDCCallbackCreatesUnverifiedUser(t *testing.T) {
+	env := newOIDCTestEnv(t, false)
+
+	recorder := env.login(t, map[string]interface{}{"sub": "subject-3", "email": "dave@example.com", "email_verified": false})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("callback: expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	user, err := env.store.Users().FindByExternalSubject(context.Background(), models.AuthProviderOIDC, "subject-3")
+	if err != nil {
+		t.Fatalf("user was not provisioned: %v", err)
+	}
+	if user.EmailVerified || user.EmailVerifiedAt != nil {
+		t.Fatalf("an email the provider did not verify must stay unverified, got %+v", user)
+	}
+}
+
+func TestOIDCCallbackLinksVerifiedLocalAccount(t *testing.T) {
+	env := newOIDCTestEnv(t, true)
+	env.createUser(t, &models.User{Username: "bob", Email: "bob@example.com", Password: "hash", AuthProvider: models.AuthProviderLocal})
+
+	recorder := env.login(t, map[string]interface{}{"sub": "subject-2", "email": "bob@example.com", "email_verified": true})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("callback: expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	user, err := env.store.Users().FindByEmail(context.Background(), "bob@example.com")
+	if err != nil || user.AuthProvider != models.AuthProviderOIDC || user.ExternalSubject == nil || *user.ExternalSubject != "subject-2" {
+		t.Fatalf("expected the local account to be linked, got %+v (%v)", user, err)
+	}
+}
+
+func TestOIDCCallbackRefusesToLinkOtherAccounts(t *testing.T) {
+	ldapSubject := "uid=carol,ou=people,dc=example,dc=com"
+	tests := []struct {
+		name     string
+		existing models.User
+		verified bool
+	}{
+		{
+			name:     "local account with an unverified email",
+			existing: models.User{Username: "carol", Email: "carol@example.com", Password: "hash", AuthProvider: models.AuthProviderLocal},
+			verified: false,
+		},
+		{
+			name:     "ldap account",
+			existing: models.User{Username: "carol", Email: "carol@example.com", AuthProvider: models.AuthProviderLDAP, ExternalSubject: &ldapSubject},
+			verified: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newOIDCTestEnv(t, false)
+			env.createUser(t, &tt.existing)
+
+			recorder := env.login(t, map[string]interface{}{"sub": "attacker", "email": "carol@example.com", "email_verified": tt.verified})
+			if recorder.Code != http.StatusConflict || decodeProblemCode(t, recorder) != "SSO_ACCOUNT_EXISTS" {
+				t.Fatalf("expected 409 SSO_ACCOUNT_EXISTS, got %d: %s", recorder.Code, recorder.Body)
+			}
+			user, err := env.store.Users().FindByEmail(context.Background(), "carol@example.com")
+			if err != nil || user.AuthProvider != tt.existing.AuthProvider {
+				t.Fatalf("the existing account must not change, got %+v (%v)", user, err)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	env := newOIDCTestEnv(t, true)
+
+	recorder := httptest.NewRecorder()
+	env.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+	callback := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?code=valid-code&state=forged", nil)
+	for _, cookie := range recorder.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	recorder = httptest.NewRecorder()
+	env.router.ServeHTTP(recorder, callback)
+
+	if recorder.Code != http.StatusUnauthorized || decodeProblemCode(t, recorder) != "SSO_INVALID_STATE" {
+		t.Fatalf("expected 401 SSO_INVALID_STATE, got %d: %s", recorder.Code, recorder.Body)
+	}
+}
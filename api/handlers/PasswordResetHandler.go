@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+type PasswordResetHandler struct {
+	passwordResetService services.PasswordResetInterface
+	resetQueue           *services.PasswordResetQueue
+}
+
+func NewPasswordResetHandler(passwordResetService services.PasswordResetInterface, resetQueue *services.PasswordResetQueue) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		passwordResetService: passwordResetService,
+		resetQueue:           resetQueue,
+	}
+}
+
+func (h *PasswordResetHandler) ForgotPassword(c *gin.Context) {
+	var forgotDto dto.ForgotPasswordDto
+	if !bindJSON(c, &forgotDto) {
+		return
+	}
+
+	// Se procesa en segundo plano para que la respuesta (y su demora) sea la
+	// misma exista o no la cuenta; con la cola llena el pedido se descarta
+	if !h.resetQueue.Enqueue(forgotDto.Email) {
+		log.Println("Password reset queue is full, dropping request")
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If the email is registered, a password reset link has been sent",
+	})
+}
+
+func (h *PasswordResetHandler) ResetPassword(c *gin.Context) {
+	var resetDto dto.ResetPasswordDto
+	if !bindJSON(c, &resetDto) {
+		return
+	}
+
+	if err := h.passwordResetService.ResetPassword(c.Request.Context(), resetDto.Token, resetDto.Password); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password reset successfully, please log in again",
+	})
+}
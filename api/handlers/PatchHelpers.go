@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+var (
+	errUnsupportedPatch = services.NewError(services.KindUnsupportedMedia, "UNSUPPORTED_PATCH_FORMAT", "use "+mergePatchContentType+" or "+jsonPatchContentType)
+	errInvalidPatch     = services.NewError(services.KindValidation, "INVALID_PATCH", "invalid patch")
+	errPatchTestFailed  = services.NewError(services.KindConflict, "PATCH_TEST_FAILED", "patch test failed")
+	errPatchNotApplied  = services.NewError(services.KindUnprocessable, "PATCH_NOT_APPLIED", "patch could not be applied")
+)
+
+// patchVersion devuelve la versión a la que se aplica un PATCH: la que pidió
+// If-Match o, con *, la que se acaba de leer. Así, si el recurso cambia entre la
+// lectura y el guardado, el patch no pisa el cambio. Responde 412 si no coincide.
+func patchVersion(c *gin.Context, expected uint, current uint) (uint, bool) {
+	if expected != services.AnyVersion && expected != current {
+		abortWithError(c, services.ErrVersionMismatch)
+		return 0, false
+	}
+	return current, true
+}
+
+// bindPatch aplica el body a current según el Content-Type, como merge patch
+// (RFC 7396) o JSON Patch (RFC 6902), y deja el resultado en target validado con
+// las mismas reglas que el alta. Si algo falla responde y devuelve false.
+func bindPatch(c *gin.Context, current interface{}, target interface{}) bool {
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		abortWithError(c, services.ErrInvalidRequest.Wrap(err))
+		return false
+	}
+	document, err := json.Marshal(current)
+	if err != nil {
+		abortWithError(c, err)
+		return false
+	}
+
+	var patched []byte
+	switch c.ContentType() {
+	case mergePatchContentType:
+		if !json.Valid(patch) {
+			abortWithError(c, errMalformedJSON)
+			return false
+		}
+		patched, err = jsonpatch.MergePatch(document, patch)
+	case jsonPatchContentType:
+		var operations jsonpatch.Patch
+		if operations, err = jsonpatch.DecodePatch(patch); err != nil {
+			abortWithError(c, errInvalidPatch.With("reason", err.Error()).Wrap(err))
+			return false
+		}
+		patched, err = operations.Apply(document)
+	default:
+		abortWithError(c, errUnsupportedPatch)
+		return false
+	}
+	if err != nil {
+		// Un test que falla indica que el recurso no está como el cliente esperaba
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			abortWithError(c, errPatchTestFailed.Wrap(err))
+			return false
+		}
+		abortWithError(c, errPatchNotApplied.With("reason", err.Error()).Wrap(err))
+		return false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return false
+	}
+	if err := binding.Validator.ValidateStruct(target); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return false
+	}
+	return true
+}
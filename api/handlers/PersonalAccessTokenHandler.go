@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+type PersonalAccessTokenHandler struct {
+	tokenService services.PersonalAccessTokenInterface
+}
+
+func NewPersonalAccessTokenHandler(tokenService services.PersonalAccessTokenInterface) *PersonalAccessTokenHandler {
+	return &PersonalAccessTokenHandler{
+		tokenService: tokenService,
+	}
+}
+
+func (h *PersonalAccessTokenHandler) CreateToken(c *gin.Context) {
+	var tokenDto dto.PersonalAccessTokenDto
+	if !bindJSON(c, &tokenDto) {
+		return
+	}
+
+	accessToken, token, err := h.tokenService.CreateToken(c.Request.Context(), currentClaims(c).UserID, tokenDto)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Store this token now, it will not be shown again",
+		"token":        token,
+		"access_token": accessToken,
+	})
+}
+
+func (h *PersonalAccessTokenHandler) ListTokens(c *gin.Context) {
+	tokens, err := h.tokenService.ListTokens(c.Request.Context(), currentClaims(c).UserID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+func (h *PersonalAccessTokenHandler) RevokeToken(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("tokenId"), 10, 32)
+	if err != nil {
+		abortWithError(c, services.InvalidParam("tokenId"))
+		return
+	}
+
+	if err := h.tokenService.RevokeToken(c.Request.Context(), currentClaims(c).UserID, uint(id)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
@@ -22,15 +22,14 @@ func NewProjectHandler(projectService services.ProjectInterface) *ProjectHandler
 func (h *ProjectHandler) CreateProject(c *gin.Context){
 	var projectDto dto.ProjectDto
 
-	if err := c.ShouldBindJSON(&projectDto); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+	if !bindJSON(c, &projectDto) {
 		return
 	}
 
-	project, err := h.projectService.CreateProject(projectDto)
+	project, err := h.projectService.CreateProject(c.Request.Context(), projectDto)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error", "details": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
@@ -43,14 +42,17 @@ func (h *ProjectHandler) GetProjectById(c *gin.Context){
 	id, err := strconv.Atoi(c.Param("projectId"))
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project id"})
+		abortWithError(c, services.InvalidParam("projectId"))
 		return
 	}
 
-	project, err := h.projectService.GetProjectById(uint(id))
+	project, err := h.projectService.GetProjectById(c.Request.Context(), uint(id))
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		abortWithError(c, err)
+		return
+	}
+	if notModified(c, project.Version) {
 		return
 	}
 
@@ -60,10 +62,10 @@ func (h *ProjectHandler) GetProjectById(c *gin.Context){
 }
 
 func (h *ProjectHandler) ListProjects(c *gin.Context){
-	projects, err := h.projectService.ListProjects()
+	projects, err := h.projectService.ListProjects(c.Request.Context())
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error", "details": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
@@ -76,23 +78,79 @@ func (h *ProjectHandler) UpdateProject(c *gin.Context){
 	id, err := strconv.Atoi(c.Param("projectId"))
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project id"})
+		abortWithError(c, services.InvalidParam("projectId"))
+		return
+	}
+	version, ok := ifMatchVersion(c)
+	if !ok {
 		return
 	}
 
 	var projectDto dto.ProjectDto
-	if err := c.ShouldBindJSON(&projectDto); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+	if !bindJSON(c, &projectDto) {
 		return
 	}
 
-	project, err := h.projectService.UpdateProject(uint(id), projectDto)
+	project, err := h.projectService.UpdateProject(c.Request.Context(), uint(id), version, projectDto)
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
+	c.Header("ETag", etag(project.Version))
+	c.JSON(http.StatusOK, gin.H{
+		"project": project,
+	})
+}
+
+// PatchProject modifica solo los campos que indica el patch; el resultado se valida como en el alta
+func (h *ProjectHandler) PatchProject(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("projectId"))
+		return
+	}
+	expected, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	project, err := h.projectService.GetProjectById(c.Request.Context(), uint(id))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	version, ok := patchVersion(c, expected, project.Version)
+	if !ok {
+		return
+	}
+
+	current := dto.ProjectDto{
+		Name:     project.Name,
+		Budget:   project.Budget,
+		OwnerID:  project.OwnerID,
+		UsersIds: []uint{},
+		TasksIds: []uint{},
+	}
+	for _, user := range project.Users {
+		current.UsersIds = append(current.UsersIds, user.ID)
+	}
+	for _, task := range project.Tasks {
+		current.TasksIds = append(current.TasksIds, task.ID)
+	}
+	var projectDto dto.ProjectDto
+	if !bindPatch(c, current, &projectDto) {
+		return
+	}
+
+	project, err = h.projectService.UpdateProject(c.Request.Context(), uint(id), version, projectDto)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("ETag", etag(project.Version))
 	c.JSON(http.StatusOK, gin.H{
 		"project": project,
 	})
@@ -102,13 +160,14 @@ func (h *ProjectHandler) ListProjectsByUserId(c *gin.Context){
 	id, err := strconv.Atoi(c.Param("userId"))
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		abortWithError(c, services.InvalidParam("userId"))
+		return
 	}
 
-	projects, err := h.projectService.ListProjectsByUserId(uint(id))
+	projects, err := h.projectService.ListProjectsByUserId(c.Request.Context(), uint(id))
 
 	if err != nil{
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error", "details": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
@@ -122,39 +181,64 @@ func (h *ProjectHandler) DeleteProject(c *gin.Context){
 	id, err := strconv.Atoi(c.Param("projectId"))
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project id"})
+		abortWithError(c, services.InvalidParam("projectId"))
 		return
 	}
 
-	err = h.projectService.DeleteProject(uint(id))
+	impact, err := h.projectService.DeleteProject(c.Request.Context(), uint(id), c.DefaultQuery("policy", services.DeletionPolicyDetach))
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error", "details": err.Error()})
+		// El impacto calculado ayuda a entender por qué se rechazó el borrado
+		if impact != nil {
+			err = services.AsError(err).With("impact", impact)
+		}
+		abortWithError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Project deleted successfully",
+		"impact": impact,
 	})
 
 }
 
+func (h *ProjectHandler) ProjectDeletionImpact(c *gin.Context){
+	id, err := strconv.Atoi(c.Param("projectId"))
+
+	if err != nil {
+		abortWithError(c, services.InvalidParam("projectId"))
+		return
+	}
+
+	impact, err := h.projectService.PlanProjectDeletion(c.Request.Context(), uint(id), c.DefaultQuery("policy", services.DeletionPolicyDetach))
+
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"impact": impact,
+	})
+}
+
 func (h *ProjectHandler) AddUserToProject(c *gin.Context){
 	idProject, err := strconv.Atoi(c.Param("projectId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project id"})
+		abortWithError(c, services.InvalidParam("projectId"))
 		return
 	}
 
 	idUser, err := strconv.Atoi(c.Param("userId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		abortWithError(c, services.InvalidParam("userId"))
 		return
 	}
-	err = h.projectService.AddUserToProject(uint(idProject), uint(idUser))
+	err = h.projectService.AddUserToProject(c.Request.Context(), uint(idProject), uint(idUser))
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error", "details": err.Error()})
+		abortWithError(c, err)
 		return
 		}
 	
@@ -166,20 +250,20 @@ func (h *ProjectHandler) AddUserToProject(c *gin.Context){
 func (h *ProjectHandler) RemoveUserFromProject(c *gin.Context){
 	idProject, err := strconv.Atoi(c.Param("projectId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project or user id"})
+		abortWithError(c, services.InvalidParam("projectId"))
 		return
 	}
 
 	idUser, err := strconv.Atoi(c.Param("userId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		abortWithError(c, services.InvalidParam("userId"))
 		return
 	}
 
-	err = h.projectService.RemoveUserFromProject(uint(idProject), uint(idUser))
+	err = h.projectService.RemoveUserFromProject(c.Request.Context(), uint(idProject), uint(idUser))
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error", "details": err.Error()})
+		abortWithError(c, err)
 		return
 		}
 	
@@ -191,20 +275,20 @@ func (h *ProjectHandler) RemoveUserFromProject(c *gin.Context){
 func (h *ProjectHandler) AddTaskToProject(c *gin.Context){
 	idProject, err := strconv.Atoi(c.Param("projectId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project id"})
+		abortWithError(c, services.InvalidParam("projectId"))
 		return
 	}
 
 	idTask, err := strconv.Atoi(c.Param("taskId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task id"})
+		abortWithError(c, services.InvalidParam("taskId"))
 		return
 	}
 
-	err = h.projectService.AddTaskToProject(uint(idProject), uint(idTask))
+	err = h.projectService.AddTaskToProject(c.Request.Context(), uint(idProject), uint(idTask))
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error", "details": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
@@ -216,23 +300,159 @@ func (h *ProjectHandler) AddTaskToProject(c *gin.Context){
 func (h *ProjectHandler) RemoveTaskFromProject(c *gin.Context){
 	idProject, err := strconv.Atoi(c.Param("projectId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project id"})
+		abortWithError(c, services.InvalidParam("projectId"))
 		return
 	}
 
 	idTask, err := strconv.Atoi(c.Param("taskId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task id"})
+		abortWithError(c, services.InvalidParam("taskId"))
 		return
 	}
 
-	err = h.projectService.RemoveTaskFromProject(uint(idProject), uint(idTask))
+	err = h.projectService.RemoveTaskFromProject(c.Request.Context(), uint(idProject), uint(idTask))
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error", "details": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Tasks removed from project successfully",
 	})
-}
\ No newline at end of file
+}
+
+func (h *ProjectHandler) AddCoOwnerToProject(c *gin.Context){
+	idProject, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("projectId"))
+		return
+	}
+
+	idUser, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("userId"))
+		return
+	}
+
+	err = h.projectService.AddCoOwnerToProject(c.Request.Context(), uint(idProject), uint(idUser), actorScope(c))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Co-owner added to project successfully",
+	})
+}
+
+func (h *ProjectHandler) RemoveCoOwnerFromProject(c *gin.Context){
+	idProject, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("projectId"))
+		return
+	}
+
+	idUser, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("userId"))
+		return
+	}
+
+	err = h.projectService.RemoveCoOwnerFromProject(c.Request.Context(), uint(idProject), uint(idUser), actorScope(c))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Co-owner removed from project successfully",
+	})
+}
+
+func (h *ProjectHandler) ProposeTransfer(c *gin.Context){
+	idProject, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("projectId"))
+		return
+	}
+
+	var transferDto dto.ProjectTransferDto
+	if !bindJSON(c, &transferDto) {
+		return
+	}
+
+	// Solo el dueño principal puede proponer la transferencia, también si es administrador
+	transfer, err := h.projectService.ProposeTransfer(c.Request.Context(), uint(idProject), transferDto.ToUserID, currentClaims(c).UserID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"transfer": transfer,
+	})
+}
+
+func (h *ProjectHandler) CancelTransfer(c *gin.Context){
+	idProject, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("projectId"))
+		return
+	}
+
+	if err := h.projectService.CancelTransfer(c.Request.Context(), uint(idProject), actorScope(c)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Transfer cancelled successfully",
+	})
+}
+
+func (h *ProjectHandler) ListIncomingTransfers(c *gin.Context){
+	transfers, err := h.projectService.ListIncomingTransfers(c.Request.Context(), currentClaims(c).UserID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transfers": transfers,
+	})
+}
+
+func (h *ProjectHandler) AcceptTransfer(c *gin.Context){
+	idTransfer, err := strconv.Atoi(c.Param("transferId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("transferId"))
+		return
+	}
+
+	project, err := h.projectService.AcceptTransfer(c.Request.Context(), uint(idTransfer), currentClaims(c).UserID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"project": project,
+	})
+}
+
+func (h *ProjectHandler) DeclineTransfer(c *gin.Context){
+	idTransfer, err := strconv.Atoi(c.Param("transferId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("transferId"))
+		return
+	}
+
+	if err := h.projectService.DeclineTransfer(c.Request.Context(), uint(idTransfer), currentClaims(c).UserID); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Transfer declined",
+	})
+}
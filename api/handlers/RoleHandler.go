@@ -20,14 +20,13 @@ func NewRoleHandler(roleService services.RoleInterface) *RoleHandler {
 
 func (h *RoleHandler) CreateRole(c *gin.Context) {
 	var roleDto dto.RoleDto
-	if err := c.ShouldBindJSON(&roleDto); err != nil {
-		c.JSON(400, gin.H{"error": "Invalid data"})
+	if !bindJSON(c, &roleDto) {
 		return
 	}
 
-	role, err := h.roleService.CreateRole(roleDto)
+	role, err := h.roleService.CreateRole(c.Request.Context(), roleDto)
 	if err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
@@ -37,13 +36,16 @@ func (h *RoleHandler) CreateRole(c *gin.Context) {
 func (h *RoleHandler) GetRole(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("roleId"), 10, 32)
 	if err != nil {
-		c.JSON(400, gin.H{"error": "Invalid ID"})
+		abortWithError(c, services.InvalidParam("roleId"))
 		return
 	}
 
-	role, err := h.roleService.GetRoleById(uint(id))
+	role, err := h.roleService.GetRoleById(c.Request.Context(), uint(id))
 	if err != nil {
-		c.JSON(404, gin.H{"error": "Role not found"})
+		abortWithError(c, err)
+		return
+	}
+	if notModified(c, role.Version) {
 		return
 	}
 
@@ -53,34 +55,75 @@ func (h *RoleHandler) GetRole(c *gin.Context) {
 func (h *RoleHandler) UpdateRole(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("roleId"), 10, 32)
 	if err != nil {
-		c.JSON(400, gin.H{"error": "Invalid ID"})
+		abortWithError(c, services.InvalidParam("roleId"))
+		return
+	}
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	var roleDto dto.RoleDto
+	if !bindJSON(c, &roleDto) {
+		return
+	}
+
+	role, err := h.roleService.UpdateRole(c.Request.Context(), uint(id), version, roleDto)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("ETag", etag(role.Version))
+	c.JSON(200, role)
+}
+
+// PatchRole modifica solo los campos que indica el patch; el resultado se valida como en el alta
+func (h *RoleHandler) PatchRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("roleId"), 10, 32)
+	if err != nil {
+		abortWithError(c, services.InvalidParam("roleId"))
+		return
+	}
+	expected, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	role, err := h.roleService.GetRoleById(c.Request.Context(), uint(id))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	version, ok := patchVersion(c, expected, role.Version)
+	if !ok {
 		return
 	}
 
 	var roleDto dto.RoleDto
-	if err := c.ShouldBindJSON(&roleDto); err != nil {
-		c.JSON(400, gin.H{"error": "Invalid data"})
+	if !bindPatch(c, dto.RoleDto{Name: role.Name}, &roleDto) {
 		return
 	}
 
-	role, err := h.roleService.UpdateRole(uint(id), roleDto)
+	role, err = h.roleService.UpdateRole(c.Request.Context(), uint(id), version, roleDto)
 	if err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
+	c.Header("ETag", etag(role.Version))
 	c.JSON(200, role)
 }
 
 func (h *RoleHandler) DeleteRole(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("roleId"), 10, 32)
 	if err != nil {
-		c.JSON(400, gin.H{"error": "Invalid ID"})
+		abortWithError(c, services.InvalidParam("roleId"))
 		return
 	}
 
-	if err := h.roleService.DeleteRole(uint(id)); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+	if err := h.roleService.DeleteRole(c.Request.Context(), uint(id)); err != nil {
+		abortWithError(c, err)
 		return
 	}
 
@@ -88,9 +131,9 @@ func (h *RoleHandler) DeleteRole(c *gin.Context) {
 }
 
 func (h *RoleHandler) ListRoles(c *gin.Context) {
-	roles, err := h.roleService.ListRoles()
+	roles, err := h.roleService.ListRoles(c.Request.Context())
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to fetch roles"})
+		abortWithError(c, err)
 		return
 	}
 
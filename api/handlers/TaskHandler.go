@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/models"
 	"github.com/lucapierini/project-go-task_manager/services"
 )
 
@@ -24,15 +27,14 @@ func NewTaskHandler(taskService services.TaskInterface) *TaskHandler {
 func (h *TaskHandler) CreateTask(c *gin.Context) {
 	var taskDto dto.TaskDto
 
-	if err := c.ShouldBindJSON(&taskDto); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+	if !bindJSON(c, &taskDto) {
 		return
 	}
 
-	task, err := h.taskService.CreateTask(taskDto)
+	task, err := h.taskService.CreateTask(c.Request.Context(), taskDto)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error", "details": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
@@ -45,14 +47,17 @@ func (h *TaskHandler) GetTaskById(c *gin.Context) {
 	id, err:= strconv.Atoi(c.Param("taskId"))
 	
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task id"})
+		abortWithError(c, services.InvalidParam("taskId"))
 		return
 	}
 	
-	task, err := h.taskService.GetTaskById(uint(id))
+	task, err := h.taskService.GetTaskById(c.Request.Context(), uint(id))
 	
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		abortWithError(c, err)
+		return
+	}
+	if notModified(c, task.Version) {
 		return
 	}
 
@@ -64,32 +69,76 @@ func (h *TaskHandler) GetTaskById(c *gin.Context) {
 func (h *TaskHandler) UpdateTask(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("taskId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task id"})
+		abortWithError(c, services.InvalidParam("taskId"))
+		return
+	}
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	var taskDto dto.TaskDto
+	if !bindJSON(c, &taskDto) {
+		return
+	}
+
+	task, err := h.taskService.UpdateTask(c.Request.Context(), uint(id), version, taskDto)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("ETag", etag(task.Version))
+	c.JSON(http.StatusOK, gin.H{
+		"task": task,
+	})
+}
+
+// PatchTask modifica solo los campos que indica el patch; el resultado se valida como en el alta
+func (h *TaskHandler) PatchTask(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("taskId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("taskId"))
+		return
+	}
+	expected, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	task, err := h.taskService.GetTaskById(c.Request.Context(), uint(id))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	version, ok := patchVersion(c, expected, task.Version)
+	if !ok {
 		return
 	}
 
+	current := dto.TaskDto{Name: task.Name, Description: task.Description, OwnerID: task.OwnerID}
 	var taskDto dto.TaskDto
-	if err := c.ShouldBindJSON(&taskDto); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+	if !bindPatch(c, current, &taskDto) {
 		return
 	}
 
-	task, err := h.taskService.UpdateTask(uint(id), taskDto)
+	task, err = h.taskService.UpdateTask(c.Request.Context(), uint(id), version, taskDto)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error", "details": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
+	c.Header("ETag", etag(task.Version))
 	c.JSON(http.StatusOK, gin.H{
 		"task": task,
 	})
 }
 
 func (h *TaskHandler) ListTasks(c *gin.Context) {
-	tasks, err := h.taskService.ListTasks()
+	tasks, err := h.taskService.ListTasks(c.Request.Context())
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error", "details": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
@@ -101,15 +150,114 @@ func (h *TaskHandler) ListTasks(c *gin.Context) {
 func (h *TaskHandler) DeleteTask(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("taskId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task id"})
+		abortWithError(c, services.InvalidParam("taskId"))
 		return
 	}
-	response := h.taskService.DeleteTask(uint(id))
+	response := h.taskService.DeleteTask(c.Request.Context(), uint(id))
 	if response != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error", "details": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Task deleted successfully",
 	})
 }
+
+// bulkTaskResult es el resultado de una operación de BulkTasks
+type bulkTaskResult struct {
+	Index  int                   `json:"index"`
+	Op     string                `json:"op"`
+	TaskID uint                  `json:"task_id,omitempty"`
+	Status int                   `json:"status"`
+	Task   *models.Task          `json:"task,omitempty"`
+	Code   string                `json:"code,omitempty"`
+	Error  string                `json:"error,omitempty"`
+	Errors []services.FieldError `json:"errors,omitempty"`
+}
+
+// fail completa el resultado con el error de la operación, con el mismo status
+// y código que tendría la operación en su endpoint individual. Los mensajes van
+// en language, como los del error del pedido.
+func (r *bulkTaskResult) fail(err error, language string) {
+	domainErr := services.AsError(err)
+	r.Status = domainErr.Status()
+	if r.Status >= http.StatusInternalServerError {
+		log.Printf("Error in bulk task operation %d (%s): %v\n", r.Index, r.Op, err)
+	}
+	domainErr = domainErr.Localize(language)
+	r.Code = domainErr.Code
+	r.Error = domainErr.Message
+	r.Errors = domainErr.Fields
+}
+
+// BulkTasks aplica varias operaciones sobre tareas (create, update, delete,
+// move y reassign) en un solo pedido y responde el resultado de cada una. En
+// modo atomic un error deshace todo y se responde con su código; en
+// best_effort se aplica lo que se pueda y, si algo falló, se responde 207.
+func (h *TaskHandler) BulkTasks(c *gin.Context) {
+	var bulkDto dto.BulkTaskDto
+	if !bindJSON(c, &bulkDto) {
+		return
+	}
+	mode := bulkDto.Mode
+	if mode == "" {
+		mode = services.BulkModeAtomic
+	}
+
+	language := requestLanguage(c)
+	results := make([]bulkTaskResult, len(bulkDto.Operations))
+	operations := []dto.BulkTaskOperationDto{}
+	indexes := []int{}
+	for i, operation := range bulkDto.Operations {
+		results[i] = bulkTaskResult{Index: i, Op: operation.Op, TaskID: operation.TaskID}
+		if err := binding.Validator.ValidateStruct(&operation); err != nil {
+			results[i].fail(invalidRequest(err), language)
+			continue
+		}
+		operations = append(operations, operation)
+		indexes = append(indexes, i)
+	}
+
+	// En modo atomic una operación inválida cancela el lote sin aplicar nada
+	if mode == services.BulkModeAtomic && len(operations) < len(results) {
+		for i := range results {
+			if results[i].Status == 0 {
+				results[i].fail(services.ErrBulkAborted, language)
+			}
+		}
+		abortWithError(c, services.ErrInvalidBulkOperation.With("mode", mode).With("results", results))
+		return
+	}
+
+	applied, err := h.taskService.BulkTasks(c.Request.Context(), actorScope(c), mode, operations)
+	failures := len(operations) < len(results)
+	for j, result := range applied {
+		i := indexes[j]
+		if result.Err != nil {
+			failures = true
+			results[i].fail(result.Err, language)
+			continue
+		}
+		results[i].Task = result.Task
+		switch results[i].Op {
+		case dto.BulkCreate:
+			results[i].Status = http.StatusCreated
+			results[i].TaskID = result.Task.ID
+		case dto.BulkDelete:
+			results[i].Status = http.StatusNoContent
+		default:
+			results[i].Status = http.StatusOK
+		}
+	}
+
+	// En modo atomic se responde el error que deshizo el lote junto con el resultado de cada operación
+	if err != nil {
+		abortWithError(c, services.AsError(err).With("mode", mode).With("results", results))
+		return
+	}
+	status := http.StatusOK
+	if failures {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, gin.H{"mode": mode, "results": results})
+}
@@ -4,45 +4,51 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/lucapierini/project-go-task_manager/models"
 	"github.com/lucapierini/project-go-task_manager/services"
-	"gorm.io/gorm"
 )
 
-func RefreshTokenHandler(c *gin.Context) {
-	refreshToken := c.GetHeader("Refresh-Token")
-	if refreshToken == "" {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "refresh token required"})
-		return
+var errRefreshTokenRequired = services.NewError(services.KindUnauthorized, "REFRESH_TOKEN_REQUIRED", "refresh token required")
+
+// RefreshTokenHandler recarga el usuario con userService antes de emitir los tokens nuevos con tokenService
+func RefreshTokenHandler(userService services.UserInterface, tokenService services.TokenInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		refreshToken := c.GetHeader("Refresh-Token")
+		if refreshToken == "" {
+			abortWithError(c, errRefreshTokenRequired)
+			return
+		}
+
+		claims, err := services.ValidateToken(refreshToken)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		if claims.TokenType != "refresh" {
+			abortWithError(c, services.ErrInvalidToken)
+			return
+		}
+
+		if err := tokenService.CheckSession(c.Request.Context(), claims); err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		// Se recarga el usuario para que los tokens nuevos reflejen sus roles y
+		// su verificación de email actuales (y no se renueven si fue borrado)
+		user, err := userService.GetUserById(c.Request.Context(), claims.UserID)
+		if err != nil {
+			abortWithError(c, services.ErrSessionRevoked.Wrap(err))
+			return
+		}
+
+		// Generate new token pair
+		tokenPair, err := tokenService.GenerateTokenPair(c.Request.Context(), user)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, tokenPair)
 	}
-
-	claims, err := services.ValidateToken(refreshToken)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		return
-	}
-
-	if claims.TokenType != "refresh" {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token type"})
-		return
-	}
-
-	// Create a minimal user object with the claims data
-	user := &models.User{
-		Model: gorm.Model{ID: claims.UserID},
-		Roles: []models.Role{},
-	}
-
-	for _, roleName := range claims.Roles {
-		user.Roles = append(user.Roles, models.Role{Name: roleName})
-	}
-
-	// Generate new token pair
-	tokenPair, err := services.GenerateTokenPair(user)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to generate new tokens"})
-		return
-	}
-
-	c.JSON(http.StatusOK, tokenPair)
 }
\ No newline at end of file
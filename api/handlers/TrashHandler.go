@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+type TrashHandler struct {
+	trashService services.TrashInterface
+}
+
+func NewTrashHandler(trashService services.TrashInterface) *TrashHandler {
+	return &TrashHandler{
+		trashService: trashService,
+	}
+}
+
+func (h *TrashHandler) ListTrash(c *gin.Context) {
+	resource := c.Param("resource")
+
+	items, err := h.trashService.ListTrash(c.Request.Context(), resource, actorScope(c))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"resource": resource,
+		"items":    items,
+	})
+}
+
+func (h *TrashHandler) RestoreFromTrash(c *gin.Context) {
+	resource := c.Param("resource")
+	id, err := strconv.Atoi(c.Param("resourceId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("resourceId"))
+		return
+	}
+
+	item, err := h.trashService.Restore(c.Request.Context(), resource, uint(id), actorScope(c))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"resource": resource,
+		"item":     item,
+	})
+}
+
+func (h *TrashHandler) PurgeFromTrash(c *gin.Context) {
+	resource := c.Param("resource")
+	id, err := strconv.Atoi(c.Param("resourceId"))
+	if err != nil {
+		abortWithError(c, services.InvalidParam("resourceId"))
+		return
+	}
+
+	if err := h.trashService.Purge(c.Request.Context(), resource, uint(id)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Item permanently deleted",
+	})
+}
@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"errors"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lucapierini/project-go-task_manager/dto"
@@ -11,35 +15,49 @@ import (
 
 type UserHandler struct {
 	userService services.UserInterface
+	verificationService services.VerificationInterface
+	tokenService services.TokenInterface
+	loginGuard *services.LoginGuard
 }
 
-func NewUserHandler(userService services.UserInterface) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService services.UserInterface, verificationService services.VerificationInterface, tokenService services.TokenInterface, loginGuard *services.LoginGuard) *UserHandler {
+	return &UserHandler{userService: userService, verificationService: verificationService, tokenService: tokenService, loginGuard: loginGuard}
+}
+
+var (
+	errEmailRequired        = services.NewError(services.KindValidation, "EMAIL_REQUIRED", "email is required")
+	errTokenRequired        = services.NewError(services.KindValidation, "TOKEN_REQUIRED", "token is required")
+	errWrongCurrentPassword = services.NewError(services.KindUnauthorized, "INVALID_CURRENT_PASSWORD", "current password is incorrect")
+)
+
+// respondTooManyAttempts responde 429 con el tiempo de espera en Retry-After
+func respondTooManyAttempts(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	abortWithError(c, services.ErrTooManyAttempts)
 }
 
 func (h *UserHandler) Register(c *gin.Context) {
 	var userDto dto.UserDto
-	if err := c.ShouldBindJSON(&userDto); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+	if !bindJSON(c, &userDto) {
 		return
 	}
+	// El registro público siempre crea usuarios con el rol por defecto
+	userDto.RoleIds = nil
 
-	user, err := h.userService.RegisterUser(userDto)
+	user, err := h.userService.RegisterUser(c.Request.Context(), userDto)
 	if err != nil {
-		statusCode := http.StatusInternalServerError
-		switch err {
-		case services.ErrEmailAlreadyRegistered:
-			statusCode = http.StatusConflict
-		case services.ErrInvalidData:
-			statusCode = http.StatusBadRequest
-		}
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
-	tokens, err := services.GenerateTokenPair(user)
+	// Si el correo falla la cuenta igual queda creada; se puede pedir otro enlace
+	if err := h.verificationService.SendVerification(user); err != nil {
+		log.Printf("Error sending verification email to user %d: %v\n", user.ID, err)
+	}
+
+	tokens, err := h.tokenService.GenerateTokenPair(c.Request.Context(), user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		abortWithError(c, err)
 		return
 	}
 
@@ -52,40 +70,72 @@ func (h *UserHandler) Register(c *gin.Context) {
 
 func (h *UserHandler) Login(c *gin.Context) {
 	var loginDto dto.LoginDto
-	if err := c.ShouldBindJSON(&loginDto); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credentials"})
+	if !bindJSON(c, &loginDto) {
+		return
+	}
+
+	// Los intentos se cuentan por email aunque la cuenta no exista, para no revelar cuáles existen
+	accountKey := services.AccountKey(loginDto.Email)
+	if retryAfter, err := h.loginGuard.Check(c.Request.Context(), accountKey, c.ClientIP()); err != nil {
+		respondTooManyAttempts(c, retryAfter)
 		return
 	}
 
-	user, err := h.userService.LoginUser(loginDto)
+	user, err := h.userService.LoginUser(c.Request.Context(), loginDto)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		h.loginGuard.RegisterFailure(c.Request.Context(), accountKey, c.ClientIP())
+		// Cuenta inexistente o contraseña incorrecta responden lo mismo, para no revelar qué cuentas existen
+		abortWithError(c, services.ErrInvalidCredentials)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		abortWithError(c, err)
+		return
+	}
+	h.loginGuard.RegisterSuccess(c.Request.Context(), accountKey, c.ClientIP())
+
+	// Con 2FA activo el login solo entrega un token para completar /api/auth/2fa/verify
+	if user.TOTPEnabled {
+		mfaToken, err := h.tokenService.GenerateMFAPendingToken(c.Request.Context(), user)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
 		return
 	}
 
-	tokens, err := services.GenerateTokenPair(user)
+	tokens, err := h.tokenService.GenerateTokenPair(c.Request.Context(), user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		abortWithError(c, err)
 		return
 	}
 
+	// Con la contraseña vencida los tokens solo sirven para /api/auth/change-password
 	c.JSON(http.StatusOK, gin.H{
-		"access_token":  tokens.AccessToken,
-		"refresh_token": tokens.RefreshToken,
-		"user":          user,
+		"access_token":             tokens.AccessToken,
+		"refresh_token":            tokens.RefreshToken,
+		"user":                     user,
+		"password_change_required": services.PasswordChangeRequired(user),
 	})
 }
 
 func (h *UserHandler) GetUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("userId"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		abortWithError(c, services.InvalidParam("userId"))
 		return
 	}
 
-	user, err := h.userService.GetUserById(uint(id))
+	user, err := h.userService.GetUserById(c.Request.Context(), uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		abortWithError(c, err)
+		return
+	}
+	if notModified(c, user.Version) {
 		return
 	}
 
@@ -95,13 +145,13 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 func (h *UserHandler) GetUserByEmail(c *gin.Context) {
 	email := c.Query("email")
 	if email == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+		abortWithError(c, errEmailRequired)
 		return
 	}
 
-	user, err := h.userService.GetUserByEmail(email)
+	user, err := h.userService.GetUserByEmail(c.Request.Context(), email)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		abortWithError(c, err)
 		return
 	}
 
@@ -109,9 +159,9 @@ func (h *UserHandler) GetUserByEmail(c *gin.Context) {
 }
 
 func (h *UserHandler) ListUsers(c *gin.Context) {
-	users, err := h.userService.ListUsers()
+	users, err := h.userService.ListUsers(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		abortWithError(c, err)
 		return
 	}
 
@@ -121,56 +171,142 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 func (h *UserHandler) UpdateUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("userId"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		abortWithError(c, services.InvalidParam("userId"))
+		return
+	}
+	version, ok := ifMatchVersion(c)
+	if !ok {
 		return
 	}
 
 	var userDto dto.UserDto
-	if err := c.ShouldBindJSON(&userDto); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+	if !bindJSON(c, &userDto) {
+		return
+	}
+	// Solo un administrador cambia roles; sin RoleIds se conservan los actuales
+	if !isAdmin(currentClaims(c)) {
+		userDto.RoleIds = nil
+	}
+
+	user, err := h.userService.UpdateUser(c.Request.Context(), uint(id), version, userDto)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("ETag", etag(user.Version))
+	c.JSON(http.StatusOK, user)
+}
+
+// PatchUser modifica solo los campos que indica el patch. A diferencia de
+// UpdateUser la contraseña es opcional: si el patch no la agrega no se cambia.
+func (h *UserHandler) PatchUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		abortWithError(c, services.InvalidParam("userId"))
+		return
+	}
+	expected, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.GetUserById(c.Request.Context(), uint(id))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	version, ok := patchVersion(c, expected, user.Version)
+	if !ok {
+		return
+	}
+
+	current := dto.UserUpdateDto{Username: user.Username, Email: user.Email, RoleIds: []uint{}, Locale: user.Locale}
+	for _, role := range user.Roles {
+		current.RoleIds = append(current.RoleIds, role.ID)
+	}
+	var userDto dto.UserUpdateDto
+	if !bindPatch(c, current, &userDto) {
 		return
 	}
+	if !isAdmin(currentClaims(c)) {
+		userDto.RoleIds = nil
+	}
 
-	user, err := h.userService.UpdateUser(uint(id), userDto)
+	user, err = h.userService.UpdateUser(c.Request.Context(), uint(id), version, dto.UserDto(userDto))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
+	c.Header("ETag", etag(user.Version))
 	c.JSON(http.StatusOK, user)
 }
 
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("userId"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		abortWithError(c, services.InvalidParam("userId"))
+		return
+	}
+
+	successorId, err := strconv.ParseUint(c.DefaultQuery("successor_id", "0"), 10, 32)
+	if err != nil {
+		abortWithError(c, services.InvalidParam("successor_id"))
+		return
+	}
+
+	impact, err := h.userService.DeleteUser(c.Request.Context(), uint(id), c.DefaultQuery("policy", services.DeletionPolicyRestrict), uint(successorId))
+	if err != nil {
+		// El impacto calculado ayuda a entender por qué se rechazó el borrado
+		if impact != nil {
+			err = services.AsError(err).With("impact", impact)
+		}
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully", "impact": impact})
+}
+
+func (h *UserHandler) UserDeletionImpact(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		abortWithError(c, services.InvalidParam("userId"))
 		return
 	}
 
-	if err := h.userService.DeleteUser(uint(id)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+	successorId, err := strconv.ParseUint(c.DefaultQuery("successor_id", "0"), 10, 32)
+	if err != nil {
+		abortWithError(c, services.InvalidParam("successor_id"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+	impact, err := h.userService.PlanUserDeletion(c.Request.Context(), uint(id), c.DefaultQuery("policy", services.DeletionPolicyRestrict), uint(successorId))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"impact": impact})
 }
 
 func (h *UserHandler) AddRoleToUser(c *gin.Context) {
 	userId, err := strconv.ParseUint(c.Param("userId"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		abortWithError(c, services.InvalidParam("userId"))
 		return
 	}
 
 	roleId, err := strconv.ParseUint(c.Param("roleId"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID format"})
+		abortWithError(c, services.InvalidParam("roleId"))
 		return
 	}
 
-	err = h.userService.AssignRoleToUser(uint(userId), uint(roleId))
+	err = h.userService.AssignRoleToUser(c.Request.Context(), uint(userId), uint(roleId))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
@@ -180,21 +316,144 @@ func (h *UserHandler) AddRoleToUser(c *gin.Context) {
 func (h *UserHandler) RemoveRoleFromUser(c *gin.Context) {
 	userId, err := strconv.ParseUint(c.Param("userId"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		abortWithError(c, services.InvalidParam("userId"))
 		return
 	}
 
 	roleId, err := strconv.ParseUint(c.Param("roleId"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID format"})
+		abortWithError(c, services.InvalidParam("roleId"))
 		return
 	}
 
-	err = h.userService.UnassignRoleToUser(uint(userId), uint(roleId))
+	err = h.userService.UnassignRoleToUser(c.Request.Context(), uint(userId), uint(roleId))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Role unassigned from user successfully"})
-}
\ No newline at end of file
+}
+
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		abortWithError(c, errTokenRequired)
+		return
+	}
+
+	user, err := h.verificationService.VerifyEmail(c.Request.Context(), token)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully", "user": user})
+}
+
+func (h *UserHandler) ResendVerification(c *gin.Context) {
+	err := h.verificationService.ResendVerification(c.Request.Context(), currentClaims(c).UserID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+func (h *UserHandler) SetEmailVerification(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		abortWithError(c, services.InvalidParam("userId"))
+		return
+	}
+
+	var verificationDto dto.VerificationDto
+	if !bindJSON(c, &verificationDto) {
+		return
+	}
+
+	user, err := h.verificationService.SetEmailVerified(c.Request.Context(), uint(id), *verificationDto.Verified)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UnlockUser levanta el bloqueo por intentos fallidos de login y de 2FA de la cuenta
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		abortWithError(c, services.InvalidParam("userId"))
+		return
+	}
+
+	user, err := h.userService.GetUserById(c.Request.Context(), uint(id))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := h.loginGuard.Unlock(c.Request.Context(), services.AccountKey(user.Email), services.MFAKey(user.ID)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	services.LogSecurityEvent("account_unlocked", "user_id", user.ID, "by", currentClaims(c).UserID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
+
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	var changeDto dto.ChangePasswordDto
+	if !bindJSON(c, &changeDto) {
+		return
+	}
+
+	user, err := h.userService.ChangePassword(c.Request.Context(), currentClaims(c).UserID, changeDto.CurrentPassword, changeDto.NewPassword)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			abortWithError(c, errWrongCurrentPassword)
+			return
+		}
+		abortWithError(c, err)
+		return
+	}
+	services.LogSecurityEvent("password_changed", "user_id", user.ID, "ip", c.ClientIP())
+
+	// Las sesiones anteriores quedaron invalidadas, así que se entregan tokens nuevos
+	tokens, err := h.tokenService.GenerateTokenPair(c.Request.Context(), user)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Password changed",
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+	})
+}
+
+// ExpirePassword obliga al usuario a cambiar la contraseña en el próximo login
+func (h *UserHandler) ExpirePassword(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		abortWithError(c, services.InvalidParam("userId"))
+		return
+	}
+
+	if err := h.userService.ExpirePassword(c.Request.Context(), uint(id)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	services.LogSecurityEvent("password_expired", "user_id", id, "by", currentClaims(c).UserID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User must change the password at the next login"})
+}
+
+// PasswordPolicy publica las reglas vigentes para que los clientes las muestren
+func (h *UserHandler) PasswordPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, services.CurrentPasswordPolicy())
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/middlewares"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+type userTestEnv struct {
+	store  *repositories.MemoryStore
+	router *gin.Engine
+	roles  map[string]models.Role
+	admin  models.User
+	user   models.User
+	tokens map[uint]string
+}
+
+func newUserTestEnv(t *testing.T) *userTestEnv {
+	t.Helper()
+	t.Setenv("SIGNING_KEY_ENCRYPTION_KEY", testEncryptionKey)
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	store := repositories.NewMemoryStore()
+	roles := map[string]models.Role{}
+	for _, name := range []string{"Administrador", "Usuario"} {
+		role := models.Role{Name: name}
+		if err := store.Roles().Create(ctx, &role); err != nil {
+			t.Fatalf("creating role %s: %v", name, err)
+		}
+		roles[name] = role
+	}
+	if err := services.LoadSigningKeys(ctx, store); err != nil {
+		t.Fatalf("loading signing keys: %v", err)
+	}
+
+	policyVersion := services.CurrentPasswordPolicy().Version
+	admin := models.User{Username: "admin", Email: "admin@example.com", Password: "$2a$10$admin-bcrypt-hash", EmailVerified: true,
+		AuthProvider: models.AuthProviderLocal, PasswordPolicyVersion: policyVersion, Roles: []models.Role{roles["Administrador"], roles["Usuario"]}}
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "$2a$10$alice-bcrypt-hash", EmailVerified: true,
+		AuthProvider: models.AuthProviderLocal, PasswordPolicyVersion: policyVersion, Roles: []models.Role{roles["Usuario"]}}
+	tokenService := services.NewTokenService(store)
+	tokens := map[uint]string{}
+	for _, u := range []*models.User{&admin, &user} {
+		if err := store.Users().Create(ctx, u); err != nil {
+			t.Fatalf("creating user %s: %v", u.Username, err)
+		}
+		pair, err := tokenService.GenerateTokenPair(ctx, u)
+		if err != nil {
+			t.Fatalf("GenerateTokenPair: %v", err)
+		}
+		tokens[u.ID] = pair.AccessToken
+	}
+
+	userService := services.NewUserService(store, services.NewVerificationService(store, &services.LogMailer{}))
+	authenticator := middlewares.NewAuthenticator(tokenService, services.NewPersonalAccessTokenService(store), services.NewImpersonationService(store))
+	handler := NewUserHandler(userService, services.NewVerificationService(store, &services.LogMailer{}), tokenService, nil)
+	router := gin.New()
+	router.Use(middlewares.ErrorHandler(), middlewares.Language())
+	router.PATCH("/api/users/:userId", authenticator.Require("Usuario"), handler.PatchUser)
+
+	return &userTestEnv{store: store, router: router, roles: roles, admin: admin, user: user, tokens: tokens}
+}
+
+// patch manda un PATCH sobre target autenticado como caller
+func (e *userTestEnv) patch(caller models.User, target models.User, contentType string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPatch, "/api/users/"+strconv.Itoa(int(target.ID)), strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+e.tokens[caller.ID])
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("If-Match", "*")
+	recorder := httptest.NewRecorder()
+	e.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (e *userTestEnv) roleIDs(t *testing.T, user models.User) []uint {
+	t.Helper()
+	stored, err := e.store.Users().FindByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	ids := []uint{}
+	for _, role := range stored.Roles {
+		ids = append(ids, role.ID)
+	}
+	return ids
+}
+
+func decodeTestUser(t *testing.T, recorder *httptest.ResponseRecorder) models.User {
+	t.Helper()
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	var user models.User
+	if err := json.Unmarshal(recorder.Body.Bytes(), &user); err != nil {
+		t.Fatalf("decoding user: %v", err)
+	}
+	return user
+}
+
+func TestPatchUserMergePatch(t *testing.T) {
+	env := newUserTestEnv(t)
+
+	// Lo que el patch no menciona se conserva
+	user := decodeTestUser(t, env.patch(env.user, env.user, mergePatchContentType, `{"username":"alice2"}`))
+	if user.Username != "alice2" || user.Email != "alice@example.com" {
+		t.Fatalf("expected only the username to change, got %+v", user)
+	}
+
+	user = decodeTestUser(t, env.patch(env.user, env.user, mergePatchContentType, `{"locale":"es"}`))
+	if user.Locale != "es" {
+		t.Fatalf("expected locale es, got %q", user.Locale)
+	}
+	// null borra el campo en un merge patch
+	user = decodeTestUser(t, env.patch(env.user, env.user, mergePatchContentType, `{"locale":null}`))
+	if user.Locale != "" {
+		t.Fatalf("expected the locale to be cleared, got %q", user.Locale)
+	}
+
+	recorder := env.patch(env.user, env.user, mergePatchContentType, `{"nickname":"al"}`)
+	if recorder.Code != http.StatusBadRequest || decodeProblemCode(t, recorder) != "INVALID_REQUEST" {
+		t.Fatalf("expected INVALID_REQUEST for an unknown field, got %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestPatchUserJSONPatch(t *testing.T) {
+	env := newUserTestEnv(t)
+
+	user := decodeTestUser(t, env.patch(env.user, env.user, jsonPatchContentType,
+		`[{"op":"test","path":"/username","value":"alice"},{"op":"replace","path":"/username","value":"alice2"}]`))
+	if user.Username != "alice2" || user.Email != "alice@example.com" {
+		t.Fatalf("expected only the username to change, got %+v", user)
+	}
+
+	// El test ya no coincide: nada se aplica
+	recorder := env.patch(env.user, env.user, jsonPatchContentType,
+		`[{"op":"test","path":"/username","value":"alice"},{"op":"replace","path":"/email","value":"new@example.com"}]`)
+	if recorder.Code != http.StatusConflict || decodeProblemCode(t, recorder) != "PATCH_TEST_FAILED" {
+		t.Fatalf("expected PATCH_TEST_FAILED, got %d: %s", recorder.Code, recorder.Body)
+	}
+	if stored, err := env.store.Users().FindByID(context.Background(), env.user.ID); err != nil || stored.Email != "alice@example.com" {
+		t.Fatalf("the email must not change, got %+v (%v)", stored, err)
+	}
+
+	recorder = env.patch(env.user, env.user, jsonPatchContentType, `{"username":"alice3"}`)
+	if recorder.Code != http.StatusBadRequest || decodeProblemCode(t, recorder) != "INVALID_PATCH" {
+		t.Fatalf("expected INVALID_PATCH for a merge patch body, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = env.patch(env.user, env.user, jsonPatchContentType, `[{"op":"remove","path":"/nickname"}]`)
+	if recorder.Code != http.StatusUnprocessableEntity || decodeProblemCode(t, recorder) != "PATCH_NOT_APPLIED" {
+		t.Fatalf("expected PATCH_NOT_APPLIED, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = env.patch(env.user, env.user, "application/json", `{"username":"alice3"}`)
+	if recorder.Code != http.StatusUnsupportedMediaType || decodeProblemCode(t, recorder) != "UNSUPPORTED_PATCH_FORMAT" {
+		t.Fatalf("expected UNSUPPORTED_PATCH_FORMAT, got %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestPatchUserRoleIdsRequireAdmin(t *testing.T) {
+	env := newUserTestEnv(t)
+	adminRole, userRole := env.roles["Administrador"].ID, env.roles["Usuario"].ID
+
+	// Un usuario común no puede darse roles: role_ids se ignora y el resto se aplica
+	body := `{"username":"alice2","role_ids":[` + strconv.Itoa(int(adminRole)) + `]}`
+	user := decodeTestUser(t, env.patch(env.user, env.user, mergePatchContentType, body))
+	if user.Username != "alice2" {
+		t.Fatalf("expected the username to change, got %+v", user)
+	}
+	if ids := env.roleIDs(t, env.user); len(ids) != 1 || ids[0] != userRole {
+		t.Fatalf("a non-admin must not change roles, got %v", ids)
+	}
+
+	// Tampoco con JSON Patch
+	body = `[{"op":"add","path":"/role_ids/-","value":` + strconv.Itoa(int(adminRole)) + `}]`
+	decodeTestUser(t, env.patch(env.user, env.user, jsonPatchContentType, body))
+	if ids := env.roleIDs(t, env.user); len(ids) != 1 || ids[0] != userRole {
+		t.Fatalf("a non-admin must not change roles, got %v", ids)
+	}
+
+	// Un administrador sí
+	decodeTestUser(t, env.patch(env.admin, env.user, jsonPatchContentType, body))
+	if ids := env.roleIDs(t, env.user); len(ids) != 2 {
+		t.Fatalf("expected the admin to add the role, got %v", ids)
+	}
+}
+
+func TestUserLocaleOverridesAcceptLanguage(t *testing.T) {
+	env := newUserTestEnv(t)
+	request := func(caller models.User) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPatch, "/api/users/999", strings.NewReader(`{}`))
+		request.Header.Set("Authorization", "Bearer "+env.tokens[caller.ID])
+		request.Header.Set("Content-Type", mergePatchContentType)
+		request.Header.Set("If-Match", "*")
+		request.Header.Set("Accept-Language", "en-US, es;q=0.5")
+		recorder := httptest.NewRecorder()
+		env.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	detail := func(recorder *httptest.ResponseRecorder) string {
+		var problem struct {
+			Detail string `json:"detail"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("decoding problem: %v", err)
+		}
+		return problem.Detail
+	}
+
+	// Sin idioma preferido manda Accept-Language
+	recorder := request(env.user)
+	if recorder.Code != http.StatusNotFound || recorder.Header().Get("Content-Language") != "en" || detail(recorder) != "user not found" {
+		t.Fatalf("expected the english message, got %s %s", recorder.Header().Get("Content-Language"), recorder.Body)
+	}
+
+	// El idioma del usuario se lee en cada request, sin esperar un token nuevo
+	decodeTestUser(t, env.patch(env.user, env.user, mergePatchContentType, `{"locale":"es"}`))
+	recorder = request(env.user)
+	if recorder.Header().Get("Content-Language") != "es" || detail(recorder) != "no se encontró el usuario" {
+		t.Fatalf("expected the user's locale to win, got %s %s", recorder.Header().Get("Content-Language"), recorder.Body)
+	}
+
+	// Solo afecta a ese usuario
+	if recorder = request(env.admin); detail(recorder) != "user not found" {
+		t.Fatalf("expected the english message for another user, got %s", recorder.Body)
+	}
+}
@@ -0,0 +1,98 @@
+// Package i18n traduce los mensajes que la API muestra a los clientes. Los
+// textos en inglés están en el código; los catálogos de locales/ tienen las
+// traducciones a los demás idiomas, indexadas por el código del error.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default es el idioma de los mensajes del código y el que se usa cuando el
+// cliente no pide ninguno que esté traducido
+const Default = "en"
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// catalogs tiene un catálogo por idioma, con el nombre del archivo sin extensión
+var catalogs = map[string]map[string]string{}
+
+func init() {
+	files, err := fs.Glob(locales, "locales/*.json")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		content, err := locales.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		catalog := map[string]string{}
+		if err := json.Unmarshal(content, &catalog); err != nil {
+			panic("i18n: invalid catalog " + file + ": " + err.Error())
+		}
+		catalogs[strings.TrimSuffix(path.Base(file), ".json")] = catalog
+	}
+}
+
+// Supported devuelve los idiomas disponibles, empezando por Default
+func Supported() []string {
+	languages := make([]string, 0, len(catalogs))
+	for language := range catalogs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return append([]string{Default}, languages...)
+}
+
+// Normalize reduce una etiqueta como "es-AR" a su idioma ("es") e indica si está disponible
+func Normalize(tag string) (string, bool) {
+	language, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	language, _, _ = strings.Cut(language, "_")
+	if language == Default {
+		return language, true
+	}
+	_, ok := catalogs[language]
+	return language, ok
+}
+
+// Negotiate elige el idioma disponible con mayor preferencia en un header
+// Accept-Language; si no hay ninguno devuelve Default
+func Negotiate(acceptLanguage string) string {
+	best, bestWeight := Default, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		weight := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		// Ante el mismo peso gana el que aparece primero
+		if language, ok := Normalize(tag); ok && weight > bestWeight {
+			best, bestWeight = language, weight
+		}
+	}
+	return best
+}
+
+// Message devuelve la traducción de key en language con los {parámetros}
+// reemplazados; ok es false si el idioma no tiene esa clave
+func Message(language string, key string, params map[string]string) (string, bool) {
+	message, ok := catalogs[language][key]
+	if !ok {
+		return "", false
+	}
+	for name, value := range params {
+		message = strings.ReplaceAll(message, "{"+name+"}", value)
+	}
+	return message, true
+}
@@ -0,0 +1,42 @@
+package i18n
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	cases := []struct {
+		header   string
+		expected string
+	}{
+		{"", Default},
+		{"es", "es"},
+		{"es-AR,es;q=0.9", "es"},
+		// Gana el de mayor q aunque aparezca después
+		{"en;q=0.5, es;q=0.8", "es"},
+		{"es;q=0.3, en", "en"},
+		// Ante el mismo peso gana el primero
+		{"es, en", "es"},
+		{"en, es", "en"},
+		// Los idiomas sin traducción se saltean
+		{"fr, de;q=0.9, es;q=0.1", "es"},
+		{"fr, de", Default},
+		{"es;q=abc, fr", Default},
+		{"es;q=0", Default},
+	}
+	for _, c := range cases {
+		if language := Negotiate(c.header); language != c.expected {
+			t.Errorf("Negotiate(%q) = %q, expected %q", c.header, language, c.expected)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	if message, ok := Message("es", "USER_NOT_FOUND", nil); !ok || message != "no se encontró el usuario" {
+		t.Fatalf("unexpected translation %q (%v)", message, ok)
+	}
+	if _, ok := Message("fr", "USER_NOT_FOUND", nil); ok {
+		t.Fatal("expected no translation for a missing language")
+	}
+	if _, ok := Message("es", "NOT_A_CODE", nil); ok {
+		t.Fatal("expected no translation for a missing key")
+	}
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lucapierini/project-go-task_manager/config"
 	"github.com/lucapierini/project-go-task_manager/dto"
 	"github.com/lucapierini/project-go-task_manager/handlers"
 	"github.com/lucapierini/project-go-task_manager/middlewares"
+	"github.com/lucapierini/project-go-task_manager/migrations"
+	"github.com/lucapierini/project-go-task_manager/repositories"
 	"github.com/lucapierini/project-go-task_manager/services"
 	// "gorm.io/gorm"
 )
@@ -18,22 +22,82 @@ var (
 	roleHandler *handlers.RoleHandler
 	projectHandler *handlers.ProjectHandler
 	taskHandler *handlers.TaskHandler
+	trashHandler *handlers.TrashHandler
+	invitationHandler *handlers.InvitationHandler
+	passwordResetHandler *handlers.PasswordResetHandler
+	mfaHandler *handlers.MFAHandler
+	accessTokenHandler *handlers.PersonalAccessTokenHandler
+	oidcHandler *handlers.OIDCHandler
+	impersonationHandler *handlers.ImpersonationHandler
+	ldapProvider *services.LDAPAuthProvider
+	trashService *services.TrashService
+	verificationService *services.VerificationService
+	rateLimiter *middlewares.RateLimiter
+	authenticator *middlewares.Authenticator
+	ownerChecker *middlewares.OwnerChecker
+	transactional gin.HandlerFunc
+	idempotent gin.HandlerFunc
+	userService *services.UserService
+	tokenService *services.TokenService
 )
 
-func init() {
+// setup conecta la base y arma servicios y handlers. No corre para el
+// subcomando migrate, que solo necesita la conexión.
+func setup() {
 	config.LoadEnvVariables()
 	config.ConnectDB()
-	config.SyncDB()
+	config.ConnectRedis()
 
-	userService := services.NewUserService()
-	roleService := services.NewRoleService()
-	projectService := services.NewProjectService()
-	taskService := services.NewTaskService()
+	// Con DB_AUTO_MIGRATE=false la API no arranca si hay migraciones pendientes
+	if err := migrations.Startup(config.DB, config.GetEnvBool("DB_AUTO_MIGRATE", true)); err != nil {
+		log.Fatalf("Database schema check failed: %v", err)
+	}
+
+	store := repositories.NewGormStore(config.DB)
+
+	if err := services.LoadSigningKeys(context.Background(), store); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
+	// Proveedores de login en orden: contraseña local y, si está configurado, LDAP
+	authProviders := []services.AuthProvider{services.NewLocalAuthProvider(store.Users())}
+	if ldapProvider = services.NewLDAPAuthProviderFromEnv(store); ldapProvider != nil {
+		authProviders = append(authProviders, ldapProvider)
+	}
 
-	userHandler = handlers.NewUserHandler(userService)
+	roleService := services.NewRoleService(store)
+	projectService := services.NewProjectService(store)
+	taskService := services.NewTaskService(store)
+	trashService = services.NewTrashService(store)
+	tokenService = services.NewTokenService(store)
+	settingService := services.NewSettingService(store)
+
+	mailer := services.NewMailerFromEnv()
+	verificationService = services.NewVerificationService(store, mailer)
+	userService = services.NewUserService(store, verificationService, authProviders...)
+
+	loginGuard := services.NewLoginGuard(services.NewLoginAttemptStoreFromEnv())
+	rateLimiter = middlewares.NewRateLimiter(services.NewRateLimitStoreFromEnv())
+	ownerChecker = middlewares.NewOwnerChecker(store)
+	accessTokenService := services.NewPersonalAccessTokenService(store)
+	impersonationService := services.NewImpersonationService(store)
+	authenticator = middlewares.NewAuthenticator(tokenService, accessTokenService, impersonationService)
+	transactional = middlewares.Transactional(store)
+	idempotent = middlewares.Idempotency(services.NewIdempotencyStoreFromEnv(), config.GetEnvDuration("IDEMPOTENCY_RETENTION", 24*time.Hour))
+
+	userHandler = handlers.NewUserHandler(userService, verificationService, tokenService, loginGuard)
 	roleHandler = handlers.NewRoleHandler(roleService)
 	projectHandler = handlers.NewProjectHandler(projectService)
 	taskHandler = handlers.NewTaskHandler(taskService)
+	trashHandler = handlers.NewTrashHandler(trashService)
+	mfaHandler = handlers.NewMFAHandler(services.NewMFAService(store), settingService, tokenService, loginGuard)
+	accessTokenHandler = handlers.NewPersonalAccessTokenHandler(accessTokenService)
+	oidcHandler = handlers.NewOIDCHandler(services.NewOIDCServiceFromEnv(store), tokenService)
+	impersonationHandler = handlers.NewImpersonationHandler(impersonationService)
+	passwordResetService := services.NewPasswordResetService(store, mailer)
+	resetQueue := services.NewPasswordResetQueue(passwordResetService, config.GetEnvInt("PASSWORD_RESET_WORKERS", 2), 100, 30*time.Second)
+	passwordResetHandler = handlers.NewPasswordResetHandler(passwordResetService, resetQueue)
+	invitationHandler = handlers.NewInvitationHandler(services.NewInvitationService(store, mailer, userService, projectService), tokenService)
 
 	initializeDefaultData(roleService, userService)
 	// DatabaseMiddleware(config.DB)
@@ -47,30 +111,81 @@ func init() {
 // }
 
 func initializeDefaultData(roleService *services.RoleService, userService *services.UserService) {
+	ctx := context.Background()
 	roles := []string{"Administrador", "Usuario"}
 	for _, role := range roles {
-		if _, err := roleService.CreateRole(dto.RoleDto{Name: role}); err != nil {
+		if _, err := roleService.CreateRole(ctx, dto.RoleDto{Name: role}); err != nil {
 			log.Printf("Error creating role %s: %v\n", role, err)
 		}
 	}
 
+	// El administrador se crea solo en el primer arranque, con una contraseña
+	// aleatoria que se muestra esta única vez y hay que cambiar al entrar
+	adminEmail := "admin@admin.com"
+	if _, err := userService.GetUserByEmail(ctx, adminEmail); err == nil {
+		return
+	}
+
+	password, err := services.GenerateRandomPassword()
+	if err != nil {
+		log.Printf("Error generating admin password: %v\n", err)
+		return
+	}
 	adminUser := dto.UserDto{
 		Username: "admin",
-		Password: "admin",
+		Password: password,
 		RoleIds:  []uint{1, 2},
-		Email:    "admin@admin.com",
+		Email:    adminEmail,
 	}
-	if _, err := userService.RegisterUser(adminUser); err != nil {
+	admin, err := userService.RegisterUser(ctx, adminUser)
+	if err != nil {
 		log.Printf("Error creating admin user: %v\n", err)
+		return
 	}
+	if _, err := verificationService.SetEmailVerified(ctx, admin.ID, true); err != nil {
+		log.Printf("Error verifying admin email: %v\n", err)
+	}
+	if err := userService.ExpirePassword(ctx, admin.ID); err != nil {
+		log.Printf("Error expiring admin password: %v\n", err)
+	}
+
+	log.Printf("Created admin user %s with password: %s\n", adminEmail, password)
+	log.Println("This password is shown only once and must be changed at the first login")
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
+	setup()
+
 	router := gin.Default()
+	// Solo se cree en X-Forwarded-For si el pedido llega desde un proxy conocido;
+	// sin TRUSTED_PROXIES se usa la IP de la conexión, que el cliente no puede falsear
+	if err := router.SetTrustedProxies(config.GetEnvList("TRUSTED_PROXIES")); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 	router.Use(middlewares.CORSMiddleware())
+	// Todos los errores se responden como application/problem+json
+	router.Use(middlewares.ErrorHandler())
+	// Los mensajes de error salen en el idioma del usuario o de Accept-Language
+	router.Use(middlewares.Language())
+	router.NoRoute(handlers.RouteNotFound)
 
 	setupRoutes(router)
 
+	// Purga de la papelera: lo que lleva más de TRASH_RETENTION_DAYS días se borra definitivamente
+	retention := time.Duration(config.GetEnvInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour
+	go services.StartTrashRetentionJob(trashService, retention, config.GetEnvDuration("TRASH_PURGE_INTERVAL", time.Hour))
+
+	// Rotación de la clave de firma de los JWT
+	go services.StartSigningKeyRotationJob(config.GetEnvDuration("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour))
+
+	if ldapProvider != nil {
+		go services.StartLDAPGroupSyncJob(ldapProvider, config.GetEnvDuration("LDAP_SYNC_INTERVAL", time.Hour))
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -83,104 +198,232 @@ func main() {
 }
 
 func setupRoutes(router *gin.Engine) {
+	// Rate limits ("cantidad/ventana"): por IP para todo, más estricto para los
+	// endpoints de autenticación, por usuario o token en las rutas autenticadas
+	// y aparte para los listados completos, que son las consultas más pesadas
+	ipLimit := services.RateLimitFromEnv("RATE_LIMIT_IP", services.RateLimit{Requests: 300, Window: time.Minute})
+	authLimit := services.RateLimitFromEnv("RATE_LIMIT_AUTH", services.RateLimit{Requests: 20, Window: time.Minute})
+	userLimit := services.RateLimitFromEnv("RATE_LIMIT_USER", services.RateLimit{Requests: 120, Window: time.Minute})
+	listLimit := services.RateLimitFromEnv("RATE_LIMIT_LIST", services.RateLimit{Requests: 10, Window: time.Minute})
+	router.Use(rateLimiter.Limit("ip", ipLimit))
+
+	// Claves públicas para verificar los JWT
+	router.GET("/.well-known/jwks.json", handlers.JWKSHandler)
+
 	api := router.Group("/api")
 	{
 		// Public routes
+		// Sin idempotent: las respuestas llevan tokens y no se deben guardar
+		// para repetirlas, ni siquiera después de un logout o un cambio de contraseña
 		auth := api.Group("/auth")
+		auth.Use(rateLimiter.Limit("auth", authLimit))
 		{
 			auth.POST("/register", userHandler.Register)
 			auth.POST("/login", userHandler.Login)
-			auth.POST("/refresh", handlers.RefreshTokenHandler)
+			auth.POST("/refresh", handlers.RefreshTokenHandler(userService, tokenService))
+			auth.GET("/verify-email", userHandler.VerifyEmail)
+			auth.POST("/resend-verification", authenticator.Require("Usuario"), userHandler.ResendVerification)
+			auth.POST("/forgot-password", passwordResetHandler.ForgotPassword)
+			auth.POST("/reset-password", passwordResetHandler.ResetPassword)
+			auth.GET("/password-policy", userHandler.PasswordPolicy)
+			auth.POST("/change-password", authenticator.Require("Usuario"), middlewares.DenyImpersonation(), userHandler.ChangePassword)
+			auth.POST("/impersonation/end", authenticator.Require("Usuario"), impersonationHandler.EndOwnImpersonation)
+
+			// Single sign-on con el proveedor OIDC
+			auth.GET("/oidc/login", oidcHandler.Login)
+			auth.GET("/oidc/callback", oidcHandler.Callback)
+
+			// Autenticación en dos pasos
+			auth.POST("/2fa/verify", mfaHandler.Verify)
+			mfa := auth.Group("/2fa")
+			mfa.Use(authenticator.Require("Usuario"), rateLimiter.Limit("user", userLimit), middlewares.DenyImpersonation())
+			{
+				mfa.POST("/enroll", mfaHandler.Enroll)
+				mfa.POST("/confirm", mfaHandler.Confirm)
+				mfa.POST("/disable", mfaHandler.Disable)
+				mfa.POST("/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+			}
 		}
 
+		// Aceptar una invitación (crea la cuenta si hace falta); sin idempotent
+		// porque la respuesta puede llevar tokens
+		api.POST("/invitations/accept", invitationHandler.AcceptInvitation)
+
 		// Protected routes
 		admin := api.Group("/admin")
-		admin.Use(middlewares.AuthMiddleware("Administrador"))
+		admin.Use(authenticator.Require("Administrador"), rateLimiter.Limit("user", userLimit))
+		// La suplantación devuelve un token, queda fuera de idempotent
+		admin.POST("/users/:userId/impersonate", impersonationHandler.Impersonate)
+		admin.Use(idempotent)
 		{
 			// Roles management
 			roles := admin.Group("/roles")
+			roles.Use(transactional)
 			{
 				roles.POST("/", roleHandler.CreateRole)
-				roles.GET("/", roleHandler.ListRoles)
+				roles.GET("/", rateLimiter.Limit("list", listLimit), roleHandler.ListRoles)
 				roles.GET("/:roleId", roleHandler.GetRole)
 				roles.PUT("/:roleId", roleHandler.UpdateRole)
+				roles.PATCH("/:roleId", roleHandler.PatchRole)
 				roles.DELETE("/:roleId", roleHandler.DeleteRole)
 			}
 
 			// User management (admin only)
 			users := admin.Group("/users")
 			{
-				users.GET("/", userHandler.ListUsers)
+				users.GET("/", rateLimiter.Limit("list", listLimit), userHandler.ListUsers)
 				users.GET("/:userId", userHandler.GetUser)
-				users.PUT("/:userId", userHandler.UpdateUser)
-				users.DELETE("/:userId", userHandler.DeleteUser)
-				users.POST("/:userId/:roleId", userHandler.AddRoleToUser)
-				users.DELETE("/:userId/:roleId", userHandler.RemoveRoleFromUser)
+				users.PUT("/:userId", transactional, userHandler.UpdateUser)
+				users.PATCH("/:userId", transactional, userHandler.PatchUser)
+				users.DELETE("/:userId", transactional, userHandler.DeleteUser)
+				users.GET("/:userId/deletion-impact", userHandler.UserDeletionImpact)
+				users.PUT("/:userId/verification", userHandler.SetEmailVerification)
+				users.DELETE("/:userId/2fa", mfaHandler.ResetUserMFA)
+				users.POST("/:userId/unlock", userHandler.UnlockUser)
+				users.POST("/:userId/expire-password", transactional, userHandler.ExpirePassword)
+				users.POST("/:userId/:roleId", transactional, userHandler.AddRoleToUser)
+				users.DELETE("/:userId/:roleId", transactional, userHandler.RemoveRoleFromUser)
 			}
 
 			// Project management
 			projects := admin.Group("/projects")
 			{
-				projects.GET("/", projectHandler.ListProjects)
+				projects.Use(transactional)
+				projects.POST("/:projectId/invitations", invitationHandler.CreateInvitation)
+				projects.GET("/:projectId/invitations", invitationHandler.ListInvitations)
+				projects.DELETE("/:projectId/invitations/:invitationId", invitationHandler.RevokeInvitation)
+				projects.GET("/", rateLimiter.Limit("list", listLimit), projectHandler.ListProjects)
 				projects.POST("/", projectHandler.CreateProject)
 				projects.GET("/:projectId", projectHandler.GetProjectById)
 				projects.PUT("/:projectId", projectHandler.UpdateProject)
+				projects.PATCH("/:projectId", projectHandler.PatchProject)
 				projects.DELETE("/:projectId", projectHandler.DeleteProject)
+				projects.GET("/:projectId/deletion-impact", projectHandler.ProjectDeletionImpact)
 				projects.GET("/user/:userId", projectHandler.ListProjectsByUserId)	
 				projects.POST("/:projectId/user/:userId", projectHandler.AddUserToProject)
 				projects.DELETE("/:projectId/user/:userId", projectHandler.RemoveUserFromProject)
 				projects.POST("/:projectId/task/:taskId", projectHandler.AddTaskToProject)
 				projects.DELETE("/:projectId/task/:taskId", projectHandler.RemoveTaskFromProject)
+				projects.POST("/:projectId/co-owner/:userId", projectHandler.AddCoOwnerToProject)
+				projects.DELETE("/:projectId/co-owner/:userId", projectHandler.RemoveCoOwnerFromProject)
 			}
 
 			tasks := admin.Group("/tasks")
+			tasks.Use(transactional)
 			{
-				tasks.GET("/", taskHandler.ListTasks)
+				tasks.GET("/", rateLimiter.Limit("list", listLimit), taskHandler.ListTasks)
 				tasks.POST("/", taskHandler.CreateTask)
 				tasks.GET("/:taskId", taskHandler.GetTaskById)
 				tasks.PUT("/:taskId", taskHandler.UpdateTask)
+				tasks.PATCH("/:taskId", taskHandler.PatchTask)
 				tasks.DELETE("/:taskId", taskHandler.DeleteTask)
 			}
+
+			// Auditoría de suplantaciones
+			impersonations := admin.Group("/impersonations")
+			{
+				impersonations.GET("/", impersonationHandler.ListImpersonations)
+				impersonations.GET("/:impersonationId", impersonationHandler.GetImpersonation)
+				impersonations.DELETE("/:impersonationId", impersonationHandler.EndImpersonation)
+			}
+
+			// Opciones de seguridad
+			admin.GET("/security", mfaHandler.GetSecuritySettings)
+			admin.PUT("/security", mfaHandler.UpdateSecuritySettings)
+			admin.POST("/security/keys/rotate", handlers.RotateSigningKeyHandler)
+
+			// Papelera: elementos borrados de cualquier tipo
+			trash := admin.Group("/trash")
+			{
+				trash.GET("/:resource", trashHandler.ListTrash)
+				trash.POST("/:resource/:resourceId/restore", trashHandler.RestoreFromTrash)
+				trash.DELETE("/:resource/:resourceId", trashHandler.PurgeFromTrash)
+			}
 		}
 
-		// Routes accessible by both Admin and Reader
+		// Routes accessible by both Admin and Reader. Sin idempotent: solo aplica a
+		// POST y acá no hay ninguno; PUT, PATCH y DELETE ya se pueden repetir
 		users := api.Group("/users")
-		users.Use(middlewares.AuthMiddleware("Usuario"), middlewares.IsOwner("user"))
+		users.Use(middlewares.TokenScope("users"), authenticator.Require("Usuario"), rateLimiter.Limit("user", userLimit), ownerChecker.IsOwner("user"), transactional)
 		{
 			users.GET("/:userId" ,userHandler.GetUser)
-			users.PUT("/:userId", userHandler.UpdateUser)
-			users.DELETE("/:userId", userHandler.DeleteUser)
+			users.PUT("/:userId", middlewares.DenyImpersonation(), userHandler.UpdateUser)
+			users.PATCH("/:userId", middlewares.DenyImpersonation(), userHandler.PatchUser)
+			users.DELETE("/:userId", middlewares.DenyImpersonation(), userHandler.DeleteUser)
+			users.GET("/:userId/deletion-impact", userHandler.UserDeletionImpact)
+			// El usuario puede ver cuándo un administrador entró como él
+			users.GET("/:userId/impersonations", impersonationHandler.ListImpersonations)
 		}
 
 		projects := api.Group("/projects")
-		projects.Use(middlewares.AuthMiddleware("Usuario"))
+		projects.Use(middlewares.TokenScope("projects"), authenticator.Require("Usuario"), rateLimiter.Limit("user", userLimit), idempotent)
 		{
-			projects.POST("/", projectHandler.CreateProject)
-			projects.GET("/user/:userId",middlewares.IsOwner("user"), projectHandler.ListProjectsByUserId)
-			projects.Use(middlewares.IsOwner("project"))
+			projects.POST("/", transactional, projectHandler.CreateProject)
+			projects.GET("/user/:userId",ownerChecker.IsOwner("user"), projectHandler.ListProjectsByUserId)
+			projects.Use(ownerChecker.IsOwner("project"))
 			{
+				projects.Use(transactional)
+				projects.POST("/:projectId/invitations", invitationHandler.CreateInvitation)
+				projects.GET("/:projectId/invitations", invitationHandler.ListInvitations)
+				projects.DELETE("/:projectId/invitations/:invitationId", invitationHandler.RevokeInvitation)
 				projects.GET("/:projectId", projectHandler.GetProjectById)
 				projects.PUT("/:projectId", projectHandler.UpdateProject)
+				projects.PATCH("/:projectId", projectHandler.PatchProject)
 				projects.DELETE("/:projectId", projectHandler.DeleteProject)
+				projects.GET("/:projectId/deletion-impact", projectHandler.ProjectDeletionImpact)
 				projects.POST("/:projectId/user/:userId", projectHandler.AddUserToProject)
 				projects.DELETE("/:projectId/user/:userId", projectHandler.RemoveUserFromProject)
 				projects.POST("/:projectId/task/:taskId", projectHandler.AddTaskToProject)
 				projects.DELETE("/:projectId/task/:taskId", projectHandler.RemoveTaskFromProject)
+				projects.POST("/:projectId/co-owner/:userId", projectHandler.AddCoOwnerToProject)
+				projects.DELETE("/:projectId/co-owner/:userId", projectHandler.RemoveCoOwnerFromProject)
+				projects.POST("/:projectId/transfer", middlewares.DenyImpersonation(), projectHandler.ProposeTransfer)
+				projects.DELETE("/:projectId/transfer", middlewares.DenyImpersonation(), projectHandler.CancelTransfer)
 			}
 			
 		}
 
+		// Transferencias de propiedad recibidas por el usuario autenticado
+		transfers := api.Group("/transfers")
+		transfers.Use(middlewares.TokenScope("projects"), authenticator.Require("Usuario"), rateLimiter.Limit("user", userLimit), idempotent, transactional)
+		{
+			transfers.GET("/", projectHandler.ListIncomingTransfers)
+			transfers.POST("/:transferId/accept", middlewares.DenyImpersonation(), projectHandler.AcceptTransfer)
+			transfers.POST("/:transferId/decline", middlewares.DenyImpersonation(), projectHandler.DeclineTransfer)
+		}
+
 		tasks := api.Group("/tasks")
-		tasks.Use(middlewares.AuthMiddleware("Usuario"))
+		tasks.Use(middlewares.TokenScope("tasks"), authenticator.Require("Usuario"), rateLimiter.Limit("user", userLimit), idempotent, transactional)
 		{
 			tasks.POST("/", taskHandler.CreateTask)
-			tasks.Use(middlewares.IsOwner("task"))
+			// Cada operación del lote verifica la propiedad de su tarea
+			tasks.POST("/bulk", taskHandler.BulkTasks)
+			tasks.Use(ownerChecker.IsOwner("task"))
 			{
 				tasks.GET("/:taskId", taskHandler.GetTaskById)
 				tasks.PUT("/:taskId", taskHandler.UpdateTask)
+				tasks.PATCH("/:taskId", taskHandler.PatchTask)
 				tasks.DELETE("/:taskId", taskHandler.DeleteTask)
 			}
 
 		}
+
+		// Tokens de acceso personal; no se pueden gestionar usando otro token personal.
+		// Sin idempotent: la respuesta de POST trae el token en claro y no se debe guardar
+		tokens := api.Group("/tokens")
+		tokens.Use(authenticator.Require("Usuario"), rateLimiter.Limit("user", userLimit), middlewares.DenyImpersonation())
+		{
+			tokens.GET("/", accessTokenHandler.ListTokens)
+			tokens.POST("/", accessTokenHandler.CreateToken)
+			tokens.DELETE("/:tokenId", accessTokenHandler.RevokeToken)
+		}
+
+		// Papelera propia: proyectos y tareas borrados del usuario
+		trash := api.Group("/trash")
+		trash.Use(middlewares.TokenScope("trash"), authenticator.Require("Usuario"), rateLimiter.Limit("user", userLimit), idempotent)
+		{
+			trash.GET("/:resource", trashHandler.ListTrash)
+			trash.POST("/:resource/:resourceId/restore", trashHandler.RestoreFromTrash)
+		}
 	}
 }
\ No newline at end of file
@@ -1,33 +1,111 @@
 package middlewares
 
 import (
-	"net/http"
+	"context"
 	"strings"
 	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/models"
 	"github.com/lucapierini/project-go-task_manager/services"
 )
 
-func AuthMiddleware(requiredRoles ...string) gin.HandlerFunc {
+// Rutas que puede usar un administrador obligado a activar 2FA que todavía no lo hizo
+var mfaEnrollmentRoutes = map[string]bool{
+    "/api/auth/2fa/enroll":  true,
+    "/api/auth/2fa/confirm": true,
+}
+
+// Rutas que puede usar alguien cuya contraseña quedó vencida por un cambio de política
+var passwordChangeRoutes = map[string]bool{
+    "/api/auth/change-password": true,
+}
+
+var (
+    errTokenNotProvided        = services.NewError(services.KindUnauthorized, "TOKEN_NOT_PROVIDED", "token not provided")
+    errInvalidTokenType        = services.NewError(services.KindUnauthorized, "INVALID_TOKEN_TYPE", "invalid token type")
+    errMFAEnrollmentRequired   = services.NewError(services.KindForbidden, "MFA_ENROLLMENT_REQUIRED", "two-factor authentication is required for administrators")
+    errPasswordChangeRequired  = services.NewError(services.KindForbidden, "PASSWORD_CHANGE_REQUIRED", "password must be changed")
+    errEmailNotVerified        = services.NewError(services.KindForbidden, "EMAIL_NOT_VERIFIED", "email not verified")
+    errInsufficientPermissions = services.NewError(services.KindForbidden, "INSUFFICIENT_PERMISSIONS", "insufficient permissions")
+)
+
+// Authenticator arma los middlewares de autenticación con los servicios que validan cada token
+type Authenticator struct {
+    tokens         services.TokenInterface
+    accessTokens   services.PersonalAccessTokenInterface
+    impersonations services.ImpersonationInterface
+}
+
+func NewAuthenticator(tokens services.TokenInterface, accessTokens services.PersonalAccessTokenInterface, impersonations services.ImpersonationInterface) *Authenticator {
+    return &Authenticator{tokens: tokens, accessTokens: accessTokens, impersonations: impersonations}
+}
+
+func (a *Authenticator) Require(requiredRoles ...string) gin.HandlerFunc {
     return func(c *gin.Context) {
+        ctx := c.Request.Context()
         authHeader := c.GetHeader("Authorization")
         if authHeader == "" {
-            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token not provided"})
+            abortWithError(c, errTokenNotProvided)
             return
         }
 
         tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-        claims, err := services.ValidateToken(tokenString)
+
+        // Los tokens de acceso personal se reconocen por el prefijo y se validan contra la base
+        var claims *models.Claims
+        var err error
+        if strings.HasPrefix(tokenString, services.PersonalAccessTokenPrefix) {
+            claims, err = a.accessTokens.Validate(ctx, tokenString)
+        } else {
+            claims, err = services.ValidateToken(tokenString)
+        }
         if err != nil {
             if err == services.ErrExpiredToken {
-                c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token expired", "code": "TOKEN_EXPIRED"})
+                abortWithError(c, services.ErrExpiredToken)
+                return
+            }
+            abortWithError(c, services.ErrInvalidToken.Wrap(err))
+            return
+        }
+
+        if claims.TokenType != "access" && claims.TokenType != "pat" {
+            abortWithError(c, errInvalidTokenType)
+            return
+        }
+
+        // Cada pedido hecho con un token de suplantación queda auditado, también
+        // los que se rechazan acá antes de llegar al handler
+        if claims.Act != nil {
+            defer a.recordImpersonatedRequest(c, ctx, claims)
+        }
+
+        if err := a.tokens.CheckSession(ctx, claims); err != nil {
+            abortWithError(c, services.ErrSessionRevoked.Wrap(err))
+            return
+        }
+
+        if claims.Act != nil {
+            if err := a.impersonations.CheckImpersonation(ctx, claims); err != nil {
+                abortWithError(c, services.ErrImpersonationEnded.Wrap(err))
                 return
             }
-            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+        } else if claims.Locale != "" {
+            // El idioma preferido del usuario pesa más que Accept-Language; al
+            // suplantar se mantiene el del administrador
+            c.Set(languageKey, claims.Locale)
+        }
+
+        if claims.MFAEnrollmentRequired && !mfaEnrollmentRoutes[c.FullPath()] {
+            abortWithError(c, errMFAEnrollmentRequired)
             return
         }
 
-        if claims.TokenType != "access" {
-            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token type"})
+        if claims.PasswordChangeRequired && !passwordChangeRoutes[c.FullPath()] {
+            abortWithError(c, errPasswordChangeRequired)
+            return
+        }
+
+        if !claims.EmailVerified && !unverifiedActionAllowed(c) {
+            abortWithError(c, errEmailNotVerified)
             return
         }
 
@@ -46,11 +124,22 @@ func AuthMiddleware(requiredRoles ...string) gin.HandlerFunc {
             }
 
             if !hasRequiredRole {
-                c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+                abortWithError(c, errInsufficientPermissions)
                 return
             }
         }
+        if claims.TokenType == "pat" && !checkTokenScope(c, claims.Scopes) {
+            return
+        }
+
         c.Set("user", claims)
         c.Next()
     }
+}
+
+// recordImpersonatedRequest escribe el error pendiente para registrar el status
+// definitivo. Se usa el contexto previo a c.Next() porque el de la transacción ya terminó
+func (a *Authenticator) recordImpersonatedRequest(c *gin.Context, ctx context.Context, claims *models.Claims) {
+    renderError(c)
+    a.impersonations.RecordRequest(context.WithoutCancel(ctx), claims, c.Request.Method, c.Request.URL.Path, c.Writer.Status())
 }
\ No newline at end of file
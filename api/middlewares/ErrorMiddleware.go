@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/i18n"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+const problemContentType = "application/problem+json"
+
+// ErrorHandler responde como problem+json (RFC 9457, antes 7807) el error que
+// dejaron los handlers y middlewares con c.Error. Va primero, después de CORS,
+// para cubrir todas las rutas.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		renderError(c)
+	}
+}
+
+// abortWithError corta la cadena y deja err para que lo responda ErrorHandler
+func abortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// renderError escribe el último error del contexto si todavía no se respondió
+// nada. Los middlewares que miran el status después de c.Next (Transactional,
+// Idempotency) lo llaman antes, así ven la respuesta final.
+func renderError(c *gin.Context) {
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+
+	err := services.AsError(c.Errors.Last().Err)
+	status := err.Status()
+	// La causa de los errores internos solo se loguea: puede traer mensajes de la base
+	if status >= http.StatusInternalServerError {
+		log.Printf("Error in %s %s: %v\n", c.Request.Method, c.Request.URL.Path, err)
+	}
+
+	language := c.GetString(languageKey)
+	if language == "" {
+		language = i18n.Default
+	}
+	err = err.Localize(language)
+
+	body := gin.H{
+		"type":     "about:blank",
+		"title":    http.StatusText(status),
+		"status":   status,
+		"detail":   err.Message,
+		"code":     err.Code,
+		"instance": c.Request.URL.Path,
+	}
+	if len(err.Fields) > 0 {
+		body["errors"] = err.Fields
+	}
+	for key, value := range err.Extra {
+		body[key] = value
+	}
+	c.Header("Content-Type", problemContentType)
+	c.Header("Content-Language", language)
+	c.Writer.Header().Add("Vary", "Accept-Language")
+	c.JSON(status, body)
+}
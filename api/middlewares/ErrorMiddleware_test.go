@@ -0,0 +1,172 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"github.com/lucapierini/project-go-task_manager/services"
+	"gorm.io/gorm"
+)
+
+type problem struct {
+	Type     string                `json:"type"`
+	Title    string                `json:"title"`
+	Status   int                   `json:"status"`
+	Detail   string                `json:"detail"`
+	Code     string                `json:"code"`
+	Instance string                `json:"instance"`
+	Errors   []services.FieldError `json:"errors"`
+}
+
+// serveError responde GET /fail dejando err con c.Error, como los handlers
+func serveError(t *testing.T, err error) (*httptest.ResponseRecorder, problem) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorHandler())
+	router.GET("/fail", func(c *gin.Context) {
+		abortWithError(c, err)
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	var body problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid problem body %q: %v", recorder.Body, err)
+	}
+	return recorder, body
+}
+
+func TestErrorHandlerWritesProblemJSON(t *testing.T) {
+	recorder, body := serveError(t, services.ErrTaskNotFound)
+
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/problem+json") {
+		t.Fatalf("expected application/problem+json, got %q", contentType)
+	}
+	if recorder.Code != http.StatusNotFound || body.Status != http.StatusNotFound || body.Title != "Not Found" {
+		t.Fatalf("expected a 404 problem, got %d %+v", recorder.Code, body)
+	}
+	if body.Type != "about:blank" || body.Code != "TASK_NOT_FOUND" || body.Detail != "task not found" || body.Instance != "/fail" {
+		t.Fatalf("unexpected problem %+v", body)
+	}
+	if language := recorder.Header().Get("Content-Language"); language != "en" {
+		t.Fatalf("expected Content-Language en, got %q", language)
+	}
+}
+
+func TestErrorHandlerFieldErrors(t *testing.T) {
+	err := services.ErrInvalidRequest.WithFields(
+		services.FieldError{Field: "email", Code: "email", Message: "must be a valid email address"},
+		services.FieldError{Field: "operations[0].op", Code: "oneof", Param: "create update", Message: "must be one of create update"},
+	)
+	recorder, body := serveError(t, err)
+
+	if recorder.Code != http.StatusBadRequest || body.Code != "INVALID_REQUEST" {
+		t.Fatalf("expected 400 INVALID_REQUEST, got %d %+v", recorder.Code, body)
+	}
+	if len(body.Errors) != 2 || body.Errors[0].Field != "email" || body.Errors[0].Code != "email" ||
+		body.Errors[1].Field != "operations[0].op" || body.Errors[1].Param != "create update" {
+		t.Fatalf("unexpected field errors %+v", body.Errors)
+	}
+	for _, field := range body.Errors {
+		if field.Message == "" {
+			t.Fatalf("expected a message for %s", field.Field)
+		}
+	}
+}
+
+func TestErrorHandlerKindStatus(t *testing.T) {
+	tests := map[services.ErrorKind]int{
+		services.KindValidation:           http.StatusBadRequest,
+		services.KindUnauthorized:         http.StatusUnauthorized,
+		services.KindForbidden:            http.StatusForbidden,
+		services.KindNotFound:             http.StatusNotFound,
+		services.KindConflict:             http.StatusConflict,
+		services.KindGone:                 http.StatusGone,
+		services.KindPreconditionFailed:   http.StatusPreconditionFailed,
+		services.KindUnsupportedMedia:     http.StatusUnsupportedMediaType,
+		services.KindUnprocessable:        http.StatusUnprocessableEntity,
+		services.KindFailedDependency:     http.StatusFailedDependency,
+		services.KindPreconditionRequired: http.StatusPreconditionRequired,
+		services.KindTooManyRequests:      http.StatusTooManyRequests,
+		services.KindBadGateway:           http.StatusBadGateway,
+		services.KindInternal:             http.StatusInternalServerError,
+		services.ErrorKind("unknown"):     http.StatusInternalServerError,
+	}
+
+	for kind, status := range tests {
+		t.Run(string(kind), func(t *testing.T) {
+			recorder, body := serveError(t, services.NewError(kind, "TEST_ERROR", "test error"))
+			if recorder.Code != status || body.Status != status || body.Code != "TEST_ERROR" {
+				t.Fatalf("expected %d, got %d %+v", status, recorder.Code, body)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerHidesDatabaseMessages(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{
+			name:   "duplicated key",
+			err:    fmt.Errorf("UNIQUE constraint failed: users.email: %w", gorm.ErrDuplicatedKey),
+			status: http.StatusConflict,
+			code:   "RESOURCE_ALREADY_EXISTS",
+		},
+		{
+			name:   "foreign key",
+			err:    fmt.Errorf("FOREIGN KEY constraint failed on tasks.owner_id: %w", gorm.ErrForeignKeyViolated),
+			status: http.StatusUnprocessableEntity,
+			code:   "INVALID_REFERENCE",
+		},
+		{
+			name:   "record not found",
+			err:    fmt.Errorf("SELECT * FROM users WHERE id = 7: %w", gorm.ErrRecordNotFound),
+			status: http.StatusNotFound,
+			code:   "RESOURCE_NOT_FOUND",
+		},
+		{
+			name:   "stale version",
+			err:    fmt.Errorf("UPDATE tasks SET version = 4: %w", repositories.ErrStaleVersion),
+			status: http.StatusPreconditionFailed,
+			code:   "VERSION_MISMATCH",
+		},
+		{
+			name:   "unknown error",
+			err:    errors.New(`pq: relation "users" does not exist`),
+			status: http.StatusInternalServerError,
+			code:   "INTERNAL_ERROR",
+		},
+		{
+			name:   "wrapped domain error",
+			err:    services.ErrInternal.Wrap(errors.New("dial tcp 10.0.0.5:5432: connection refused")),
+			status: http.StatusInternalServerError,
+			code:   "INTERNAL_ERROR",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, body := serveError(t, tt.err)
+			if recorder.Code != tt.status || body.Code != tt.code {
+				t.Fatalf("expected %d %s, got %d %+v", tt.status, tt.code, recorder.Code, body)
+			}
+			for _, leaked := range []string{"constraint", "SELECT", "UPDATE", "relation", "tcp"} {
+				if strings.Contains(recorder.Body.String(), leaked) {
+					t.Fatalf("the response leaks the database message: %s", recorder.Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+	// idempotencyLockTTL es cuánto queda reservada una clave mientras se procesa
+	// el pedido; si la réplica se cae a mitad de camino, la clave se libera sola
+	idempotencyLockTTL = time.Minute
+)
+
+var (
+	errIdempotencyKeyTooLong = services.NewError(services.KindValidation, "INVALID_IDEMPOTENCY_KEY", "Idempotency-Key is too long")
+	errIdempotencyKeyReused  = services.NewError(services.KindUnprocessable, "IDEMPOTENCY_KEY_REUSED", "Idempotency-Key was already used for a different request")
+	errIdempotencyKeyInUse   = services.NewError(services.KindConflict, "IDEMPOTENCY_KEY_IN_USE", "a request with this Idempotency-Key is still being processed")
+)
+
+// idempotentHeaders son los headers de la respuesta que se repiten junto con el cuerpo
+var idempotentHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// Idempotency hace que un POST con Idempotency-Key se ejecute una sola vez:
+// guarda la respuesta durante retention y ante un reintento con la misma clave
+// la repite sin volver a llamar al handler. La clave es por usuario (o IP, en
+// las rutas públicas) y se compara con una huella del método, la ruta y el
+// cuerpo; si llega con otro pedido se responde 422. Las respuestas 5xx no se
+// guardan, así el cliente puede reintentar. Tiene que ir antes de Transactional
+// para guardar la respuesta recién cuando se confirmó la transacción.
+func Idempotency(store services.IdempotencyStore, retention time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			abortWithError(c, errIdempotencyKeyTooLong)
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithError(c, services.ErrInvalidRequest.Wrap(err))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(append([]byte(c.Request.Method+" "+c.Request.URL.Path+"\n"), body...))
+		fingerprint := hex.EncodeToString(sum[:])
+		key = rateLimitIdentity(c) + ":" + key
+		// Si el cliente corta la conexión igual hay que guardar la respuesta:
+		// es justo el caso en que va a reintentar
+		ctx := context.WithoutCancel(c.Request.Context())
+
+		record, err := store.Reserve(ctx, key, fingerprint, idempotencyLockTTL)
+		if err != nil {
+			// Si el store no responde se atiende el pedido sin idempotencia
+			log.Printf("Error reserving idempotency key: %v\n", err)
+			c.Next()
+			return
+		}
+		if record != nil {
+			switch {
+			case record.Fingerprint != fingerprint:
+				abortWithError(c, errIdempotencyKeyReused)
+			case !record.Completed:
+				abortWithError(c, errIdempotencyKeyInUse)
+			default:
+				replay(c, record)
+			}
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		completed := false
+		defer func() {
+			c.Writer = writer.ResponseWriter
+			// Con un panic la clave se libera para poder reintentar
+			if !completed {
+				if err := store.Release(ctx, key); err != nil {
+					log.Printf("Error releasing idempotency key: %v\n", err)
+				}
+			}
+		}()
+
+		c.Next()
+		renderError(c)
+
+		if writer.Status() >= http.StatusInternalServerError {
+			return
+		}
+		response := services.IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Completed:   true,
+			Status:      writer.Status(),
+			Header:      http.Header{},
+			Body:        writer.body.Bytes(),
+		}
+		for _, name := range idempotentHeaders {
+			if value := writer.Header().Get(name); value != "" {
+				response.Header.Set(name, value)
+			}
+		}
+		if err := store.Complete(ctx, key, response, retention); err != nil {
+			log.Printf("Error saving idempotent response: %v\n", err)
+			return
+		}
+		completed = true
+	}
+}
+
+// replay repite la respuesta guardada; Idempotent-Replayed le avisa al cliente
+func replay(c *gin.Context, record *services.IdempotencyRecord) {
+	for name, values := range record.Header {
+		for _, value := range values {
+			c.Writer.Header().Add(name, value)
+		}
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.Status(record.Status)
+	if len(record.Body) > 0 {
+		if _, err := c.Writer.Write(record.Body); err != nil {
+			log.Printf("Error writing response: %v\n", err)
+		}
+	}
+	c.Abort()
+}
+
+// recordingWriter escribe la respuesta normalmente y guarda una copia del cuerpo
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
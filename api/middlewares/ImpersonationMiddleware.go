@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+var errImpersonationForbidden = services.NewError(services.KindForbidden, "IMPERSONATION_FORBIDDEN", "this action is not allowed while impersonating a user")
+
+// DenyImpersonation bloquea las acciones sensibles (contraseña, 2FA, tokens,
+// cambios de cuenta) para los tokens de suplantación. Va después de AuthMiddleware.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userClaims, exists := c.Get("user"); exists && userClaims.(*models.Claims).Act != nil {
+			abortWithError(c, errImpersonationForbidden)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,18 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/i18n"
+)
+
+// languageKey es la clave del contexto con el idioma de los mensajes de error
+const languageKey = "language"
+
+// Language elige el idioma de los mensajes según Accept-Language. Si el
+// usuario autenticado tiene un idioma preferido, AuthMiddleware lo reemplaza.
+func Language() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(languageKey, i18n.Negotiate(c.GetHeader("Accept-Language")))
+		c.Next()
+	}
+}
@@ -2,20 +2,32 @@
 package middlewares
 
 import (
-	"net/http"
+	"errors"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/lucapierini/project-go-task_manager/config"
 	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"github.com/lucapierini/project-go-task_manager/services"
 )
 
-func IsOwner(resourceType string) gin.HandlerFunc {
+var errNotResourceOwner = services.NewError(services.KindForbidden, "NOT_RESOURCE_OWNER", "you don't have permission to modify this resource")
+
+// OwnerChecker arma los middlewares de propiedad consultando los repositorios
+type OwnerChecker struct {
+	store repositories.Store
+}
+
+func NewOwnerChecker(store repositories.Store) *OwnerChecker {
+	return &OwnerChecker{store: store}
+}
+
+func (o *OwnerChecker) IsOwner(resourceType string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Obtener el usuario del contexto (establecido por AuthMiddleware)
 		userClaims, exists := c.Get("user")
 		if !exists {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+			abortWithError(c, errTokenNotProvided)
 			return
 		}
 		claims := userClaims.(*models.Claims)
@@ -44,7 +56,7 @@ func IsOwner(resourceType string) gin.HandlerFunc {
 			// resourceID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
             resourceID, err := strconv.Atoi(c.Param("userId"))
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid resource ID"})
+				abortWithError(c, services.InvalidParam("userId"))
 				return
 			}
 			isOwner = claims.UserID == uint(resourceID)
@@ -53,39 +65,41 @@ func IsOwner(resourceType string) gin.HandlerFunc {
 			// Obtener el ID del recurso de los parámetros
 			resourceID, err := strconv.ParseUint(c.Param("projectId"), 10, 64)
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid resource ID"})
+				abortWithError(c, services.InvalidParam("projectId"))
 				return
 			}
-			var project models.Project
-			result := config.DB.First(&project, resourceID)
-			if result.Error != nil {
-				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "project not found"})
+			project, err := o.store.Projects().FindByID(c.Request.Context(), uint(resourceID))
+			if err != nil {
+				abortWithError(c, services.ErrProjectNotFound.Wrap(err))
 				return
 			}
 			isOwner = project.OwnerID == claims.UserID
+			if !isOwner {
+				// Los co-dueños tienen los mismos permisos que el dueño principal
+				isOwner, _ = o.store.Projects().IsCoOwner(c.Request.Context(), project.ID, claims.UserID)
+			}
 
 		case "task":
 			// Obtener el ID del recurso de los parámetros
 			resourceID, err := strconv.ParseUint(c.Param("taskId"), 10, 64)
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid resource ID"})
+				abortWithError(c, services.InvalidParam("taskId"))
 				return
 			}
-			var task models.Task
-			result := config.DB.First(&task, resourceID)
-			if result.Error != nil {
-				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "task not found"})
+			task, err := o.store.Tasks().FindByID(c.Request.Context(), uint(resourceID))
+			if err != nil {
+				abortWithError(c, services.ErrTaskNotFound.Wrap(err))
 				return
 			}
 			isOwner = task.OwnerID == claims.UserID
 
 		default:
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid resource type"})
+			abortWithError(c, services.ErrInternal.Wrap(errors.New("invalid resource type "+resourceType)))
 			return
 		}
 
 		if !isOwner {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "you don't have permission to modify this resource"})
+			abortWithError(c, errNotResourceOwner)
 			return
 		}
 
@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+var errRateLimited = services.NewError(services.KindTooManyRequests, "RATE_LIMITED", "rate limit exceeded")
+
+// RateLimiter arma los middlewares de rate limit sobre un store compartido
+type RateLimiter struct {
+	store services.RateLimitStore
+}
+
+func NewRateLimiter(store services.RateLimitStore) *RateLimiter {
+	return &RateLimiter{store: store}
+}
+
+// rateLimitIdentity identifica a quién se le cuenta el pedido: el token personal,
+// el usuario autenticado o, antes de AuthMiddleware, la IP
+func rateLimitIdentity(c *gin.Context) string {
+	if userClaims, exists := c.Get("user"); exists {
+		claims := userClaims.(*models.Claims)
+		if claims.TokenType == "pat" {
+			return fmt.Sprintf("token:%d", claims.TokenID)
+		}
+		return fmt.Sprintf("user:%d", claims.UserID)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Limit aplica el límite con nombre name a las rutas donde se use. Cada nombre
+// tiene sus propios buckets, así un límite específico no consume el general.
+func (r *RateLimiter) Limit(name string, limit services.RateLimit) gin.HandlerFunc {
+	policy := fmt.Sprintf("%d;w=%s", limit.Requests, seconds(limit.Window))
+
+	return func(c *gin.Context) {
+		result, err := r.store.Take(c.Request.Context(), name+":"+rateLimitIdentity(c), limit)
+		if err != nil {
+			// Si el store no responde se deja pasar el pedido
+			log.Printf("Error checking rate limit %s: %v\n", name, err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", policy)
+		c.Header("RateLimit-Limit", strconv.Itoa(limit.Requests))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", seconds(result.Reset))
+
+		if !result.Allowed {
+			c.Header("Retry-After", seconds(result.RetryAfter))
+			abortWithError(c, errRateLimited)
+			return
+		}
+		c.Next()
+	}
+}
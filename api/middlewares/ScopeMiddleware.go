@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/services"
+)
+
+const tokenScopeKey = "token_scope_resource"
+
+var errTokenNotAllowed = services.NewError(services.KindForbidden, "TOKEN_NOT_ALLOWED", "personal access tokens are not allowed on this route")
+
+// TokenScope declara a qué recurso pertenecen las rutas del grupo para los tokens
+// de acceso personal. Va antes de AuthMiddleware: las rutas sin TokenScope
+// rechazan los tokens personales.
+func TokenScope(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(tokenScopeKey, resource)
+		c.Next()
+	}
+}
+
+// scopeAction deduce la acción del método HTTP: las lecturas piden :read y el resto :write
+func scopeAction(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return "read"
+	}
+	return "write"
+}
+
+// checkTokenScope corta la request si un token personal no tiene el scope de la ruta
+func checkTokenScope(c *gin.Context, scopes []string) bool {
+	resource := c.GetString(tokenScopeKey)
+	if resource == "" {
+		abortWithError(c, errTokenNotAllowed)
+		return false
+	}
+
+	action := scopeAction(c.Request.Method)
+	if !services.HasScope(scopes, resource, action) {
+		abortWithError(c, services.ErrInsufficientScope.With("required_scope", resource+":"+action))
+		return false
+	}
+	return true
+}
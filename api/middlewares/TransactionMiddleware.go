@@ -0,0 +1,117 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"github.com/lucapierini/project-go-task_manager/services"
+	"gorm.io/gorm"
+)
+
+// errRollback deshace la transacción cuando el handler respondió con error
+var errRollback = errors.New("request failed, rolling back")
+
+var errCommitFailed = services.NewError(services.KindInternal, "COMMIT_FAILED", "the changes could not be saved")
+
+// Transactional corre el handler dentro de una transacción de store que viaja
+// en el contexto del request, así todos los servicios que llama escriben en
+// ella. Se confirma si la respuesta es exitosa (status < 400) y se deshace si
+// no, o si hay un panic. La respuesta se retiene hasta confirmar, para que el
+// cliente no reciba un éxito que después no quedó guardado.
+// Los GET, HEAD y OPTIONS pasan sin transacción.
+func Transactional(store repositories.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		writer := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = writer
+		// Con un panic Recovery tiene que escribir en la respuesta real
+		defer func() { c.Writer = writer.ResponseWriter }()
+
+		err := repositories.RunInTransaction(c.Request.Context(), store, func(ctx context.Context, _ repositories.Store) error {
+			c.Request = c.Request.WithContext(ctx)
+			c.Next()
+			renderError(c)
+			if writer.status >= http.StatusBadRequest {
+				return errRollback
+			}
+			return nil
+		})
+
+		c.Writer = writer.ResponseWriter
+		if err != nil && !errors.Is(err, errRollback) {
+			// Falló el commit: lo que respondió el handler no quedó guardado
+			if !errors.Is(err, gorm.ErrDuplicatedKey) {
+				err = errCommitFailed.Wrap(err)
+			}
+			_ = c.Error(err)
+			renderError(c)
+			return
+		}
+		writer.flush()
+	}
+}
+
+// bufferedWriter guarda el status y el cuerpo de la respuesta hasta flush
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body    bytes.Buffer
+	status  int
+	written bool
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.written
+}
+
+// flush envía al cliente lo que escribió el handler
+func (w *bufferedWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.body.Len() > 0 {
+		if _, err := w.ResponseWriter.Write(w.body.Bytes()); err != nil {
+			log.Printf("Error writing response: %v\n", err)
+		}
+	} else if w.written {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Por defecto una cuenta sin verificar solo puede leer y pedir otro enlace de verificación
+const defaultUnverifiedAllowedRoutes = "GET *,POST /api/auth/resend-verification"
+
+type routeRule struct {
+	method string
+	path   string
+}
+
+var (
+	unverifiedRulesOnce sync.Once
+	unverifiedRules     []routeRule
+)
+
+// loadUnverifiedRules lee UNVERIFIED_ALLOWED_ROUTES: una lista separada por comas
+// de "METODO /ruta", donde la ruta es la de gin (ej: /api/tasks/:taskId) y
+// tanto el método como la ruta pueden ser "*"
+func loadUnverifiedRules() {
+	value := os.Getenv("UNVERIFIED_ALLOWED_ROUTES")
+	if value == "" {
+		value = defaultUnverifiedAllowedRoutes
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Fields(entry)
+		if len(parts) != 2 {
+			continue
+		}
+		unverifiedRules = append(unverifiedRules, routeRule{method: strings.ToUpper(parts[0]), path: parts[1]})
+	}
+}
+
+// unverifiedActionAllowed indica si una cuenta con el email sin verificar puede usar la ruta actual
+func unverifiedActionAllowed(c *gin.Context) bool {
+	unverifiedRulesOnce.Do(loadUnverifiedRules)
+
+	for _, rule := range unverifiedRules {
+		if (rule.method == "*" || rule.method == c.Request.Method) && (rule.path == "*" || rule.path == c.FullPath()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/lucapierini/project-go-task_manager/config"
+	"github.com/lucapierini/project-go-task_manager/migrations"
+)
+
+const migrateUsage = `usage: migrate <command>
+
+  up [version]   aplica las migraciones pendientes (hasta version, si se indica)
+  down [steps]   revierte las últimas migraciones aplicadas (1 por defecto)
+  status         lista las migraciones y cuándo se aplicaron`
+
+// runMigrate implementa `migrate up|down|status` y devuelve el código de salida
+func runMigrate(args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	var arg uint64
+	if len(args) == 2 {
+		var err error
+		if arg, err = strconv.ParseUint(args[1], 10, 32); err != nil {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+	}
+
+	config.LoadEnvVariables()
+	config.ConnectDB()
+
+	switch args[0] {
+	case "up":
+		done, err := migrations.Up(config.DB, uint(arg))
+		for _, m := range done {
+			log.Printf("Applied migration %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Printf("Migration failed: %v\n", err)
+			return 1
+		}
+		if len(done) == 0 {
+			log.Println("Database schema is up to date")
+		}
+
+	case "down":
+		steps := int(arg)
+		if steps == 0 {
+			steps = 1
+		}
+		reverted, err := migrations.Down(config.DB, steps)
+		for _, m := range reverted {
+			log.Printf("Reverted migration %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Printf("Rollback failed: %v\n", err)
+			return 1
+		}
+
+	case "status":
+		status, err := migrations.Status(config.DB)
+		if err != nil {
+			log.Printf("Failed to read migrations: %v\n", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, m := range status {
+			applied := "pending"
+			if m.AppliedAt != nil {
+				applied = m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", m.Version, m.Name, applied)
+		}
+		w.Flush()
+		if err := migrations.Check(config.DB); err != nil {
+			log.Println(err)
+			return 1
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"github.com/lucapierini/project-go-task_manager/migrations/schemav1"
+	"gorm.io/gorm"
+)
+
+// initialSchema crea el esquema tal como lo dejaba AutoMigrate antes de que
+// existieran las migraciones. Usa copias de los modelos de ese momento para
+// que cambios futuros en models no alteren lo que hace. Sobre una base creada
+// por AutoMigrate no cambia nada y solo queda registrada como aplicada.
+var initialSchema = Migration{
+	Version: 1,
+	Name:    "initial_schema",
+	Up: func(tx *gorm.DB) error {
+		// Las cuentas que existían antes de la verificación por email se consideran verificadas
+		migrator := tx.Migrator()
+		backfillVerified := migrator.HasTable(&schemav1.User{}) && !migrator.HasColumn(&schemav1.User{}, "EmailVerified")
+
+		// Una tabla por vez y en el mismo orden que SyncDB, para que las tablas
+		// intermedias queden igual que en las bases creadas con AutoMigrate
+		for _, table := range schemav1Tables() {
+			if err := tx.AutoMigrate(table); err != nil {
+				return err
+			}
+		}
+		if backfillVerified {
+			return tx.Model(&schemav1.User{}).Where("email_verified = ?", false).Update("email_verified", true).Error
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		tables := append([]interface{}{"user_roles", "project_co_owners", "project_users", "project_tasks"}, reversed(schemav1Tables())...)
+		return tx.Migrator().DropTable(tables...)
+	},
+}
+
+func schemav1Tables() []interface{} {
+	return []interface{}{
+		&schemav1.User{}, &schemav1.Role{}, &schemav1.Project{}, &schemav1.Task{},
+		&schemav1.ProjectTransfer{}, &schemav1.ProjectInvitation{}, &schemav1.PasswordResetToken{},
+		&schemav1.RecoveryCode{}, &schemav1.Setting{}, &schemav1.PersonalAccessToken{},
+		&schemav1.SigningKey{}, &schemav1.PasswordHistory{}, &schemav1.Impersonation{},
+		&schemav1.ImpersonationRequest{},
+	}
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// versionColumn es la columna que agrega resourceVersions, congelada acá para
+// que cambios futuros en models no alteren la migración
+type versionColumn struct {
+	Version uint `gorm:"not null;default:1"`
+}
+
+// Tablas cuyos registros se editan con If-Match
+var versionedTables = []string{"users", "roles", "projects", "tasks"}
+
+// resourceVersions agrega el número de versión que se expone como ETag y que
+// permite rechazar una edición hecha sobre datos viejos. Los registros
+// existentes arrancan en la versión 1.
+var resourceVersions = Migration{
+	Version: 2,
+	Name:    "resource_versions",
+	Up: func(tx *gorm.DB) error {
+		for _, table := range versionedTables {
+			if err := tx.Table(table).Migrator().AddColumn(&versionColumn{}, "Version"); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		for _, table := range versionedTables {
+			if err := tx.Table(table).Migrator().DropColumn(&versionColumn{}, "Version"); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
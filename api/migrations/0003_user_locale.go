@@ -0,0 +1,23 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// localeColumn es la columna que agrega userLocale, congelada acá para que
+// cambios futuros en models no alteren la migración
+type localeColumn struct {
+	Locale string `gorm:"not null;default:''"`
+}
+
+// userLocale agrega el idioma preferido de cada usuario para los mensajes de
+// la API. Los usuarios existentes quedan sin preferencia y siguen usando
+// Accept-Language.
+var userLocale = Migration{
+	Version: 3,
+	Name:    "user_locale",
+	Up: func(tx *gorm.DB) error {
+		return tx.Table("users").Migrator().AddColumn(&localeColumn{}, "Locale")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Table("users").Migrator().DropColumn(&localeColumn{}, "Locale")
+	},
+}
@@ -0,0 +1,251 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration es un cambio de esquema versionado. Up y Down corren dentro de una
+// transacción junto con el registro en schema_migrations.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// all son las migraciones que conoce este binario, en orden de versión.
+// Una migración ya publicada no se modifica: los cambios van en una nueva.
+var all = []Migration{
+	initialSchema,
+	resourceVersions,
+	userLocale,
+}
+
+// reversed devuelve una copia de tables en orden inverso, para borrar tablas
+// dependientes antes que aquellas a las que apuntan
+func reversed(tables []interface{}) []interface{} {
+	result := make([]interface{}, 0, len(tables))
+	for i := len(tables) - 1; i >= 0; i-- {
+		result = append(result, tables[i])
+	}
+	return result
+}
+
+// SchemaMigration es una fila de schema_migrations: una migración aplicada
+type SchemaMigration struct {
+	Version   uint      `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// MigrationStatus es el estado de una migración para `migrate status`
+type MigrationStatus struct {
+	Version   uint
+	Name      string
+	AppliedAt *time.Time
+}
+
+var (
+	ErrUnknownSchemaVersion = errors.New("database schema has migrations unknown to this binary")
+	ErrPendingMigrations    = errors.New("database schema has pending migrations")
+	ErrIrreversible         = errors.New("migration cannot be rolled back")
+)
+
+// Clave del advisory lock de Postgres que serializa a las instancias que migran a la vez
+const postgresLockKey = 4_103_870_221
+
+func init() {
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+}
+
+// Latest devuelve la última versión que conoce este binario
+func Latest() uint {
+	if len(all) == 0 {
+		return 0
+	}
+	return all[len(all)-1].Version
+}
+
+func known(version uint) (Migration, bool) {
+	for _, m := range all {
+		if m.Version == version {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
+
+func applied(db *gorm.DB) (map[uint]SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[uint]SchemaMigration, len(rows))
+	for _, row := range rows {
+		result[row.Version] = row
+	}
+	return result, nil
+}
+
+// Check verifica que la base no tenga migraciones que este binario no conoce,
+// por ejemplo porque ya la migró una versión más nueva de la API
+func Check(db *gorm.DB) error {
+	done, err := applied(db)
+	if err != nil {
+		return err
+	}
+	for version := range done {
+		if _, ok := known(version); !ok {
+			return fmt.Errorf("%w: version %d (latest known is %d)", ErrUnknownSchemaVersion, version, Latest())
+		}
+	}
+	return nil
+}
+
+// Pending devuelve las migraciones que faltan aplicar, en orden
+func Pending(db *gorm.DB) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	pending := []Migration{}
+	for _, m := range all {
+		if _, ok := done[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// lock toma, en Postgres, un lock de la transacción para que dos instancias no
+// apliquen la misma migración; en SQLite la escritura ya es exclusiva
+func lock(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", postgresLockKey).Error
+}
+
+// Up aplica las migraciones pendientes hasta target inclusive (0 = todas) y
+// devuelve las que aplicó
+func Up(db *gorm.DB, target uint) ([]Migration, error) {
+	if err := Check(db); err != nil {
+		return nil, err
+	}
+	pending, err := Pending(db)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, m := range pending {
+		if target != 0 && m.Version > target {
+			break
+		}
+		ran := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lock(tx); err != nil {
+				return err
+			}
+			// Otra instancia pudo aplicarla mientras esperábamos el lock
+			var count int64
+			if err := tx.Model(&SchemaMigration{}).Where("version = ?", m.Version).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return nil
+			}
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			ran = true
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if ran {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// Down revierte las últimas steps migraciones aplicadas y devuelve las que revirtió
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	if err := Check(db); err != nil {
+		return nil, err
+	}
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := []Migration{}
+	for i := len(all) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := all[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return reverted, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, ErrIrreversible)
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lock(tx); err != nil {
+				return err
+			}
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+// Status devuelve todas las migraciones conocidas con la fecha en que se aplicaron
+func Status(db *gorm.DB) ([]MigrationStatus, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]MigrationStatus, 0, len(all))
+	for _, m := range all {
+		entry := MigrationStatus{Version: m.Version, Name: m.Name}
+		if row, ok := done[m.Version]; ok {
+			appliedAt := row.AppliedAt
+			entry.AppliedAt = &appliedAt
+		}
+		status = append(status, entry)
+	}
+	return status, nil
+}
+
+// Startup se usa al arrancar la API: se niega a correr contra un esquema más
+// nuevo y aplica las migraciones pendientes, o falla si autoApply es false
+func Startup(db *gorm.DB, autoApply bool) error {
+	if err := Check(db); err != nil {
+		return err
+	}
+	pending, err := Pending(db)
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	if !autoApply {
+		return fmt.Errorf("%w: %d to apply, run `migrate up`", ErrPendingMigrations, len(pending))
+	}
+	_, err = Up(db, 0)
+	return err
+}
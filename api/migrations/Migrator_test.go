@@ -0,0 +1,71 @@
+package migrations
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/config"
+)
+
+func TestUpOnSQLiteMemory(t *testing.T) {
+	db, err := config.OpenDB("sqlite://:memory:")
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+
+	done, err := Up(db, 0)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(done) != len(all) || done[len(done)-1].Version != Latest() {
+		t.Fatalf("expected %d migrations up to %d, applied %+v", len(all), Latest(), done)
+	}
+
+	// Volver a correr Up no aplica nada y el esquema queda al día
+	if done, err := Up(db, 0); err != nil || len(done) != 0 {
+		t.Fatalf("second Up applied %+v (%v)", done, err)
+	}
+	if err := Check(db); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	status, err := Status(db)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, entry := range status {
+		if entry.AppliedAt == nil {
+			t.Fatalf("migration %d (%s) is not applied", entry.Version, entry.Name)
+		}
+	}
+}
+
+func TestCheckRejectsNewerSchema(t *testing.T) {
+	db, err := config.OpenDB("sqlite://:memory:")
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+
+	// Sin aplicar nada, el arranque sin auto-migración avisa que hay pendientes
+	if err := Startup(db, false); !errors.Is(err, ErrPendingMigrations) {
+		t.Fatalf("expected ErrPendingMigrations, got %v", err)
+	}
+	if _, err := Up(db, 0); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	// Una versión más nueva de la API ya migró la base
+	future := SchemaMigration{Version: Latest() + 1, Name: "from_the_future", AppliedAt: time.Now()}
+	if err := db.Create(&future).Error; err != nil {
+		t.Fatalf("inserting schema_migrations row: %v", err)
+	}
+	if err := Check(db); !errors.Is(err, ErrUnknownSchemaVersion) {
+		t.Fatalf("expected ErrUnknownSchemaVersion, got %v", err)
+	}
+	if err := Startup(db, true); !errors.Is(err, ErrUnknownSchemaVersion) {
+		t.Fatalf("expected Startup to refuse the newer schema, got %v", err)
+	}
+	if _, err := Down(db, 1); !errors.Is(err, ErrUnknownSchemaVersion) {
+		t.Fatalf("expected Down to refuse the newer schema, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+// Package schemav1 congela los modelos tal como estaban cuando se introdujeron
+// las migraciones. Los tipos conservan los nombres de models porque GORM deriva
+// de ellos los nombres de columnas y constraints de las tablas intermedias.
+// No se modifica: los cambios de esquema van en migraciones nuevas.
+package schemav1
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type User struct {
+	gorm.Model
+	Username              string `gorm:"not null;uniqueIndex:idx_users_username,where:deleted_at IS NULL"`
+	Password              string `gorm:"not null"`
+	Email                 string `gorm:"not null;uniqueIndex:idx_users_email,where:deleted_at IS NULL"`
+	EmailVerified         bool   `gorm:"not null;default:false"`
+	EmailVerifiedAt       *time.Time
+	SessionVersion        uint `gorm:"not null;default:0"`
+	TOTPSecret            string
+	TOTPEnabled           bool `gorm:"not null;default:false"`
+	TOTPLastStep          int64
+	PasswordPolicyVersion uint `gorm:"not null;default:0"`
+	PasswordChangedAt     *time.Time
+	AuthProvider          string  `gorm:"not null;default:local"`
+	ExternalSubject       *string `gorm:"uniqueIndex:idx_users_external_subject,where:deleted_at IS NULL"`
+	Roles                 []Role  `gorm:"many2many:user_roles"`
+}
+
+type Role struct {
+	gorm.Model
+	Name  string `gorm:"not null;uniqueIndex:idx_roles_name,where:deleted_at IS NULL"`
+	Users []User `gorm:"many2many:user_roles"`
+}
+
+type Project struct {
+	gorm.Model
+	Name     string `gorm:"not null;uniqueIndex:idx_projects_name,where:deleted_at IS NULL"`
+	Budget   uint   `gorm:"not null"`
+	Owner    User   `gorm:"foreignKey:OwnerID"`
+	OwnerID  uint
+	CoOwners []User `gorm:"many2many:project_co_owners"`
+	Users    []User `gorm:"many2many:project_users"`
+	Tasks    []Task `gorm:"many2many:project_tasks"`
+}
+
+type Task struct {
+	gorm.Model
+	Name        string `gorm:"not null"`
+	Description string
+	Owner       User `gorm:"foreignKey:OwnerID"`
+	OwnerID     uint
+	Project     []Project `gorm:"many2many:project_tasks"`
+}
+
+type ProjectTransfer struct {
+	gorm.Model
+	ProjectID  uint    `gorm:"not null;index"`
+	Project    Project `gorm:"foreignKey:ProjectID"`
+	FromUserID uint    `gorm:"not null"`
+	ToUserID   uint    `gorm:"not null;index"`
+	Status     string  `gorm:"not null;default:pending"`
+}
+
+type ProjectInvitation struct {
+	gorm.Model
+	ProjectID    uint      `gorm:"not null;index"`
+	Project      Project   `gorm:"foreignKey:ProjectID"`
+	Email        string    `gorm:"not null;index"`
+	ProjectRole  string    `gorm:"not null;default:member"`
+	InvitedByID  uint      `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	AcceptedAt   *time.Time
+	AcceptedByID *uint
+}
+
+type PasswordResetToken struct {
+	gorm.Model
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+}
+
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"not null;index"`
+	CodeHash string `gorm:"not null"`
+	UsedAt   *time.Time
+}
+
+type Setting struct {
+	Key       string `gorm:"primaryKey"`
+	Value     string `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+type PersonalAccessToken struct {
+	gorm.Model
+	UserID     uint      `gorm:"not null;index"`
+	Name       string    `gorm:"not null"`
+	Prefix     string    `gorm:"not null"`
+	TokenHash  string    `gorm:"not null;uniqueIndex"`
+	Scopes     string    `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	LastUsedAt *time.Time
+}
+
+type SigningKey struct {
+	KID        string `gorm:"primaryKey"`
+	Algorithm  string `gorm:"not null"`
+	PrivateKey string `gorm:"not null"`
+	CreatedAt  time.Time
+	RetiredAt  *time.Time
+	ExpiresAt  *time.Time
+}
+
+type PasswordHistory struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       uint   `gorm:"not null;index"`
+	PasswordHash string `gorm:"not null"`
+	CreatedAt    time.Time
+}
+
+type Impersonation struct {
+	gorm.Model
+	AdminID   uint   `gorm:"not null;index"`
+	Admin     User   `gorm:"foreignKey:AdminID"`
+	UserID    uint   `gorm:"not null;index"`
+	Reason    string `gorm:"not null"`
+	IP        string
+	ExpiresAt time.Time `gorm:"not null"`
+	EndedAt   *time.Time
+	Requests  []ImpersonationRequest `gorm:"foreignKey:ImpersonationID"`
+}
+
+type ImpersonationRequest struct {
+	ID              uint   `gorm:"primaryKey"`
+	ImpersonationID uint   `gorm:"not null;index"`
+	Method          string `gorm:"not null"`
+	Path            string `gorm:"not null"`
+	Status          int
+	CreatedAt       time.Time
+}
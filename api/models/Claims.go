@@ -9,5 +9,16 @@ type Claims struct {
     UserID uint
     Roles  []string
     TokenType string
+    EmailVerified bool
+    SessionVersion uint
+    MFAEnrollmentRequired bool
+    PasswordChangeRequired bool
+    // Scopes solo se usa con tokens de acceso personal (TokenType "pat")
+    Scopes []string `json:",omitempty"`
+    TokenID uint `json:",omitempty"`
+    // Act solo está en los tokens de suplantación e identifica al administrador real
+    Act *Actor `json:"act,omitempty"`
+    // Locale no viaja en el token: la carga CheckSession para que un cambio de idioma aplique enseguida
+    Locale string `json:"-"`
     jwt.StandardClaims
 }
\ No newline at end of file
@@ -0,0 +1,25 @@
+package models
+
+// UserDeletionImpact describe todo lo que afecta el borrado de un usuario.
+// Las filas de user_roles, project_users y project_co_owners se conservan
+// mientras el usuario está en la papelera y se eliminan recién al purgarlo.
+type UserDeletionImpact struct {
+	UserID             uint   `json:"user_id"`
+	Policy             string `json:"policy"`
+	SuccessorID        uint   `json:"successor_id,omitempty"`
+	OwnedProjects      []uint `json:"owned_projects"`
+	OwnedTasks         []uint `json:"owned_tasks"`
+	ProjectMemberships []uint `json:"project_memberships"`
+	CoOwnedProjects    []uint `json:"co_owned_projects"`
+	Roles              []uint `json:"roles"`
+}
+
+// ProjectDeletionImpact describe todo lo que afecta el borrado de un proyecto.
+// OrphanedTasks son las tareas que no pertenecen a ningún otro proyecto activo.
+type ProjectDeletionImpact struct {
+	ProjectID     uint   `json:"project_id"`
+	Policy        string `json:"policy"`
+	Members       []uint `json:"members"`
+	Tasks         []uint `json:"tasks"`
+	OrphanedTasks []uint `json:"orphaned_tasks"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Impersonation registra cada vez que un administrador entra como otro usuario.
+// Se conserva como auditoría; el usuario la puede ver en su listado.
+type Impersonation struct {
+	gorm.Model
+	AdminID   uint                   `gorm:"not null;index" json:"admin_id"`
+	Admin     ImpersonationAdmin     `gorm:"-" json:"admin"`
+	UserID    uint                   `gorm:"not null;index" json:"user_id"`
+	Reason    string                 `gorm:"not null" json:"reason"`
+	IP        string                 `json:"ip"`
+	ExpiresAt time.Time              `gorm:"not null" json:"expires_at"`
+	EndedAt   *time.Time             `json:"ended_at"`
+	Requests  []ImpersonationRequest `json:"requests,omitempty"`
+}
+
+// ImpersonationAdmin es lo único que se muestra del administrador en la
+// auditoría: el usuario suplantado también la ve
+type ImpersonationAdmin struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+// ImpersonationRequest es un pedido hecho con un token de suplantación
+type ImpersonationRequest struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	ImpersonationID uint      `gorm:"not null;index" json:"impersonation_id"`
+	Method          string    `gorm:"not null" json:"method"`
+	Path            string    `gorm:"not null" json:"path"`
+	Status          int       `json:"status"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Actor es el claim "act": identifica al administrador que usa el token de otro usuario
+type Actor struct {
+	UserID          uint `json:"sub"`
+	ImpersonationID uint `json:"impersonation_id"`
+}
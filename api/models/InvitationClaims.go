@@ -0,0 +1,13 @@
+package models
+
+import (
+	"github.com/golang-jwt/jwt"
+)
+
+// InvitationClaims viajan en el token firmado que se envía por email con cada invitación
+type InvitationClaims struct {
+	InvitationID uint
+	Email        string
+	TokenType    string
+	jwt.StandardClaims
+}
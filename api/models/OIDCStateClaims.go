@@ -0,0 +1,15 @@
+package models
+
+import (
+	"github.com/golang-jwt/jwt"
+)
+
+// OIDCStateClaims viajan firmados en la cookie que acompaña el login con el
+// proveedor OIDC, entre la redirección y el callback
+type OIDCStateClaims struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	TokenType    string
+	jwt.StandardClaims
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// PasswordHistory guarda los hashes de las contraseñas anteriores de un usuario
+// para no permitir que se vuelvan a usar
+type PasswordHistory struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       uint   `gorm:"not null;index"`
+	PasswordHash string `gorm:"not null"`
+	CreatedAt    time.Time
+}
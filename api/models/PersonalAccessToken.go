@@ -0,0 +1,28 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PersonalAccessToken es un token de larga duración para automatizaciones.
+// Solo se guarda el hash; Prefix sirve para reconocerlo en los listados.
+type PersonalAccessToken struct {
+	gorm.Model
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null" json:"prefix"`
+	TokenHash  string     `gorm:"not null;uniqueIndex" json:"-"`
+	Scopes     string     `gorm:"not null" json:"-"`
+	ScopeList  []string   `gorm:"-" json:"scopes"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// AfterFind carga ScopeList a partir de los scopes guardados separados por comas
+func (t *PersonalAccessToken) AfterFind(tx *gorm.DB) error {
+	t.ScopeList = strings.Split(t.Scopes, ",")
+	return nil
+}
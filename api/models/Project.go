@@ -4,10 +4,12 @@ import "gorm.io/gorm"
 
 type Project struct {
 	gorm.Model
-	Name    string `gorm:"unique;not null"`
-	Budget  uint   `gorm:"not null"`
-	Owner   User   `gorm:"foreignKey:OwnerID"`
-	OwnerID uint
-	Users   []User `gorm:"many2many:project_users"`
-	Tasks   []Task `gorm:"many2many:project_tasks"`
+	Versioned
+	Name     string `gorm:"not null;uniqueIndex:idx_projects_name,where:deleted_at IS NULL"`
+	Budget   uint   `gorm:"not null"`
+	Owner    User   `gorm:"foreignKey:OwnerID"`
+	OwnerID  uint
+	CoOwners []User `gorm:"many2many:project_co_owners"`
+	Users    []User `gorm:"many2many:project_users"`
+	Tasks    []Task `gorm:"many2many:project_tasks"`
 }
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Rol con el que la persona invitada se une al proyecto
+const (
+	ProjectRoleMember  = "member"
+	ProjectRoleCoOwner = "co_owner"
+)
+
+// ProjectInvitation es una invitación por email a un proyecto. Revocarla la borra (soft delete).
+type ProjectInvitation struct {
+	gorm.Model
+	ProjectID    uint      `gorm:"not null;index"`
+	Project      Project   `gorm:"foreignKey:ProjectID" json:"-"`
+	Email        string    `gorm:"not null;index"`
+	ProjectRole  string    `gorm:"not null;default:member"`
+	InvitedByID  uint      `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	AcceptedAt   *time.Time
+	AcceptedByID *uint
+}
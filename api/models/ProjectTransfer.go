@@ -0,0 +1,22 @@
+package models
+
+import "gorm.io/gorm"
+
+// Estados de una transferencia de propiedad
+const (
+	TransferPending   = "pending"
+	TransferAccepted  = "accepted"
+	TransferDeclined  = "declined"
+	TransferCancelled = "cancelled"
+)
+
+// ProjectTransfer es una propuesta del dueño actual para ceder el proyecto.
+// El proyecto cambia de dueño recién cuando el destinatario la acepta.
+type ProjectTransfer struct {
+	gorm.Model
+	ProjectID  uint    `gorm:"not null;index"`
+	Project    Project `gorm:"foreignKey:ProjectID"`
+	FromUserID uint    `gorm:"not null"`
+	ToUserID   uint    `gorm:"not null;index"`
+	Status     string  `gorm:"not null;default:pending"`
+}
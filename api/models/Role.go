@@ -4,7 +4,8 @@ import "gorm.io/gorm"
 
 type Role struct {
 	gorm.Model
-	Name string `gorm:"unique;not null" json:"name"`
+	Versioned
+	Name string `gorm:"not null;uniqueIndex:idx_roles_name,where:deleted_at IS NULL" json:"name"`
 	Users []User `gorm:"many2many:user_roles" json:"users,omitempty"`
 }
 
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// Setting es una opción de configuración que los administradores cambian en tiempo de ejecución
+type Setting struct {
+	Key       string `gorm:"primaryKey"`
+	Value     string `gorm:"not null"`
+	UpdatedAt time.Time
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// SigningKey es una clave asimétrica para firmar los JWT, identificada por su kid.
+// Al rotarla deja de firmar (RetiredAt) pero sigue publicada en el JWKS hasta
+// ExpiresAt para que los tokens ya emitidos se puedan verificar.
+type SigningKey struct {
+	KID        string `gorm:"primaryKey"`
+	Algorithm  string `gorm:"not null"`
+	PrivateKey string `gorm:"not null" json:"-"`
+	CreatedAt  time.Time
+	RetiredAt  *time.Time
+	ExpiresAt  *time.Time
+}
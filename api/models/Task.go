@@ -4,6 +4,7 @@ import "gorm.io/gorm"
 
 type Task struct {
 	gorm.Model
+	Versioned
 	Name string `gorm:"not null"`
 	Description string
 	Owner   User    `gorm:"foreignKey:OwnerID"`
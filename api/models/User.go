@@ -1,13 +1,41 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type User struct {
 	gorm.Model
-	Username string `gorm:"unique;not null"`
-	Password string `gorm:"not null"`
-	Email string `gorm:"unique;not null"`
+	Versioned
+	Username string `gorm:"not null;uniqueIndex:idx_users_username,where:deleted_at IS NULL"`
+	Password string `gorm:"not null" json:"-"`
+	Email string `gorm:"not null;uniqueIndex:idx_users_email,where:deleted_at IS NULL"`
+	EmailVerified bool `gorm:"not null;default:false"`
+	EmailVerifiedAt *time.Time
+	// SessionVersion se incrementa para invalidar todos los tokens emitidos hasta el momento
+	SessionVersion uint `gorm:"not null;default:0"`
+	// Autenticación en dos pasos (TOTP). El secreto se guarda al iniciar el alta
+	// y TOTPEnabled recién se activa cuando el usuario confirma con un código.
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `gorm:"not null;default:false"`
+	TOTPLastStep int64  `json:"-"`
+	// PasswordPolicyVersion es la versión de la política con la que se eligió la
+	// contraseña; si es anterior a la vigente hay que cambiarla en el próximo login
+	PasswordPolicyVersion uint `gorm:"not null;default:0" json:"-"`
+	PasswordChangedAt     *time.Time
+	// AuthProvider indica quién autentica la cuenta. Las cuentas externas no usan
+	// Password; ExternalSubject es el identificador del usuario en el proveedor.
+	AuthProvider    string  `gorm:"not null;default:local"`
+	ExternalSubject *string `gorm:"uniqueIndex:idx_users_external_subject,where:deleted_at IS NULL" json:"-"`
+	// Locale es el idioma preferido para los mensajes de la API; vacío usa Accept-Language
+	Locale string `gorm:"not null;default:''"`
 	Roles []Role `gorm:"many2many:user_roles"`
-}
\ No newline at end of file
+}
+
+const (
+	AuthProviderLocal = "local"
+	AuthProviderOIDC  = "oidc"
+	AuthProviderLDAP  = "ldap"
+)
\ No newline at end of file
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"github.com/golang-jwt/jwt"
+)
+
+// VerificationClaims viajan en el enlace de verificación de email.
+// Guardan el email para que el enlace deje de servir si el usuario lo cambia.
+type VerificationClaims struct {
+	UserID    uint
+	Email     string
+	TokenType string
+	jwt.StandardClaims
+}
@@ -0,0 +1,8 @@
+package models
+
+// Versioned se embebe en los recursos con control de concurrencia optimista:
+// Version se incrementa con cada cambio, asociaciones incluidas, y se expone
+// como ETag para los If-Match
+type Versioned struct {
+	Version uint `gorm:"not null;default:1" json:"version"`
+}
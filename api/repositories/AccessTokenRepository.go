@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+)
+
+// AccessTokenRepository guarda los tokens de acceso personal
+type AccessTokenRepository interface {
+	Create(ctx context.Context, token *models.PersonalAccessToken) error
+	// ListByUser devuelve los tokens del usuario, del más nuevo al más viejo
+	ListByUser(ctx context.Context, userId uint) ([]models.PersonalAccessToken, error)
+	FindByHash(ctx context.Context, hash string) (*models.PersonalAccessToken, error)
+	TouchLastUsed(ctx context.Context, id uint, at time.Time) error
+	// Delete borra el token solo si es del usuario
+	Delete(ctx context.Context, userId uint, id uint) error
+}
+
+type GormAccessTokenRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormAccessTokenRepository) Create(ctx context.Context, token *models.PersonalAccessToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+func (r *GormAccessTokenRepository) ListByUser(ctx context.Context, userId uint) ([]models.PersonalAccessToken, error) {
+	tokens := []models.PersonalAccessToken{}
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userId).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *GormAccessTokenRepository) FindByHash(ctx context.Context, hash string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	if err := r.db.WithContext(ctx).Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *GormAccessTokenRepository) TouchLastUsed(ctx context.Context, id uint, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.PersonalAccessToken{}).Where("id = ?", id).UpdateColumn("last_used_at", at).Error
+}
+
+func (r *GormAccessTokenRepository) Delete(ctx context.Context, userId uint, id uint) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userId).Delete(&models.PersonalAccessToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
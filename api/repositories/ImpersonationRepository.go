@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+)
+
+type ImpersonationRepository interface {
+	Create(ctx context.Context, impersonation *models.Impersonation) error
+	FindByID(ctx context.Context, id uint) (*models.Impersonation, error)
+	// FindWithRequests devuelve la suplantación con el id y username del administrador y los pedidos en orden
+	FindWithRequests(ctx context.Context, id uint) (*models.Impersonation, error)
+	// List devuelve las suplantaciones de un usuario (0 para todas) con el id y
+	// username del administrador, de la más nueva a la más vieja
+	List(ctx context.Context, userId uint) ([]models.Impersonation, error)
+	// End termina una suplantación en curso; si ya había terminado devuelve gorm.ErrRecordNotFound
+	End(ctx context.Context, id uint, at time.Time) error
+	AddRequest(ctx context.Context, request *models.ImpersonationRequest) error
+}
+
+type GormImpersonationRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormImpersonationRepository) Create(ctx context.Context, impersonation *models.Impersonation) error {
+	return r.db.WithContext(ctx).Create(impersonation).Error
+}
+
+func (r *GormImpersonationRepository) FindByID(ctx context.Context, id uint) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+	if err := r.db.WithContext(ctx).First(&impersonation, id).Error; err != nil {
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+func (r *GormImpersonationRepository) FindWithRequests(ctx context.Context, id uint) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+	if err := r.db.WithContext(ctx).Preload("Requests", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at")
+	}).First(&impersonation, id).Error; err != nil {
+		return nil, err
+	}
+	impersonations := []models.Impersonation{impersonation}
+	if err := r.loadAdmins(ctx, impersonations); err != nil {
+		return nil, err
+	}
+	return &impersonations[0], nil
+}
+
+func (r *GormImpersonationRepository) List(ctx context.Context, userId uint) ([]models.Impersonation, error) {
+	query := r.db.WithContext(ctx).Order("created_at DESC")
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+
+	impersonations := []models.Impersonation{}
+	if err := query.Find(&impersonations).Error; err != nil {
+		return nil, err
+	}
+	return impersonations, r.loadAdmins(ctx, impersonations)
+}
+
+// loadAdmins completa el id y el username de cada administrador, aunque su
+// cuenta esté borrada; el resto del usuario no sale de la base
+func (r *GormImpersonationRepository) loadAdmins(ctx context.Context, impersonations []models.Impersonation) error {
+	if len(impersonations) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(impersonations))
+	for _, impersonation := range impersonations {
+		ids = append(ids, impersonation.AdminID)
+	}
+
+	admins := []models.ImpersonationAdmin{}
+	if err := r.db.WithContext(ctx).Unscoped().Model(&models.User{}).
+		Select("id", "username").Where("id IN ?", ids).Find(&admins).Error; err != nil {
+		return err
+	}
+	byId := make(map[uint]models.ImpersonationAdmin, len(admins))
+	for _, admin := range admins {
+		byId[admin.ID] = admin
+	}
+	for i := range impersonations {
+		impersonations[i].Admin = byId[impersonations[i].AdminID]
+	}
+	return nil
+}
+
+func (r *GormImpersonationRepository) End(ctx context.Context, id uint, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.Impersonation{}).
+		Where("id = ? AND ended_at IS NULL", id).
+		Update("ended_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormImpersonationRepository) AddRequest(ctx context.Context, request *models.ImpersonationRequest) error {
+	return r.db.WithContext(ctx).Create(request).Error
+}
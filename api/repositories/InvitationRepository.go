@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+)
+
+type InvitationRepository interface {
+	Create(ctx context.Context, invitation *models.ProjectInvitation) error
+	FindByID(ctx context.Context, id uint) (*models.ProjectInvitation, error)
+	// FindInProject busca la invitación solo entre las del proyecto
+	FindInProject(ctx context.Context, projectId uint, id uint) (*models.ProjectInvitation, error)
+	// ListByProject devuelve las invitaciones del proyecto, de la más nueva a la más vieja
+	ListByProject(ctx context.Context, projectId uint) ([]models.ProjectInvitation, error)
+	// DeletePending borra las invitaciones sin aceptar del email en el proyecto
+	DeletePending(ctx context.Context, projectId uint, email string) error
+	Save(ctx context.Context, invitation *models.ProjectInvitation) error
+	Delete(ctx context.Context, id uint) error
+}
+
+type GormInvitationRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormInvitationRepository) Create(ctx context.Context, invitation *models.ProjectInvitation) error {
+	return r.db.WithContext(ctx).Create(invitation).Error
+}
+
+func (r *GormInvitationRepository) FindByID(ctx context.Context, id uint) (*models.ProjectInvitation, error) {
+	var invitation models.ProjectInvitation
+	if err := r.db.WithContext(ctx).First(&invitation, id).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *GormInvitationRepository) FindInProject(ctx context.Context, projectId uint, id uint) (*models.ProjectInvitation, error) {
+	var invitation models.ProjectInvitation
+	if err := r.db.WithContext(ctx).Where("id = ? AND project_id = ?", id, projectId).First(&invitation).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *GormInvitationRepository) ListByProject(ctx context.Context, projectId uint) ([]models.ProjectInvitation, error) {
+	invitations := []models.ProjectInvitation{}
+	if err := r.db.WithContext(ctx).Where("project_id = ?", projectId).Order("created_at DESC").Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (r *GormInvitationRepository) DeletePending(ctx context.Context, projectId uint, email string) error {
+	return r.db.WithContext(ctx).Where("project_id = ? AND email = ? AND accepted_at IS NULL", projectId, email).
+		Delete(&models.ProjectInvitation{}).Error
+}
+
+func (r *GormInvitationRepository) Save(ctx context.Context, invitation *models.ProjectInvitation) error {
+	return r.db.WithContext(ctx).Save(invitation).Error
+}
+
+func (r *GormInvitationRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.ProjectInvitation{}, id).Error
+}
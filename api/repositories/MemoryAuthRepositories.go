@@ -0,0 +1,455 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+)
+
+// findRow devuelve la primera fila, por ID, que cumple match
+func findRow[V any](rows map[uint]V, match func(row V) bool) (V, bool) {
+	for _, id := range sortedIDs(rows) {
+		if match(rows[id]) {
+			return rows[id], true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// newestFirst ordena por fecha de creación descendente y, si coincide, por ID
+func newestFirst(createdAt func(i int) time.Time, id func(i int) uint) func(i, j int) bool {
+	return func(i, j int) bool {
+		if !createdAt(i).Equal(createdAt(j)) {
+			return createdAt(i).After(createdAt(j))
+		}
+		return id(i) > id(j)
+	}
+}
+
+type MemoryInvitationRepository struct {
+	store *MemoryStore
+}
+
+func (r *MemoryInvitationRepository) Create(ctx context.Context, invitation *models.ProjectInvitation) error {
+	return r.Save(ctx, invitation)
+}
+
+func (r *MemoryInvitationRepository) find(match func(invitation models.ProjectInvitation) bool) (*models.ProjectInvitation, error) {
+	var invitation models.ProjectInvitation
+	err := r.store.with(func(d *memoryData) error {
+		var ok bool
+		if invitation, ok = findRow(d.invitations, match); !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *MemoryInvitationRepository) FindByID(ctx context.Context, id uint) (*models.ProjectInvitation, error) {
+	return r.find(func(invitation models.ProjectInvitation) bool { return invitation.ID == id })
+}
+
+func (r *MemoryInvitationRepository) FindInProject(ctx context.Context, projectId uint, id uint) (*models.ProjectInvitation, error) {
+	return r.find(func(invitation models.ProjectInvitation) bool {
+		return invitation.ID == id && invitation.ProjectID == projectId
+	})
+}
+
+func (r *MemoryInvitationRepository) ListByProject(ctx context.Context, projectId uint) ([]models.ProjectInvitation, error) {
+	invitations := []models.ProjectInvitation{}
+	err := r.store.with(func(d *memoryData) error {
+		for _, invitation := range d.invitations {
+			if invitation.ProjectID == projectId {
+				invitations = append(invitations, invitation)
+			}
+		}
+		sort.Slice(invitations, newestFirst(
+			func(i int) time.Time { return invitations[i].CreatedAt },
+			func(i int) uint { return invitations[i].ID },
+		))
+		return nil
+	})
+	return invitations, err
+}
+
+func (r *MemoryInvitationRepository) DeletePending(ctx context.Context, projectId uint, email string) error {
+	return r.store.with(func(d *memoryData) error {
+		for id, invitation := range d.invitations {
+			if invitation.ProjectID == projectId && invitation.Email == email && invitation.AcceptedAt == nil {
+				delete(d.invitations, id)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *MemoryInvitationRepository) Save(ctx context.Context, invitation *models.ProjectInvitation) error {
+	return r.store.with(func(d *memoryData) error {
+		d.stamp(&invitation.Model)
+		row := *invitation
+		row.Project = models.Project{}
+		d.invitations[invitation.ID] = row
+		return nil
+	})
+}
+
+func (r *MemoryInvitationRepository) Delete(ctx context.Context, id uint) error {
+	return r.store.with(func(d *memoryData) error {
+		delete(d.invitations, id)
+		return nil
+	})
+}
+
+type MemoryPasswordResetRepository struct {
+	store *MemoryStore
+}
+
+func (r *MemoryPasswordResetRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	return r.store.with(func(d *memoryData) error {
+		d.stamp(&token.Model)
+		d.passwordResets[token.ID] = *token
+		return nil
+	})
+}
+
+func (r *MemoryPasswordResetRepository) FindValid(ctx context.Context, hash string, now time.Time) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	err := r.store.with(func(d *memoryData) error {
+		var ok bool
+		token, ok = findRow(d.passwordResets, func(token models.PasswordResetToken) bool {
+			return token.TokenHash == hash && token.UsedAt == nil && token.ExpiresAt.After(now)
+		})
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *MemoryPasswordResetRepository) UseAll(ctx context.Context, userId uint, now time.Time) (int64, error) {
+	var used int64
+	err := r.store.with(func(d *memoryData) error {
+		for id, token := range d.passwordResets {
+			if token.UserID == userId && token.UsedAt == nil {
+				token.UsedAt = &now
+				d.passwordResets[id] = token
+				used++
+			}
+		}
+		return nil
+	})
+	return used, err
+}
+
+type MemoryAccessTokenRepository struct {
+	store *MemoryStore
+}
+
+// withScopeList carga ScopeList como lo hace el AfterFind del modelo
+func withScopeList(token models.PersonalAccessToken) models.PersonalAccessToken {
+	token.ScopeList = strings.Split(token.Scopes, ",")
+	return token
+}
+
+func (r *MemoryAccessTokenRepository) Create(ctx context.Context, token *models.PersonalAccessToken) error {
+	return r.store.with(func(d *memoryData) error {
+		d.stamp(&token.Model)
+		d.accessTokens[token.ID] = *token
+		return nil
+	})
+}
+
+func (r *MemoryAccessTokenRepository) ListByUser(ctx context.Context, userId uint) ([]models.PersonalAccessToken, error) {
+	tokens := []models.PersonalAccessToken{}
+	err := r.store.with(func(d *memoryData) error {
+		for _, token := range d.accessTokens {
+			if token.UserID == userId {
+				tokens = append(tokens, withScopeList(token))
+			}
+		}
+		sort.Slice(tokens, newestFirst(
+			func(i int) time.Time { return tokens[i].CreatedAt },
+			func(i int) uint { return tokens[i].ID },
+		))
+		return nil
+	})
+	return tokens, err
+}
+
+func (r *MemoryAccessTokenRepository) FindByHash(ctx context.Context, hash string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	err := r.store.with(func(d *memoryData) error {
+		var ok bool
+		token, ok = findRow(d.accessTokens, func(token models.PersonalAccessToken) bool { return token.TokenHash == hash })
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		token = withScopeList(token)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *MemoryAccessTokenRepository) TouchLastUsed(ctx context.Context, id uint, at time.Time) error {
+	return r.store.with(func(d *memoryData) error {
+		if token, ok := d.accessTokens[id]; ok {
+			token.LastUsedAt = &at
+			d.accessTokens[id] = token
+		}
+		return nil
+	})
+}
+
+func (r *MemoryAccessTokenRepository) Delete(ctx context.Context, userId uint, id uint) error {
+	return r.store.with(func(d *memoryData) error {
+		if token, ok := d.accessTokens[id]; !ok || token.UserID != userId {
+			return gorm.ErrRecordNotFound
+		}
+		delete(d.accessTokens, id)
+		return nil
+	})
+}
+
+type MemoryImpersonationRepository struct {
+	store *MemoryStore
+}
+
+func (r *MemoryImpersonationRepository) Create(ctx context.Context, impersonation *models.Impersonation) error {
+	return r.store.with(func(d *memoryData) error {
+		d.stamp(&impersonation.Model)
+		row := *impersonation
+		row.Admin, row.Requests = models.ImpersonationAdmin{}, nil
+		d.impersonations[impersonation.ID] = row
+		return nil
+	})
+}
+
+func (r *MemoryImpersonationRepository) FindByID(ctx context.Context, id uint) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+	err := r.store.with(func(d *memoryData) error {
+		var ok bool
+		if impersonation, ok = d.impersonations[id]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+func (r *MemoryImpersonationRepository) FindWithRequests(ctx context.Context, id uint) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+	err := r.store.with(func(d *memoryData) error {
+		var ok bool
+		if impersonation, ok = d.impersonations[id]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		impersonation.Admin = d.impersonationAdmin(impersonation.AdminID)
+		impersonation.Requests = []models.ImpersonationRequest{}
+		for _, requestId := range sortedIDs(d.impersonationRequests) {
+			if request := d.impersonationRequests[requestId]; request.ImpersonationID == id {
+				impersonation.Requests = append(impersonation.Requests, request)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+func (r *MemoryImpersonationRepository) List(ctx context.Context, userId uint) ([]models.Impersonation, error) {
+	impersonations := []models.Impersonation{}
+	err := r.store.with(func(d *memoryData) error {
+		for _, impersonation := range d.impersonations {
+			if userId == 0 || impersonation.UserID == userId {
+				impersonation.Admin = d.impersonationAdmin(impersonation.AdminID)
+				impersonations = append(impersonations, impersonation)
+			}
+		}
+		sort.Slice(impersonations, newestFirst(
+			func(i int) time.Time { return impersonations[i].CreatedAt },
+			func(i int) uint { return impersonations[i].ID },
+		))
+		return nil
+	})
+	return impersonations, err
+}
+
+// impersonationAdmin busca al administrador también entre los usuarios borrados
+func (d *memoryData) impersonationAdmin(id uint) models.ImpersonationAdmin {
+	admin, ok := d.users[id]
+	if !ok {
+		admin = d.deletedUsers[id]
+	}
+	return models.ImpersonationAdmin{ID: admin.ID, Username: admin.Username}
+}
+
+func (r *MemoryImpersonationRepository) End(ctx context.Context, id uint, at time.Time) error {
+	return r.store.with(func(d *memoryData) error {
+		impersonation, ok := d.impersonations[id]
+		if !ok || impersonation.EndedAt != nil {
+			return gorm.ErrRecordNotFound
+		}
+		impersonation.EndedAt = &at
+		d.impersonations[id] = impersonation
+		return nil
+	})
+}
+
+func (r *MemoryImpersonationRepository) AddRequest(ctx context.Context, request *models.ImpersonationRequest) error {
+	return r.store.with(func(d *memoryData) error {
+		if request.ID == 0 {
+			request.ID = d.newID()
+		}
+		if request.CreatedAt.IsZero() {
+			request.CreatedAt = time.Now()
+		}
+		d.impersonationRequests[request.ID] = *request
+		return nil
+	})
+}
+
+type MemoryRecoveryCodeRepository struct {
+	store *MemoryStore
+}
+
+func (d *memoryData) deleteRecoveryCodes(userId uint) {
+	for id, code := range d.recoveryCodes {
+		if code.UserID == userId {
+			delete(d.recoveryCodes, id)
+		}
+	}
+}
+
+func (r *MemoryRecoveryCodeRepository) Replace(ctx context.Context, userId uint, hashes []string) error {
+	return r.store.with(func(d *memoryData) error {
+		d.deleteRecoveryCodes(userId)
+		for _, hash := range hashes {
+			code := models.RecoveryCode{UserID: userId, CodeHash: hash}
+			d.stamp(&code.Model)
+			d.recoveryCodes[code.ID] = code
+		}
+		return nil
+	})
+}
+
+func (r *MemoryRecoveryCodeRepository) Use(ctx context.Context, userId uint, hash string, at time.Time) (bool, error) {
+	var used bool
+	err := r.store.with(func(d *memoryData) error {
+		code, ok := findRow(d.recoveryCodes, func(code models.RecoveryCode) bool {
+			return code.UserID == userId && code.CodeHash == hash && code.UsedAt == nil
+		})
+		if !ok {
+			return nil
+		}
+		code.UsedAt = &at
+		d.recoveryCodes[code.ID] = code
+		used = true
+		return nil
+	})
+	return used, err
+}
+
+func (r *MemoryRecoveryCodeRepository) DeleteByUser(ctx context.Context, userId uint) error {
+	return r.store.with(func(d *memoryData) error {
+		d.deleteRecoveryCodes(userId)
+		return nil
+	})
+}
+
+type MemorySettingRepository struct {
+	store *MemoryStore
+}
+
+func (r *MemorySettingRepository) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := r.store.with(func(d *memoryData) error {
+		var ok bool
+		if value, ok = d.settings[key]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	return value, err
+}
+
+func (r *MemorySettingRepository) Set(ctx context.Context, key string, value string) error {
+	return r.store.with(func(d *memoryData) error {
+		d.settings[key] = value
+		return nil
+	})
+}
+
+type MemorySigningKeyRepository struct {
+	store *MemoryStore
+}
+
+func (r *MemorySigningKeyRepository) ListValid(ctx context.Context, now time.Time) ([]models.SigningKey, error) {
+	keys := []models.SigningKey{}
+	err := r.store.with(func(d *memoryData) error {
+		for _, key := range d.signingKeys {
+			if key.ExpiresAt == nil || key.ExpiresAt.After(now) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+		return nil
+	})
+	return keys, err
+}
+
+func (r *MemorySigningKeyRepository) Create(ctx context.Context, key *models.SigningKey) error {
+	return r.store.with(func(d *memoryData) error {
+		if _, ok := d.signingKeys[key.KID]; ok {
+			return gorm.ErrDuplicatedKey
+		}
+		if key.CreatedAt.IsZero() {
+			key.CreatedAt = time.Now()
+		}
+		d.signingKeys[key.KID] = *key
+		return nil
+	})
+}
+
+func (r *MemorySigningKeyRepository) Retire(ctx context.Context, at time.Time, expiresAt time.Time) error {
+	return r.store.with(func(d *memoryData) error {
+		for kid, key := range d.signingKeys {
+			if key.RetiredAt == nil {
+				key.RetiredAt, key.ExpiresAt = &at, &expiresAt
+				d.signingKeys[kid] = key
+			}
+		}
+		return nil
+	})
+}
+
+func (r *MemorySigningKeyRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	return r.store.with(func(d *memoryData) error {
+		for kid, key := range d.signingKeys {
+			if key.ExpiresAt != nil && !key.ExpiresAt.After(now) {
+				delete(d.signingKeys, kid)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,1113 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+)
+
+// link es una fila de una tabla intermedia (user_roles, project_users, ...)
+type link struct {
+	left, right uint
+}
+
+type linkSet map[link]struct{}
+
+func (s linkSet) rights(left uint) []uint {
+	ids := []uint{}
+	for l := range s {
+		if l.left == left {
+			ids = append(ids, l.right)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (s linkSet) lefts(right uint) []uint {
+	ids := []uint{}
+	for l := range s {
+		if l.right == right {
+			ids = append(ids, l.left)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+type passwordEntry struct {
+	hash      string
+	createdAt time.Time
+}
+
+// memoryData son las "tablas" del MemoryStore. Las filas se guardan sin
+// asociaciones; las relaciones viven en los linkSet. Las filas borradas de
+// usuarios, roles, proyectos y tareas pasan a los mapas deleted*, como el soft
+// delete de GORM, y sus relaciones se conservan hasta purgarlas.
+type memoryData struct {
+	nextID                uint
+	users                 map[uint]models.User
+	roles                 map[uint]models.Role
+	projects              map[uint]models.Project
+	tasks                 map[uint]models.Task
+	deletedUsers          map[uint]models.User
+	deletedRoles          map[uint]models.Role
+	deletedProjects       map[uint]models.Project
+	deletedTasks          map[uint]models.Task
+	transfers             map[uint]models.ProjectTransfer
+	passwordHistory       map[uint][]passwordEntry // del más nuevo al más viejo
+	invitations           map[uint]models.ProjectInvitation
+	passwordResets        map[uint]models.PasswordResetToken
+	accessTokens          map[uint]models.PersonalAccessToken
+	impersonations        map[uint]models.Impersonation
+	impersonationRequests map[uint]models.ImpersonationRequest
+	recoveryCodes         map[uint]models.RecoveryCode
+	settings              map[string]string
+	signingKeys           map[string]models.SigningKey
+	userRoles             linkSet // usuario -> rol
+	projectUsers          linkSet // proyecto -> usuario
+	projectCoOwners       linkSet // proyecto -> usuario
+	projectTasks          linkSet // proyecto -> tarea
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		users:                 map[uint]models.User{},
+		roles:                 map[uint]models.Role{},
+		projects:              map[uint]models.Project{},
+		tasks:                 map[uint]models.Task{},
+		deletedUsers:          map[uint]models.User{},
+		deletedRoles:          map[uint]models.Role{},
+		deletedProjects:       map[uint]models.Project{},
+		deletedTasks:          map[uint]models.Task{},
+		transfers:             map[uint]models.ProjectTransfer{},
+		passwordHistory:       map[uint][]passwordEntry{},
+		invitations:           map[uint]models.ProjectInvitation{},
+		passwordResets:        map[uint]models.PasswordResetToken{},
+		accessTokens:          map[uint]models.PersonalAccessToken{},
+		impersonations:        map[uint]models.Impersonation{},
+		impersonationRequests: map[uint]models.ImpersonationRequest{},
+		recoveryCodes:         map[uint]models.RecoveryCode{},
+		settings:              map[string]string{},
+		signingKeys:           map[string]models.SigningKey{},
+		userRoles:             linkSet{},
+		projectUsers:          linkSet{},
+		projectCoOwners:       linkSet{},
+		projectTasks:          linkSet{},
+	}
+}
+
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	clone := make(map[K]V, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+func (d *memoryData) clone() *memoryData {
+	history := make(map[uint][]passwordEntry, len(d.passwordHistory))
+	for k, v := range d.passwordHistory {
+		history[k] = append([]passwordEntry(nil), v...)
+	}
+	return &memoryData{
+		nextID:                d.nextID,
+		users:                 cloneMap(d.users),
+		roles:                 cloneMap(d.roles),
+		projects:              cloneMap(d.projects),
+		tasks:                 cloneMap(d.tasks),
+		deletedUsers:          cloneMap(d.deletedUsers),
+		deletedRoles:          cloneMap(d.deletedRoles),
+		deletedProjects:       cloneMap(d.deletedProjects),
+		deletedTasks:          cloneMap(d.deletedTasks),
+		transfers:             cloneMap(d.transfers),
+		passwordHistory:       history,
+		invitations:           cloneMap(d.invitations),
+		passwordResets:        cloneMap(d.passwordResets),
+		accessTokens:          cloneMap(d.accessTokens),
+		impersonations:        cloneMap(d.impersonations),
+		impersonationRequests: cloneMap(d.impersonationRequests),
+		recoveryCodes:         cloneMap(d.recoveryCodes),
+		settings:              cloneMap(d.settings),
+		signingKeys:           cloneMap(d.signingKeys),
+		userRoles:             cloneMap(d.userRoles),
+		projectUsers:          cloneMap(d.projectUsers),
+		projectCoOwners:       cloneMap(d.projectCoOwners),
+		projectTasks:          cloneMap(d.projectTasks),
+	}
+}
+
+func (d *memoryData) newID() uint {
+	d.nextID++
+	return d.nextID
+}
+
+// stamp completa ID y fechas como lo haría GORM al crear o guardar
+func (d *memoryData) stamp(model *gorm.Model) {
+	now := time.Now()
+	if model.ID == 0 {
+		model.ID = d.newID()
+	} else if model.ID > d.nextID {
+		d.nextID = model.ID
+	}
+	if model.CreatedAt.IsZero() {
+		model.CreatedAt = now
+	}
+	model.UpdatedAt = now
+}
+
+// saveVersionedRow hace en memoria lo mismo que saveVersioned: save solo corre
+// si stored, la versión guardada, es la que se leyó, y la versión se incrementa
+func saveVersionedRow(stored uint, version *uint, save func() error) error {
+	read := *version
+	if stored != read {
+		return ErrStaleVersion
+	}
+	*version = read + 1
+	if err := save(); err != nil {
+		*version = read
+		return err
+	}
+	return nil
+}
+
+// softDelete pasa la fila de active a deleted marcando DeletedAt, como el soft delete de GORM
+func softDelete[V any](active map[uint]V, deleted map[uint]V, id uint, model func(*V) *gorm.Model) {
+	row, ok := active[id]
+	if !ok {
+		return
+	}
+	model(&row).DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	deleted[id] = row
+	delete(active, id)
+}
+
+func userModel(user *models.User) *gorm.Model          { return &user.Model }
+func roleModel(role *models.Role) *gorm.Model          { return &role.Model }
+func projectModel(project *models.Project) *gorm.Model { return &project.Model }
+func taskModel(task *models.Task) *gorm.Model          { return &task.Model }
+
+func (d *memoryData) bumpUser(id uint) {
+	if user, ok := d.users[id]; ok {
+		user.Version++
+		d.users[id] = user
+	}
+}
+
+func (d *memoryData) bumpProject(id uint) {
+	if project, ok := d.projects[id]; ok {
+		project.Version++
+		d.projects[id] = project
+	}
+}
+
+// MemoryStore implementa Store en memoria, para probar servicios y handlers sin
+// base de datos. Las transacciones restauran el estado anterior si fallan, pero
+// no aíslan a quienes usan el store en paralelo.
+type MemoryStore struct {
+	mu   sync.Mutex
+	data *memoryData
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: newMemoryData()}
+}
+
+func (s *MemoryStore) Users() UserRepository {
+	return &MemoryUserRepository{store: s}
+}
+
+func (s *MemoryStore) Roles() RoleRepository {
+	return &MemoryRoleRepository{store: s}
+}
+
+func (s *MemoryStore) Projects() ProjectRepository {
+	return &MemoryProjectRepository{store: s}
+}
+
+func (s *MemoryStore) Tasks() TaskRepository {
+	return &MemoryTaskRepository{store: s}
+}
+
+func (s *MemoryStore) Invitations() InvitationRepository {
+	return &MemoryInvitationRepository{store: s}
+}
+
+func (s *MemoryStore) PasswordResets() PasswordResetRepository {
+	return &MemoryPasswordResetRepository{store: s}
+}
+
+func (s *MemoryStore) AccessTokens() AccessTokenRepository {
+	return &MemoryAccessTokenRepository{store: s}
+}
+
+func (s *MemoryStore) Impersonations() ImpersonationRepository {
+	return &MemoryImpersonationRepository{store: s}
+}
+
+func (s *MemoryStore) RecoveryCodes() RecoveryCodeRepository {
+	return &MemoryRecoveryCodeRepository{store: s}
+}
+
+func (s *MemoryStore) Settings() SettingRepository {
+	return &MemorySettingRepository{store: s}
+}
+
+func (s *MemoryStore) SigningKeys() SigningKeyRepository {
+	return &MemorySigningKeyRepository{store: s}
+}
+
+func (s *MemoryStore) Trash() TrashRepository {
+	return &MemoryTrashRepository{store: s}
+}
+
+func (s *MemoryStore) Transaction(ctx context.Context, fn func(store Store) error) error {
+	s.mu.Lock()
+	snapshot := s.data.clone()
+	s.mu.Unlock()
+
+	if err := fn(s); err != nil {
+		s.mu.Lock()
+		s.data = snapshot
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// with ejecuta fn con los datos bloqueados
+func (s *MemoryStore) with(fn func(d *memoryData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(s.data)
+}
+
+func (d *memoryData) loadUser(id uint) (models.User, bool) {
+	user, ok := d.users[id]
+	if !ok {
+		return user, false
+	}
+	user.Roles = []models.Role{}
+	for _, roleId := range d.userRoles.rights(id) {
+		if role, ok := d.roles[roleId]; ok {
+			user.Roles = append(user.Roles, role)
+		}
+	}
+	return user, true
+}
+
+func (d *memoryData) loadProject(id uint) (models.Project, bool) {
+	project, ok := d.projects[id]
+	if !ok {
+		return project, false
+	}
+	project.Owner = d.users[project.OwnerID]
+	project.Users = d.usersByIDs(d.projectUsers.rights(id))
+	project.CoOwners = d.usersByIDs(d.projectCoOwners.rights(id))
+	project.Tasks = []models.Task{}
+	for _, taskId := range d.projectTasks.rights(id) {
+		if task, ok := d.tasks[taskId]; ok {
+			project.Tasks = append(project.Tasks, task)
+		}
+	}
+	return project, true
+}
+
+func (d *memoryData) usersByIDs(ids []uint) []models.User {
+	users := []models.User{}
+	for _, id := range ids {
+		if user, ok := d.users[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+func sortedIDs[V any](m map[uint]V) []uint {
+	ids := make([]uint, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// saveUserRow guarda la fila y, como GORM, agrega (sin quitar) los roles cargados
+func (d *memoryData) saveUserRow(user *models.User) error {
+	for id, other := range d.users {
+		if id != user.ID && (other.Email == user.Email || other.Username == user.Username) {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	d.stamp(&user.Model)
+	row := *user
+	row.Roles = nil
+	d.users[user.ID] = row
+	for _, role := range user.Roles {
+		d.userRoles[link{user.ID, role.ID}] = struct{}{}
+	}
+	return nil
+}
+
+type MemoryUserRepository struct {
+	store *MemoryStore
+}
+
+func (r *MemoryUserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	err := r.store.with(func(d *memoryData) error {
+		var ok bool
+		if user, ok = d.loadUser(id); !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findUser(func(user models.User) bool { return user.Email == email })
+}
+
+// findUser devuelve el primer usuario, por ID, que cumple match
+func (r *MemoryUserRepository) findUser(match func(user models.User) bool) (*models.User, error) {
+	var user models.User
+	err := r.store.with(func(d *memoryData) error {
+		for _, id := range sortedIDs(d.users) {
+			if match(d.users[id]) {
+				user, _ = d.loadUser(id)
+				return nil
+			}
+		}
+		return gorm.ErrRecordNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) FindByExternalSubject(ctx context.Context, provider string, subject string) (*models.User, error) {
+	return r.findUser(func(user models.User) bool {
+		return user.AuthProvider == provider && user.ExternalSubject != nil && *user.ExternalSubject == subject
+	})
+}
+
+func (r *MemoryUserRepository) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.findUser(func(user models.User) bool { return user.Username == username })
+}
+
+func (r *MemoryUserRepository) FindByIDs(ctx context.Context, ids []uint) ([]models.User, error) {
+	var users []models.User
+	err := r.store.with(func(d *memoryData) error {
+		users = d.usersByIDs(ids)
+		return nil
+	})
+	return users, err
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	err := r.store.with(func(d *memoryData) error {
+		for _, id := range sortedIDs(d.users) {
+			user, _ := d.loadUser(id)
+			users = append(users, user)
+		}
+		return nil
+	})
+	return users, err
+}
+
+func (r *MemoryUserRepository) ListByProvider(ctx context.Context, provider string) ([]models.User, error) {
+	users := []models.User{}
+	err := r.store.with(func(d *memoryData) error {
+		for _, id := range sortedIDs(d.users) {
+			if d.users[id].AuthProvider == provider {
+				users = append(users, d.users[id])
+			}
+		}
+		return nil
+	})
+	return users, err
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	return r.store.with(func(d *memoryData) error {
+		user.Version = 1
+		return d.saveUserRow(user)
+	})
+}
+
+func (r *MemoryUserRepository) Save(ctx context.Context, user *models.User) error {
+	return r.store.with(func(d *memoryData) error {
+		return saveVersionedRow(d.users[user.ID].Version, &user.Version, func() error {
+			return d.saveUserRow(user)
+		})
+	})
+}
+
+func (r *MemoryUserRepository) Delete(ctx context.Context, id uint) error {
+	return r.store.with(func(d *memoryData) error {
+		softDelete(d.users, d.deletedUsers, id, userModel)
+		return nil
+	})
+}
+
+func (r *MemoryUserRepository) AddRole(ctx context.Context, userId uint, role *models.Role) error {
+	return r.store.with(func(d *memoryData) error {
+		d.userRoles[link{userId, role.ID}] = struct{}{}
+		d.bumpUser(userId)
+		return nil
+	})
+}
+
+func (r *MemoryUserRepository) RemoveRole(ctx context.Context, userId uint, roleId uint) error {
+	return r.store.with(func(d *memoryData) error {
+		delete(d.userRoles, link{userId, roleId})
+		d.bumpUser(userId)
+		return nil
+	})
+}
+
+func (r *MemoryUserRepository) ReplaceRoles(ctx context.Context, userId uint, roles []models.Role) error {
+	return r.store.with(func(d *memoryData) error {
+		for _, roleId := range d.userRoles.rights(userId) {
+			delete(d.userRoles, link{userId, roleId})
+		}
+		for _, role := range roles {
+			d.userRoles[link{userId, role.ID}] = struct{}{}
+		}
+		d.bumpUser(userId)
+		return nil
+	})
+}
+
+func (r *MemoryUserRepository) RevokeSessions(ctx context.Context, id uint) error {
+	return r.store.with(func(d *memoryData) error {
+		if user, ok := d.users[id]; ok {
+			user.SessionVersion++
+			d.users[id] = user
+		}
+		return nil
+	})
+}
+
+func (r *MemoryUserRepository) AdvanceTOTPStep(ctx context.Context, id uint, step int64) (bool, error) {
+	var advanced bool
+	err := r.store.with(func(d *memoryData) error {
+		user, ok := d.users[id]
+		if !ok || user.TOTPLastStep >= step {
+			return nil
+		}
+		user.TOTPLastStep = step
+		d.users[id] = user
+		advanced = true
+		return nil
+	})
+	return advanced, err
+}
+
+func (r *MemoryUserRepository) UpdatePassword(ctx context.Context, user *models.User, revokeSessions bool) error {
+	return r.store.with(func(d *memoryData) error {
+		row, ok := d.users[user.ID]
+		if !ok {
+			return nil
+		}
+		row.Password = user.Password
+		row.PasswordChangedAt = user.PasswordChangedAt
+		row.PasswordPolicyVersion = user.PasswordPolicyVersion
+		if revokeSessions {
+			row.SessionVersion++
+		}
+		row.Version++
+		row.UpdatedAt = time.Now()
+		d.users[user.ID] = row
+		user.Version = row.Version
+		return nil
+	})
+}
+
+func (r *MemoryUserRepository) ExpirePassword(ctx context.Context, id uint) error {
+	return r.store.with(func(d *memoryData) error {
+		row, ok := d.users[id]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		row.PasswordPolicyVersion = 0
+		d.users[id] = row
+		return nil
+	})
+}
+
+func (r *MemoryUserRepository) PasswordHistory(ctx context.Context, userId uint, limit int) ([]string, error) {
+	hashes := []string{}
+	err := r.store.with(func(d *memoryData) error {
+		for _, entry := range d.passwordHistory[userId] {
+			if len(hashes) >= limit {
+				break
+			}
+			hashes = append(hashes, entry.hash)
+		}
+		return nil
+	})
+	return hashes, err
+}
+
+func (r *MemoryUserRepository) AddPasswordHistory(ctx context.Context, userId uint, hash string, keep int) error {
+	return r.store.with(func(d *memoryData) error {
+		history := append([]passwordEntry{{hash: hash, createdAt: time.Now()}}, d.passwordHistory[userId]...)
+		if keep < 0 {
+			keep = 0
+		}
+		if len(history) > keep {
+			history = history[:keep]
+		}
+		d.passwordHistory[userId] = history
+		return nil
+	})
+}
+
+type MemoryRoleRepository struct {
+	store *MemoryStore
+}
+
+func (r *MemoryRoleRepository) FindByID(ctx context.Context, id uint) (*models.Role, error) {
+	var role models.Role
+	err := r.store.with(func(d *memoryData) error {
+		var ok bool
+		if role, ok = d.roles[id]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *MemoryRoleRepository) FindByName(ctx context.Context, name string) (*models.Role, error) {
+	var role models.Role
+	err := r.store.with(func(d *memoryData) error {
+		for _, id := range sortedIDs(d.roles) {
+			if d.roles[id].Name == name {
+				role = d.roles[id]
+				return nil
+			}
+		}
+		return gorm.ErrRecordNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *MemoryRoleRepository) FindByIDs(ctx context.Context, ids []uint) ([]models.Role, error) {
+	roles := []models.Role{}
+	err := r.store.with(func(d *memoryData) error {
+		for _, id := range ids {
+			if role, ok := d.roles[id]; ok {
+				roles = append(roles, role)
+			}
+		}
+		return nil
+	})
+	return roles, err
+}
+
+func (r *MemoryRoleRepository) FindByNames(ctx context.Context, names []string) ([]models.Role, error) {
+	roles := []models.Role{}
+	err := r.store.with(func(d *memoryData) error {
+		for _, id := range sortedIDs(d.roles) {
+			for _, name := range names {
+				if d.roles[id].Name == name {
+					roles = append(roles, d.roles[id])
+					break
+				}
+			}
+		}
+		return nil
+	})
+	return roles, err
+}
+
+func (r *MemoryRoleRepository) List(ctx context.Context) ([]models.Role, error) {
+	var roles []models.Role
+	err := r.store.with(func(d *memoryData) error {
+		for _, id := range sortedIDs(d.roles) {
+			roles = append(roles, d.roles[id])
+		}
+		return nil
+	})
+	return roles, err
+}
+
+func (d *memoryData) saveRoleRow(role *models.Role) error {
+	for id, other := range d.roles {
+		if id != role.ID && other.Name == role.Name {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	d.stamp(&role.Model)
+	row := *role
+	row.Users = nil
+	d.roles[role.ID] = row
+	return nil
+}
+
+func (r *MemoryRoleRepository) Create(ctx context.Context, role *models.Role) error {
+	return r.store.with(func(d *memoryData) error {
+		role.Version = 1
+		return d.saveRoleRow(role)
+	})
+}
+
+func (r *MemoryRoleRepository) Save(ctx context.Context, role *models.Role) error {
+	return r.store.with(func(d *memoryData) error {
+		return saveVersionedRow(d.roles[role.ID].Version, &role.Version, func() error {
+			return d.saveRoleRow(role)
+		})
+	})
+}
+
+func (r *MemoryRoleRepository) Delete(ctx context.Context, id uint) error {
+	return r.store.with(func(d *memoryData) error {
+		softDelete(d.roles, d.deletedRoles, id, roleModel)
+		return nil
+	})
+}
+
+type MemoryProjectRepository struct {
+	store *MemoryStore
+}
+
+func (r *MemoryProjectRepository) FindByID(ctx context.Context, id uint) (*models.Project, error) {
+	var project models.Project
+	err := r.store.with(func(d *memoryData) error {
+		var ok bool
+		if project, ok = d.loadProject(id); !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+func (r *MemoryProjectRepository) FindByName(ctx context.Context, name string) (*models.Project, error) {
+	var project models.Project
+	err := r.store.with(func(d *memoryData) error {
+		for _, id := range sortedIDs(d.projects) {
+			if d.projects[id].Name == name {
+				project = d.projects[id]
+				return nil
+			}
+		}
+		return gorm.ErrRecordNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+func (r *MemoryProjectRepository) list(filter func(d *memoryData, project models.Project) bool) ([]models.Project, error) {
+	var projects []models.Project
+	err := r.store.with(func(d *memoryData) error {
+		for _, id := range sortedIDs(d.projects) {
+			if filter(d, d.projects[id]) {
+				project, _ := d.loadProject(id)
+				projects = append(projects, project)
+			}
+		}
+		return nil
+	})
+	return projects, err
+}
+
+func (r *MemoryProjectRepository) List(ctx context.Context) ([]models.Project, error) {
+	return r.list(func(d *memoryData, project models.Project) bool { return true })
+}
+
+func (r *MemoryProjectRepository) ListByUser(ctx context.Context, userId uint) ([]models.Project, error) {
+	return r.list(func(d *memoryData, project models.Project) bool {
+		_, coOwner := d.projectCoOwners[link{project.ID, userId}]
+		return project.OwnerID == userId || coOwner
+	})
+}
+
+// saveProjectRow guarda la fila y, como GORM, agrega (sin quitar) las asociaciones cargadas
+func (d *memoryData) saveProjectRow(project *models.Project) error {
+	for id, other := range d.projects {
+		if id != project.ID && other.Name == project.Name {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	d.stamp(&project.Model)
+	row := *project
+	row.Owner, row.Users, row.CoOwners, row.Tasks = models.User{}, nil, nil, nil
+	d.projects[project.ID] = row
+	for _, user := range project.Users {
+		d.projectUsers[link{project.ID, user.ID}] = struct{}{}
+	}
+	for _, user := range project.CoOwners {
+		d.projectCoOwners[link{project.ID, user.ID}] = struct{}{}
+	}
+	for _, task := range project.Tasks {
+		d.projectTasks[link{project.ID, task.ID}] = struct{}{}
+	}
+	return nil
+}
+
+func (r *MemoryProjectRepository) Create(ctx context.Context, project *models.Project) error {
+	return r.store.with(func(d *memoryData) error {
+		project.Version = 1
+		return d.saveProjectRow(project)
+	})
+}
+
+func (r *MemoryProjectRepository) Save(ctx context.Context, project *models.Project) error {
+	return r.store.with(func(d *memoryData) error {
+		return saveVersionedRow(d.projects[project.ID].Version, &project.Version, func() error {
+			return d.saveProjectRow(project)
+		})
+	})
+}
+
+func (r *MemoryProjectRepository) Delete(ctx context.Context, ids ...uint) error {
+	return r.store.with(func(d *memoryData) error {
+		for _, id := range ids {
+			softDelete(d.projects, d.deletedProjects, id, projectModel)
+		}
+		return nil
+	})
+}
+
+func (r *MemoryProjectRepository) setLink(set func(d *memoryData) linkSet, l link, add bool) error {
+	return r.store.with(func(d *memoryData) error {
+		if add {
+			set(d)[l] = struct{}{}
+		} else {
+			delete(set(d), l)
+		}
+		// En todos los enlaces de proyecto el de la izquierda es el proyecto
+		d.bumpProject(l.left)
+		return nil
+	})
+}
+
+func projectUsers(d *memoryData) linkSet    { return d.projectUsers }
+func projectCoOwners(d *memoryData) linkSet { return d.projectCoOwners }
+func projectTasks(d *memoryData) linkSet    { return d.projectTasks }
+
+func (r *MemoryProjectRepository) AddUser(ctx context.Context, projectId uint, user *models.User) error {
+	return r.setLink(projectUsers, link{projectId, user.ID}, true)
+}
+
+func (r *MemoryProjectRepository) RemoveUser(ctx context.Context, projectId uint, userId uint) error {
+	return r.setLink(projectUsers, link{projectId, userId}, false)
+}
+
+func (r *MemoryProjectRepository) AddTask(ctx context.Context, projectId uint, task *models.Task) error {
+	return r.setLink(projectTasks, link{projectId, task.ID}, true)
+}
+
+func (r *MemoryProjectRepository) RemoveTask(ctx context.Context, projectId uint, taskId uint) error {
+	return r.setLink(projectTasks, link{projectId, taskId}, false)
+}
+
+func (r *MemoryProjectRepository) AddCoOwner(ctx context.Context, projectId uint, user *models.User) error {
+	return r.setLink(projectCoOwners, link{projectId, user.ID}, true)
+}
+
+func (r *MemoryProjectRepository) RemoveCoOwner(ctx context.Context, projectId uint, userId uint) error {
+	return r.setLink(projectCoOwners, link{projectId, userId}, false)
+}
+
+func (r *MemoryProjectRepository) IsCoOwner(ctx context.Context, projectId uint, userId uint) (bool, error) {
+	var found bool
+	err := r.store.with(func(d *memoryData) error {
+		_, found = d.projectCoOwners[link{projectId, userId}]
+		return nil
+	})
+	return found, err
+}
+
+func (r *MemoryProjectRepository) ids(fn func(d *memoryData) []uint) ([]uint, error) {
+	var ids []uint
+	err := r.store.with(func(d *memoryData) error {
+		ids = fn(d)
+		return nil
+	})
+	return ids, err
+}
+
+func (r *MemoryProjectRepository) IDsOwnedBy(ctx context.Context, userId uint) ([]uint, error) {
+	return r.ids(func(d *memoryData) []uint {
+		ids := []uint{}
+		for _, id := range sortedIDs(d.projects) {
+			if d.projects[id].OwnerID == userId {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	})
+}
+
+func (r *MemoryProjectRepository) IDsWithMember(ctx context.Context, userId uint) ([]uint, error) {
+	return r.ids(func(d *memoryData) []uint { return d.projectUsers.lefts(userId) })
+}
+
+func (r *MemoryProjectRepository) IDsCoOwnedBy(ctx context.Context, userId uint) ([]uint, error) {
+	return r.ids(func(d *memoryData) []uint { return d.projectCoOwners.lefts(userId) })
+}
+
+func (r *MemoryProjectRepository) IDsWithTask(ctx context.Context, taskId uint) ([]uint, error) {
+	return r.ids(func(d *memoryData) []uint { return d.projectTasks.lefts(taskId) })
+}
+
+func (r *MemoryProjectRepository) MemberIDs(ctx context.Context, projectId uint) ([]uint, error) {
+	return r.ids(func(d *memoryData) []uint { return d.projectUsers.rights(projectId) })
+}
+
+func (d *memoryData) activeProjectTasks(projectId uint) []uint {
+	ids := []uint{}
+	for _, taskId := range d.projectTasks.rights(projectId) {
+		if _, ok := d.tasks[taskId]; ok {
+			ids = append(ids, taskId)
+		}
+	}
+	return ids
+}
+
+func (r *MemoryProjectRepository) TaskIDs(ctx context.Context, projectId uint) ([]uint, error) {
+	return r.ids(func(d *memoryData) []uint { return d.activeProjectTasks(projectId) })
+}
+
+func (r *MemoryProjectRepository) OrphanedTaskIDs(ctx context.Context, projectId uint) ([]uint, error) {
+	return r.ids(func(d *memoryData) []uint {
+		ids := []uint{}
+		for _, taskId := range d.activeProjectTasks(projectId) {
+			orphan := true
+			for _, otherId := range d.projectTasks.lefts(taskId) {
+				if _, active := d.projects[otherId]; active && otherId != projectId {
+					orphan = false
+					break
+				}
+			}
+			if orphan {
+				ids = append(ids, taskId)
+			}
+		}
+		return ids
+	})
+}
+
+func (r *MemoryProjectRepository) ReassignOwner(ctx context.Context, fromUserId uint, toUserId uint) error {
+	return r.store.with(func(d *memoryData) error {
+		for id, project := range d.projects {
+			if project.OwnerID == fromUserId {
+				project.OwnerID = toUserId
+				project.Version++
+				d.projects[id] = project
+			}
+		}
+		return nil
+	})
+}
+
+func (r *MemoryProjectRepository) SetOwner(ctx context.Context, projectId uint, userId uint) error {
+	return r.store.with(func(d *memoryData) error {
+		project, ok := d.projects[projectId]
+		if !ok {
+			return nil
+		}
+		project.OwnerID = userId
+		project.Version++
+		d.projects[projectId] = project
+		delete(d.projectCoOwners, link{projectId, userId})
+		return nil
+	})
+}
+
+func (r *MemoryProjectRepository) CreateTransfer(ctx context.Context, transfer *models.ProjectTransfer) error {
+	return r.store.with(func(d *memoryData) error {
+		d.stamp(&transfer.Model)
+		row := *transfer
+		row.Project = models.Project{}
+		d.transfers[transfer.ID] = row
+		return nil
+	})
+}
+
+func (r *MemoryProjectRepository) CancelPendingTransfers(ctx context.Context, projectId uint) (int64, error) {
+	var cancelled int64
+	err := r.store.with(func(d *memoryData) error {
+		for id, transfer := range d.transfers {
+			if transfer.ProjectID == projectId && transfer.Status == models.TransferPending {
+				transfer.Status = models.TransferCancelled
+				d.transfers[id] = transfer
+				cancelled++
+			}
+		}
+		return nil
+	})
+	return cancelled, err
+}
+
+func (r *MemoryProjectRepository) ListIncomingTransfers(ctx context.Context, userId uint) ([]models.ProjectTransfer, error) {
+	transfers := []models.ProjectTransfer{}
+	err := r.store.with(func(d *memoryData) error {
+		for _, id := range sortedIDs(d.transfers) {
+			transfer := d.transfers[id]
+			if transfer.ToUserID == userId && transfer.Status == models.TransferPending {
+				transfer.Project = d.projects[transfer.ProjectID]
+				transfers = append(transfers, transfer)
+			}
+		}
+		return nil
+	})
+	return transfers, err
+}
+
+func (r *MemoryProjectRepository) FindTransfer(ctx context.Context, transferId uint, toUserId uint) (*models.ProjectTransfer, error) {
+	var transfer models.ProjectTransfer
+	err := r.store.with(func(d *memoryData) error {
+		var ok bool
+		if transfer, ok = d.transfers[transferId]; !ok || transfer.ToUserID != toUserId {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+func (r *MemoryProjectRepository) UpdateTransferStatus(ctx context.Context, transfer *models.ProjectTransfer, status string) error {
+	return r.store.with(func(d *memoryData) error {
+		row, ok := d.transfers[transfer.ID]
+		if !ok {
+			return nil
+		}
+		row.Status = status
+		d.transfers[transfer.ID] = row
+		transfer.Status = status
+		return nil
+	})
+}
+
+type MemoryTaskRepository struct {
+	store *MemoryStore
+}
+
+func (r *MemoryTaskRepository) FindByID(ctx context.Context, id uint) (*models.Task, error) {
+	var task models.Task
+	err := r.store.with(func(d *memoryData) error {
+		var ok bool
+		if task, ok = d.tasks[id]; !ok {
+			return gorm.ErrRecordNotFound
+		}
+		task.Owner = d.users[task.OwnerID]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func (r *MemoryTaskRepository) FindByIDs(ctx context.Context, ids []uint) ([]models.Task, error) {
+	tasks := []models.Task{}
+	err := r.store.with(func(d *memoryData) error {
+		for _, id := range ids {
+			if task, ok := d.tasks[id]; ok {
+				tasks = append(tasks, task)
+			}
+		}
+		return nil
+	})
+	return tasks, err
+}
+
+func (r *MemoryTaskRepository) List(ctx context.Context) ([]models.Task, error) {
+	var tasks []models.Task
+	err := r.store.with(func(d *memoryData) error {
+		for _, id := range sortedIDs(d.tasks) {
+			task := d.tasks[id]
+			task.Owner = d.users[task.OwnerID]
+			tasks = append(tasks, task)
+		}
+		return nil
+	})
+	return tasks, err
+}
+
+func (d *memoryData) saveTaskRow(task *models.Task) error {
+	d.stamp(&task.Model)
+	row := *task
+	row.Owner, row.Project = models.User{}, nil
+	d.tasks[task.ID] = row
+	return nil
+}
+
+func (r *MemoryTaskRepository) Create(ctx context.Context, task *models.Task) error {
+	return r.store.with(func(d *memoryData) error {
+		task.Version = 1
+		return d.saveTaskRow(task)
+	})
+}
+
+func (r *MemoryTaskRepository) Save(ctx context.Context, task *models.Task) error {
+	return r.store.with(func(d *memoryData) error {
+		return saveVersionedRow(d.tasks[task.ID].Version, &task.Version, func() error {
+			return d.saveTaskRow(task)
+		})
+	})
+}
+
+func (r *MemoryTaskRepository) Delete(ctx context.Context, ids ...uint) error {
+	return r.store.with(func(d *memoryData) error {
+		for _, id := range ids {
+			softDelete(d.tasks, d.deletedTasks, id, taskModel)
+		}
+		return nil
+	})
+}
+
+func (r *MemoryTaskRepository) IDsOwnedBy(ctx context.Context, userId uint) ([]uint, error) {
+	ids := []uint{}
+	err := r.store.with(func(d *memoryData) error {
+		for _, id := range sortedIDs(d.tasks) {
+			if d.tasks[id].OwnerID == userId {
+				ids = append(ids, id)
+			}
+		}
+		return nil
+	})
+	return ids, err
+}
+
+func (r *MemoryTaskRepository) ReassignOwner(ctx context.Context, fromUserId uint, toUserId uint) error {
+	return r.store.with(func(d *memoryData) error {
+		for id, task := range d.tasks {
+			if task.OwnerID == fromUserId {
+				task.OwnerID = toUserId
+				task.Version++
+				d.tasks[id] = task
+			}
+		}
+		return nil
+	})
+}
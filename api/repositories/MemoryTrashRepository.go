@@ -0,0 +1,250 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+)
+
+// memoryTrashTable es un recurso de la papelera: sus filas activas y las borradas
+type memoryTrashTable[V any] struct {
+	active  map[uint]V
+	deleted map[uint]V
+	model   func(*V) *gorm.Model
+	// owner es nil en los recursos sin dueño
+	owner func(row V) uint
+	// conflicts indica si dos filas comparten un valor único; nil si no hay índices únicos
+	conflicts func(a, b V) bool
+	// cleanup borra las relaciones y registros que dependen de la fila al purgarla
+	cleanup func(id uint)
+}
+
+func (t *memoryTrashTable[V]) ownedBy(row V, ownerId uint) bool {
+	if ownerId == 0 {
+		return true
+	}
+	return t.owner != nil && t.owner(row) == ownerId
+}
+
+func (t *memoryTrashTable[V]) list(ownerId uint) interface{} {
+	rows := []V{}
+	for _, row := range t.deleted {
+		if t.ownedBy(row, ownerId) {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return t.model(&rows[i]).DeletedAt.Time.After(t.model(&rows[j]).DeletedAt.Time)
+	})
+	return &rows
+}
+
+func (t *memoryTrashTable[V]) find(id uint, ownerId uint) (interface{}, error) {
+	row, ok := t.deleted[id]
+	if !ok || !t.ownedBy(row, ownerId) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &row, nil
+}
+
+func (t *memoryTrashTable[V]) restore(id uint) error {
+	row, ok := t.deleted[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if t.conflicts != nil {
+		for _, other := range t.active {
+			if t.conflicts(row, other) {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+	}
+	t.model(&row).DeletedAt = gorm.DeletedAt{}
+	t.active[id] = row
+	delete(t.deleted, id)
+	return nil
+}
+
+func (t *memoryTrashTable[V]) deletedBefore(cutoff time.Time) []uint {
+	ids := []uint{}
+	for _, id := range sortedIDs(t.deleted) {
+		row := t.deleted[id]
+		if t.model(&row).DeletedAt.Time.Before(cutoff) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (t *memoryTrashTable[V]) purge(id uint) error {
+	if _, ok := t.deleted[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(t.deleted, id)
+	t.cleanup(id)
+	return nil
+}
+
+// trashTable da acceso a las operaciones de la papelera de un recurso sin importar su tipo
+type trashTable interface {
+	list(ownerId uint) interface{}
+	find(id uint, ownerId uint) (interface{}, error)
+	restore(id uint) error
+	deletedBefore(cutoff time.Time) []uint
+	purge(id uint) error
+}
+
+func (s linkSet) removeLeft(left uint) {
+	for l := range s {
+		if l.left == left {
+			delete(s, l)
+		}
+	}
+}
+
+func (s linkSet) removeRight(right uint) {
+	for l := range s {
+		if l.right == right {
+			delete(s, l)
+		}
+	}
+}
+
+func (d *memoryData) trashTable(resource string) (trashTable, bool) {
+	switch resource {
+	case "users":
+		return &memoryTrashTable[models.User]{
+			active: d.users, deleted: d.deletedUsers, model: userModel,
+			conflicts: func(a, b models.User) bool { return a.Email == b.Email || a.Username == b.Username },
+			cleanup:   d.purgeUser,
+		}, true
+	case "roles":
+		return &memoryTrashTable[models.Role]{
+			active: d.roles, deleted: d.deletedRoles, model: roleModel,
+			conflicts: func(a, b models.Role) bool { return a.Name == b.Name },
+			cleanup:   d.userRoles.removeRight,
+		}, true
+	case "projects":
+		return &memoryTrashTable[models.Project]{
+			active: d.projects, deleted: d.deletedProjects, model: projectModel,
+			owner:     func(project models.Project) uint { return project.OwnerID },
+			conflicts: func(a, b models.Project) bool { return a.Name == b.Name },
+			cleanup:   d.purgeProject,
+		}, true
+	case "tasks":
+		return &memoryTrashTable[models.Task]{
+			active: d.tasks, deleted: d.deletedTasks, model: taskModel,
+			owner:   func(task models.Task) uint { return task.OwnerID },
+			cleanup: d.projectTasks.removeRight,
+		}, true
+	}
+	return nil, false
+}
+
+func (d *memoryData) purgeUser(id uint) {
+	d.userRoles.removeLeft(id)
+	d.projectUsers.removeRight(id)
+	d.projectCoOwners.removeRight(id)
+	for transferId, transfer := range d.transfers {
+		if transfer.FromUserID == id || transfer.ToUserID == id {
+			delete(d.transfers, transferId)
+		}
+	}
+	for tokenId, token := range d.passwordResets {
+		if token.UserID == id {
+			delete(d.passwordResets, tokenId)
+		}
+	}
+	for tokenId, token := range d.accessTokens {
+		if token.UserID == id {
+			delete(d.accessTokens, tokenId)
+		}
+	}
+	d.deleteRecoveryCodes(id)
+	delete(d.passwordHistory, id)
+}
+
+func (d *memoryData) purgeProject(id uint) {
+	d.projectUsers.removeLeft(id)
+	d.projectCoOwners.removeLeft(id)
+	d.projectTasks.removeLeft(id)
+	for transferId, transfer := range d.transfers {
+		if transfer.ProjectID == id {
+			delete(d.transfers, transferId)
+		}
+	}
+	for invitationId, invitation := range d.invitations {
+		if invitation.ProjectID == id {
+			delete(d.invitations, invitationId)
+		}
+	}
+}
+
+type MemoryTrashRepository struct {
+	store *MemoryStore
+}
+
+// table ejecuta fn con la tabla del recurso; un recurso desconocido no tiene elementos
+func (r *MemoryTrashRepository) table(resource string, fn func(table trashTable) error) error {
+	return r.store.with(func(d *memoryData) error {
+		table, ok := d.trashTable(resource)
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		return fn(table)
+	})
+}
+
+func (r *MemoryTrashRepository) List(ctx context.Context, resource string, ownerId uint) (interface{}, error) {
+	var items interface{}
+	err := r.table(resource, func(table trashTable) error {
+		items = table.list(ownerId)
+		return nil
+	})
+	return items, err
+}
+
+func (r *MemoryTrashRepository) Find(ctx context.Context, resource string, id uint, ownerId uint) (interface{}, error) {
+	var item interface{}
+	err := r.table(resource, func(table trashTable) error {
+		var err error
+		item, err = table.find(id, ownerId)
+		return err
+	})
+	return item, err
+}
+
+func (r *MemoryTrashRepository) Restore(ctx context.Context, resource string, id uint) error {
+	return r.table(resource, func(table trashTable) error { return table.restore(id) })
+}
+
+func (r *MemoryTrashRepository) DeletedBefore(ctx context.Context, resource string, cutoff time.Time) ([]uint, error) {
+	var ids []uint
+	err := r.table(resource, func(table trashTable) error {
+		ids = table.deletedBefore(cutoff)
+		return nil
+	})
+	return ids, err
+}
+
+func (r *MemoryTrashRepository) OwnsResources(ctx context.Context, userId uint) (bool, error) {
+	var owns bool
+	err := r.store.with(func(d *memoryData) error {
+		isOwner := func(project models.Project) bool { return project.OwnerID == userId }
+		isTaskOwner := func(task models.Task) bool { return task.OwnerID == userId }
+		_, active := findRow(d.projects, isOwner)
+		_, deleted := findRow(d.deletedProjects, isOwner)
+		_, activeTask := findRow(d.tasks, isTaskOwner)
+		_, deletedTask := findRow(d.deletedTasks, isTaskOwner)
+		owns = active || deleted || activeTask || deletedTask
+		return nil
+	})
+	return owns, err
+}
+
+func (r *MemoryTrashRepository) Purge(ctx context.Context, resource string, id uint) error {
+	return r.table(resource, func(table trashTable) error { return table.purge(id) })
+}
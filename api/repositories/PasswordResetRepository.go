@@ -0,0 +1,41 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+)
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, token *models.PasswordResetToken) error
+	// FindValid busca por su hash un token que no se usó y no venció
+	FindValid(ctx context.Context, hash string, now time.Time) (*models.PasswordResetToken, error)
+	// UseAll marca como usados los tokens pendientes del usuario y devuelve cuántos eran
+	UseAll(ctx context.Context, userId uint, now time.Time) (int64, error)
+}
+
+type GormPasswordResetRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormPasswordResetRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+func (r *GormPasswordResetRepository) FindValid(ctx context.Context, hash string, now time.Time) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	if err := r.db.WithContext(ctx).Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hash, now).
+		First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *GormPasswordResetRepository) UseAll(ctx context.Context, userId uint, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userId).
+		Update("used_at", now)
+	return result.RowsAffected, result.Error
+}
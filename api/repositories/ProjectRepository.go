@@ -0,0 +1,249 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+)
+
+type ProjectRepository interface {
+	// FindByID devuelve el proyecto con dueño, co-dueños, miembros y tareas
+	FindByID(ctx context.Context, id uint) (*models.Project, error)
+	FindByName(ctx context.Context, name string) (*models.Project, error)
+	List(ctx context.Context) ([]models.Project, error)
+	// ListByUser devuelve los proyectos de los que el usuario es dueño o co-dueño
+	ListByUser(ctx context.Context, userId uint) ([]models.Project, error)
+	Create(ctx context.Context, project *models.Project) error
+	Save(ctx context.Context, project *models.Project) error
+	Delete(ctx context.Context, ids ...uint) error
+
+	AddUser(ctx context.Context, projectId uint, user *models.User) error
+	RemoveUser(ctx context.Context, projectId uint, userId uint) error
+	AddTask(ctx context.Context, projectId uint, task *models.Task) error
+	RemoveTask(ctx context.Context, projectId uint, taskId uint) error
+	AddCoOwner(ctx context.Context, projectId uint, user *models.User) error
+	RemoveCoOwner(ctx context.Context, projectId uint, userId uint) error
+	IsCoOwner(ctx context.Context, projectId uint, userId uint) (bool, error)
+
+	IDsOwnedBy(ctx context.Context, userId uint) ([]uint, error)
+	IDsWithMember(ctx context.Context, userId uint) ([]uint, error)
+	IDsCoOwnedBy(ctx context.Context, userId uint) ([]uint, error)
+	// IDsWithTask devuelve los proyectos que incluyen la tarea
+	IDsWithTask(ctx context.Context, taskId uint) ([]uint, error)
+	MemberIDs(ctx context.Context, projectId uint) ([]uint, error)
+	// TaskIDs devuelve las tareas activas del proyecto y OrphanedTaskIDs las
+	// que no están en ningún otro proyecto activo
+	TaskIDs(ctx context.Context, projectId uint) ([]uint, error)
+	OrphanedTaskIDs(ctx context.Context, projectId uint) ([]uint, error)
+	// ReassignOwner pasa todos los proyectos de un dueño a otro, papelera incluida
+	ReassignOwner(ctx context.Context, fromUserId uint, toUserId uint) error
+	// SetOwner cambia el dueño del proyecto; si era co-dueño deja de serlo
+	SetOwner(ctx context.Context, projectId uint, userId uint) error
+
+	CreateTransfer(ctx context.Context, transfer *models.ProjectTransfer) error
+	// CancelPendingTransfers cancela las transferencias pendientes del proyecto y devuelve cuántas eran
+	CancelPendingTransfers(ctx context.Context, projectId uint) (int64, error)
+	ListIncomingTransfers(ctx context.Context, userId uint) ([]models.ProjectTransfer, error)
+	FindTransfer(ctx context.Context, transferId uint, toUserId uint) (*models.ProjectTransfer, error)
+	UpdateTransferStatus(ctx context.Context, transfer *models.ProjectTransfer, status string) error
+}
+
+type GormProjectRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormProjectRepository) withAssociations(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Preload("Users").Preload("Tasks").Preload("Owner").Preload("CoOwners")
+}
+
+func (r *GormProjectRepository) FindByID(ctx context.Context, id uint) (*models.Project, error) {
+	var project models.Project
+	if err := r.withAssociations(ctx).First(&project, id).Error; err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+func (r *GormProjectRepository) FindByName(ctx context.Context, name string) (*models.Project, error) {
+	var project models.Project
+	if err := r.db.WithContext(ctx).Where("name = ?", name).First(&project).Error; err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+func (r *GormProjectRepository) List(ctx context.Context) ([]models.Project, error) {
+	var projects []models.Project
+	if err := r.withAssociations(ctx).Find(&projects).Error; err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+func (r *GormProjectRepository) ListByUser(ctx context.Context, userId uint) ([]models.Project, error) {
+	var projects []models.Project
+	if err := r.withAssociations(ctx).
+		Where("owner_id = ? OR id IN (SELECT project_id FROM project_co_owners WHERE user_id = ?)", userId, userId).
+		Find(&projects).Error; err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+func (r *GormProjectRepository) Create(ctx context.Context, project *models.Project) error {
+	return r.db.WithContext(ctx).Create(project).Error
+}
+
+func (r *GormProjectRepository) Save(ctx context.Context, project *models.Project) error {
+	return saveVersioned(r.db.WithContext(ctx), project, &project.Version)
+}
+
+func (r *GormProjectRepository) Delete(ctx context.Context, ids ...uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Delete(&models.Project{}, ids).Error
+}
+
+func (r *GormProjectRepository) association(ctx context.Context, projectId uint, name string) *gorm.Association {
+	project := models.Project{Model: gorm.Model{ID: projectId}}
+	return r.db.WithContext(ctx).Model(&project).Association(name)
+}
+
+// changeAssociation aplica fn sobre una asociación del proyecto y le sube la versión
+func (r *GormProjectRepository) changeAssociation(ctx context.Context, projectId uint, name string, fn func(association *gorm.Association) error) error {
+	if err := fn(r.association(ctx, projectId, name)); err != nil {
+		return err
+	}
+	return bumpVersion(r.db.WithContext(ctx), &models.Project{}, projectId)
+}
+
+func (r *GormProjectRepository) AddUser(ctx context.Context, projectId uint, user *models.User) error {
+	return r.changeAssociation(ctx, projectId, "Users", func(association *gorm.Association) error {
+		return association.Append(user)
+	})
+}
+
+func (r *GormProjectRepository) RemoveUser(ctx context.Context, projectId uint, userId uint) error {
+	return r.changeAssociation(ctx, projectId, "Users", func(association *gorm.Association) error {
+		return association.Delete(&models.User{Model: gorm.Model{ID: userId}})
+	})
+}
+
+func (r *GormProjectRepository) AddTask(ctx context.Context, projectId uint, task *models.Task) error {
+	return r.changeAssociation(ctx, projectId, "Tasks", func(association *gorm.Association) error {
+		return association.Append(task)
+	})
+}
+
+func (r *GormProjectRepository) RemoveTask(ctx context.Context, projectId uint, taskId uint) error {
+	return r.changeAssociation(ctx, projectId, "Tasks", func(association *gorm.Association) error {
+		return association.Delete(&models.Task{Model: gorm.Model{ID: taskId}})
+	})
+}
+
+func (r *GormProjectRepository) AddCoOwner(ctx context.Context, projectId uint, user *models.User) error {
+	return r.changeAssociation(ctx, projectId, "CoOwners", func(association *gorm.Association) error {
+		return association.Append(user)
+	})
+}
+
+func (r *GormProjectRepository) RemoveCoOwner(ctx context.Context, projectId uint, userId uint) error {
+	return r.changeAssociation(ctx, projectId, "CoOwners", func(association *gorm.Association) error {
+		return association.Delete(&models.User{Model: gorm.Model{ID: userId}})
+	})
+}
+
+func (r *GormProjectRepository) IsCoOwner(ctx context.Context, projectId uint, userId uint) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Table("project_co_owners").
+		Where("project_id = ? AND user_id = ?", projectId, userId).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *GormProjectRepository) IDsOwnedBy(ctx context.Context, userId uint) ([]uint, error) {
+	return pluckIds(r.db.WithContext(ctx).Model(&models.Project{}).Where("owner_id = ?", userId), "id")
+}
+
+func (r *GormProjectRepository) IDsWithMember(ctx context.Context, userId uint) ([]uint, error) {
+	return pluckIds(r.db.WithContext(ctx).Table("project_users").Where("user_id = ?", userId), "project_id")
+}
+
+func (r *GormProjectRepository) IDsCoOwnedBy(ctx context.Context, userId uint) ([]uint, error) {
+	return pluckIds(r.db.WithContext(ctx).Table("project_co_owners").Where("user_id = ?", userId), "project_id")
+}
+
+func (r *GormProjectRepository) IDsWithTask(ctx context.Context, taskId uint) ([]uint, error) {
+	return pluckIds(r.db.WithContext(ctx).Table("project_tasks").Where("task_id = ?", taskId), "project_id")
+}
+
+func (r *GormProjectRepository) MemberIDs(ctx context.Context, projectId uint) ([]uint, error) {
+	return pluckIds(r.db.WithContext(ctx).Table("project_users").Where("project_id = ?", projectId), "user_id")
+}
+
+func (r *GormProjectRepository) projectTasks(ctx context.Context, projectId uint) *gorm.DB {
+	return r.db.WithContext(ctx).Table("project_tasks").
+		Joins("JOIN tasks ON tasks.id = project_tasks.task_id AND tasks.deleted_at IS NULL").
+		Where("project_tasks.project_id = ?", projectId)
+}
+
+func (r *GormProjectRepository) TaskIDs(ctx context.Context, projectId uint) ([]uint, error) {
+	return pluckIds(r.projectTasks(ctx, projectId), "project_tasks.task_id")
+}
+
+func (r *GormProjectRepository) OrphanedTaskIDs(ctx context.Context, projectId uint) ([]uint, error) {
+	return pluckIds(r.projectTasks(ctx, projectId).
+		Where(`NOT EXISTS (SELECT 1 FROM project_tasks other
+			JOIN projects ON projects.id = other.project_id AND projects.deleted_at IS NULL
+			WHERE other.task_id = project_tasks.task_id AND other.project_id <> ?)`, projectId), "project_tasks.task_id")
+}
+
+func (r *GormProjectRepository) ReassignOwner(ctx context.Context, fromUserId uint, toUserId uint) error {
+	return r.db.WithContext(ctx).Unscoped().Model(&models.Project{}).Where("owner_id = ?", fromUserId).
+		Updates(map[string]interface{}{"owner_id": toUserId, "version": gorm.Expr("version + 1")}).Error
+}
+
+func (r *GormProjectRepository) SetOwner(ctx context.Context, projectId uint, userId uint) error {
+	db := r.db.WithContext(ctx)
+	if err := db.Model(&models.Project{}).Where("id = ?", projectId).
+		Updates(map[string]interface{}{"owner_id": userId, "version": gorm.Expr("version + 1")}).Error; err != nil {
+		return err
+	}
+	return db.Exec("DELETE FROM project_co_owners WHERE project_id = ? AND user_id = ?", projectId, userId).Error
+}
+
+func (r *GormProjectRepository) CreateTransfer(ctx context.Context, transfer *models.ProjectTransfer) error {
+	return r.db.WithContext(ctx).Create(transfer).Error
+}
+
+func (r *GormProjectRepository) CancelPendingTransfers(ctx context.Context, projectId uint) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&models.ProjectTransfer{}).
+		Where("project_id = ? AND status = ?", projectId, models.TransferPending).
+		Update("status", models.TransferCancelled)
+	return result.RowsAffected, result.Error
+}
+
+func (r *GormProjectRepository) ListIncomingTransfers(ctx context.Context, userId uint) ([]models.ProjectTransfer, error) {
+	var transfers []models.ProjectTransfer
+	if err := r.db.WithContext(ctx).Preload("Project").
+		Where("to_user_id = ? AND status = ?", userId, models.TransferPending).
+		Find(&transfers).Error; err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+func (r *GormProjectRepository) FindTransfer(ctx context.Context, transferId uint, toUserId uint) (*models.ProjectTransfer, error) {
+	var transfer models.ProjectTransfer
+	if err := r.db.WithContext(ctx).Where("id = ? AND to_user_id = ?", transferId, toUserId).First(&transfer).Error; err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+func (r *GormProjectRepository) UpdateTransferStatus(ctx context.Context, transfer *models.ProjectTransfer, status string) error {
+	return r.db.WithContext(ctx).Model(transfer).Update("status", status).Error
+}
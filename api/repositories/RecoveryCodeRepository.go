@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+)
+
+// RecoveryCodeRepository guarda los hashes de los códigos de recuperación de 2FA
+type RecoveryCodeRepository interface {
+	// Replace borra los códigos del usuario y guarda hashes en su lugar
+	Replace(ctx context.Context, userId uint, hashes []string) error
+	// Use marca el código como usado; devuelve false si no existe o ya se usó
+	Use(ctx context.Context, userId uint, hash string, at time.Time) (bool, error)
+	DeleteByUser(ctx context.Context, userId uint) error
+}
+
+type GormRecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormRecoveryCodeRepository) Replace(ctx context.Context, userId uint, hashes []string) error {
+	if err := r.DeleteByUser(ctx, userId); err != nil {
+		return err
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	codes := make([]models.RecoveryCode, 0, len(hashes))
+	for _, hash := range hashes {
+		codes = append(codes, models.RecoveryCode{UserID: userId, CodeHash: hash})
+	}
+	return r.db.WithContext(ctx).Create(&codes).Error
+}
+
+// Use filtra por used_at para que dos pedidos simultáneos no usen el mismo código
+func (r *GormRecoveryCodeRepository) Use(ctx context.Context, userId uint, hash string, at time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, hash).
+		Update("used_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *GormRecoveryCodeRepository) DeleteByUser(ctx context.Context, userId uint) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userId).Delete(&models.RecoveryCode{}).Error
+}
@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+)
+
+type RoleRepository interface {
+	FindByID(ctx context.Context, id uint) (*models.Role, error)
+	FindByName(ctx context.Context, name string) (*models.Role, error)
+	FindByIDs(ctx context.Context, ids []uint) ([]models.Role, error)
+	FindByNames(ctx context.Context, names []string) ([]models.Role, error)
+	List(ctx context.Context) ([]models.Role, error)
+	Create(ctx context.Context, role *models.Role) error
+	Save(ctx context.Context, role *models.Role) error
+	Delete(ctx context.Context, id uint) error
+}
+
+type GormRoleRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormRoleRepository) FindByID(ctx context.Context, id uint) (*models.Role, error) {
+	var role models.Role
+	if err := r.db.WithContext(ctx).First(&role, id).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *GormRoleRepository) FindByName(ctx context.Context, name string) (*models.Role, error) {
+	var role models.Role
+	if err := r.db.WithContext(ctx).First(&role, "name = ?", name).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *GormRoleRepository) FindByIDs(ctx context.Context, ids []uint) ([]models.Role, error) {
+	roles := []models.Role{}
+	if len(ids) == 0 {
+		return roles, nil
+	}
+	if err := r.db.WithContext(ctx).Find(&roles, ids).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *GormRoleRepository) FindByNames(ctx context.Context, names []string) ([]models.Role, error) {
+	roles := []models.Role{}
+	if len(names) == 0 {
+		return roles, nil
+	}
+	if err := r.db.WithContext(ctx).Where("name IN ?", names).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *GormRoleRepository) List(ctx context.Context) ([]models.Role, error) {
+	var roles []models.Role
+	if err := r.db.WithContext(ctx).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *GormRoleRepository) Create(ctx context.Context, role *models.Role) error {
+	return r.db.WithContext(ctx).Create(role).Error
+}
+
+func (r *GormRoleRepository) Save(ctx context.Context, role *models.Role) error {
+	return saveVersioned(r.db.WithContext(ctx), role, &role.Version)
+}
+
+func (r *GormRoleRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.Role{}, id).Error
+}
@@ -0,0 +1,36 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SettingRepository guarda las opciones que se cambian en tiempo de ejecución
+type SettingRepository interface {
+	// Get devuelve el valor de la opción o gorm.ErrRecordNotFound si no está definida
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string) error
+}
+
+type GormSettingRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormSettingRepository) Get(ctx context.Context, key string) (string, error) {
+	var setting models.Setting
+	if err := r.db.WithContext(ctx).First(&setting, "key = ?", key).Error; err != nil {
+		return "", err
+	}
+	return setting.Value, nil
+}
+
+func (r *GormSettingRepository) Set(ctx context.Context, key string, value string) error {
+	setting := models.Setting{Key: key, Value: value}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&setting).Error
+}
@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+)
+
+// SigningKeyRepository guarda las claves con las que se firman los JWT
+type SigningKeyRepository interface {
+	// ListValid devuelve las claves que no expiraron, de la más vieja a la más nueva
+	ListValid(ctx context.Context, now time.Time) ([]models.SigningKey, error)
+	Create(ctx context.Context, key *models.SigningKey) error
+	// Retire deja de usar las claves activas para firmar; se aceptan hasta expiresAt
+	Retire(ctx context.Context, at time.Time, expiresAt time.Time) error
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+type GormSigningKeyRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormSigningKeyRepository) ListValid(ctx context.Context, now time.Time) ([]models.SigningKey, error) {
+	keys := []models.SigningKey{}
+	if err := r.db.WithContext(ctx).Where("expires_at IS NULL OR expires_at > ?", now).
+		Order("created_at").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *GormSigningKeyRepository) Create(ctx context.Context, key *models.SigningKey) error {
+	return r.db.WithContext(ctx).Create(key).Error
+}
+
+func (r *GormSigningKeyRepository) Retire(ctx context.Context, at time.Time, expiresAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.SigningKey{}).Where("retired_at IS NULL").
+		Updates(map[string]interface{}{"retired_at": at, "expires_at": expiresAt}).Error
+}
+
+func (r *GormSigningKeyRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	return r.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&models.SigningKey{}).Error
+}
@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Los repositorios devuelven gorm.ErrRecordNotFound cuando no existe el registro
+// y gorm.ErrDuplicatedKey cuando se viola un índice único, sea cual sea la
+// implementación, para que servicios y handlers no dependan de cuál se usa.
+
+// Store agrupa los repositorios y permite usarlos dentro de una transacción
+type Store interface {
+	Users() UserRepository
+	Roles() RoleRepository
+	Projects() ProjectRepository
+	Tasks() TaskRepository
+	Invitations() InvitationRepository
+	PasswordResets() PasswordResetRepository
+	AccessTokens() AccessTokenRepository
+	Impersonations() ImpersonationRepository
+	RecoveryCodes() RecoveryCodeRepository
+	Settings() SettingRepository
+	SigningKeys() SigningKeyRepository
+	Trash() TrashRepository
+	// Transaction ejecuta fn con repositorios que comparten la transacción;
+	// si fn devuelve error no queda ningún cambio
+	Transaction(ctx context.Context, fn func(store Store) error) error
+}
+
+// GormStore implementa Store sobre una conexión (o transacción) de GORM
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+func (s *GormStore) Users() UserRepository {
+	return &GormUserRepository{db: s.db}
+}
+
+func (s *GormStore) Roles() RoleRepository {
+	return &GormRoleRepository{db: s.db}
+}
+
+func (s *GormStore) Projects() ProjectRepository {
+	return &GormProjectRepository{db: s.db}
+}
+
+func (s *GormStore) Tasks() TaskRepository {
+	return &GormTaskRepository{db: s.db}
+}
+
+func (s *GormStore) Invitations() InvitationRepository {
+	return &GormInvitationRepository{db: s.db}
+}
+
+func (s *GormStore) PasswordResets() PasswordResetRepository {
+	return &GormPasswordResetRepository{db: s.db}
+}
+
+func (s *GormStore) AccessTokens() AccessTokenRepository {
+	return &GormAccessTokenRepository{db: s.db}
+}
+
+func (s *GormStore) Impersonations() ImpersonationRepository {
+	return &GormImpersonationRepository{db: s.db}
+}
+
+func (s *GormStore) RecoveryCodes() RecoveryCodeRepository {
+	return &GormRecoveryCodeRepository{db: s.db}
+}
+
+func (s *GormStore) Settings() SettingRepository {
+	return &GormSettingRepository{db: s.db}
+}
+
+func (s *GormStore) SigningKeys() SigningKeyRepository {
+	return &GormSigningKeyRepository{db: s.db}
+}
+
+func (s *GormStore) Trash() TrashRepository {
+	return &GormTrashRepository{db: s.db}
+}
+
+func (s *GormStore) Transaction(ctx context.Context, fn func(store Store) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(NewGormStore(tx))
+	})
+}
+
+// pluckIds ejecuta la consulta y devuelve la columna indicada como lista de IDs
+func pluckIds(query *gorm.DB, column string) ([]uint, error) {
+	ids := []uint{}
+	if err := query.Pluck(column, &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
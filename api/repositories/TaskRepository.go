@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+)
+
+type TaskRepository interface {
+	// FindByID y List devuelven las tareas con su dueño
+	FindByID(ctx context.Context, id uint) (*models.Task, error)
+	FindByIDs(ctx context.Context, ids []uint) ([]models.Task, error)
+	List(ctx context.Context) ([]models.Task, error)
+	Create(ctx context.Context, task *models.Task) error
+	Save(ctx context.Context, task *models.Task) error
+	Delete(ctx context.Context, ids ...uint) error
+	IDsOwnedBy(ctx context.Context, userId uint) ([]uint, error)
+	// ReassignOwner pasa todas las tareas de un dueño a otro, papelera incluida
+	ReassignOwner(ctx context.Context, fromUserId uint, toUserId uint) error
+}
+
+type GormTaskRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormTaskRepository) FindByID(ctx context.Context, id uint) (*models.Task, error) {
+	var task models.Task
+	if err := r.db.WithContext(ctx).Preload("Owner").First(&task, id).Error; err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func (r *GormTaskRepository) FindByIDs(ctx context.Context, ids []uint) ([]models.Task, error) {
+	tasks := []models.Task{}
+	if len(ids) == 0 {
+		return tasks, nil
+	}
+	if err := r.db.WithContext(ctx).Find(&tasks, ids).Error; err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (r *GormTaskRepository) List(ctx context.Context) ([]models.Task, error) {
+	var tasks []models.Task
+	if err := r.db.WithContext(ctx).Preload("Owner").Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (r *GormTaskRepository) Create(ctx context.Context, task *models.Task) error {
+	return r.db.WithContext(ctx).Create(task).Error
+}
+
+func (r *GormTaskRepository) Save(ctx context.Context, task *models.Task) error {
+	return saveVersioned(r.db.WithContext(ctx), task, &task.Version)
+}
+
+func (r *GormTaskRepository) Delete(ctx context.Context, ids ...uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Delete(&models.Task{}, ids).Error
+}
+
+func (r *GormTaskRepository) IDsOwnedBy(ctx context.Context, userId uint) ([]uint, error) {
+	return pluckIds(r.db.WithContext(ctx).Model(&models.Task{}).Where("owner_id = ?", userId), "id")
+}
+
+func (r *GormTaskRepository) ReassignOwner(ctx context.Context, fromUserId uint, toUserId uint) error {
+	return r.db.WithContext(ctx).Unscoped().Model(&models.Task{}).Where("owner_id = ?", fromUserId).
+		Updates(map[string]interface{}{"owner_id": toUserId, "version": gorm.Expr("version + 1")}).Error
+}
@@ -0,0 +1,185 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TrashRepository accede a los elementos borrados (soft delete) de los recursos
+// "users", "roles", "projects" y "tasks". Un ownerId distinto de 0 limita la
+// búsqueda a los elementos de ese usuario, solo tiene sentido en proyectos y tareas.
+type TrashRepository interface {
+	// List devuelve un puntero al slice de elementos borrados, del último borrado al primero
+	List(ctx context.Context, resource string, ownerId uint) (interface{}, error)
+	Find(ctx context.Context, resource string, id uint, ownerId uint) (interface{}, error)
+	// Restore quita la marca de borrado; si ya hay un elemento activo con los
+	// mismos valores únicos devuelve gorm.ErrDuplicatedKey
+	Restore(ctx context.Context, resource string, id uint) error
+	// DeletedBefore devuelve los IDs de los elementos borrados antes de cutoff
+	DeletedBefore(ctx context.Context, resource string, cutoff time.Time) ([]uint, error)
+	// OwnsResources indica si el usuario es dueño de proyectos o tareas, borrados o no
+	OwnsResources(ctx context.Context, userId uint) (bool, error)
+	// Purge elimina definitivamente el elemento junto con sus filas en las
+	// tablas intermedias y los registros que dependen de él
+	Purge(ctx context.Context, resource string, id uint) error
+}
+
+// Modelos de cada recurso de la papelera
+var trashModels = map[string]func() interface{}{
+	"users":    func() interface{} { return &[]models.User{} },
+	"roles":    func() interface{} { return &[]models.Role{} },
+	"projects": func() interface{} { return &[]models.Project{} },
+	"tasks":    func() interface{} { return &[]models.Task{} },
+}
+
+type GormTrashRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormTrashRepository) query(ctx context.Context, ownerId uint) *gorm.DB {
+	query := r.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL")
+	if ownerId != 0 {
+		query = query.Where("owner_id = ?", ownerId)
+	}
+	return query
+}
+
+func (r *GormTrashRepository) List(ctx context.Context, resource string, ownerId uint) (interface{}, error) {
+	items := trashModels[resource]()
+	if err := r.query(ctx, ownerId).Order("deleted_at DESC").Find(items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *GormTrashRepository) Find(ctx context.Context, resource string, id uint, ownerId uint) (interface{}, error) {
+	items := trashModels[resource]()
+	if err := r.query(ctx, ownerId).Where("id = ?", id).Find(items).Error; err != nil {
+		return nil, err
+	}
+
+	list := itemsOf(items)
+	if len(list) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return list[0], nil
+}
+
+func (r *GormTrashRepository) Restore(ctx context.Context, resource string, id uint) error {
+	item, err := r.Find(ctx, resource, id, 0)
+	if err != nil {
+		return err
+	}
+
+	db := r.db.WithContext(ctx)
+	var active *gorm.DB
+	switch item := item.(type) {
+	case *models.User:
+		active = db.Model(&models.User{}).Where("email = ? OR username = ?", item.Email, item.Username)
+	case *models.Role:
+		active = db.Model(&models.Role{}).Where("name = ?", item.Name)
+	case *models.Project:
+		active = db.Model(&models.Project{}).Where("name = ?", item.Name)
+	}
+	if active != nil {
+		var count int64
+		if err := active.Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	return db.Unscoped().Model(item).Update("deleted_at", nil).Error
+}
+
+func (r *GormTrashRepository) DeletedBefore(ctx context.Context, resource string, cutoff time.Time) ([]uint, error) {
+	return pluckIds(r.db.WithContext(ctx).Unscoped().Model(trashModels[resource]()).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff), "id")
+}
+
+func (r *GormTrashRepository) OwnsResources(ctx context.Context, userId uint) (bool, error) {
+	db := r.db.WithContext(ctx).Unscoped()
+	var owned int64
+	if err := db.Model(&models.Project{}).Where("owner_id = ?", userId).Count(&owned).Error; err != nil {
+		return false, err
+	}
+	if owned == 0 {
+		if err := db.Model(&models.Task{}).Where("owner_id = ?", userId).Count(&owned).Error; err != nil {
+			return false, err
+		}
+	}
+	return owned > 0, nil
+}
+
+func (r *GormTrashRepository) Purge(ctx context.Context, resource string, id uint) error {
+	item, err := r.Find(ctx, resource, id, 0)
+	if err != nil {
+		return err
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		switch resource {
+		case "users":
+			// Las relaciones project_users y project_co_owners se declaran en Project, hay que limpiarlas a mano
+			if err := tx.Exec("DELETE FROM project_users WHERE user_id = ?", id).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM project_co_owners WHERE user_id = ?", id).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("from_user_id = ? OR to_user_id = ?", id, id).Delete(&models.ProjectTransfer{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("user_id = ?", id).Delete(&models.PasswordResetToken{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("user_id = ?", id).Delete(&models.RecoveryCode{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("user_id = ?", id).Delete(&models.PersonalAccessToken{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", id).Delete(&models.PasswordHistory{}).Error; err != nil {
+				return err
+			}
+		case "projects":
+			if err := tx.Unscoped().Where("project_id = ?", id).Delete(&models.ProjectTransfer{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("project_id = ?", id).Delete(&models.ProjectInvitation{}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Unscoped().Select(clause.Associations).Delete(item).Error
+	})
+}
+
+// itemsOf separa un slice de modelos en punteros individuales
+func itemsOf(items interface{}) []interface{} {
+	var result []interface{}
+	switch list := items.(type) {
+	case *[]models.User:
+		for i := range *list {
+			result = append(result, &(*list)[i])
+		}
+	case *[]models.Role:
+		for i := range *list {
+			result = append(result, &(*list)[i])
+		}
+	case *[]models.Project:
+		for i := range *list {
+			result = append(result, &(*list)[i])
+		}
+	case *[]models.Task:
+		for i := range *list {
+			result = append(result, &(*list)[i])
+		}
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+)
+
+type storeKey struct{}
+
+type afterCommitKey struct{}
+
+// afterCommitHooks son las funciones que esperan a que se confirme la transacción
+type afterCommitHooks struct {
+	mu    sync.Mutex
+	hooks []func()
+}
+
+func (h *afterCommitHooks) add(hooks ...func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = append(h.hooks, hooks...)
+}
+
+func (h *afterCommitHooks) take() []func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hooks := h.hooks
+	h.hooks = nil
+	return hooks
+}
+
+// WithStore devuelve un contexto que lleva el store de una transacción en curso,
+// para que los servicios llamados con ese contexto trabajen dentro de ella
+func WithStore(ctx context.Context, store Store) context.Context {
+	return context.WithValue(ctx, storeKey{}, store)
+}
+
+// StoreFrom devuelve el store de la transacción que lleva ctx o, si no lleva
+// ninguna, fallback
+func StoreFrom(ctx context.Context, fallback Store) Store {
+	if store, ok := ctx.Value(storeKey{}).(Store); ok {
+		return store
+	}
+	return fallback
+}
+
+// RunInTransaction ejecuta fn como una unidad de trabajo. Si ctx ya lleva una
+// transacción fn corre dentro de ella (con un savepoint, así un error de fn no
+// deshace lo anterior); si no, se abre una nueva sobre store. El contexto que
+// recibe fn lleva la transacción, para pasarlo a otros servicios.
+func RunInTransaction(ctx context.Context, store Store, fn func(ctx context.Context, store Store) error) error {
+	parent, nested := ctx.Value(afterCommitKey{}).(*afterCommitHooks)
+	hooks := &afterCommitHooks{}
+	err := StoreFrom(ctx, store).Transaction(ctx, func(tx Store) error {
+		return fn(context.WithValue(WithStore(ctx, tx), afterCommitKey{}, hooks), tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Lo registrado en un savepoint espera a la transacción de afuera
+	if nested {
+		parent.add(hooks.take()...)
+		return nil
+	}
+	for _, hook := range hooks.take() {
+		hook()
+	}
+	return nil
+}
+
+// AfterCommit corre fn cuando se confirma la transacción que lleva ctx (la más
+// externa, si hay savepoints) y la descarta si se deshace. Sin transacción la
+// corre enseguida. Sirve para efectos que no se pueden deshacer, como un correo.
+func AfterCommit(ctx context.Context, fn func()) {
+	hooks, ok := ctx.Value(afterCommitKey{}).(*afterCommitHooks)
+	if !ok {
+		fn()
+		return
+	}
+	hooks.add(fn)
+}
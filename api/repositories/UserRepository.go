@@ -0,0 +1,214 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"gorm.io/gorm"
+)
+
+type UserRepository interface {
+	// FindByID y FindByEmail devuelven el usuario con sus roles
+	FindByID(ctx context.Context, id uint) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// FindByExternalSubject busca la cuenta vinculada al usuario del proveedor externo
+	FindByExternalSubject(ctx context.Context, provider string, subject string) (*models.User, error)
+	FindByUsername(ctx context.Context, username string) (*models.User, error)
+	FindByIDs(ctx context.Context, ids []uint) ([]models.User, error)
+	List(ctx context.Context) ([]models.User, error)
+	ListByProvider(ctx context.Context, provider string) ([]models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	Save(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, id uint) error
+	AddRole(ctx context.Context, userId uint, role *models.Role) error
+	RemoveRole(ctx context.Context, userId uint, roleId uint) error
+	// ReplaceRoles deja al usuario solo con roles
+	ReplaceRoles(ctx context.Context, userId uint, roles []models.Role) error
+	// RevokeSessions incrementa SessionVersion para invalidar los tokens emitidos
+	RevokeSessions(ctx context.Context, id uint) error
+	// AdvanceTOTPStep guarda el último paso TOTP usado solo si es posterior al
+	// guardado; devuelve false si el código ya se había usado
+	AdvanceTOTPStep(ctx context.Context, id uint, step int64) (bool, error)
+	// UpdatePassword guarda Password, PasswordChangedAt y PasswordPolicyVersion
+	// del usuario; con revokeSessions incrementa además SessionVersion
+	UpdatePassword(ctx context.Context, user *models.User, revokeSessions bool) error
+	ExpirePassword(ctx context.Context, id uint) error
+	// PasswordHistory devuelve los últimos limit hashes anteriores, del más nuevo al más viejo
+	PasswordHistory(ctx context.Context, userId uint, limit int) ([]string, error)
+	// AddPasswordHistory agrega un hash al historial y conserva solo los últimos keep
+	AddPasswordHistory(ctx context.Context, userId uint, hash string, keep int) error
+}
+
+type GormUserRepository struct {
+	db *gorm.DB
+}
+
+func (r *GormUserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Preload("Roles").Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *GormUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Preload("Roles").Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *GormUserRepository) FindByExternalSubject(ctx context.Context, provider string, subject string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Preload("Roles").Where("auth_provider = ? AND external_subject = ?", provider, subject).
+		First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *GormUserRepository) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Preload("Roles").Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *GormUserRepository) FindByIDs(ctx context.Context, ids []uint) ([]models.User, error) {
+	users := []models.User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+	if err := r.db.WithContext(ctx).Find(&users, ids).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *GormUserRepository) List(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	if err := r.db.WithContext(ctx).Preload("Roles").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *GormUserRepository) ListByProvider(ctx context.Context, provider string) ([]models.User, error) {
+	users := []models.User{}
+	if err := r.db.WithContext(ctx).Where("auth_provider = ?", provider).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *GormUserRepository) Create(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *GormUserRepository) Save(ctx context.Context, user *models.User) error {
+	return saveVersioned(r.db.WithContext(ctx), user, &user.Version)
+}
+
+func (r *GormUserRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.User{}, id).Error
+}
+
+func (r *GormUserRepository) AddRole(ctx context.Context, userId uint, role *models.Role) error {
+	user := models.User{Model: gorm.Model{ID: userId}}
+	if err := r.db.WithContext(ctx).Model(&user).Association("Roles").Append(role); err != nil {
+		return err
+	}
+	return bumpVersion(r.db.WithContext(ctx), &models.User{}, userId)
+}
+
+func (r *GormUserRepository) RemoveRole(ctx context.Context, userId uint, roleId uint) error {
+	user := models.User{Model: gorm.Model{ID: userId}}
+	role := models.Role{Model: gorm.Model{ID: roleId}}
+	if err := r.db.WithContext(ctx).Model(&user).Association("Roles").Delete(&role); err != nil {
+		return err
+	}
+	return bumpVersion(r.db.WithContext(ctx), &models.User{}, userId)
+}
+
+func (r *GormUserRepository) ReplaceRoles(ctx context.Context, userId uint, roles []models.Role) error {
+	user := models.User{Model: gorm.Model{ID: userId}}
+	if err := r.db.WithContext(ctx).Model(&user).Association("Roles").Replace(roles); err != nil {
+		return err
+	}
+	return bumpVersion(r.db.WithContext(ctx), &models.User{}, userId)
+}
+
+func (r *GormUserRepository) RevokeSessions(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).
+		UpdateColumn("session_version", gorm.Expr("session_version + 1")).Error
+}
+
+func (r *GormUserRepository) AdvanceTOTPStep(ctx context.Context, id uint, step int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		UpdateColumn("totp_last_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *GormUserRepository) UpdatePassword(ctx context.Context, user *models.User, revokeSessions bool) error {
+	updates := map[string]interface{}{
+		"password":                user.Password,
+		"password_changed_at":     user.PasswordChangedAt,
+		"password_policy_version": user.PasswordPolicyVersion,
+		"version":                 gorm.Expr("version + 1"),
+	}
+	if revokeSessions {
+		updates["session_version"] = gorm.Expr("session_version + 1")
+	}
+	if err := r.db.WithContext(ctx).Model(user).Updates(updates).Error; err != nil {
+		return err
+	}
+	// Así un Save posterior del mismo usuario no se toma como una versión vieja
+	user.Version++
+	return nil
+}
+
+func (r *GormUserRepository) ExpirePassword(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).UpdateColumn("password_policy_version", 0)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormUserRepository) PasswordHistory(ctx context.Context, userId uint, limit int) ([]string, error) {
+	hashes := []string{}
+	if limit <= 0 {
+		return hashes, nil
+	}
+	if err := r.db.WithContext(ctx).Model(&models.PasswordHistory{}).Where("user_id = ?", userId).
+		Order("created_at DESC").Limit(limit).Pluck("password_hash", &hashes).Error; err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+func (r *GormUserRepository) AddPasswordHistory(ctx context.Context, userId uint, hash string, keep int) error {
+	db := r.db.WithContext(ctx)
+	if err := db.Create(&models.PasswordHistory{UserID: userId, PasswordHash: hash}).Error; err != nil {
+		return err
+	}
+
+	var kept []uint
+	if keep > 0 {
+		if err := db.Model(&models.PasswordHistory{}).Where("user_id = ?", userId).
+			Order("created_at DESC").Limit(keep).Pluck("id", &kept).Error; err != nil {
+			return err
+		}
+	}
+	cleanup := db.Where("user_id = ?", userId)
+	if len(kept) > 0 {
+		cleanup = cleanup.Where("id NOT IN ?", kept)
+	}
+	return cleanup.Delete(&models.PasswordHistory{}).Error
+}
@@ -0,0 +1,32 @@
+package repositories
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrStaleVersion indica que el registro cambió (o se borró) desde que se leyó
+var ErrStaleVersion = errors.New("record was modified since it was read")
+
+// saveVersioned guarda model solo si en la base sigue teniendo la versión con
+// la que se leyó y la incrementa. Select("*") hace lo mismo que Save por su
+// cuenta, pero evita que Save inserte el registro si el UPDATE no afecta filas.
+func saveVersioned(db *gorm.DB, model interface{}, version *uint) error {
+	read := *version
+	*version = read + 1
+	result := db.Select("*").Where("version = ?", read).Save(model)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = ErrStaleVersion
+	}
+	if result.Error != nil {
+		*version = read
+	}
+	return result.Error
+}
+
+// bumpVersion incrementa la versión de los registros que cambian sin pasar por
+// Save, como al agregar o quitar asociaciones
+func bumpVersion(db *gorm.DB, model interface{}, ids ...uint) error {
+	return db.Model(model).Where("id IN ?", ids).UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// AuthProvider autentica un login con email y contraseña contra un backend.
+// Devuelve ErrUnknownAccount si la cuenta no es suya, para que LoginUser
+// pruebe con el siguiente proveedor.
+type AuthProvider interface {
+	Name() string
+	Authenticate(ctx context.Context, loginDto dto.LoginDto) (*models.User, error)
+}
+
+var (
+	ErrInvalidCredentials = NewError(KindUnauthorized, "INVALID_CREDENTIALS", "invalid credentials")
+	ErrUnknownAccount     = errors.New("account not handled by this provider")
+)
+
+// LocalAuthProvider valida la contraseña guardada con bcrypt en la tabla users
+type LocalAuthProvider struct {
+	users repositories.UserRepository
+}
+
+func NewLocalAuthProvider(users repositories.UserRepository) *LocalAuthProvider {
+	return &LocalAuthProvider{users: users}
+}
+
+func (p *LocalAuthProvider) Name() string {
+	return models.AuthProviderLocal
+}
+
+func (p *LocalAuthProvider) Authenticate(ctx context.Context, loginDto dto.LoginDto) (*models.User, error) {
+	user, err := p.users.FindByEmail(ctx, loginDto.Email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownAccount
+		}
+		return nil, err
+	}
+
+	// Las cuentas de un proveedor externo no tienen contraseña local
+	if user.AuthProvider != models.AuthProviderLocal {
+		return nil, ErrUnknownAccount
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginDto.Password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
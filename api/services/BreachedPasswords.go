@@ -0,0 +1,66 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// BreachedPasswordChecker indica si una contraseña aparece en filtraciones conocidas
+type BreachedPasswordChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// LocalBreachedList es una lista de hashes SHA-1 de contraseñas filtradas, en el
+// formato de Have I Been Pwned ("HASH" o "HASH:cantidad" por línea). Se indexa
+// por los primeros 5 caracteres del hash, como la API de rangos: la consulta
+// pide el rango del prefijo y compara el resto localmente.
+type LocalBreachedList struct {
+	ranges map[string]map[string]struct{}
+}
+
+const breachedHashPrefixLength = 5
+
+func LoadBreachedList(path string) (*LocalBreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &LocalBreachedList{ranges: map[string]map[string]struct{}{}}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != sha1.Size*2 {
+			continue
+		}
+
+		prefix, suffix := hash[:breachedHashPrefixLength], hash[breachedHashPrefixLength:]
+		if list.ranges[prefix] == nil {
+			list.ranges[prefix] = map[string]struct{}{}
+		}
+		list.ranges[prefix][suffix] = struct{}{}
+	}
+	return list, scanner.Err()
+}
+
+// Range devuelve los sufijos conocidos para el prefijo, igual que la API de rangos
+func (l *LocalBreachedList) Range(prefix string) map[string]struct{} {
+	return l.ranges[strings.ToUpper(prefix)]
+}
+
+func (l *LocalBreachedList) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	_, found := l.Range(hash[:breachedHashPrefixLength])[hash[breachedHashPrefixLength:]]
+	return found, nil
+}
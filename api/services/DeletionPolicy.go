@@ -0,0 +1,19 @@
+package services
+
+// Políticas de borrado para usuarios y proyectos
+//   - restrict: se niega a borrar si todavía hay recursos que dependen del elemento
+//   - transfer: (usuarios) pasa proyectos y tareas a un sucesor
+//   - cascade:  borra también los recursos dependientes
+//   - detach:   (proyectos) borra el proyecto y deja sus tareas como están
+const (
+	DeletionPolicyRestrict = "restrict"
+	DeletionPolicyTransfer = "transfer"
+	DeletionPolicyCascade  = "cascade"
+	DeletionPolicyDetach   = "detach"
+)
+
+var (
+	ErrInvalidDeletionPolicy = NewError(KindValidation, "INVALID_DELETION_POLICY", "invalid deletion policy")
+	ErrSuccessorRequired     = NewError(KindValidation, "SUCCESSOR_REQUIRED", "a valid successor_id is required for the transfer policy")
+	ErrDeletionRestricted    = NewError(KindConflict, "DELETION_RESTRICTED", "resource still has dependent resources")
+)
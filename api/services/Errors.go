@@ -0,0 +1,203 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/lucapierini/project-go-task_manager/i18n"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"gorm.io/gorm"
+)
+
+// ErrorKind clasifica los errores de dominio; de ella sale el status HTTP
+type ErrorKind string
+
+const (
+	KindValidation           ErrorKind = "validation"
+	KindUnauthorized         ErrorKind = "unauthorized"
+	KindForbidden            ErrorKind = "forbidden"
+	KindNotFound             ErrorKind = "not_found"
+	KindConflict             ErrorKind = "conflict"
+	KindGone                 ErrorKind = "gone"
+	KindPreconditionFailed   ErrorKind = "precondition_failed"
+	KindUnsupportedMedia     ErrorKind = "unsupported_media_type"
+	KindUnprocessable        ErrorKind = "unprocessable"
+	KindFailedDependency     ErrorKind = "failed_dependency"
+	KindPreconditionRequired ErrorKind = "precondition_required"
+	KindTooManyRequests      ErrorKind = "too_many_requests"
+	KindBadGateway           ErrorKind = "bad_gateway"
+	KindInternal             ErrorKind = "internal"
+)
+
+var kindStatus = map[ErrorKind]int{
+	KindValidation:           http.StatusBadRequest,
+	KindUnauthorized:         http.StatusUnauthorized,
+	KindForbidden:            http.StatusForbidden,
+	KindNotFound:             http.StatusNotFound,
+	KindConflict:             http.StatusConflict,
+	KindGone:                 http.StatusGone,
+	KindPreconditionFailed:   http.StatusPreconditionFailed,
+	KindUnsupportedMedia:     http.StatusUnsupportedMediaType,
+	KindUnprocessable:        http.StatusUnprocessableEntity,
+	KindFailedDependency:     http.StatusFailedDependency,
+	KindPreconditionRequired: http.StatusPreconditionRequired,
+	KindTooManyRequests:      http.StatusTooManyRequests,
+	KindBadGateway:           http.StatusBadGateway,
+	KindInternal:             http.StatusInternalServerError,
+}
+
+// FieldError describe por qué no es válido un campo del pedido
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// Error es un error de dominio con un código estable que los clientes pueden
+// comparar. Message se muestra al cliente; la causa (Err) solo se loguea.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Fields  []FieldError
+	// Extra son miembros adicionales de la respuesta, como el impacto de un borrado
+	Extra map[string]interface{}
+	Err   error
+}
+
+// NewError crea un error de dominio; los servicios lo declaran una vez como variable
+func NewError(kind ErrorKind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is compara por código, así una copia con más detalle sigue siendo el mismo error
+func (e *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+	return ok && other.Code == e.Code
+}
+
+// Status es el status HTTP que corresponde al error
+func (e *Error) Status() int {
+	if status, ok := kindStatus[e.Kind]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Wrap devuelve una copia del error con la causa err
+func (e *Error) Wrap(err error) *Error {
+	copied := *e
+	copied.Err = err
+	return &copied
+}
+
+// WithFields devuelve una copia del error con el detalle de los campos inválidos
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	copied := *e
+	copied.Fields = append(append([]FieldError{}, e.Fields...), fields...)
+	return &copied
+}
+
+// With devuelve una copia del error con un miembro adicional en la respuesta
+func (e *Error) With(key string, value interface{}) *Error {
+	copied := *e
+	copied.Extra = map[string]interface{}{}
+	for k, v := range e.Extra {
+		copied.Extra[k] = v
+	}
+	copied.Extra[key] = value
+	return &copied
+}
+
+// Localize devuelve una copia del error con el mensaje y el detalle de los
+// campos en language. Lo que no está traducido queda en inglés, salvo los
+// campos con un código desconocido, que usan el mensaje genérico.
+func (e *Error) Localize(language string) *Error {
+	copied := *e
+	if message, ok := i18n.Message(language, e.Code, nil); ok {
+		copied.Message = message
+	}
+	if len(e.Fields) > 0 {
+		copied.Fields = make([]FieldError, len(e.Fields))
+		for i, field := range e.Fields {
+			// Los parámetros con varios valores, como los de oneof, se muestran separados por comas
+			params := map[string]string{"param": strings.Join(strings.Fields(field.Param), ", ")}
+			if message, ok := i18n.Message(language, "field."+field.Code, params); ok {
+				field.Message = message
+			} else if message, ok := i18n.Message(language, "field.invalid", nil); ok {
+				field.Message = message
+			}
+			copied.Fields[i] = field
+		}
+	}
+	return &copied
+}
+
+// Errores genéricos, para lo que no tiene un error de dominio propio
+var (
+	ErrNotFound          = NewError(KindNotFound, "RESOURCE_NOT_FOUND", "resource not found")
+	ErrAlreadyExists     = NewError(KindConflict, "RESOURCE_ALREADY_EXISTS", "a unique value is already in use")
+	ErrReferenceConflict = NewError(KindUnprocessable, "INVALID_REFERENCE", "a related resource does not exist or is still in use")
+	ErrInvalidRequest    = NewError(KindValidation, "INVALID_REQUEST", "invalid request data")
+	ErrInvalidParameter  = NewError(KindValidation, "INVALID_PARAMETER", "invalid parameter")
+	ErrForbidden         = NewError(KindForbidden, "FORBIDDEN", "you don't have permission to do this")
+	ErrInternal          = NewError(KindInternal, "INTERNAL_ERROR", "internal server error")
+)
+
+// InvalidParam es el error de un id de la ruta o la query que no es un número válido
+func InvalidParam(name string) *Error {
+	return ErrInvalidParameter.WithFields(FieldError{Field: name, Code: "uint", Message: "must be a positive integer"})
+}
+
+// AsError traduce cualquier error a uno de dominio: los de GORM y los
+// repositorios a su equivalente y el resto a un error interno, para no
+// mostrarle al cliente mensajes de la base
+func AsError(err error) *Error {
+	var domainErr *Error
+	var policyErr *PasswordPolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		return policyErr.asError()
+	case errors.As(err, &domainErr):
+		return domainErr
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound.Wrap(err)
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrAlreadyExists.Wrap(err)
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return ErrReferenceConflict.Wrap(err)
+	case errors.Is(err, repositories.ErrStaleVersion):
+		return ErrVersionMismatch.Wrap(err)
+	}
+	return ErrInternal.Wrap(err)
+}
+
+// Errores de recursos inexistentes
+var (
+	ErrUserNotFound    = NewError(KindNotFound, "USER_NOT_FOUND", "user not found")
+	ErrRoleNotFound    = NewError(KindNotFound, "ROLE_NOT_FOUND", "role not found")
+	ErrProjectNotFound = NewError(KindNotFound, "PROJECT_NOT_FOUND", "project not found")
+	ErrTaskNotFound    = NewError(KindNotFound, "TASK_NOT_FOUND", "task not found")
+)
+
+// notFoundAs cambia el "record not found" de los repositorios por notFound; el
+// resto de los errores pasan sin cambios
+func notFoundAs(err error, notFound *Error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFound.Wrap(err)
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"gorm.io/gorm"
+)
+
+// roleMapper traduce los grupos de un proveedor externo (OIDC, LDAP) a roles locales
+type roleMapper struct {
+	mapping     map[string][]string
+	defaultRole string
+}
+
+// newRoleMapper lee el mapeo "grupo:Rol,otro-grupo:Rol"; un grupo puede aparecer varias veces
+func newRoleMapper(value string, defaultRole string) roleMapper {
+	if defaultRole == "" {
+		defaultRole = "Usuario"
+	}
+
+	mapping := map[string][]string{}
+	for _, entry := range splitList(value, ",") {
+		group, role, found := strings.Cut(entry, ":")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !found || group == "" || role == "" {
+			log.Printf("Ignoring invalid role mapping entry %q\n", entry)
+			continue
+		}
+		mapping[group] = append(mapping[group], role)
+	}
+	return roleMapper{mapping: mapping, defaultRole: defaultRole}
+}
+
+// enabled indica si los roles se sincronizan con los grupos en cada login
+func (m roleMapper) enabled() bool {
+	return len(m.mapping) > 0
+}
+
+// roles devuelve los roles locales de los grupos; el rol por defecto siempre se incluye
+func (m roleMapper) roles(groups []string) []string {
+	roles := []string{m.defaultRole}
+	seen := map[string]bool{m.defaultRole: true}
+	for _, group := range groups {
+		for _, role := range m.mapping[group] {
+			if !seen[role] {
+				seen[role] = true
+				roles = append(roles, role)
+			}
+		}
+	}
+	return roles
+}
+
+func splitList(value string, separators string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return strings.ContainsRune(separators, r)
+	})
+}
+
+func replaceUserRoles(ctx context.Context, store repositories.Store, user *models.User, roleNames []string) error {
+	roles, err := store.Roles().FindByNames(ctx, roleNames)
+	if err != nil {
+		return err
+	}
+	if len(roles) != len(roleNames) {
+		log.Printf("Some mapped roles do not exist: %v\n", roleNames)
+	}
+	return store.Users().ReplaceRoles(ctx, user.ID, roles)
+}
+
+// availableUsername usa el nombre preferido (o la parte local del email) y le
+// agrega un sufijo numérico si ya está tomado
+func availableUsername(ctx context.Context, users repositories.UserRepository, preferred string, email string) (string, error) {
+	base := preferred
+	if base == "" {
+		base, _, _ = strings.Cut(email, "@")
+	}
+
+	candidate := base
+	for i := 2; ; i++ {
+		_, err := users.FindByUsername(ctx, candidate)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+}
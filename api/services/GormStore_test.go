@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lucapierini/project-go-task_manager/config"
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/migrations"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+)
+
+// newSQLiteStore arma un GormStore sobre SQLite en memoria con el esquema migrado
+func newSQLiteStore(t *testing.T) repositories.Store {
+	t.Helper()
+	t.Setenv("SIGNING_KEY_ENCRYPTION_KEY", testEncryptionKey)
+	ctx := context.Background()
+	db, err := config.OpenDB("sqlite://:memory:")
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	if _, err := migrations.Up(db, 0); err != nil {
+		t.Fatalf("migrations.Up: %v", err)
+	}
+
+	store := repositories.NewGormStore(db)
+	roles := NewRoleService(store)
+	for _, name := range []string{"Administrador", "Usuario"} {
+		if _, err := roles.CreateRole(ctx, dto.RoleDto{Name: name}); err != nil {
+			t.Fatalf("creating role %s: %v", name, err)
+		}
+	}
+	if err := LoadSigningKeys(ctx, store); err != nil {
+		t.Fatalf("loading signing keys: %v", err)
+	}
+	return store
+}
+
+func TestProjectLifecycleOnSQLite(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	member := registerTestUser(t, store, "member", "member@example.com")
+	projects := NewProjectService(store)
+	trash := NewTrashService(store)
+
+	if _, err := newTestUserService(store, &fakeMailer{}).RegisterUser(ctx, dto.UserDto{Username: "again", Email: "owner@example.com", Password: testPassword}); !errors.Is(err, ErrEmailAlreadyRegistered) {
+		t.Fatalf("expected ErrEmailAlreadyRegistered, got %v", err)
+	}
+
+	project := createTestProject(t, store, "Apollo", owner.ID)
+	if err := projects.AddUserToProject(ctx, project.ID, member.ID); err != nil {
+		t.Fatalf("AddUserToProject: %v", err)
+	}
+	if _, err := projects.DeleteProject(ctx, project.ID, DeletionPolicyDetach); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+
+	// El nombre vuelve a estar libre, pero entonces el proyecto borrado no se puede restaurar
+	replacement := createTestProject(t, store, "Apollo", owner.ID)
+	if _, err := trash.Restore(ctx, "projects", project.ID, owner.ID); !errors.Is(err, ErrRestoreConflict) {
+		t.Fatalf("expected ErrRestoreConflict, got %v", err)
+	}
+	if _, err := projects.DeleteProject(ctx, replacement.ID, DeletionPolicyDetach); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+
+	if _, err := trash.Restore(ctx, "projects", project.ID, owner.ID); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	restored, err := projects.GetProjectById(ctx, project.ID)
+	if err != nil {
+		t.Fatalf("GetProjectById: %v", err)
+	}
+	if !containsUser(restored.Users, member.ID) {
+		t.Fatalf("expected the restored project to keep its members, got %+v", restored.Users)
+	}
+
+	if err := trash.Purge(ctx, "projects", replacement.ID); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+)
+
+const (
+	testPassword = "Str0ng-Test-Passw0rd"
+	// testEncryptionKey son 32 bytes en base64 para SIGNING_KEY_ENCRYPTION_KEY
+	testEncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+)
+
+// newTestStore arma un MemoryStore con los roles por defecto y una clave de firma
+func newTestStore(t *testing.T) *repositories.MemoryStore {
+	t.Helper()
+	ctx := context.Background()
+	t.Setenv("SIGNING_KEY_ENCRYPTION_KEY", testEncryptionKey)
+	store := repositories.NewMemoryStore()
+	for _, name := range []string{"Administrador", "Usuario"} {
+		if err := store.Roles().Create(ctx, &models.Role{Name: name}); err != nil {
+			t.Fatalf("creating role %s: %v", name, err)
+		}
+	}
+	if err := LoadSigningKeys(ctx, store); err != nil {
+		t.Fatalf("loading signing keys: %v", err)
+	}
+	return store
+}
+
+// newTestUserService arma un UserService que envía los enlaces de verificación con mailer
+func newTestUserService(store repositories.Store, mailer Mailer) *UserService {
+	return NewUserService(store, NewVerificationService(store, mailer))
+}
+
+func registerTestUser(t *testing.T, store repositories.Store, username string, email string) *models.User {
+	t.Helper()
+	user, err := newTestUserService(store, &fakeMailer{}).RegisterUser(context.Background(), dto.UserDto{
+		Username: username,
+		Email:    email,
+		Password: testPassword,
+	})
+	if err != nil {
+		t.Fatalf("registering %s: %v", email, err)
+	}
+	return user
+}
+
+func createTestProject(t *testing.T, store repositories.Store, name string, ownerId uint) *models.Project {
+	t.Helper()
+	project, err := NewProjectService(store).CreateProject(context.Background(), dto.ProjectDto{
+		Name:    name,
+		Budget:  100,
+		OwnerID: ownerId,
+	})
+	if err != nil {
+		t.Fatalf("creating project %s: %v", name, err)
+	}
+	return project
+}
+
+type sentMail struct {
+	to      string
+	subject string
+	body    string
+}
+
+// fakeMailer guarda los correos en lugar de enviarlos; con err simula un SMTP caído
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []sentMail
+	err  error
+}
+
+func (m *fakeMailer) Send(to string, subject string, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, sentMail{to: to, subject: subject, body: body})
+	return nil
+}
+
+func (m *fakeMailer) last(t *testing.T) sentMail {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.sent) == 0 {
+		t.Fatal("no email was sent")
+	}
+	return m.sent[len(m.sent)-1]
+}
+
+var mailTokenPattern = regexp.MustCompile(`token=(\S+)`)
+
+// mailToken extrae el token del enlace del último correo enviado
+func (m *fakeMailer) mailToken(t *testing.T) string {
+	t.Helper()
+	match := mailTokenPattern.FindStringSubmatch(m.last(t).body)
+	if match == nil {
+		t.Fatal("email does not contain a token link")
+	}
+	return match[1]
+}
+
+func containsUser(users []models.User, id uint) bool {
+	for _, user := range users {
+		if user.ID == id {
+			return true
+		}
+	}
+	return false
+}
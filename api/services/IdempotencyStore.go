@@ -0,0 +1,173 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// IdempotencyRecord es lo que se guarda por cada Idempotency-Key: la huella del
+// pedido y, cuando termina, la respuesta para repetirla ante un reintento
+type IdempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Completed   bool        `json:"completed"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// IdempotencyStore guarda los pedidos por clave; con varias réplicas tiene que ser compartido (Redis)
+type IdempotencyStore interface {
+	// Reserve marca la clave como en curso durante ttl y devuelve nil si no
+	// existía; si ya existía devuelve lo guardado, haya terminado o no
+	Reserve(ctx context.Context, key string, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error)
+	// Complete guarda la respuesta del pedido durante retention
+	Complete(ctx context.Context, key string, record IdempotencyRecord, retention time.Duration) error
+	// Release borra la clave para que el pedido se pueda volver a intentar
+	Release(ctx context.Context, key string) error
+}
+
+// NewIdempotencyStoreFromEnv usa Redis si está configurado y si no la memoria del proceso
+func NewIdempotencyStoreFromEnv() IdempotencyStore {
+	if config.Redis != nil {
+		return NewRedisIdempotencyStore(config.Redis)
+	}
+	return NewMemoryIdempotencyStore(config.GetEnvInt("IDEMPOTENCY_MAX_KEYS", 10000))
+}
+
+type memoryIdempotency struct {
+	key       string
+	record    IdempotencyRecord
+	expiresAt time.Time
+}
+
+// MemoryIdempotencyStore sirve con una sola réplica; las claves se pierden al
+// reiniciar. Guarda como mucho maxKeys claves: al llenarse descarta la usada
+// hace más tiempo, que suele ser también la primera en vencer.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	maxKeys int
+	// order va de la clave usada hace más tiempo a la más reciente
+	order   *list.List
+	records map[string]*list.Element
+}
+
+func NewMemoryIdempotencyStore(maxKeys int) *MemoryIdempotencyStore {
+	if maxKeys < 1 {
+		maxKeys = 1
+	}
+	return &MemoryIdempotencyStore{maxKeys: maxKeys, order: list.New(), records: map[string]*list.Element{}}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, key string, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if element, ok := s.records[key]; ok {
+		entry := element.Value.(*memoryIdempotency)
+		if now.Before(entry.expiresAt) {
+			s.order.MoveToBack(element)
+			record := entry.record
+			return &record, nil
+		}
+	}
+	s.set(key, IdempotencyRecord{Fingerprint: fingerprint}, now.Add(ttl))
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, key string, record IdempotencyRecord, retention time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(key, record, time.Now().Add(retention))
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.records[key]; ok {
+		s.order.Remove(element)
+		delete(s.records, key)
+	}
+	return nil
+}
+
+// set guarda la clave como la más reciente y, si se pasa del límite, hace lugar
+func (s *MemoryIdempotencyStore) set(key string, record IdempotencyRecord, expiresAt time.Time) {
+	if element, ok := s.records[key]; ok {
+		entry := element.Value.(*memoryIdempotency)
+		entry.record = record
+		entry.expiresAt = expiresAt
+		s.order.MoveToBack(element)
+		return
+	}
+	s.records[key] = s.order.PushBack(&memoryIdempotency{key: key, record: record, expiresAt: expiresAt})
+
+	for len(s.records) > s.maxKeys {
+		oldest := s.order.Front()
+		s.order.Remove(oldest)
+		delete(s.records, oldest.Value.(*memoryIdempotency).key)
+	}
+}
+
+// RedisIdempotencyStore comparte las claves entre réplicas; Redis vence las claves solo
+type RedisIdempotencyStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisIdempotencyStore(client *redis.Client) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{client: client, prefix: "idempotency:"}
+}
+
+func (s *RedisIdempotencyStore) Reserve(ctx context.Context, key string, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	pending, err := json.Marshal(IdempotencyRecord{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+
+	// Si la clave vence entre SETNX y GET se vuelve a intentar la reserva
+	for attempt := 0; attempt < 3; attempt++ {
+		reserved, err := s.client.SetNX(ctx, s.prefix+key, pending, ttl).Result()
+		if err != nil {
+			return nil, err
+		}
+		if reserved {
+			return nil, nil
+		}
+
+		data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var record IdempotencyRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, err
+		}
+		return &record, nil
+	}
+	return nil, errors.New("could not reserve idempotency key")
+}
+
+func (s *RedisIdempotencyStore) Complete(ctx context.Context, key string, record IdempotencyRecord, retention time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.prefix+key, data, retention).Err()
+}
+
+func (s *RedisIdempotencyStore) Release(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
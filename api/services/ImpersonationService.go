@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/config"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+)
+
+type ImpersonationInterface interface {
+	StartImpersonation(ctx context.Context, adminId uint, userId uint, reason string, ip string) (*models.Impersonation, string, error)
+	EndImpersonation(ctx context.Context, impersonationId uint) error
+	ListImpersonations(ctx context.Context, userId uint) ([]models.Impersonation, error)
+	GetImpersonation(ctx context.Context, impersonationId uint) (*models.Impersonation, error)
+	CheckImpersonation(ctx context.Context, claims *models.Claims) error
+	RecordRequest(ctx context.Context, claims *models.Claims, method string, path string, status int)
+}
+
+type ImpersonationService struct {
+	store repositories.Store
+}
+
+func NewImpersonationService(store repositories.Store) *ImpersonationService {
+	return &ImpersonationService{store: store}
+}
+
+func (s *ImpersonationService) repos(ctx context.Context) repositories.Store {
+	return repositories.StoreFrom(ctx, s.store)
+}
+
+var (
+	ErrCannotImpersonate  = NewError(KindForbidden, "CANNOT_IMPERSONATE", "this user cannot be impersonated")
+	ErrImpersonationEnded = NewError(KindUnauthorized, "IMPERSONATION_ENDED", "impersonation has ended")
+)
+
+// StartImpersonation registra la suplantación y devuelve el access token del usuario.
+// No se puede suplantar a uno mismo ni a otro administrador.
+func (s *ImpersonationService) StartImpersonation(ctx context.Context, adminId uint, userId uint, reason string, ip string) (*models.Impersonation, string, error) {
+	user, err := s.repos(ctx).Users().FindByID(ctx, userId)
+	if err != nil {
+		return nil, "", notFoundAs(err, ErrUserNotFound)
+	}
+	if user.ID == adminId {
+		return nil, "", ErrCannotImpersonate
+	}
+	for _, role := range user.Roles {
+		if role.Name == "Administrador" {
+			return nil, "", ErrCannotImpersonate
+		}
+	}
+
+	impersonation := models.Impersonation{
+		AdminID:   adminId,
+		UserID:    user.ID,
+		Reason:    reason,
+		IP:        ip,
+		ExpiresAt: time.Now().Add(config.GetEnvDuration("IMPERSONATION_TTL", 15*time.Minute)),
+	}
+	if err := s.repos(ctx).Impersonations().Create(ctx, &impersonation); err != nil {
+		return nil, "", err
+	}
+
+	token, err := GenerateImpersonationToken(user, &impersonation)
+	if err != nil {
+		return nil, "", err
+	}
+
+	LogSecurityEvent("impersonation_started", "impersonation_id", impersonation.ID,
+		"admin_id", adminId, "user_id", user.ID, "ip", ip, "reason", reason)
+	return &impersonation, token, nil
+}
+
+// EndImpersonation corta la suplantación antes de que venza el token
+func (s *ImpersonationService) EndImpersonation(ctx context.Context, impersonationId uint) error {
+	if err := s.repos(ctx).Impersonations().End(ctx, impersonationId, time.Now()); err != nil {
+		return err
+	}
+
+	LogSecurityEvent("impersonation_ended", "impersonation_id", impersonationId)
+	return nil
+}
+
+// ListImpersonations devuelve las suplantaciones de un usuario (0 para todas)
+func (s *ImpersonationService) ListImpersonations(ctx context.Context, userId uint) ([]models.Impersonation, error) {
+	return s.repos(ctx).Impersonations().List(ctx, userId)
+}
+
+// GetImpersonation incluye los pedidos hechos durante la suplantación
+func (s *ImpersonationService) GetImpersonation(ctx context.Context, impersonationId uint) (*models.Impersonation, error) {
+	return s.repos(ctx).Impersonations().FindWithRequests(ctx, impersonationId)
+}
+
+// CheckImpersonation verifica que la suplantación del token no se haya terminado
+func (s *ImpersonationService) CheckImpersonation(ctx context.Context, claims *models.Claims) error {
+	impersonation, err := s.repos(ctx).Impersonations().FindByID(ctx, claims.Act.ImpersonationID)
+	if err != nil {
+		return ErrImpersonationEnded
+	}
+	if impersonation.EndedAt != nil || time.Now().After(impersonation.ExpiresAt) {
+		return ErrImpersonationEnded
+	}
+	return nil
+}
+
+// RecordRequest guarda y registra en el log un pedido hecho con un token de suplantación
+func (s *ImpersonationService) RecordRequest(ctx context.Context, claims *models.Claims, method string, path string, status int) {
+	LogSecurityEvent("impersonated_request", "impersonation_id", claims.Act.ImpersonationID,
+		"admin_id", claims.Act.UserID, "user_id", claims.UserID, "method", method, "path", path, "status", status)
+
+	request := models.ImpersonationRequest{
+		ImpersonationID: claims.Act.ImpersonationID,
+		Method:          method,
+		Path:            path,
+		Status:          status,
+	}
+	if err := s.repos(ctx).Impersonations().AddRequest(ctx, &request); err != nil {
+		LogSecurityEvent("impersonation_audit_failed", "impersonation_id", claims.Act.ImpersonationID, "error", err)
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/config"
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+)
+
+type InvitationInterface interface {
+	CreateInvitation(ctx context.Context, projectId uint, invitationDto dto.InvitationDto, invitedBy uint, actorId uint) (*models.ProjectInvitation, error)
+	ListInvitations(ctx context.Context, projectId uint) ([]models.ProjectInvitation, error)
+	RevokeInvitation(ctx context.Context, projectId uint, invitationId uint) error
+	AcceptInvitation(ctx context.Context, acceptDto dto.AcceptInvitationDto) (*models.User, *models.Project, bool, error)
+}
+
+type InvitationService struct {
+	store          repositories.Store
+	mailer         Mailer
+	userService    UserInterface
+	projectService ProjectInterface
+}
+
+func NewInvitationService(store repositories.Store, mailer Mailer, userService UserInterface, projectService ProjectInterface) *InvitationService {
+	return &InvitationService{
+		store:          store,
+		mailer:         mailer,
+		userService:    userService,
+		projectService: projectService,
+	}
+}
+
+func (s *InvitationService) repos(ctx context.Context) repositories.Store {
+	return repositories.StoreFrom(ctx, s.store)
+}
+
+var (
+	ErrInvitationNotFound     = NewError(KindNotFound, "INVITATION_NOT_FOUND", "invitation not found")
+	ErrInvitationUsed         = NewError(KindConflict, "INVITATION_USED", "invitation has already been accepted")
+	ErrInvitationExpired      = NewError(KindGone, "INVITATION_EXPIRED", "invitation has expired")
+	ErrAccountDetailsRequired = NewError(KindValidation, "ACCOUNT_DETAILS_REQUIRED", "username and password are required to create the account")
+)
+
+// CreateInvitation guarda la invitación y envía el email cuando se confirma la
+// transacción. Si el envío falla la invitación queda guardada; invitar otra vez
+// al mismo email la reemplaza y manda un token nuevo.
+func (s *InvitationService) CreateInvitation(ctx context.Context, projectId uint, invitationDto dto.InvitationDto, invitedBy uint, actorId uint) (*models.ProjectInvitation, error) {
+	project, err := s.repos(ctx).Projects().FindByID(ctx, projectId)
+	if err != nil {
+		return nil, notFoundAs(err, ErrProjectNotFound)
+	}
+
+	role := invitationDto.ProjectRole
+	if role == "" {
+		role = models.ProjectRoleMember
+	}
+	// Solo el dueño principal puede sumar co-dueños, igual que con AddCoOwnerToProject
+	if role == models.ProjectRoleCoOwner {
+		if err := checkPrimaryOwner(project, actorId); err != nil {
+			return nil, err
+		}
+	}
+
+	email := strings.ToLower(strings.TrimSpace(invitationDto.Email))
+	invitation := models.ProjectInvitation{
+		ProjectID:   project.ID,
+		Email:       email,
+		ProjectRole: role,
+		InvitedByID: invitedBy,
+		ExpiresAt:   time.Now().Add(config.GetEnvDuration("INVITATION_TTL", 72*time.Hour)),
+	}
+
+	err = repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, tx repositories.Store) error {
+		// Una nueva invitación reemplaza a las pendientes para el mismo email
+		if err := tx.Invitations().DeletePending(ctx, project.ID, email); err != nil {
+			return err
+		}
+		if err := tx.Invitations().Create(ctx, &invitation); err != nil {
+			return err
+		}
+
+		token, err := GenerateInvitationToken(&invitation)
+		if err != nil {
+			return err
+		}
+
+		body := fmt.Sprintf("You have been invited to join the project %q.\n\n"+
+			"Accept the invitation here:\n%s/invitations/accept?token=%s\n\n"+
+			"Or send this token to POST /api/invitations/accept:\n%s\n\n"+
+			"The invitation expires on %s.",
+			project.Name, appBaseURL(), token, token, invitation.ExpiresAt.Format(time.RFC1123))
+		repositories.AfterCommit(ctx, func() {
+			if err := s.mailer.Send(email, "Invitation to "+project.Name, body); err != nil {
+				log.Printf("Error sending invitation %d to %s: %v\n", invitation.ID, email, err)
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &invitation, nil
+}
+
+// ListInvitations devuelve las invitaciones pendientes y aceptadas del proyecto
+func (s *InvitationService) ListInvitations(ctx context.Context, projectId uint) ([]models.ProjectInvitation, error) {
+	return s.repos(ctx).Invitations().ListByProject(ctx, projectId)
+}
+
+func (s *InvitationService) RevokeInvitation(ctx context.Context, projectId uint, invitationId uint) error {
+	invitations := s.repos(ctx).Invitations()
+	invitation, err := invitations.FindInProject(ctx, projectId, invitationId)
+	if err != nil {
+		return notFoundAs(err, ErrInvitationNotFound)
+	}
+	if invitation.AcceptedAt != nil {
+		return ErrInvitationUsed
+	}
+	return invitations.Delete(ctx, invitation.ID)
+}
+
+// AcceptInvitation suma al dueño del email al proyecto con el rol de la invitación.
+// Si el email no tiene cuenta la crea con el username y password recibidos;
+// el booleano indica si la cuenta se creó en este momento.
+func (s *InvitationService) AcceptInvitation(ctx context.Context, acceptDto dto.AcceptInvitationDto) (*models.User, *models.Project, bool, error) {
+	claims, err := ValidateInvitationToken(acceptDto.Token)
+	if err != nil {
+		if err == ErrExpiredToken {
+			return nil, nil, false, ErrInvitationExpired
+		}
+		return nil, nil, false, ErrInvitationNotFound
+	}
+
+	// Una invitación revocada está borrada, así que FindByID no la encuentra
+	invitation, err := s.repos(ctx).Invitations().FindByID(ctx, claims.InvitationID)
+	if err != nil || invitation.Email != claims.Email {
+		return nil, nil, false, ErrInvitationNotFound
+	}
+	if invitation.AcceptedAt != nil {
+		return nil, nil, false, ErrInvitationUsed
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return nil, nil, false, ErrInvitationExpired
+	}
+
+	// La cuenta, la membresía y la marca de aceptada se guardan juntas
+	var user *models.User
+	created := false
+	err = repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, tx repositories.Store) error {
+		var err error
+		user, err = s.userService.GetUserByEmail(ctx, invitation.Email)
+		if err != nil {
+			if acceptDto.Username == "" || acceptDto.Password == "" {
+				return ErrAccountDetailsRequired
+			}
+			user, err = s.userService.RegisterUser(ctx, dto.UserDto{
+				Username: acceptDto.Username,
+				Email:    invitation.Email,
+				Password: acceptDto.Password,
+			})
+			if err != nil {
+				return err
+			}
+			// Quien acepta la invitación demostró que el email es suyo
+			if err := markEmailVerified(ctx, tx.Users(), user, true); err != nil {
+				return err
+			}
+			created = true
+		}
+
+		switch invitation.ProjectRole {
+		case models.ProjectRoleCoOwner:
+			err = s.projectService.AddCoOwnerToProject(ctx, invitation.ProjectID, user.ID, 0)
+			if errors.Is(err, ErrAlreadyCoOwner) {
+				err = nil
+			}
+		default:
+			err = s.projectService.AddUserToProject(ctx, invitation.ProjectID, user.ID)
+			if errors.Is(err, ErrUserAlreadyInProject) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		invitation.AcceptedAt = &now
+		invitation.AcceptedByID = &user.ID
+		return tx.Invitations().Save(ctx, invitation)
+	})
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	project, err := s.projectService.GetProjectById(ctx, invitation.ProjectID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	return user, project, created, nil
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+)
+
+func newTestInvitationService(store repositories.Store, mailer Mailer) *InvitationService {
+	return NewInvitationService(store, mailer, newTestUserService(store, mailer), NewProjectService(store))
+}
+
+func TestAcceptInvitationCreatesAccountAndJoinsProject(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	project := createTestProject(t, store, "Apollo", owner.ID)
+	mailer := &fakeMailer{}
+	service := newTestInvitationService(store, mailer)
+
+	if _, err := service.CreateInvitation(ctx, project.ID, dto.InvitationDto{Email: "Guest@Example.com"}, owner.ID, owner.ID); err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+
+	user, joined, created, err := service.AcceptInvitation(ctx, dto.AcceptInvitationDto{
+		Token:    mailer.mailToken(t),
+		Username: "guest",
+		Password: testPassword,
+	})
+	if err != nil {
+		t.Fatalf("AcceptInvitation: %v", err)
+	}
+	if !created || user.Email != "guest@example.com" || !user.EmailVerified {
+		t.Fatalf("expected a new verified account for guest@example.com, got created=%v %+v", created, user)
+	}
+	if !containsUser(joined.Users, user.ID) {
+		t.Fatalf("user %d was not added to project %d", user.ID, joined.ID)
+	}
+
+	invitations, err := service.ListInvitations(ctx, project.ID)
+	if err != nil || len(invitations) != 1 || invitations[0].AcceptedAt == nil {
+		t.Fatalf("expected the invitation to be marked as accepted, got %+v (%v)", invitations, err)
+	}
+}
+
+func TestCreateInvitationMailsAfterCommit(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	project := createTestProject(t, store, "Apollo", owner.ID)
+	mailer := &fakeMailer{}
+	service := newTestInvitationService(store, mailer)
+
+	// Si la transacción del request se deshace no se guarda la invitación ni sale el correo
+	rollback := errors.New("rollback")
+	err := repositories.RunInTransaction(ctx, store, func(ctx context.Context, _ repositories.Store) error {
+		if _, err := service.CreateInvitation(ctx, project.ID, dto.InvitationDto{Email: "guest@example.com"}, owner.ID, owner.ID); err != nil {
+			return err
+		}
+		if len(mailer.sent) != 0 {
+			t.Fatal("the mail must wait for the commit")
+		}
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatalf("expected the rollback error, got %v", err)
+	}
+	if len(mailer.sent) != 0 {
+		t.Fatalf("expected no mail after the rollback, got %+v", mailer.sent)
+	}
+	invitations, err := service.ListInvitations(ctx, project.ID)
+	if err != nil || len(invitations) != 0 {
+		t.Fatalf("expected no stored invitations, got %+v (%v)", invitations, err)
+	}
+}
+
+func TestCreateInvitationKeepsInvitationWhenMailFails(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	project := createTestProject(t, store, "Apollo", owner.ID)
+	service := newTestInvitationService(store, &fakeMailer{err: errors.New("smtp down")})
+
+	// El correo sale después del commit: un error ya no deshace la invitación
+	if _, err := service.CreateInvitation(ctx, project.ID, dto.InvitationDto{Email: "guest@example.com"}, owner.ID, owner.ID); err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+
+	invitations, err := service.ListInvitations(ctx, project.ID)
+	if err != nil || len(invitations) != 1 {
+		t.Fatalf("expected the invitation to be stored, got %+v (%v)", invitations, err)
+	}
+}
+
+func TestCreateInvitationMailsAcceptLink(t *testing.T) {
+	t.Setenv("APP_BASE_URL", "https://tasks.example.com/")
+	ctx := context.Background()
+	store := newTestStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	project := createTestProject(t, store, "Apollo", owner.ID)
+	mailer := &fakeMailer{}
+	service := newTestInvitationService(store, mailer)
+
+	invitation, err := service.CreateInvitation(ctx, project.ID, dto.InvitationDto{Email: " Guest@Example.com "}, owner.ID, owner.ID)
+	if err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+
+	mail := mailer.last(t)
+	if mail.to != "guest@example.com" || !strings.Contains(mail.subject, "Apollo") {
+		t.Fatalf("unexpected mail to %q with subject %q", mail.to, mail.subject)
+	}
+	token := mailer.mailToken(t)
+	if link := "https://tasks.example.com/invitations/accept?token=" + token; !strings.Contains(mail.body, link) {
+		t.Fatalf("mail does not contain the accept link %q:\n%s", link, mail.body)
+	}
+	claims, err := ValidateInvitationToken(token)
+	if err != nil || claims.InvitationID != invitation.ID || claims.Email != "guest@example.com" {
+		t.Fatalf("the token in the mail does not match the invitation: %+v (%v)", claims, err)
+	}
+}
+
+func TestAcceptInvitationWithExpiredToken(t *testing.T) {
+	t.Setenv("INVITATION_TTL", "-1h")
+	ctx := context.Background()
+	store := newTestStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	project := createTestProject(t, store, "Apollo", owner.ID)
+	mailer := &fakeMailer{}
+	service := newTestInvitationService(store, mailer)
+
+	if _, err := service.CreateInvitation(ctx, project.ID, dto.InvitationDto{Email: "guest@example.com"}, owner.ID, owner.ID); err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+
+	_, _, _, err := service.AcceptInvitation(ctx, dto.AcceptInvitationDto{Token: mailer.mailToken(t), Username: "guest", Password: testPassword})
+	if !errors.Is(err, ErrInvitationExpired) {
+		t.Fatalf("expected ErrInvitationExpired, got %v", err)
+	}
+	if _, err := store.Users().FindByEmail(ctx, "guest@example.com"); err == nil {
+		t.Fatal("an expired invitation must not create the account")
+	}
+}
+
+func TestAcceptRevokedInvitation(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	guest := registerTestUser(t, store, "guest", "guest@example.com")
+	project := createTestProject(t, store, "Apollo", owner.ID)
+	mailer := &fakeMailer{}
+	service := newTestInvitationService(store, mailer)
+
+	invitation, err := service.CreateInvitation(ctx, project.ID, dto.InvitationDto{Email: "guest@example.com"}, owner.ID, owner.ID)
+	if err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+	if err := service.RevokeInvitation(ctx, project.ID, invitation.ID); err != nil {
+		t.Fatalf("RevokeInvitation: %v", err)
+	}
+
+	_, _, _, err = service.AcceptInvitation(ctx, dto.AcceptInvitationDto{Token: mailer.mailToken(t)})
+	if !errors.Is(err, ErrInvitationNotFound) {
+		t.Fatalf("expected ErrInvitationNotFound, got %v", err)
+	}
+	joined, err := NewProjectService(store).GetProjectById(ctx, project.ID)
+	if err != nil || containsUser(joined.Users, guest.ID) {
+		t.Fatalf("a revoked invitation must not add the user to the project: %+v (%v)", joined, err)
+	}
+}
+
+func TestRevokeAcceptedInvitation(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	registerTestUser(t, store, "guest", "guest@example.com")
+	project := createTestProject(t, store, "Apollo", owner.ID)
+	mailer := &fakeMailer{}
+	service := newTestInvitationService(store, mailer)
+
+	invitation, err := service.CreateInvitation(ctx, project.ID, dto.InvitationDto{Email: "guest@example.com"}, owner.ID, owner.ID)
+	if err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+	// Con la cuenta ya creada no hacen falta username ni password
+	if _, _, created, err := service.AcceptInvitation(ctx, dto.AcceptInvitationDto{Token: mailer.mailToken(t)}); err != nil || created {
+		t.Fatalf("AcceptInvitation: created=%v err=%v", created, err)
+	}
+
+	if err := service.RevokeInvitation(ctx, project.ID, invitation.ID); !errors.Is(err, ErrInvitationUsed) {
+		t.Fatalf("expected ErrInvitationUsed, got %v", err)
+	}
+}
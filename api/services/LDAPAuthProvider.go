@@ -0,0 +1,362 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"gorm.io/gorm"
+)
+
+// LDAPConnection es la parte de *ldap.Conn que se usa; permite reemplazar el
+// servidor por uno en memoria
+type LDAPConnection interface {
+	Bind(username, password string) error
+	Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// LDAPAuthProvider valida la contraseña haciendo bind contra un directorio
+// LDAP o Active Directory y crea la cuenta local la primera vez
+type LDAPAuthProvider struct {
+	store             repositories.Store
+	dial              func() (LDAPConnection, error)
+	bindDN            string
+	bindPassword      string
+	baseDN            string
+	userFilter        string
+	groupFilter       string
+	emailAttribute    string
+	usernameAttribute string
+	groupAttribute    string
+	roles             roleMapper
+}
+
+var ErrLDAPUserNotFound = errors.New("ldap user not found")
+
+// ldapEntry es lo que se necesita de la entrada del usuario en el directorio
+type ldapEntry struct {
+	DN       string
+	Email    string
+	Username string
+	Groups   []string
+}
+
+// NewLDAPAuthProviderFromEnv arma el proveedor con las variables LDAP_*; sin LDAP_URL devuelve nil
+func NewLDAPAuthProviderFromEnv(store repositories.Store) *LDAPAuthProvider {
+	url := os.Getenv("LDAP_URL")
+	if url == "" {
+		return nil
+	}
+	startTLS := os.Getenv("LDAP_START_TLS") == "true"
+	insecureSkipVerify := os.Getenv("LDAP_INSECURE_SKIP_VERIFY") == "true"
+
+	dial := func() (LDAPConnection, error) {
+		conn, err := ldap.DialURL(url, ldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: insecureSkipVerify}))
+		if err != nil {
+			return nil, err
+		}
+		conn.SetTimeout(10 * time.Second)
+		if startTLS {
+			if err := conn.StartTLS(&tls.Config{InsecureSkipVerify: insecureSkipVerify}); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+	}
+
+	return NewLDAPAuthProvider(store, dial, LDAPConfig{
+		BindDN:            os.Getenv("LDAP_BIND_DN"),
+		BindPassword:      os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:            os.Getenv("LDAP_BASE_DN"),
+		UserFilter:        os.Getenv("LDAP_USER_FILTER"),
+		GroupFilter:       os.Getenv("LDAP_GROUP_FILTER"),
+		EmailAttribute:    os.Getenv("LDAP_EMAIL_ATTRIBUTE"),
+		UsernameAttribute: os.Getenv("LDAP_USERNAME_ATTRIBUTE"),
+		GroupAttribute:    os.Getenv("LDAP_GROUP_NAME_ATTRIBUTE"),
+		RoleMapping:       os.Getenv("LDAP_ROLE_MAPPING"),
+		DefaultRole:       os.Getenv("LDAP_DEFAULT_ROLE"),
+	})
+}
+
+// LDAPConfig son las opciones del proveedor; los campos vacíos usan los valores de OpenLDAP
+type LDAPConfig struct {
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter recibe el email del login en %s, ya escapado
+	UserFilter string
+	// GroupFilter recibe el DN del usuario en %s, ya escapado
+	GroupFilter       string
+	EmailAttribute    string
+	UsernameAttribute string
+	GroupAttribute    string
+	RoleMapping       string
+	DefaultRole       string
+}
+
+func NewLDAPAuthProvider(store repositories.Store, dial func() (LDAPConnection, error), ldapConfig LDAPConfig) *LDAPAuthProvider {
+	orDefault := func(value string, fallback string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	}
+
+	return &LDAPAuthProvider{
+		store:             store,
+		dial:              dial,
+		bindDN:            ldapConfig.BindDN,
+		bindPassword:      ldapConfig.BindPassword,
+		baseDN:            ldapConfig.BaseDN,
+		userFilter:        orDefault(ldapConfig.UserFilter, "(&(objectClass=inetOrgPerson)(mail=%s))"),
+		groupFilter:       orDefault(ldapConfig.GroupFilter, "(&(objectClass=groupOfNames)(member=%s))"),
+		emailAttribute:    orDefault(ldapConfig.EmailAttribute, "mail"),
+		usernameAttribute: orDefault(ldapConfig.UsernameAttribute, "uid"),
+		groupAttribute:    orDefault(ldapConfig.GroupAttribute, "cn"),
+		roles:             newRoleMapper(ldapConfig.RoleMapping, ldapConfig.DefaultRole),
+	}
+}
+
+func (p *LDAPAuthProvider) Name() string {
+	return models.AuthProviderLDAP
+}
+
+// connect abre la conexión autenticada con la cuenta de servicio
+func (p *LDAPAuthProvider) connect() (LDAPConnection, error) {
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	if p.bindDN != "" {
+		if err := conn.Bind(p.bindDN, p.bindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap service bind: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (p *LDAPAuthProvider) Authenticate(ctx context.Context, loginDto dto.LoginDto) (*models.User, error) {
+	// Un bind con contraseña vacía es anónimo y el servidor lo acepta
+	if loginDto.Password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := p.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entry, err := p.findUser(conn, fmt.Sprintf(p.userFilter, ldap.EscapeFilter(loginDto.Email)), p.baseDN, ldap.ScopeWholeSubtree)
+	if errors.Is(err, ErrLDAPUserNotFound) {
+		return nil, ErrUnknownAccount
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, loginDto.Password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	// Se vuelve a la cuenta de servicio para leer los grupos
+	if p.bindDN != "" {
+		if err := conn.Bind(p.bindDN, p.bindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind: %w", err)
+		}
+	}
+	if entry.Groups, err = p.findGroups(conn, entry.DN); err != nil {
+		return nil, err
+	}
+
+	return p.provisionUser(ctx, entry)
+}
+
+func (p *LDAPAuthProvider) findUser(conn LDAPConnection, filter string, baseDN string, scope int) (*ldapEntry, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		baseDN, scope, ldap.NeverDerefAliases, 2, 0, false,
+		filter, []string{"dn", p.emailAttribute, p.usernameAttribute}, nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, ErrLDAPUserNotFound
+		}
+		return nil, err
+	}
+	// Un filtro que devuelve más de una entrada es ambiguo y no se usa
+	if len(result.Entries) != 1 {
+		return nil, ErrLDAPUserNotFound
+	}
+
+	entry := result.Entries[0]
+	return &ldapEntry{
+		DN:       entry.DN,
+		Email:    strings.ToLower(strings.TrimSpace(entry.GetAttributeValue(p.emailAttribute))),
+		Username: entry.GetAttributeValue(p.usernameAttribute),
+	}, nil
+}
+
+func (p *LDAPAuthProvider) findGroups(conn LDAPConnection, userDN string) ([]string, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(p.groupFilter, ldap.EscapeFilter(userDN)), []string{p.groupAttribute}, nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []string{}
+	for _, entry := range result.Entries {
+		if name := entry.GetAttributeValue(p.groupAttribute); name != "" {
+			groups = append(groups, name)
+		}
+	}
+	return groups, nil
+}
+
+// provisionUser busca la cuenta local por DN o por email y la crea si no existe.
+// No toma cuentas de otros proveedores aunque el email coincida.
+func (p *LDAPAuthProvider) provisionUser(ctx context.Context, entry *ldapEntry) (*models.User, error) {
+	if entry.Email == "" {
+		return nil, fmt.Errorf("ldap entry %s has no %s attribute", entry.DN, p.emailAttribute)
+	}
+
+	var user *models.User
+	err := repositories.RunInTransaction(ctx, p.store, func(ctx context.Context, tx repositories.Store) error {
+		users := tx.Users()
+		var err error
+		user, err = users.FindByExternalSubject(ctx, models.AuthProviderLDAP, entry.DN)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			user, err = users.FindByEmail(ctx, entry.Email)
+		}
+
+		now := time.Now()
+		switch {
+		case err == nil:
+			if user.AuthProvider != models.AuthProviderLDAP {
+				return ErrInvalidCredentials
+			}
+			if user.ExternalSubject == nil || *user.ExternalSubject != entry.DN || user.Email != entry.Email {
+				user.ExternalSubject = &entry.DN
+				user.Email = entry.Email
+				if err := users.Save(ctx, user); err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			username, err := availableUsername(ctx, users, entry.Username, entry.Email)
+			if err != nil {
+				return err
+			}
+			user = &models.User{
+				Username:        username,
+				Email:           entry.Email,
+				EmailVerified:   true,
+				EmailVerifiedAt: &now,
+				AuthProvider:    models.AuthProviderLDAP,
+				ExternalSubject: &entry.DN,
+			}
+			if err := users.Create(ctx, user); err != nil {
+				return err
+			}
+			if !p.roles.enabled() {
+				return replaceUserRoles(ctx, tx, user, p.roles.roles(nil))
+			}
+		default:
+			return err
+		}
+
+		if p.roles.enabled() {
+			return replaceUserRoles(ctx, tx, user, p.roles.roles(entry.Groups))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repositories.StoreFrom(ctx, p.store).Users().FindByID(ctx, user.ID)
+}
+
+// SyncGroups actualiza los roles de todas las cuentas LDAP según sus grupos actuales.
+// Si la entrada ya no existe en el directorio se invalidan las sesiones de la cuenta.
+func (p *LDAPAuthProvider) SyncGroups(ctx context.Context) (int, error) {
+	repos := repositories.StoreFrom(ctx, p.store)
+	users, err := repos.Users().ListByProvider(ctx, models.AuthProviderLDAP)
+	if err != nil {
+		return 0, err
+	}
+	if len(users) == 0 {
+		return 0, nil
+	}
+
+	conn, err := p.connect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	synced := 0
+	for i := range users {
+		user := &users[i]
+		if user.ExternalSubject == nil {
+			continue
+		}
+
+		entry, err := p.findUser(conn, "(objectClass=*)", *user.ExternalSubject, ldap.ScopeBaseObject)
+		if errors.Is(err, ErrLDAPUserNotFound) {
+			if err := repos.Users().RevokeSessions(ctx, user.ID); err != nil {
+				log.Printf("Error revoking sessions of LDAP user %d: %v\n", user.ID, err)
+			}
+			continue
+		}
+		if err != nil {
+			return synced, err
+		}
+
+		if !p.roles.enabled() {
+			synced++
+			continue
+		}
+		groups, err := p.findGroups(conn, entry.DN)
+		if err != nil {
+			return synced, err
+		}
+		if err := replaceUserRoles(ctx, repos, user, p.roles.roles(groups)); err != nil {
+			return synced, err
+		}
+		synced++
+	}
+	return synced, nil
+}
+
+// StartLDAPGroupSyncJob sincroniza periódicamente los grupos del directorio con
+// los roles. Pensado para correr en su propia goroutine.
+func StartLDAPGroupSyncJob(provider *LDAPAuthProvider, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		synced, err := provider.SyncGroups(context.Background())
+		if err != nil {
+			log.Printf("Error syncing LDAP groups: %v\n", err)
+			continue
+		}
+		log.Printf("LDAP group sync updated %d users\n", synced)
+	}
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+)
+
+const (
+	testLDAPBindDN   = "cn=service,dc=example,dc=com"
+	testLDAPBaseDN   = "dc=example,dc=com"
+	testLDAPAliceDN  = "uid=alice,ou=people,dc=example,dc=com"
+	testLDAPPassword = "directory-password"
+)
+
+var (
+	ldapMailFilter   = regexp.MustCompile(`\(mail=([^)]*)\)`)
+	ldapMemberFilter = regexp.MustCompile(`\(member=([^)]*)\)`)
+)
+
+type fakeLDAPPerson struct {
+	mail     string
+	uid      string
+	password string
+}
+
+// fakeLDAPDirectory es un directorio en memoria que entiende los filtros por
+// defecto de LDAPAuthProvider (usuarios por mail, grupos por member)
+type fakeLDAPDirectory struct {
+	mu              sync.Mutex
+	servicePassword string
+	people          map[string]fakeLDAPPerson
+	groups          map[string][]string
+	open            int
+}
+
+func newFakeLDAPDirectory() *fakeLDAPDirectory {
+	return &fakeLDAPDirectory{
+		servicePassword: "service-password",
+		people: map[string]fakeLDAPPerson{
+			testLDAPAliceDN: {mail: "Alice@Example.com", uid: "alice", password: testLDAPPassword},
+		},
+		groups: map[string][]string{
+			"task-admins": {testLDAPAliceDN},
+			"developers":  {testLDAPAliceDN},
+		},
+	}
+}
+
+func (d *fakeLDAPDirectory) dial() (LDAPConnection, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.open++
+	return &fakeLDAPConnection{directory: d}, nil
+}
+
+func (d *fakeLDAPDirectory) openConnections() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.open
+}
+
+type fakeLDAPConnection struct {
+	directory *fakeLDAPDirectory
+	closed    bool
+}
+
+func (c *fakeLDAPConnection) Bind(username, password string) error {
+	d := c.directory
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if username == testLDAPBindDN && password == d.servicePassword {
+		return nil
+	}
+	if person, ok := d.people[username]; ok && password != "" && password == person.password {
+		return nil
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (c *fakeLDAPConnection) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	d := c.directory
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	result := &ldap.SearchResult{}
+
+	switch {
+	case request.Scope == ldap.ScopeBaseObject:
+		person, ok := d.people[request.BaseDN]
+		if !ok {
+			return nil, ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object"))
+		}
+		result.Entries = append(result.Entries, person.entry(request.BaseDN))
+	case ldapMailFilter.MatchString(request.Filter):
+		mail := ldapMailFilter.FindStringSubmatch(request.Filter)[1]
+		for dn, person := range d.people {
+			if strings.EqualFold(person.mail, mail) {
+				result.Entries = append(result.Entries, person.entry(dn))
+			}
+		}
+	case ldapMemberFilter.MatchString(request.Filter):
+		member := ldapMemberFilter.FindStringSubmatch(request.Filter)[1]
+		for name, members := range d.groups {
+			for _, dn := range members {
+				if dn == member {
+					result.Entries = append(result.Entries, ldap.NewEntry("cn="+name+",ou=groups,"+testLDAPBaseDN, map[string][]string{"cn": {name}}))
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+func (c *fakeLDAPConnection) Close() error {
+	if !c.closed {
+		c.closed = true
+		c.directory.mu.Lock()
+		c.directory.open--
+		c.directory.mu.Unlock()
+	}
+	return nil
+}
+
+func (p fakeLDAPPerson) entry(dn string) *ldap.Entry {
+	return ldap.NewEntry(dn, map[string][]string{"mail": {p.mail}, "uid": {p.uid}})
+}
+
+func newTestLDAPProvider(store repositories.Store, directory *fakeLDAPDirectory) *LDAPAuthProvider {
+	return NewLDAPAuthProvider(store, directory.dial, LDAPConfig{
+		BindDN:       testLDAPBindDN,
+		BindPassword: "service-password",
+		BaseDN:       testLDAPBaseDN,
+		RoleMapping:  "task-admins:Administrador",
+	})
+}
+
+func roleNames(user *models.User) map[string]bool {
+	names := map[string]bool{}
+	for _, role := range user.Roles {
+		names[role.Name] = true
+	}
+	return names
+}
+
+func TestLDAPAuthenticateProvisionsUserWithMappedRoles(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	directory := newFakeLDAPDirectory()
+	provider := newTestLDAPProvider(store, directory)
+
+	user, err := provider.Authenticate(ctx, dto.LoginDto{Email: "alice@example.com", Password: testLDAPPassword})
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.AuthProvider != models.AuthProviderLDAP || user.Username != "alice" || user.Email != "alice@example.com" || !user.EmailVerified {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if user.ExternalSubject == nil || *user.ExternalSubject != testLDAPAliceDN {
+		t.Fatalf("expected the DN as external subject, got %v", user.ExternalSubject)
+	}
+	if roles := roleNames(user); len(roles) != 2 || !roles["Usuario"] || !roles["Administrador"] {
+		t.Fatalf("expected Usuario and Administrador, got %+v", user.Roles)
+	}
+
+	// El segundo login reutiliza la cuenta
+	again, err := provider.Authenticate(ctx, dto.LoginDto{Email: "alice@example.com", Password: testLDAPPassword})
+	if err != nil || again.ID != user.ID {
+		t.Fatalf("expected the same account on the second login, got %+v (%v)", again, err)
+	}
+	if open := directory.openConnections(); open != 0 {
+		t.Fatalf("%d LDAP connections were left open", open)
+	}
+}
+
+func TestLDAPAuthenticateBindFailures(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	directory := newFakeLDAPDirectory()
+	provider := newTestLDAPProvider(store, directory)
+
+	if _, err := provider.Authenticate(ctx, dto.LoginDto{Email: "alice@example.com", Password: "wrong"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password: expected ErrInvalidCredentials, got %v", err)
+	}
+	if _, err := provider.Authenticate(ctx, dto.LoginDto{Email: "alice@example.com", Password: ""}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("empty password: expected ErrInvalidCredentials, got %v", err)
+	}
+	if _, err := provider.Authenticate(ctx, dto.LoginDto{Email: "nobody@example.com", Password: testLDAPPassword}); !errors.Is(err, ErrUnknownAccount) {
+		t.Fatalf("unknown email: expected ErrUnknownAccount, got %v", err)
+	}
+
+	// Si falla la cuenta de servicio es un error del directorio, no del usuario
+	directory.servicePassword = "rotated"
+	_, err := provider.Authenticate(ctx, dto.LoginDto{Email: "alice@example.com", Password: testLDAPPassword})
+	if err == nil || errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrUnknownAccount) {
+		t.Fatalf("service bind failure: expected a directory error, got %v", err)
+	}
+
+	if _, err := store.Users().FindByEmail(ctx, "alice@example.com"); err == nil {
+		t.Fatal("failed logins must not provision the account")
+	}
+	if open := directory.openConnections(); open != 0 {
+		t.Fatalf("%d LDAP connections were left open", open)
+	}
+}
+
+func TestLDAPAuthenticateRejectsAccountsFromOtherProviders(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	local := registerTestUser(t, store, "alice", "alice@example.com")
+	provider := newTestLDAPProvider(store, newFakeLDAPDirectory())
+
+	if _, err := provider.Authenticate(ctx, dto.LoginDto{Email: "alice@example.com", Password: testLDAPPassword}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+
+	user, err := store.Users().FindByID(ctx, local.ID)
+	if err != nil || user.AuthProvider != models.AuthProviderLocal || user.ExternalSubject != nil {
+		t.Fatalf("the local account must not change, got %+v (%v)", user, err)
+	}
+	if roles := roleNames(user); roles["Administrador"] {
+		t.Fatalf("the local account must not receive mapped roles, got %+v", user.Roles)
+	}
+}
+
+func TestLDAPSyncGroups(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	directory := newFakeLDAPDirectory()
+	provider := newTestLDAPProvider(store, directory)
+
+	user, err := provider.Authenticate(ctx, dto.LoginDto{Email: "alice@example.com", Password: testLDAPPassword})
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	// Sacarla del grupo de administradores le quita el rol en la próxima sincronización
+	directory.groups["task-admins"] = nil
+	synced, err := provider.SyncGroups(ctx)
+	if err != nil || synced != 1 {
+		t.Fatalf("SyncGroups: synced=%d err=%v", synced, err)
+	}
+	updated, err := store.Users().FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if roles := roleNames(updated); len(roles) != 1 || !roles["Usuario"] {
+		t.Fatalf("expected only Usuario after the sync, got %+v", updated.Roles)
+	}
+
+	// Si la entrada desaparece del directorio se revocan sus sesiones
+	delete(directory.people, testLDAPAliceDN)
+	synced, err = provider.SyncGroups(ctx)
+	if err != nil || synced != 0 {
+		t.Fatalf("SyncGroups: synced=%d err=%v", synced, err)
+	}
+	removed, err := store.Users().FindByID(ctx, user.ID)
+	if err != nil || removed.SessionVersion <= updated.SessionVersion {
+		t.Fatalf("expected the sessions to be revoked, got %+v (%v)", removed, err)
+	}
+	if open := directory.openConnections(); open != 0 {
+		t.Fatalf("%d LDAP connections were left open", open)
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// LoginAttemptStore guarda los intentos fallidos y los bloqueos por clave
+// (cuenta o IP). Con varias réplicas tiene que ser compartido (Redis).
+type LoginAttemptStore interface {
+	// RegisterFailure suma un intento fallido y devuelve cuántos lleva la clave
+	// desde que empezó la ventana; cada fallo extiende la ventana
+	RegisterFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	Lock(ctx context.Context, key string, duration time.Duration) error
+	// LockedFor devuelve cuánto falta para que se levante el bloqueo (0 si no hay)
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// Reset borra los intentos y el bloqueo de la clave
+	Reset(ctx context.Context, key string) error
+}
+
+// NewLoginAttemptStoreFromEnv usa Redis si está configurado y si no la memoria del proceso
+func NewLoginAttemptStoreFromEnv() LoginAttemptStore {
+	if config.Redis != nil {
+		return NewRedisLoginAttemptStore(config.Redis)
+	}
+	return NewMemoryLoginAttemptStore()
+}
+
+type memoryAttempts struct {
+	key         string
+	failures    int
+	expiresAt   time.Time
+	lockedUntil time.Time
+}
+
+// expired indica que ya no quedan intentos ni bloqueo vigentes
+func (a *memoryAttempts) expired(now time.Time) bool {
+	return now.After(a.expiresAt) && now.After(a.lockedUntil)
+}
+
+// MemoryLoginAttemptStore sirve con una sola réplica; los contadores se pierden al reiniciar
+type MemoryLoginAttemptStore struct {
+	mu sync.Mutex
+	// order va de la clave modificada hace más tiempo a la más reciente
+	order    *list.List
+	attempts map[string]*list.Element
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{order: list.New(), attempts: map[string]*list.Element{}}
+}
+
+// entry devuelve la entrada de la clave descartando lo vencido; requiere tener el lock
+func (s *MemoryLoginAttemptStore) entry(key string, now time.Time) *memoryAttempts {
+	element, ok := s.attempts[key]
+	if !ok {
+		return nil
+	}
+	attempts := element.Value.(*memoryAttempts)
+	if now.After(attempts.expiresAt) {
+		attempts.failures = 0
+	}
+	if attempts.failures == 0 && now.After(attempts.lockedUntil) {
+		s.remove(element)
+		return nil
+	}
+	return attempts
+}
+
+// touch devuelve la entrada de la clave, creándola si hace falta, como la más
+// reciente; requiere tener el lock. Antes descarta las vencidas desde la
+// modificada hace más tiempo hasta la primera vigente, así el mapa no crece
+// sin tener que recorrerlo entero.
+func (s *MemoryLoginAttemptStore) touch(key string, now time.Time) *memoryAttempts {
+	for element := s.order.Front(); element != nil; element = s.order.Front() {
+		if !element.Value.(*memoryAttempts).expired(now) {
+			break
+		}
+		s.remove(element)
+	}
+
+	attempts := s.entry(key, now)
+	if attempts == nil {
+		attempts = &memoryAttempts{key: key}
+		s.attempts[key] = s.order.PushBack(attempts)
+	} else {
+		s.order.MoveToBack(s.attempts[key])
+	}
+	return attempts
+}
+
+func (s *MemoryLoginAttemptStore) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.attempts, element.Value.(*memoryAttempts).key)
+}
+
+func (s *MemoryLoginAttemptStore) RegisterFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	attempts := s.touch(key, now)
+	attempts.failures++
+	attempts.expiresAt = now.Add(window)
+	return attempts.failures, nil
+}
+
+func (s *MemoryLoginAttemptStore) Lock(ctx context.Context, key string, duration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.touch(key, now).lockedUntil = now.Add(duration)
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := s.entry(key, time.Now())
+	if attempts == nil {
+		return 0, nil
+	}
+	if remaining := time.Until(attempts.lockedUntil); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.attempts[key]; ok {
+		s.remove(element)
+	}
+	return nil
+}
+
+// RedisLoginAttemptStore comparte los contadores entre réplicas; Redis vence las claves solo
+type RedisLoginAttemptStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisLoginAttemptStore(client *redis.Client) *RedisLoginAttemptStore {
+	return &RedisLoginAttemptStore{client: client, prefix: "login_attempts:"}
+}
+
+func (s *RedisLoginAttemptStore) failuresKey(key string) string {
+	return s.prefix + "failures:" + key
+}
+
+func (s *RedisLoginAttemptStore) lockKey(key string) string {
+	return s.prefix + "lock:" + key
+}
+
+func (s *RedisLoginAttemptStore) RegisterFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	pipe := s.client.TxPipeline()
+	incr := pipe.Incr(ctx, s.failuresKey(key))
+	pipe.PExpire(ctx, s.failuresKey(key), window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+func (s *RedisLoginAttemptStore) Lock(ctx context.Context, key string, duration time.Duration) error {
+	return s.client.Set(ctx, s.lockKey(key), 1, duration).Err()
+}
+
+func (s *RedisLoginAttemptStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, s.lockKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	// PTTL devuelve valores negativos si la clave no existe o no vence
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s *RedisLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.failuresKey(key), s.lockKey(key)).Err()
+}
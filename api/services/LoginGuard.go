@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/config"
+)
+
+var ErrTooManyAttempts = NewError(KindTooManyRequests, "TOO_MANY_ATTEMPTS", "too many failed login attempts, try again later")
+
+// LoginGuard limita los intentos de login fallidos por cuenta y por IP. Al
+// superar el umbral bloquea la clave con un tiempo que se duplica en cada
+// fallo siguiente, hasta maxLockout.
+type LoginGuard struct {
+	store            LoginAttemptStore
+	accountThreshold int
+	ipThreshold      int
+	window           time.Duration
+	baseLockout      time.Duration
+	maxLockout       time.Duration
+}
+
+func NewLoginGuard(store LoginAttemptStore) *LoginGuard {
+	return &LoginGuard{
+		store:            store,
+		accountThreshold: config.GetEnvInt("LOGIN_MAX_FAILURES_PER_ACCOUNT", 5),
+		ipThreshold:      config.GetEnvInt("LOGIN_MAX_FAILURES_PER_IP", 20),
+		window:           config.GetEnvDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+		baseLockout:      config.GetEnvDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+		maxLockout:       config.GetEnvDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+	}
+}
+
+// AccountKey y MFAKey identifican los contadores de una cuenta; el de IP se arma con ipKey
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func MFAKey(userId uint) string {
+	return fmt.Sprintf("mfa:%d", userId)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check devuelve ErrTooManyAttempts y el tiempo de espera si la cuenta o la IP están bloqueadas.
+// Si el store falla se deja pasar el intento para no impedir todos los logins.
+func (g *LoginGuard) Check(ctx context.Context, accountKey string, ip string) (time.Duration, error) {
+	for _, key := range []string{accountKey, ipKey(ip)} {
+		remaining, err := g.store.LockedFor(ctx, key)
+		if err != nil {
+			log.Printf("Error checking login lockout: %v\n", err)
+			continue
+		}
+		if remaining > 0 {
+			LogSecurityEvent("login_blocked", "key", key, "ip", ip, "retry_after", remaining.Round(time.Second))
+			return remaining, ErrTooManyAttempts
+		}
+	}
+	return 0, nil
+}
+
+// RegisterFailure cuenta el fallo para la cuenta y la IP y bloquea las que superaron el umbral
+func (g *LoginGuard) RegisterFailure(ctx context.Context, accountKey string, ip string) {
+	LogSecurityEvent("login_failed", "key", accountKey, "ip", ip)
+
+	limits := map[string]int{accountKey: g.accountThreshold, ipKey(ip): g.ipThreshold}
+	for key, threshold := range limits {
+		failures, err := g.store.RegisterFailure(ctx, key, g.window)
+		if err != nil {
+			log.Printf("Error registering failed login: %v\n", err)
+			continue
+		}
+		if failures < threshold {
+			continue
+		}
+
+		lockout := g.lockoutFor(failures - threshold)
+		if err := g.store.Lock(ctx, key, lockout); err != nil {
+			log.Printf("Error locking %s: %v\n", key, err)
+			continue
+		}
+		LogSecurityEvent("login_locked", "key", key, "ip", ip, "failures", failures, "duration", lockout)
+	}
+}
+
+// lockoutFor es baseLockout * 2^excess, sin pasar de maxLockout
+func (g *LoginGuard) lockoutFor(excess int) time.Duration {
+	lockout := g.baseLockout
+	for i := 0; i < excess && lockout < g.maxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > g.maxLockout {
+		return g.maxLockout
+	}
+	return lockout
+}
+
+// RegisterSuccess reinicia el contador de la cuenta; el de la IP se mantiene
+func (g *LoginGuard) RegisterSuccess(ctx context.Context, accountKey string, ip string) {
+	if err := g.store.Reset(ctx, accountKey); err != nil {
+		log.Printf("Error resetting failed logins: %v\n", err)
+	}
+}
+
+// Unlock levanta el bloqueo y borra los intentos de las claves indicadas
+func (g *LoginGuard) Unlock(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := g.store.Reset(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
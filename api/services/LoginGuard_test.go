@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestLoginGuard(t *testing.T, store LoginAttemptStore) *LoginGuard {
+	t.Setenv("LOGIN_MAX_FAILURES_PER_ACCOUNT", "3")
+	t.Setenv("LOGIN_MAX_FAILURES_PER_IP", "100")
+	t.Setenv("LOGIN_LOCKOUT_BASE", "1m")
+	t.Setenv("LOGIN_LOCKOUT_MAX", "4m")
+	return NewLoginGuard(store)
+}
+
+func TestLoginGuardLocksOutWithBackoff(t *testing.T) {
+	ctx := context.Background()
+	guard := newTestLoginGuard(t, NewMemoryLoginAttemptStore())
+	account := AccountKey(" Alice@Example.com ")
+
+	for i := 0; i < 2; i++ {
+		guard.RegisterFailure(ctx, account, "10.0.0.1")
+	}
+	if _, err := guard.Check(ctx, account, "10.0.0.1"); err != nil {
+		t.Fatalf("expected no lockout below the threshold, got %v", err)
+	}
+
+	// Desde el umbral cada fallo duplica el bloqueo, hasta LOGIN_LOCKOUT_MAX
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+		guard.RegisterFailure(ctx, account, "10.0.0.1")
+		remaining, err := guard.Check(ctx, AccountKey("alice@example.com"), "10.0.0.2")
+		if !errors.Is(err, ErrTooManyAttempts) || remaining > want || remaining < want-time.Second {
+			t.Fatalf("expected a lockout of %s, got %s (%v)", want, remaining, err)
+		}
+	}
+
+	// Desbloquear la cuenta borra también los intentos
+	if err := guard.Unlock(ctx, account); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if _, err := guard.Check(ctx, account, "10.0.0.1"); err != nil {
+		t.Fatalf("expected no lockout after Unlock, got %v", err)
+	}
+	guard.RegisterFailure(ctx, account, "10.0.0.1")
+	if _, err := guard.Check(ctx, account, "10.0.0.1"); err != nil {
+		t.Fatalf("expected the failures to start over after Unlock, got %v", err)
+	}
+}
+
+func TestLoginGuardSuccessResetsOnlyTheAccount(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("LOGIN_MAX_FAILURES_PER_IP", "2")
+	store := NewMemoryLoginAttemptStore()
+	guard := NewLoginGuard(store)
+
+	guard.RegisterFailure(ctx, AccountKey("alice@example.com"), "10.0.0.1")
+	guard.RegisterSuccess(ctx, AccountKey("alice@example.com"), "10.0.0.1")
+	if failures, _ := store.RegisterFailure(ctx, AccountKey("alice@example.com"), time.Hour); failures != 1 {
+		t.Fatalf("expected the account failures to start over, got %d", failures)
+	}
+
+	// La IP sigue sumando: el segundo fallo desde ella la bloquea para cualquier cuenta
+	guard.RegisterFailure(ctx, AccountKey("bob@example.com"), "10.0.0.1")
+	if _, err := guard.Check(ctx, AccountKey("carol@example.com"), "10.0.0.1"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("expected the IP to be locked, got %v", err)
+	}
+}
+
+func TestMemoryLoginAttemptStoreEvictsExpiredKeys(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryLoginAttemptStore()
+
+	for _, key := range []string{"ip:1", "ip:2", "ip:3"} {
+		if _, err := store.RegisterFailure(ctx, key, time.Hour); err != nil {
+			t.Fatalf("RegisterFailure: %v", err)
+		}
+	}
+	if err := store.Lock(ctx, "ip:2", time.Hour); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	// Vencen ip:1 e ip:3; ip:2 sigue bloqueada aunque sus intentos también venzan
+	past := time.Now().Add(-time.Minute)
+	for _, key := range []string{"ip:1", "ip:2", "ip:3"} {
+		store.attempts[key].Value.(*memoryAttempts).expiresAt = past
+	}
+
+	if _, err := store.RegisterFailure(ctx, "ip:4", time.Hour); err != nil {
+		t.Fatalf("RegisterFailure: %v", err)
+	}
+	for _, key := range []string{"ip:1", "ip:3"} {
+		if _, ok := store.attempts[key]; ok {
+			t.Fatalf("expected the expired key %s to be evicted", key)
+		}
+	}
+	if remaining, _ := store.LockedFor(ctx, "ip:2"); remaining <= 0 {
+		t.Fatal("expected ip:2 to stay locked")
+	}
+	if len(store.attempts) != store.order.Len() {
+		t.Fatalf("the map and the list are out of sync: %d keys, %d elements", len(store.attempts), store.order.Len())
+	}
+}
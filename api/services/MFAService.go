@@ -0,0 +1,336 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+)
+
+type MFAInterface interface {
+	BeginEnrollment(ctx context.Context, userId uint) (secret string, provisioningURI string, err error)
+	ConfirmEnrollment(ctx context.Context, userId uint, code string) (*models.User, []string, error)
+	Disable(ctx context.Context, userId uint, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userId uint, code string) ([]string, error)
+	VerifyLogin(ctx context.Context, mfaToken string, code string, recoveryCode string) (*models.User, error)
+	ResetForUser(ctx context.Context, userId uint) error
+}
+
+type MFAService struct {
+	store repositories.Store
+}
+
+func NewMFAService(store repositories.Store) *MFAService {
+	return &MFAService{store: store}
+}
+
+func (s *MFAService) repos(ctx context.Context) repositories.Store {
+	return repositories.StoreFrom(ctx, s.store)
+}
+
+var (
+	ErrMFAAlreadyEnabled = NewError(KindConflict, "MFA_ALREADY_ENABLED", "two-factor authentication is already enabled")
+	ErrMFANotEnrolled    = NewError(KindValidation, "MFA_NOT_ENROLLED", "two-factor authentication enrollment has not been started")
+	ErrMFANotEnabled     = NewError(KindValidation, "MFA_NOT_ENABLED", "two-factor authentication is not enabled")
+	ErrInvalidMFACode    = NewError(KindUnauthorized, "INVALID_MFA_CODE", "invalid two-factor authentication code")
+)
+
+const (
+	totpDigits        = 6
+	totpPeriod        = 30
+	recoveryCodeCount = 10
+)
+
+func (s *MFAService) BeginEnrollment(ctx context.Context, userId uint) (string, string, error) {
+	users := s.repos(ctx).Users()
+	user, err := users.FindByID(ctx, userId)
+	if err != nil {
+		return "", "", notFoundAs(err, ErrUserNotFound)
+	}
+	if user.TOTPEnabled {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	if err := users.Save(ctx, user); err != nil {
+		return "", "", err
+	}
+
+	return secret, totpProvisioningURI(user.Email, secret), nil
+}
+
+// ConfirmEnrollment activa 2FA si el código corresponde al secreto generado en
+// BeginEnrollment. Devuelve el usuario actualizado y los códigos de recuperación,
+// que solo se muestran esta vez.
+func (s *MFAService) ConfirmEnrollment(ctx context.Context, userId uint, code string) (*models.User, []string, error) {
+	user, err := s.repos(ctx).Users().FindByID(ctx, userId)
+	if err != nil {
+		return nil, nil, notFoundAs(err, ErrUserNotFound)
+	}
+	if user.TOTPEnabled {
+		return nil, nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, nil, ErrMFANotEnrolled
+	}
+
+	step, ok := validateTOTP(user.TOTPSecret, code, user.TOTPLastStep, time.Now())
+	if !ok {
+		return nil, nil, ErrInvalidMFACode
+	}
+
+	var codes []string
+	err = repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, tx repositories.Store) error {
+		user.TOTPEnabled = true
+		user.TOTPLastStep = step
+		if err := tx.Users().Save(ctx, user); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(ctx, tx.RecoveryCodes(), user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, codes, nil
+}
+
+// Disable desactiva 2FA. Pide un código TOTP o de recuperación válido.
+func (s *MFAService) Disable(ctx context.Context, userId uint, code string) error {
+	user, err := s.checkCode(ctx, userId, code)
+	if err != nil {
+		return err
+	}
+	return s.clearMFA(ctx, user)
+}
+
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userId uint, code string) ([]string, error) {
+	user, err := s.checkCode(ctx, userId, code)
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err = repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, tx repositories.Store) error {
+		var err error
+		codes, err = replaceRecoveryCodes(ctx, tx.RecoveryCodes(), user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// VerifyLogin canjea el token "mfa_pending" del login más un código TOTP o de
+// recuperación por el usuario, listo para emitir el par de tokens normal
+func (s *MFAService) VerifyLogin(ctx context.Context, mfaToken string, code string, recoveryCode string) (*models.User, error) {
+	claims, err := ValidateToken(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != "mfa_pending" {
+		return nil, ErrInvalidToken
+	}
+	repos := s.repos(ctx)
+	if err := checkSession(ctx, repos.Users(), claims); err != nil {
+		return nil, err
+	}
+
+	user, err := repos.Users().FindByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	if recoveryCode != "" {
+		if !useRecoveryCode(ctx, repos.RecoveryCodes(), user.ID, recoveryCode) {
+			return nil, ErrInvalidMFACode
+		}
+		return user, nil
+	}
+
+	if err := consumeTOTP(ctx, repos.Users(), user, code); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ResetForUser le quita 2FA a un usuario que perdió el autenticador y sus códigos (solo administradores)
+func (s *MFAService) ResetForUser(ctx context.Context, userId uint) error {
+	user, err := s.repos(ctx).Users().FindByID(ctx, userId)
+	if err != nil {
+		return notFoundAs(err, ErrUserNotFound)
+	}
+	return s.clearMFA(ctx, user)
+}
+
+// checkCode valida un código TOTP o de recuperación de un usuario con 2FA activo
+func (s *MFAService) checkCode(ctx context.Context, userId uint, code string) (*models.User, error) {
+	repos := s.repos(ctx)
+	user, err := repos.Users().FindByID(ctx, userId)
+	if err != nil {
+		return nil, notFoundAs(err, ErrUserNotFound)
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	if consumeTOTP(ctx, repos.Users(), user, code) == nil || useRecoveryCode(ctx, repos.RecoveryCodes(), user.ID, code) {
+		return user, nil
+	}
+	return nil, ErrInvalidMFACode
+}
+
+func (s *MFAService) clearMFA(ctx context.Context, user *models.User) error {
+	return repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, tx repositories.Store) error {
+		user.TOTPEnabled = false
+		user.TOTPSecret = ""
+		user.TOTPLastStep = 0
+		if err := tx.Users().Save(ctx, user); err != nil {
+			return err
+		}
+		return tx.RecoveryCodes().DeleteByUser(ctx, user.ID)
+	})
+}
+
+// consumeTOTP valida el código y guarda su paso de tiempo, así no se puede volver a usar
+func consumeTOTP(ctx context.Context, users repositories.UserRepository, user *models.User, code string) error {
+	step, ok := validateTOTP(user.TOTPSecret, code, user.TOTPLastStep, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	advanced, err := users.AdvanceTOTPStep(ctx, user.ID, step)
+	if err != nil {
+		return err
+	}
+	if !advanced {
+		return ErrInvalidMFACode
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+// replaceRecoveryCodes borra los códigos anteriores y genera otros nuevos
+func replaceRecoveryCodes(ctx context.Context, recoveryCodes repositories.RecoveryCodeRepository, userId uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buffer := make([]byte, 5)
+		if _, err := rand.Read(buffer); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(buffer)
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	if err := recoveryCodes.Replace(ctx, userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func useRecoveryCode(ctx context.Context, recoveryCodes repositories.RecoveryCodeRepository, userId uint, code string) bool {
+	used, err := recoveryCodes.Use(ctx, userId, hashToken(normalizeRecoveryCode(code)), time.Now())
+	return err == nil && used
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// requiresMFAEnrollment indica si el usuario es administrador, no tiene 2FA y
+// los administradores están obligados a usarlo
+func requiresMFAEnrollment(ctx context.Context, settings repositories.SettingRepository, user *models.User) bool {
+	if user.TOTPEnabled {
+		return false
+	}
+	for _, role := range user.Roles {
+		if role.Name == "Administrador" {
+			return getBoolSetting(ctx, settings, SettingRequireAdmin2FA, false)
+		}
+	}
+	return false
+}
+
+// --- TOTP (RFC 6238, HMAC-SHA1, 6 dígitos, pasos de 30 segundos) ---
+
+func generateTOTPSecret() (string, error) {
+	buffer := make([]byte, 20)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buffer), nil
+}
+
+// totpProvisioningURI es la URI otpauth:// que las apps de autenticación leen desde un código QR
+func totpProvisioningURI(account string, secret string) string {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "Task Manager"
+	}
+
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(totpDigits))
+	values.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// validateTOTP acepta el código del paso actual y de los pasos vecinos (por
+// desfasajes de reloj), siempre que sea posterior a lastStep. Devuelve el paso usado.
+func validateTOTP(secret string, code string, lastStep int64, at time.Time) (int64, bool) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := at.Unix() / totpPeriod
+	for _, step := range []int64{current - 1, current, current + 1} {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func totpCode(key []byte, step int64) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
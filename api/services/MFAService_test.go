@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTOTP calcula el código del paso actual más offset
+func testTOTP(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		t.Fatalf("decoding secret: %v", err)
+	}
+	return totpCode(key, time.Now().Unix()/totpPeriod+offset)
+}
+
+func TestMFAEnrollmentAndLogin(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	user := registerTestUser(t, store, "alice", "alice@example.com")
+	service := NewMFAService(store)
+
+	secret, _, err := service.BeginEnrollment(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("BeginEnrollment: %v", err)
+	}
+	code := testTOTP(t, secret, 0)
+	enrolled, recoveryCodes, err := service.ConfirmEnrollment(ctx, user.ID, code)
+	if err != nil {
+		t.Fatalf("ConfirmEnrollment: %v", err)
+	}
+	if !enrolled.TOTPEnabled || len(recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("expected 2FA enabled with %d recovery codes, got %v and %d", recoveryCodeCount, enrolled.TOTPEnabled, len(recoveryCodes))
+	}
+
+	mfaToken, err := NewTokenService(store).GenerateMFAPendingToken(ctx, enrolled)
+	if err != nil {
+		t.Fatalf("GenerateMFAPendingToken: %v", err)
+	}
+
+	// El código usado para confirmar el alta no se puede repetir
+	if _, err := service.VerifyLogin(ctx, mfaToken, code, ""); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("expected a replayed code to be rejected, got %v", err)
+	}
+
+	if _, err := service.VerifyLogin(ctx, mfaToken, "", recoveryCodes[0]); err != nil {
+		t.Fatalf("VerifyLogin with a recovery code: %v", err)
+	}
+	if _, err := service.VerifyLogin(ctx, mfaToken, "", recoveryCodes[0]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("expected a used recovery code to be rejected, got %v", err)
+	}
+
+	if err := service.Disable(ctx, user.ID, testTOTP(t, secret, 1)); err != nil {
+		t.Fatalf("Disable: %v", err)
+	}
+	disabled, err := store.Users().FindByID(ctx, user.ID)
+	if err != nil || disabled.TOTPEnabled || disabled.TOTPSecret != "" {
+		t.Fatalf("expected 2FA to be cleared, got %+v (%v)", disabled, err)
+	}
+	if _, err := service.VerifyLogin(ctx, mfaToken, "", recoveryCodes[1]); err == nil {
+		t.Fatal("expected recovery codes to be removed with 2FA")
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		t.Fatalf("generateTOTPSecret: %v", err)
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decoding secret: %v", err)
+	}
+	at := time.Unix(1_700_000_000, 0)
+	current := at.Unix() / totpPeriod
+
+	// Se aceptan el paso actual y sus vecinos por desfasajes de reloj
+	for _, step := range []int64{current - 1, current, current + 1} {
+		if used, ok := validateTOTP(secret, totpCode(key, step), 0, at); !ok || used != step {
+			t.Fatalf("expected step %d to be accepted, got %d (%v)", step, used, ok)
+		}
+	}
+	for _, step := range []int64{current - 2, current + 2} {
+		if _, ok := validateTOTP(secret, totpCode(key, step), 0, at); ok {
+			t.Fatalf("expected step %d to be rejected", step)
+		}
+	}
+
+	// Un paso igual o anterior al último usado no vale aunque el código sea correcto
+	if _, ok := validateTOTP(secret, totpCode(key, current), current, at); ok {
+		t.Fatal("expected a replayed step to be rejected")
+	}
+	if _, ok := validateTOTP(secret, "12345", 0, at); ok {
+		t.Fatal("expected a short code to be rejected")
+	}
+}
+
+func TestRegenerateRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	user := registerTestUser(t, store, "alice", "alice@example.com")
+	service := NewMFAService(store)
+
+	secret, _, err := service.BeginEnrollment(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("BeginEnrollment: %v", err)
+	}
+	enrolled, oldCodes, err := service.ConfirmEnrollment(ctx, user.ID, testTOTP(t, secret, 0))
+	if err != nil {
+		t.Fatalf("ConfirmEnrollment: %v", err)
+	}
+	mfaToken, err := NewTokenService(store).GenerateMFAPendingToken(ctx, enrolled)
+	if err != nil {
+		t.Fatalf("GenerateMFAPendingToken: %v", err)
+	}
+
+	if _, err := service.RegenerateRecoveryCodes(ctx, user.ID, "00000-00000"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("expected ErrInvalidMFACode without a valid code, got %v", err)
+	}
+	newCodes, err := service.RegenerateRecoveryCodes(ctx, user.ID, oldCodes[0])
+	if err != nil {
+		t.Fatalf("RegenerateRecoveryCodes: %v", err)
+	}
+	if len(newCodes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", recoveryCodeCount, len(newCodes))
+	}
+
+	// Los códigos anteriores dejan de valer
+	if _, err := service.VerifyLogin(ctx, mfaToken, "", oldCodes[1]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("expected an old recovery code to be rejected, got %v", err)
+	}
+	// Mayúsculas, espacios y guiones no importan
+	typed := "  " + strings.ToUpper(strings.ReplaceAll(newCodes[0], "-", "")) + " "
+	if _, err := service.VerifyLogin(ctx, mfaToken, "", typed); err != nil {
+		t.Fatalf("VerifyLogin with a retyped recovery code: %v", err)
+	}
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+type OIDCInterface interface {
+	Enabled() bool
+	BeginLogin(ctx context.Context) (authURL string, stateToken string, err error)
+	CompleteLogin(ctx context.Context, code string, state string, stateToken string) (*models.User, error)
+}
+
+// OIDCService implementa el login con un proveedor OpenID Connect usando
+// authorization code con PKCE
+type OIDCService struct {
+	store                repositories.Store
+	issuer               string
+	clientID             string
+	clientSecret         string
+	redirectURL          string
+	scopes               []string
+	groupsClaim          string
+	roles                roleMapper
+	requireVerifiedEmail bool
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+var (
+	ErrOIDCDisabled       = NewError(KindNotFound, "SSO_DISABLED", "single sign-on is not configured")
+	ErrOIDCInvalidState   = NewError(KindUnauthorized, "SSO_INVALID_STATE", "invalid or expired login state")
+	ErrOIDCEmailRequired  = NewError(KindUnauthorized, "SSO_EMAIL_REQUIRED", "identity provider did not return a verified email")
+	ErrOIDCExchangeFailed = NewError(KindUnauthorized, "SSO_EXCHANGE_FAILED", "failed to exchange authorization code")
+	ErrOIDCInvalidIDToken = NewError(KindUnauthorized, "SSO_INVALID_ID_TOKEN", "invalid id token")
+	ErrOIDCAccountExists  = NewError(KindConflict, "SSO_ACCOUNT_EXISTS", "an account with this email already exists and cannot be linked to single sign-on")
+)
+
+const oidcStateDuration = 10 * time.Minute
+
+// NewOIDCServiceFromEnv arma el servicio con las variables OIDC_*; sin
+// OIDC_ISSUER el login por SSO queda deshabilitado
+func NewOIDCServiceFromEnv(store repositories.Store) *OIDCService {
+	return NewOIDCService(store, OIDCConfig{
+		Issuer:               os.Getenv("OIDC_ISSUER"),
+		ClientID:             os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:         os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:          os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:               splitList(os.Getenv("OIDC_SCOPES"), " ,"),
+		GroupsClaim:          os.Getenv("OIDC_GROUPS_CLAIM"),
+		RoleMapping:          os.Getenv("OIDC_ROLE_MAPPING"),
+		DefaultRole:          os.Getenv("OIDC_DEFAULT_ROLE"),
+		RequireVerifiedEmail: os.Getenv("OIDC_REQUIRE_VERIFIED_EMAIL") != "false",
+	})
+}
+
+// OIDCConfig son las opciones del servicio; los campos vacíos usan los valores por defecto
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes se piden además de openid
+	Scopes               []string
+	GroupsClaim          string
+	RoleMapping          string
+	DefaultRole          string
+	RequireVerifiedEmail bool
+}
+
+func NewOIDCService(store repositories.Store, oidcConfig OIDCConfig) *OIDCService {
+	redirectURL := oidcConfig.RedirectURL
+	if redirectURL == "" {
+		redirectURL = appBaseURL() + "/api/auth/oidc/callback"
+	}
+
+	scopes := []string{oidc.ScopeOpenID, "profile", "email"}
+	if len(oidcConfig.Scopes) > 0 {
+		scopes = append([]string{oidc.ScopeOpenID}, oidcConfig.Scopes...)
+	}
+
+	groupsClaim := oidcConfig.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	return &OIDCService{
+		store:                store,
+		issuer:               oidcConfig.Issuer,
+		clientID:             oidcConfig.ClientID,
+		clientSecret:         oidcConfig.ClientSecret,
+		redirectURL:          redirectURL,
+		scopes:               scopes,
+		groupsClaim:          groupsClaim,
+		roles:                newRoleMapper(oidcConfig.RoleMapping, oidcConfig.DefaultRole),
+		requireVerifiedEmail: oidcConfig.RequireVerifiedEmail,
+	}
+}
+
+func (s *OIDCService) Enabled() bool {
+	return s.issuer != "" && s.clientID != ""
+}
+
+// oauthConfig descubre el proveedor la primera vez que se usa (y reintenta si falla)
+func (s *OIDCService) oauthConfig(ctx context.Context) (*oidc.Provider, *oauth2.Config, error) {
+	if !s.Enabled() {
+		return nil, nil, ErrOIDCDisabled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.provider == nil {
+		provider, err := oidc.NewProvider(ctx, s.issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+		}
+		s.provider = provider
+	}
+
+	return s.provider, &oauth2.Config{
+		ClientID:     s.clientID,
+		ClientSecret: s.clientSecret,
+		RedirectURL:  s.redirectURL,
+		Endpoint:     s.provider.Endpoint(),
+		Scopes:       s.scopes,
+	}, nil
+}
+
+// BeginLogin devuelve la URL del proveedor y el token firmado con state, nonce y
+// code verifier que el handler guarda en una cookie hasta el callback
+func (s *OIDCService) BeginLogin(ctx context.Context) (string, string, error) {
+	_, oauthConfig, err := s.oauthConfig(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := generateRandomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := generateRandomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	stateToken, err := signClaims(models.OIDCStateClaims{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		TokenType:    "oidc_state",
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(oidcStateDuration).Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL := oauthConfig.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return authURL, stateToken, nil
+}
+
+// oidcIdentity son los datos del id_token que se usan para vincular la cuenta
+type oidcIdentity struct {
+	Subject           string   `json:"-"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+	Groups            []string `json:"-"`
+}
+
+// CompleteLogin valida el callback, canjea el código y devuelve el usuario local,
+// creándolo o vinculándolo por email si hace falta
+func (s *OIDCService) CompleteLogin(ctx context.Context, code string, state string, stateToken string) (*models.User, error) {
+	provider, oauthConfig, err := s.oauthConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stateClaims := &models.OIDCStateClaims{}
+	if err := parseClaims(stateToken, stateClaims); err != nil || stateClaims.TokenType != "oidc_state" || stateClaims.State != state {
+		return nil, ErrOIDCInvalidState
+	}
+
+	oauthToken, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(stateClaims.CodeVerifier))
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v\n", err)
+		return nil, ErrOIDCExchangeFailed
+	}
+	rawIDToken, ok := oauthToken.Extra("id_token").(string)
+	if !ok {
+		return nil, ErrOIDCInvalidIDToken
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: s.clientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		log.Printf("OIDC id token verification failed: %v\n", err)
+		return nil, ErrOIDCInvalidIDToken
+	}
+	if idToken.Nonce != stateClaims.Nonce {
+		return nil, ErrOIDCInvalidIDToken
+	}
+
+	identity, err := s.identityFromToken(idToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.provisionUser(ctx, identity)
+}
+
+func (s *OIDCService) identityFromToken(idToken *oidc.IDToken) (*oidcIdentity, error) {
+	identity := &oidcIdentity{Subject: idToken.Subject}
+	if err := idToken.Claims(identity); err != nil {
+		return nil, ErrOIDCInvalidIDToken
+	}
+
+	// El claim de grupos es configurable, así que se lee aparte
+	var rawClaims map[string]interface{}
+	if err := idToken.Claims(&rawClaims); err != nil {
+		return nil, ErrOIDCInvalidIDToken
+	}
+	switch groups := rawClaims[s.groupsClaim].(type) {
+	case []interface{}:
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				identity.Groups = append(identity.Groups, name)
+			}
+		}
+	case string:
+		identity.Groups = []string{groups}
+	}
+
+	identity.Email = strings.ToLower(strings.TrimSpace(identity.Email))
+	// Vincular por un email sin verificar permitiría tomar cuentas ajenas
+	if identity.Email == "" || (s.requireVerifiedEmail && !identity.EmailVerified) {
+		return nil, ErrOIDCEmailRequired
+	}
+	return identity, nil
+}
+
+// provisionUser busca la cuenta por el subject del proveedor o por email y si
+// no existe la crea. Por email solo se vincula una cuenta local y cuando el
+// proveedor afirma que el email está verificado; si no, un proveedor que acepta
+// emails sin verificar podría tomar cualquier cuenta, incluidas las de
+// administradores o de LDAP. Con OIDC_ROLE_MAPPING los roles se sincronizan en cada login.
+func (s *OIDCService) provisionUser(ctx context.Context, identity *oidcIdentity) (*models.User, error) {
+	var user *models.User
+	err := repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, tx repositories.Store) error {
+		users := tx.Users()
+		var err error
+		user, err = users.FindByExternalSubject(ctx, models.AuthProviderOIDC, identity.Subject)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			user, err = users.FindByEmail(ctx, identity.Email)
+			if err == nil && (user.AuthProvider != models.AuthProviderLocal || !identity.EmailVerified) {
+				return ErrOIDCAccountExists
+			}
+		}
+
+		now := time.Now()
+		switch {
+		case err == nil && user.AuthProvider == models.AuthProviderLocal:
+			// Cuenta local: queda vinculada al proveedor y deja de usar la contraseña local
+			user.AuthProvider = models.AuthProviderOIDC
+			user.ExternalSubject = &identity.Subject
+			if !user.EmailVerified {
+				user.EmailVerified = true
+				user.EmailVerifiedAt = &now
+			}
+			if err := users.Save(ctx, user); err != nil {
+				return err
+			}
+		case err == nil:
+			// Cuenta ya vinculada a este subject
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			username, err := availableUsername(ctx, users, identity.PreferredUsername, identity.Email)
+			if err != nil {
+				return err
+			}
+			// El email queda verificado solo si el proveedor lo verificó
+			user = &models.User{
+				Username:        username,
+				Email:           identity.Email,
+				EmailVerified:   identity.EmailVerified,
+				AuthProvider:    models.AuthProviderOIDC,
+				ExternalSubject: &identity.Subject,
+			}
+			if identity.EmailVerified {
+				user.EmailVerifiedAt = &now
+			}
+			if err := users.Create(ctx, user); err != nil {
+				return err
+			}
+			if !s.roles.enabled() {
+				return replaceUserRoles(ctx, tx, user, s.roles.roles(nil))
+			}
+		default:
+			return err
+		}
+
+		if s.roles.enabled() {
+			return replaceUserRoles(ctx, tx, user, s.roles.roles(identity.Groups))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repositories.StoreFrom(ctx, s.store).Users().FindByID(ctx, user.ID)
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// hashNewPassword valida la contraseña contra la política y contra las últimas
+// contraseñas del usuario (la actual incluida) y devuelve su hash
+func hashNewPassword(ctx context.Context, users repositories.UserRepository, user *models.User, password string) (string, error) {
+	policy := CurrentPasswordPolicy()
+	if err := policy.Validate(password, user.Username, user.Email); err != nil {
+		return "", err
+	}
+
+	if user.ID != 0 && policy.HistorySize > 0 {
+		history, err := users.PasswordHistory(ctx, user.ID, policy.HistorySize-1)
+		if err != nil {
+			return "", err
+		}
+		previous := append([]string{user.Password}, history...)
+
+		for _, hash := range previous {
+			if hash != "" && bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+				return "", ErrPasswordReused
+			}
+		}
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// savePassword guarda el hash nuevo, pasa el anterior al historial y marca la
+// contraseña como conforme a la política vigente. Con revokeSessions invalida
+// los tokens emitidos hasta ahora.
+func savePassword(ctx context.Context, users repositories.UserRepository, user *models.User, hashed string, revokeSessions bool) error {
+	policy := CurrentPasswordPolicy()
+	if user.Password != "" && policy.HistorySize > 0 {
+		// Solo se conservan las últimas HistorySize-1 anteriores; con la actual son HistorySize
+		if err := users.AddPasswordHistory(ctx, user.ID, user.Password, policy.HistorySize-1); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	previous := *user
+	user.Password = hashed
+	user.PasswordChangedAt = &now
+	user.PasswordPolicyVersion = policy.Version
+	if err := users.UpdatePassword(ctx, user, revokeSessions); err != nil {
+		*user = previous
+		return err
+	}
+	return nil
+}
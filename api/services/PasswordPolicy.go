@@ -0,0 +1,205 @@
+package services
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lucapierini/project-go-task_manager/config"
+	"github.com/lucapierini/project-go-task_manager/models"
+)
+
+// PasswordPolicy son las reglas para las contraseñas locales. Version se sube
+// (PASSWORD_POLICY_VERSION) para obligar a cambiar las contraseñas anteriores.
+type PasswordPolicy struct {
+	MinLength     int  `json:"min_length"`
+	RequireUpper  bool `json:"require_upper"`
+	RequireLower  bool `json:"require_lower"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+	HistorySize   int  `json:"history_size"`
+	Version       uint `json:"version"`
+	CheckBreached bool `json:"check_breached"`
+
+	breached BreachedPasswordChecker
+}
+
+var (
+	ErrWeakPassword              = NewError(KindValidation, "WEAK_PASSWORD", "password does not meet the password policy")
+	ErrPasswordReused            = NewError(KindValidation, "PASSWORD_REUSED", "password was used recently")
+	ErrPasswordManagedExternally = NewError(KindValidation, "PASSWORD_MANAGED_EXTERNALLY", "password is managed by an external identity provider")
+)
+
+// PasswordPolicyError detalla qué reglas no se cumplen
+type PasswordPolicyError struct {
+	Violations []FieldError
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message
+	}
+	return ErrWeakPassword.Error() + ": " + strings.Join(messages, ", ")
+}
+
+// asError arma el error de validación con una entrada por regla incumplida
+func (e *PasswordPolicyError) asError() *Error {
+	return ErrWeakPassword.WithFields(e.Violations...)
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+var (
+	passwordPolicy     *PasswordPolicy
+	passwordPolicyOnce sync.Once
+)
+
+// CurrentPasswordPolicy lee la política de las variables PASSWORD_* la primera vez que se usa
+func CurrentPasswordPolicy() *PasswordPolicy {
+	passwordPolicyOnce.Do(func() {
+		passwordPolicy = &PasswordPolicy{
+			MinLength:     config.GetEnvInt("PASSWORD_MIN_LENGTH", 10),
+			RequireUpper:  config.GetEnvBool("PASSWORD_REQUIRE_UPPER", true),
+			RequireLower:  config.GetEnvBool("PASSWORD_REQUIRE_LOWER", true),
+			RequireDigit:  config.GetEnvBool("PASSWORD_REQUIRE_DIGIT", true),
+			RequireSymbol: config.GetEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+			HistorySize:   config.GetEnvInt("PASSWORD_HISTORY", 5),
+			Version:       uint(config.GetEnvInt("PASSWORD_POLICY_VERSION", 1)),
+		}
+
+		if path := os.Getenv("PASSWORD_BREACHED_LIST"); path != "" {
+			list, err := LoadBreachedList(path)
+			if err != nil {
+				log.Printf("Error loading breached password list %s: %v\n", path, err)
+				return
+			}
+			passwordPolicy.breached = list
+			passwordPolicy.CheckBreached = true
+		}
+	})
+	return passwordPolicy
+}
+
+// Validate revisa la contraseña contra las reglas; username y email son los del dueño
+func (p *PasswordPolicy) Validate(password string, username string, email string) error {
+	violations := []FieldError{}
+	violate := func(code string, param string, message string) {
+		violations = append(violations, FieldError{Field: "password", Code: code, Param: param, Message: message})
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violate("min_length", strconv.Itoa(p.MinLength), fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		violate("uppercase", "", "must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		violate("lowercase", "", "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		violate("digit", "", "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violate("symbol", "", "must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+	for _, personal := range []string{strings.ToLower(username), localPart} {
+		if len(personal) >= 3 && strings.Contains(lowered, personal) {
+			violate("personal_info", "", "must not contain the username or email")
+			break
+		}
+	}
+
+	if p.breached != nil {
+		breached, err := p.breached.IsBreached(password)
+		if err != nil {
+			log.Printf("Error checking breached passwords: %v\n", err)
+		} else if breached {
+			violate("breached", "", "appears in a list of breached passwords")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// PasswordChangeRequired indica si la contraseña local es anterior a la política vigente
+func PasswordChangeRequired(user *models.User) bool {
+	return user.AuthProvider == models.AuthProviderLocal && user.PasswordPolicyVersion < CurrentPasswordPolicy().Version
+}
+
+// GenerateRandomPassword genera una contraseña que cumple la política, con al menos
+// un carácter de cada clase
+func GenerateRandomPassword() (string, error) {
+	classes := []string{
+		"ABCDEFGHJKLMNPQRSTUVWXYZ",
+		"abcdefghijkmnopqrstuvwxyz",
+		"23456789",
+		"!#$%&*+-=?@_",
+	}
+	length := CurrentPasswordPolicy().MinLength
+	if length < 20 {
+		length = 20
+	}
+
+	pick := func(alphabet string) (byte, error) {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return 0, err
+		}
+		return alphabet[n.Int64()], nil
+	}
+
+	password := make([]byte, 0, length)
+	all := strings.Join(classes, "")
+	for i := 0; i < length; i++ {
+		alphabet := all
+		if i < len(classes) {
+			alphabet = classes[i]
+		}
+		c, err := pick(alphabet)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	// Mezcla para que los caracteres obligatorios no queden siempre al principio
+	for i := len(password) - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		j := n.Int64()
+		password[i], password[j] = password[j], password[i]
+	}
+	return string(password), nil
+}
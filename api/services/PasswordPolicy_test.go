@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func violationCodes(t *testing.T, err error) []string {
+	t.Helper()
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected a PasswordPolicyError, got %v", err)
+	}
+	codes := []string{}
+	for _, violation := range policyErr.Violations {
+		codes = append(codes, violation.Code)
+	}
+	return codes
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 10, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+
+	if err := policy.Validate("Correct-H0rse", "alice", "alice@example.com"); err != nil {
+		t.Fatalf("expected a valid password, got %v", err)
+	}
+	if codes := violationCodes(t, policy.Validate("short", "alice", "alice@example.com")); strings.Join(codes, ",") != "min_length,uppercase,digit,symbol" {
+		t.Fatalf("unexpected violations %v", codes)
+	}
+	// Ni el usuario ni la parte local del email
+	for _, password := range []string{"Alice-Passw0rd", "Wonderland5-X!"} {
+		if codes := violationCodes(t, policy.Validate(password, "alice", "wonderland5@example.com")); len(codes) != 1 || codes[0] != "personal_info" {
+			t.Fatalf("expected personal_info for %q, got %v", password, codes)
+		}
+	}
+}
+
+func TestPasswordPolicyBreachedList(t *testing.T) {
+	sum := sha1.Sum([]byte("Correct-H0rse"))
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	content := "# HIBP\n" + strings.ToLower(hex.EncodeToString(sum[:])) + ":42\nnot-a-hash\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing list: %v", err)
+	}
+	list, err := LoadBreachedList(path)
+	if err != nil {
+		t.Fatalf("LoadBreachedList: %v", err)
+	}
+
+	policy := &PasswordPolicy{MinLength: 10, CheckBreached: true, breached: list}
+	if codes := violationCodes(t, policy.Validate("Correct-H0rse", "alice", "alice@example.com")); len(codes) != 1 || codes[0] != "breached" {
+		t.Fatalf("expected breached, got %v", codes)
+	}
+	if err := policy.Validate("Battery-Stap1e", "alice", "alice@example.com"); err != nil {
+		t.Fatalf("expected a password off the list to pass, got %v", err)
+	}
+}
+
+func TestChangePasswordRejectsRecentPasswords(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	user := registerTestUser(t, store, "alice", "alice@example.com")
+	service := newTestUserService(store, &fakeMailer{})
+
+	// La actual también cuenta como usada
+	if _, err := service.ChangePassword(ctx, user.ID, testPassword, testPassword); !errors.Is(err, ErrPasswordReused) {
+		t.Fatalf("expected ErrPasswordReused for the current password, got %v", err)
+	}
+	if _, err := service.ChangePassword(ctx, user.ID, testPassword, "Second-Passw0rd"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if _, err := service.ChangePassword(ctx, user.ID, "Second-Passw0rd", testPassword); !errors.Is(err, ErrPasswordReused) {
+		t.Fatalf("expected ErrPasswordReused for a previous password, got %v", err)
+	}
+	if _, err := service.ChangePassword(ctx, user.ID, "wrong", "Third-Passw0rd"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
+func TestExpirePasswordRequiresChange(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	user := registerTestUser(t, store, "alice", "alice@example.com")
+	service := newTestUserService(store, &fakeMailer{})
+	if PasswordChangeRequired(user) {
+		t.Fatal("a new password must follow the current policy")
+	}
+
+	if err := service.ExpirePassword(ctx, user.ID); err != nil {
+		t.Fatalf("ExpirePassword: %v", err)
+	}
+	expired, err := service.GetUserById(ctx, user.ID)
+	if err != nil || !PasswordChangeRequired(expired) {
+		t.Fatalf("expected a password change to be required, got %+v (%v)", expired, err)
+	}
+
+	changed, err := service.ChangePassword(ctx, user.ID, testPassword, "Second-Passw0rd")
+	if err != nil || PasswordChangeRequired(changed) {
+		t.Fatalf("expected the new password to clear the requirement, got %+v (%v)", changed, err)
+	}
+}
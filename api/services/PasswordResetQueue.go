@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// PasswordResetQueue procesa los pedidos de recuperación en segundo plano para
+// que la respuesta (y su demora) sea la misma exista o no la cuenta. Tiene una
+// cantidad fija de workers y una cola acotada, y cada pedido tiene un plazo.
+type PasswordResetQueue struct {
+	service  PasswordResetInterface
+	requests chan string
+	timeout  time.Duration
+}
+
+// NewPasswordResetQueue arranca los workers que atienden la cola
+func NewPasswordResetQueue(service PasswordResetInterface, workers int, size int, timeout time.Duration) *PasswordResetQueue {
+	queue := &PasswordResetQueue{
+		service:  service,
+		requests: make(chan string, size),
+		timeout:  timeout,
+	}
+	for i := 0; i < workers; i++ {
+		go queue.work()
+	}
+	return queue
+}
+
+// Enqueue agrega el pedido sin esperar; si la cola está llena lo descarta y devuelve false
+func (q *PasswordResetQueue) Enqueue(email string) bool {
+	select {
+	case q.requests <- email:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *PasswordResetQueue) work() {
+	for email := range q.requests {
+		ctx, cancel := context.WithTimeout(context.Background(), q.timeout)
+		if err := q.service.RequestPasswordReset(ctx, email); err != nil {
+			log.Printf("Error processing password reset request: %v\n", err)
+		}
+		cancel()
+	}
+}
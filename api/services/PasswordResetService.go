@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/config"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"gorm.io/gorm"
+)
+
+type PasswordResetInterface interface {
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, newPassword string) error
+}
+
+type PasswordResetService struct {
+	store  repositories.Store
+	mailer Mailer
+}
+
+func NewPasswordResetService(store repositories.Store, mailer Mailer) *PasswordResetService {
+	return &PasswordResetService{store: store, mailer: mailer}
+}
+
+func (s *PasswordResetService) repos(ctx context.Context) repositories.Store {
+	return repositories.StoreFrom(ctx, s.store)
+}
+
+var ErrInvalidResetToken = NewError(KindValidation, "INVALID_RESET_TOKEN", "invalid or expired reset token")
+
+// RequestPasswordReset envía un enlace de recuperación si el email tiene cuenta.
+// Si no la tiene (o la cuenta es de un proveedor externo) no hace nada y tampoco
+// devuelve error, para no revelar qué emails existen.
+func (s *PasswordResetService) RequestPasswordReset(ctx context.Context, email string) error {
+	repos := s.repos(ctx)
+	user, err := repos.Users().FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.AuthProvider != models.AuthProviderLocal {
+		return nil
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	ttl := config.GetEnvDuration("PASSWORD_RESET_TTL", 30*time.Minute)
+	resetToken := models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := repos.PasswordResets().Create(ctx, &resetToken); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account. "+
+		"If it was you, open this link to choose a new one:\n%s/reset-password?token=%s\n\n"+
+		"Or send this token to POST /api/auth/reset-password:\n%s\n\n"+
+		"The link can be used once and expires in %s. If you did not ask for it you can ignore this email.",
+		user.Username, appBaseURL(), token, token, ttl)
+	return s.mailer.Send(user.Email, "Reset your password", body)
+}
+
+// ResetPassword cambia la contraseña usando un token de recuperación válido.
+// Invalida el token, cualquier otro token de recuperación pendiente y todas
+// las sesiones (access y refresh tokens) del usuario.
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	return repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, tx repositories.Store) error {
+		now := time.Now()
+		resetToken, err := tx.PasswordResets().FindValid(ctx, hashToken(token), now)
+		if err != nil {
+			return ErrInvalidResetToken
+		}
+
+		// UseAll filtra por used_at, así dos pedidos simultáneos no usan el mismo token
+		used, err := tx.PasswordResets().UseAll(ctx, resetToken.UserID, now)
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return ErrInvalidResetToken
+		}
+
+		users := tx.Users()
+		user, err := users.FindByID(ctx, resetToken.UserID)
+		if err != nil {
+			return ErrInvalidResetToken
+		}
+		hashedPassword, err := hashNewPassword(ctx, users, user, newPassword)
+		if err != nil {
+			return err
+		}
+		return savePassword(ctx, users, user, hashedPassword, true)
+	})
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lucapierini/project-go-task_manager/dto"
+)
+
+const resetPassword = "N3w-Reset-Passw0rd"
+
+func TestResetPasswordUsesTokenOnce(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	user := registerTestUser(t, store, "alice", "alice@example.com")
+	mailer := &fakeMailer{}
+	service := NewPasswordResetService(store, mailer)
+
+	// Un email sin cuenta no da error ni manda correo
+	if err := service.RequestPasswordReset(ctx, "nobody@example.com"); err != nil || len(mailer.sent) != 0 {
+		t.Fatalf("expected no mail for an unknown email, got %+v (%v)", mailer.sent, err)
+	}
+
+	if err := service.RequestPasswordReset(ctx, user.Email); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	first := mailer.mailToken(t)
+	if err := service.RequestPasswordReset(ctx, user.Email); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	second := mailer.mailToken(t)
+	if mailer.last(t).to != user.Email || first == second {
+		t.Fatalf("expected two mails with different tokens, got %+v", mailer.sent)
+	}
+
+	// La contraseña nueva pasa por la política
+	if err := service.ResetPassword(ctx, first, "short"); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("expected ErrWeakPassword, got %v", err)
+	}
+	if err := service.ResetPassword(ctx, first, resetPassword); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	// El token usado y los demás pendientes quedan invalidados
+	for _, token := range []string{first, second, "not-a-token"} {
+		if err := service.ResetPassword(ctx, token, "An0ther-Passw0rd"); !errors.Is(err, ErrInvalidResetToken) {
+			t.Fatalf("expected ErrInvalidResetToken, got %v", err)
+		}
+	}
+
+	users := newTestUserService(store, &fakeMailer{})
+	if _, err := users.LoginUser(ctx, dto.LoginDto{Email: user.Email, Password: resetPassword}); err != nil {
+		t.Fatalf("expected to log in with the new password: %v", err)
+	}
+	reset, err := users.GetUserById(ctx, user.ID)
+	if err != nil || reset.SessionVersion == user.SessionVersion {
+		t.Fatalf("expected the sessions to be revoked, got %+v (%v)", reset, err)
+	}
+}
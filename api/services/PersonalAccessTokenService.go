@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"gorm.io/gorm"
+)
+
+type PersonalAccessTokenInterface interface {
+	CreateToken(ctx context.Context, userId uint, tokenDto dto.PersonalAccessTokenDto) (*models.PersonalAccessToken, string, error)
+	ListTokens(ctx context.Context, userId uint) ([]models.PersonalAccessToken, error)
+	RevokeToken(ctx context.Context, userId uint, tokenId uint) error
+	Validate(ctx context.Context, token string) (*models.Claims, error)
+}
+
+type PersonalAccessTokenService struct {
+	store repositories.Store
+}
+
+func NewPersonalAccessTokenService(store repositories.Store) *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{store: store}
+}
+
+func (s *PersonalAccessTokenService) repos(ctx context.Context) repositories.Store {
+	return repositories.StoreFrom(ctx, s.store)
+}
+
+var (
+	ErrInvalidScope        = NewError(KindValidation, "INVALID_SCOPE", "invalid scope")
+	ErrAccessTokenNotFound = NewError(KindNotFound, "ACCESS_TOKEN_NOT_FOUND", "personal access token not found")
+	ErrInsufficientScope   = NewError(KindForbidden, "INSUFFICIENT_SCOPE", "token does not have the required scope")
+)
+
+const (
+	// PersonalAccessTokenPrefix distingue los tokens personales de los JWT en el header Authorization
+	PersonalAccessTokenPrefix = "tm_pat_"
+
+	defaultPersonalAccessTokenDays = 90
+	// No se actualiza last_used_at en cada request, alcanza con esta precisión
+	lastUsedResolution = time.Minute
+)
+
+// Recursos que se pueden habilitar en un token; cada uno admite :read y :write
+var tokenScopeResources = []string{"projects", "tasks", "users", "trash"}
+
+func validScope(scope string) bool {
+	resource, action, found := strings.Cut(scope, ":")
+	if !found || (action != "read" && action != "write") {
+		return false
+	}
+	for _, r := range tokenScopeResources {
+		if r == resource {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PersonalAccessTokenService) CreateToken(ctx context.Context, userId uint, tokenDto dto.PersonalAccessTokenDto) (*models.PersonalAccessToken, string, error) {
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, scope := range tokenDto.Scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !validScope(scope) {
+			return nil, "", ErrInvalidScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	days := tokenDto.ExpiresInDays
+	if days == 0 {
+		days = defaultPersonalAccessTokenDays
+	}
+
+	secret, err := generateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	token := PersonalAccessTokenPrefix + secret
+
+	accessToken := models.PersonalAccessToken{
+		UserID:    userId,
+		Name:      tokenDto.Name,
+		Prefix:    token[:len(PersonalAccessTokenPrefix)+6],
+		TokenHash: hashToken(token),
+		Scopes:    strings.Join(scopes, ","),
+		ScopeList: scopes,
+		ExpiresAt: time.Now().Add(time.Duration(days) * 24 * time.Hour),
+	}
+	if err := s.repos(ctx).AccessTokens().Create(ctx, &accessToken); err != nil {
+		return nil, "", err
+	}
+
+	// El token en claro solo se devuelve en este momento
+	return &accessToken, token, nil
+}
+
+func (s *PersonalAccessTokenService) ListTokens(ctx context.Context, userId uint) ([]models.PersonalAccessToken, error) {
+	return s.repos(ctx).AccessTokens().ListByUser(ctx, userId)
+}
+
+func (s *PersonalAccessTokenService) RevokeToken(ctx context.Context, userId uint, tokenId uint) error {
+	err := s.repos(ctx).AccessTokens().Delete(ctx, userId, tokenId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAccessTokenNotFound
+	}
+	return err
+}
+
+// Validate busca el token por su hash y arma los claims del dueño con los
+// scopes del token, igual que si fuera un access token
+func (s *PersonalAccessTokenService) Validate(ctx context.Context, token string) (*models.Claims, error) {
+	repos := s.repos(ctx)
+	accessToken, err := repos.AccessTokens().FindByHash(ctx, hashToken(token))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().After(accessToken.ExpiresAt) {
+		return nil, ErrExpiredToken
+	}
+
+	// Un usuario borrado no encuentra resultado y sus tokens dejan de servir
+	user, err := repos.Users().FindByID(ctx, accessToken.UserID)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if accessToken.LastUsedAt == nil || now.Sub(*accessToken.LastUsedAt) > lastUsedResolution {
+		repos.AccessTokens().TouchLastUsed(ctx, accessToken.ID, now)
+	}
+
+	var roleNames []string
+	for _, role := range user.Roles {
+		roleNames = append(roleNames, role.Name)
+	}
+
+	return &models.Claims{
+		UserID:                 user.ID,
+		Roles:                  roleNames,
+		TokenType:              "pat",
+		EmailVerified:          user.EmailVerified,
+		SessionVersion:         user.SessionVersion,
+		MFAEnrollmentRequired:  requiresMFAEnrollment(ctx, repos.Settings(), user),
+		PasswordChangeRequired: PasswordChangeRequired(user),
+		Scopes:                 accessToken.ScopeList,
+		TokenID:                accessToken.ID,
+	}, nil
+}
+
+// HasScope indica si los scopes alcanzan para la acción pedida; write incluye read
+func HasScope(scopes []string, resource string, action string) bool {
+	for _, scope := range scopes {
+		if scope == resource+":"+action || (action == "read" && scope == resource+":write") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lucapierini/project-go-task_manager/dto"
+)
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	user := registerTestUser(t, store, "alice", "alice@example.com")
+	service := NewPersonalAccessTokenService(store)
+
+	if _, _, err := service.CreateToken(ctx, user.ID, dto.PersonalAccessTokenDto{Name: "ci", Scopes: []string{"tasks:delete"}}); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("expected ErrInvalidScope, got %v", err)
+	}
+
+	created, token, err := service.CreateToken(ctx, user.ID, dto.PersonalAccessTokenDto{Name: "ci", Scopes: []string{" Tasks:Write ", "tasks:write", "projects:read"}})
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if !strings.HasPrefix(token, PersonalAccessTokenPrefix) || created.Scopes != "tasks:write,projects:read" {
+		t.Fatalf("unexpected token %q with scopes %q", token, created.Scopes)
+	}
+	if created.TokenHash == token || !strings.HasPrefix(token, created.Prefix) {
+		t.Fatalf("the token must be stored hashed, got %+v", created)
+	}
+
+	claims, err := service.Validate(ctx, token)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if claims.UserID != user.ID || claims.TokenType != "pat" || claims.TokenID != created.ID {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+	// write incluye read, pero nada fuera de los recursos del token
+	if !HasScope(claims.Scopes, "tasks", "read") || !HasScope(claims.Scopes, "tasks", "write") ||
+		!HasScope(claims.Scopes, "projects", "read") || HasScope(claims.Scopes, "projects", "write") || HasScope(claims.Scopes, "users", "read") {
+		t.Fatalf("unexpected scopes %v", claims.Scopes)
+	}
+
+	// Solo el dueño lo revoca
+	other := registerTestUser(t, store, "other", "other@example.com")
+	if err := service.RevokeToken(ctx, other.ID, created.ID); !errors.Is(err, ErrAccessTokenNotFound) {
+		t.Fatalf("expected ErrAccessTokenNotFound for another user, got %v", err)
+	}
+	if err := service.RevokeToken(ctx, user.ID, created.ID); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if _, err := service.Validate(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected a revoked token to be rejected, got %v", err)
+	}
+}
+
+func TestExpiredPersonalAccessToken(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	user := registerTestUser(t, store, "alice", "alice@example.com")
+	service := NewPersonalAccessTokenService(store)
+
+	_, token, err := service.CreateToken(ctx, user.ID, dto.PersonalAccessTokenDto{Name: "old", Scopes: []string{"tasks:read"}, ExpiresInDays: -1})
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if _, err := service.Validate(ctx, token); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("expected ErrExpiredToken, got %v", err)
+	}
+}
@@ -1,229 +1,294 @@
 package services
 
 import (
+	"context"
 	"errors"
 
-	"github.com/lucapierini/project-go-task_manager/config"
 	"github.com/lucapierini/project-go-task_manager/dto"
 	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
 )
 
 type ProjectInterface interface {
-	CreateProject(projectDto dto.ProjectDto) (*models.Project, error)
-	GetProjectById(id uint) (*models.Project, error)
-	ListProjects() ([]models.Project, error)
-	UpdateProject(id uint, projectDto dto.ProjectDto) (*models.Project, error)
-	ListProjectsByUserId(userId uint) ([]models.Project, error)
-	DeleteProject(id uint) error
-	AddUserToProject(projectId uint, userId uint) error
-	RemoveUserFromProject(projectId uint, userId uint) error
-	AddTaskToProject(projectId uint, taskId uint) error
-	RemoveTaskFromProject(projectId uint, taskId uint) error
+	CreateProject(ctx context.Context, projectDto dto.ProjectDto) (*models.Project, error)
+	GetProjectById(ctx context.Context, id uint) (*models.Project, error)
+	ListProjects(ctx context.Context) ([]models.Project, error)
+	UpdateProject(ctx context.Context, id uint, version uint, projectDto dto.ProjectDto) (*models.Project, error)
+	ListProjectsByUserId(ctx context.Context, userId uint) ([]models.Project, error)
+	DeleteProject(ctx context.Context, id uint, policy string) (*models.ProjectDeletionImpact, error)
+	PlanProjectDeletion(ctx context.Context, id uint, policy string) (*models.ProjectDeletionImpact, error)
+	AddUserToProject(ctx context.Context, projectId uint, userId uint) error
+	RemoveUserFromProject(ctx context.Context, projectId uint, userId uint) error
+	AddTaskToProject(ctx context.Context, projectId uint, taskId uint) error
+	RemoveTaskFromProject(ctx context.Context, projectId uint, taskId uint) error
+	AddCoOwnerToProject(ctx context.Context, projectId uint, userId uint, actorId uint) error
+	RemoveCoOwnerFromProject(ctx context.Context, projectId uint, userId uint, actorId uint) error
+	ProposeTransfer(ctx context.Context, projectId uint, toUserId uint, actorId uint) (*models.ProjectTransfer, error)
+	CancelTransfer(ctx context.Context, projectId uint, actorId uint) error
+	ListIncomingTransfers(ctx context.Context, userId uint) ([]models.ProjectTransfer, error)
+	AcceptTransfer(ctx context.Context, transferId uint, userId uint) (*models.Project, error)
+	DeclineTransfer(ctx context.Context, transferId uint, userId uint) error
 }
 
-type ProjectService struct{}
+var (
+	ErrUserAlreadyInProject  = NewError(KindConflict, "USER_ALREADY_IN_PROJECT", "user is already in project")
+	ErrNotProjectOwner       = NewError(KindForbidden, "NOT_PROJECT_OWNER", "only the project owner can do this")
+	ErrInvalidTransferTarget = NewError(KindValidation, "INVALID_TRANSFER_TARGET", "invalid transfer target")
+	ErrTransferNotFound      = NewError(KindNotFound, "TRANSFER_NOT_FOUND", "transfer not found")
+	ErrTransferNotPending    = NewError(KindConflict, "TRANSFER_NOT_PENDING", "transfer is no longer pending")
+	ErrAlreadyCoOwner        = NewError(KindConflict, "ALREADY_CO_OWNER", "user is already a co-owner of the project")
+	ErrNotCoOwner            = NewError(KindValidation, "NOT_CO_OWNER", "user is not a co-owner of the project")
+	ErrProjectAlreadyExists  = NewError(KindConflict, "PROJECT_ALREADY_EXISTS", "project already exists")
+	ErrUserNotInProject      = NewError(KindNotFound, "USER_NOT_IN_PROJECT", "user is not in project")
+	ErrTaskAlreadyInProject  = NewError(KindConflict, "TASK_ALREADY_IN_PROJECT", "task is already in project")
+	ErrTaskNotInProject      = NewError(KindNotFound, "TASK_NOT_IN_PROJECT", "task is not in project")
+)
 
-func NewProjectService() *ProjectService {
-	return &ProjectService{}
+type ProjectService struct {
+	store repositories.Store
 }
 
-func (s *ProjectService) CreateProject(projectDto dto.ProjectDto) (*models.Project, error) {
-	var existingProject models.Project
-	if result := config.DB.Where("name = ?", projectDto.Name).First(&existingProject); result.Error == nil {
-		return nil, errors.New("project already exists")
-	}
+func NewProjectService(store repositories.Store) *ProjectService {
+	return &ProjectService{store: store}
+}
 
-	project := models.Project{
-		Name:    projectDto.Name,
-		Budget:  projectDto.Budget,
-		OwnerID: projectDto.OwnerID,
-	}
+// repos devuelve los repositorios de la transacción de ctx si la hay
+func (s *ProjectService) repos(ctx context.Context) repositories.Store {
+	return repositories.StoreFrom(ctx, s.store)
+}
+
+func (s *ProjectService) CreateProject(ctx context.Context, projectDto dto.ProjectDto) (*models.Project, error) {
+	var project models.Project
+	err := repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		if _, err := store.Projects().FindByName(ctx, projectDto.Name); err == nil {
+			return ErrProjectAlreadyExists
+		}
 
-	if len(projectDto.UsersIds) > 0 {
-		var users []models.User
-		if err := config.DB.Find(&users, projectDto.UsersIds).Error; err != nil {
-			return nil, err
+		project = models.Project{
+			Name:    projectDto.Name,
+			Budget:  projectDto.Budget,
+			OwnerID: projectDto.OwnerID,
 		}
-		project.Users = users
 
-	}
+		if len(projectDto.UsersIds) > 0 {
+			users, err := store.Users().FindByIDs(ctx, projectDto.UsersIds)
+			if err != nil {
+				return err
+			}
+			project.Users = users
 
-	if len(projectDto.TasksIds) > 0 {
-		var tasks []models.Task
-		if err := config.DB.Find(&tasks, projectDto.TasksIds).Error; err != nil {
-			return nil, err
 		}
-		project.Tasks = tasks
-	}
 
-	if err := config.DB.Create(&project).Error; err != nil {
+		if len(projectDto.TasksIds) > 0 {
+			tasks, err := store.Tasks().FindByIDs(ctx, projectDto.TasksIds)
+			if err != nil {
+				return err
+			}
+			project.Tasks = tasks
+		}
+
+		return store.Projects().Create(ctx, &project)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return &project, nil
 }
 
-func (s *ProjectService) GetProjectById(id uint) (*models.Project, error) {
-	var project models.Project
-	if result := config.DB.Preload("Users").Preload("Tasks").Preload("Owner").First(&project, id); result.Error != nil {
-		return nil, result.Error
-	}
-
-	return &project, nil
+func (s *ProjectService) GetProjectById(ctx context.Context, id uint) (*models.Project, error) {
+	project, err := s.repos(ctx).Projects().FindByID(ctx, id)
+	return project, notFoundAs(err, ErrProjectNotFound)
 }
 
-func (s *ProjectService) ListProjects() ([]models.Project, error) {
-	var projects []models.Project
-	if result := config.DB.Preload("Users").Preload("Tasks").Preload("Owner").Find(&projects); result.Error != nil {
-		return nil, result.Error
-	}
-
-	return projects, nil
+func (s *ProjectService) ListProjects(ctx context.Context) ([]models.Project, error) {
+	return s.repos(ctx).Projects().List(ctx)
 }
 
-func (s *ProjectService) UpdateProject(id uint, projectDto dto.ProjectDto) (*models.Project, error) {
-	project, err := s.GetProjectById(id)
-	if err != nil {
-		return nil, err
-	}
+func (s *ProjectService) UpdateProject(ctx context.Context, id uint, version uint, projectDto dto.ProjectDto) (*models.Project, error) {
+	var project *models.Project
+	err := repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		var err error
+		project, err = store.Projects().FindByID(ctx, id)
+		if err != nil {
+			return notFoundAs(err, ErrProjectNotFound)
+		}
+		if err := checkVersion(project.Version, version); err != nil {
+			return err
+		}
 
-	project.Name = projectDto.Name
-	project.Budget = projectDto.Budget
+		project.Name = projectDto.Name
+		project.Budget = projectDto.Budget
 
-	if len(projectDto.UsersIds) > 0 {
-		var users []models.User
-		if err := config.DB.Find(&users, projectDto.UsersIds).Error; err != nil {
-			return nil, err
+		if len(projectDto.UsersIds) > 0 {
+			users, err := store.Users().FindByIDs(ctx, projectDto.UsersIds)
+			if err != nil {
+				return err
+			}
+			project.Users = users
 		}
-		project.Users = users
-	}
 
-	if len(projectDto.TasksIds) > 0 {
-		var tasks []models.Task
-		if err := config.DB.Find(&tasks, projectDto.TasksIds).Error; err != nil {
-			return nil, err
+		if len(projectDto.TasksIds) > 0 {
+			tasks, err := store.Tasks().FindByIDs(ctx, projectDto.TasksIds)
+			if err != nil {
+				return err
+			}
+			project.Tasks = tasks
 		}
-		project.Tasks = tasks
-	}
 
-	if err := config.DB.Save(project).Error; err != nil {
+		return store.Projects().Save(ctx, project)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return project, nil
 }
 
-func (s *ProjectService) ListProjectsByUserId(userId uint) ([]models.Project, error) {
-	var projects []models.Project
-	if result := config.DB.Preload("Users").Preload("Tasks").Preload("Owner").Where("owner_id = ?", userId).Find(&projects); result.Error != nil {
-		return nil, result.Error
-	}
-
-	return projects, nil
+func (s *ProjectService) ListProjectsByUserId(ctx context.Context, userId uint) ([]models.Project, error) {
+	return s.repos(ctx).Projects().ListByUser(ctx, userId)
 }
 
-func (s *ProjectService) DeleteProject(id uint) error {
-	var project models.Project
-	if result := config.DB.First(&project, id); result.Error != nil {
-		return result.Error
+// PlanProjectDeletion calcula qué afectaría borrar el proyecto con la política indicada, sin modificar nada
+func (s *ProjectService) PlanProjectDeletion(ctx context.Context, id uint, policy string) (*models.ProjectDeletionImpact, error) {
+	store := s.repos(ctx)
+	if _, err := store.Projects().FindByID(ctx, id); err != nil {
+		return nil, notFoundAs(err, ErrProjectNotFound)
 	}
 
-	if result := config.DB.Delete(&project); result.Error != nil {
-		return result.Error
+	switch policy {
+	case DeletionPolicyDetach, DeletionPolicyRestrict, DeletionPolicyCascade:
+	default:
+		return nil, ErrInvalidDeletionPolicy
 	}
 
-	return nil
-}
-
+	impact := models.ProjectDeletionImpact{ProjectID: id, Policy: policy}
 
-func (s *ProjectService) AddUserToProject(projectId uint,  userId uint) error {
-	var project models.Project
-	if result := config.DB.Preload("Users").First(&project, projectId); result.Error != nil {
-		return result.Error
+	var err error
+	if impact.Members, err = store.Projects().MemberIDs(ctx, id); err != nil {
+		return nil, err
 	}
-
-	for _, user := range project.Users {
-		if user.ID == userId {
-			return errors.New("user is already in project")
-		}
+	if impact.Tasks, err = store.Projects().TaskIDs(ctx, id); err != nil {
+		return nil, err
 	}
 
-	var user models.User
-	if err := config.DB.Where("id = ?", userId).First(&user).Error; err != nil {
-		return err
+	// Tareas que no están en ningún otro proyecto activo
+	if impact.OrphanedTasks, err = store.Projects().OrphanedTaskIDs(ctx, id); err != nil {
+		return nil, err
 	}
 
-	err := config.DB.Model(&project).Association("Users").Append(&user)
+	return &impact, nil
+}
+
+// DeleteProject borra el proyecto aplicando la política indicada sobre sus tareas:
+// detach las deja como están, restrict se niega si tiene tareas y cascade borra las que quedarían huérfanas
+func (s *ProjectService) DeleteProject(ctx context.Context, id uint, policy string) (*models.ProjectDeletionImpact, error) {
+	var impact *models.ProjectDeletionImpact
+	err := repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		var err error
+		impact, err = s.PlanProjectDeletion(ctx, id, policy)
+		if err != nil {
+			return err
+		}
+
+		if policy == DeletionPolicyRestrict && len(impact.Tasks) > 0 {
+			return ErrDeletionRestricted
+		}
 
+		if policy == DeletionPolicyCascade {
+			if err := store.Tasks().Delete(ctx, impact.OrphanedTasks...); err != nil {
+				return err
+			}
+		}
+		return store.Projects().Delete(ctx, id)
+	})
+	if errors.Is(err, ErrDeletionRestricted) {
+		return impact, err
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+
+	return impact, nil
 }
 
-func (s *ProjectService) RemoveUserFromProject(projectId uint, userId uint) error {
-	var project models.Project
-	if result := config.DB.Preload("Users").First(&project, projectId); result.Error != nil {
-		return result.Error
-	}
 
-	// Check if the user is the owner or part of the project
-	find := false
-	for _, user := range project.Users {
-		if user.ID == userId {
-			find = true
+func (s *ProjectService) AddUserToProject(ctx context.Context, projectId uint,  userId uint) error {
+	return repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		project, err := store.Projects().FindByID(ctx, projectId)
+		if err != nil {
+			return notFoundAs(err, ErrProjectNotFound)
 		}
-	}
-	if !find {
-		return errors.New("user is not in project")
-	}
 
-	var user models.User
-	if err := config.DB.Where("id = ?", userId).First(&user).Error; err != nil {
-		return err
-	}
+		for _, user := range project.Users {
+			if user.ID == userId {
+				return ErrUserAlreadyInProject
+			}
+		}
 
-	err := config.DB.Model(&project).Association("Users").Delete(&user)
+		user, err := store.Users().FindByID(ctx, userId)
+		if err != nil {
+			return notFoundAs(err, ErrUserNotFound)
+		}
 
-	if err != nil {
-		return err
-	}
-	return nil
+		return store.Projects().AddUser(ctx, project.ID, user)
+	})
 }
 
-func (s *ProjectService) AddTaskToProject(projectId uint, taskId uint) error {
-	var project models.Project
-	if result := config.DB.Preload("Tasks").First(&project, projectId); result.Error != nil {
-		return result.Error
-	}
+func (s *ProjectService) RemoveUserFromProject(ctx context.Context, projectId uint, userId uint) error {
+	return repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		project, err := store.Projects().FindByID(ctx, projectId)
+		if err != nil {
+			return notFoundAs(err, ErrProjectNotFound)
+		}
 
-	for _, task := range project.Tasks {
-		if task.ID == taskId {
-			return errors.New("task is already in project")
+		// Check if the user is the owner or part of the project
+		find := false
+		for _, user := range project.Users {
+			if user.ID == userId {
+				find = true
+			}
+		}
+		if !find {
+			return ErrUserNotInProject
 		}
-	}
 
-	var task models.Task
-	if err := config.DB.Where("id = ?", taskId).First(&task).Error; err != nil {
-		return err
-	}
+		return store.Projects().RemoveUser(ctx, project.ID, userId)
+	})
+}
 
-	err := config.DB.Model(&project).Association("Tasks").Append(&task)
+func (s *ProjectService) AddTaskToProject(ctx context.Context, projectId uint, taskId uint) error {
+	return repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		project, err := store.Projects().FindByID(ctx, projectId)
+		if err != nil {
+			return notFoundAs(err, ErrProjectNotFound)
+		}
 
-	if err != nil {
-		return err
-	}
-	return nil
+		for _, task := range project.Tasks {
+			if task.ID == taskId {
+				return ErrTaskAlreadyInProject
+			}
+		}
+
+		task, err := store.Tasks().FindByID(ctx, taskId)
+		if err != nil {
+			return notFoundAs(err, ErrTaskNotFound)
+		}
+		task.Owner = models.User{}
+
+		return store.Projects().AddTask(ctx, project.ID, task)
+	})
 }
 
-func (s *ProjectService) RemoveTaskFromProject(projectId uint, taskId uint) error {
-	var project models.Project
-	if result := config.DB.Preload("Tasks").First(&project, projectId); result.Error != nil {
-		return result.Error
-	}
+func (s *ProjectService) RemoveTaskFromProject(ctx context.Context, projectId uint, taskId uint) error {
+	return repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		project, err := store.Projects().FindByID(ctx, projectId)
+		if err != nil {
+			return notFoundAs(err, ErrProjectNotFound)
+		}
 
-	find := false
-	// Check if the task is already in the project
+		find := false
+		// Check if the task is already in the project
 		for _, task := range project.Tasks {
 			if task.ID == taskId {
 				find = true
@@ -231,20 +296,188 @@ func (s *ProjectService) RemoveTaskFromProject(projectId uint, taskId uint) erro
 		}
 
 		if !find {
-			return errors.New("task is not in project")
+			return ErrTaskNotInProject
 		}
 
-		// Add the task to the project
-		var task models.Task
-		if err := config.DB.Where("id = ?", taskId).First(&task).Error; err != nil {
+		return store.Projects().RemoveTask(ctx, project.ID, taskId)
+	})
+}
+
+// checkPrimaryOwner verifica que actorId sea el dueño principal del proyecto.
+// Un actorId igual a 0 indica una acción de administrador y no se verifica.
+func checkPrimaryOwner(project *models.Project, actorId uint) error {
+	if actorId != 0 && project.OwnerID != actorId {
+		return ErrNotProjectOwner
+	}
+	return nil
+}
+
+func (s *ProjectService) AddCoOwnerToProject(ctx context.Context, projectId uint, userId uint, actorId uint) error {
+	return repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		project, err := store.Projects().FindByID(ctx, projectId)
+		if err != nil {
+			return notFoundAs(err, ErrProjectNotFound)
+		}
+		if err := checkPrimaryOwner(project, actorId); err != nil {
 			return err
 		}
 
-		err := config.DB.Model(&project).Association("Tasks").Delete(&task)
+		if project.OwnerID == userId {
+			return ErrInvalidTransferTarget
+		}
+		for _, coOwner := range project.CoOwners {
+			if coOwner.ID == userId {
+				return ErrAlreadyCoOwner
+			}
+		}
+
+		user, err := store.Users().FindByID(ctx, userId)
 		if err != nil {
+			return notFoundAs(err, ErrUserNotFound)
+		}
+
+		return store.Projects().AddCoOwner(ctx, project.ID, user)
+	})
+}
+
+func (s *ProjectService) RemoveCoOwnerFromProject(ctx context.Context, projectId uint, userId uint, actorId uint) error {
+	return repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		project, err := store.Projects().FindByID(ctx, projectId)
+		if err != nil {
+			return notFoundAs(err, ErrProjectNotFound)
+		}
+		if err := checkPrimaryOwner(project, actorId); err != nil {
 			return err
 		}
 
-	return nil
+		for _, coOwner := range project.CoOwners {
+			if coOwner.ID == userId {
+				return store.Projects().RemoveCoOwner(ctx, project.ID, userId)
+			}
+		}
+		return ErrNotCoOwner
+	})
+}
+
+// ProposeTransfer crea una propuesta de transferencia hacia toUserId.
+// Si ya había una pendiente para el proyecto, queda cancelada.
+func (s *ProjectService) ProposeTransfer(ctx context.Context, projectId uint, toUserId uint, actorId uint) (*models.ProjectTransfer, error) {
+	var transfer models.ProjectTransfer
+	err := repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		project, err := store.Projects().FindByID(ctx, projectId)
+		if err != nil {
+			return notFoundAs(err, ErrProjectNotFound)
+		}
+		if err := checkPrimaryOwner(project, actorId); err != nil {
+			return err
+		}
+
+		if toUserId == project.OwnerID {
+			return ErrInvalidTransferTarget
+		}
+		if _, err := store.Users().FindByID(ctx, toUserId); err != nil {
+			return ErrInvalidTransferTarget
+		}
+
+		transfer = models.ProjectTransfer{
+			ProjectID:  project.ID,
+			FromUserID: project.OwnerID,
+			ToUserID:   toUserId,
+			Status:     models.TransferPending,
+		}
+
+		if _, err := store.Projects().CancelPendingTransfers(ctx, project.ID); err != nil {
+			return err
+		}
+		return store.Projects().CreateTransfer(ctx, &transfer)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &transfer, nil
 }
 
+func (s *ProjectService) CancelTransfer(ctx context.Context, projectId uint, actorId uint) error {
+	return repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		project, err := store.Projects().FindByID(ctx, projectId)
+		if err != nil {
+			return notFoundAs(err, ErrProjectNotFound)
+		}
+		if err := checkPrimaryOwner(project, actorId); err != nil {
+			return err
+		}
+
+		cancelled, err := store.Projects().CancelPendingTransfers(ctx, project.ID)
+		if err != nil {
+			return err
+		}
+		if cancelled == 0 {
+			return ErrTransferNotFound
+		}
+		return nil
+	})
+}
+
+// ListIncomingTransfers devuelve las transferencias pendientes dirigidas al usuario
+func (s *ProjectService) ListIncomingTransfers(ctx context.Context, userId uint) ([]models.ProjectTransfer, error) {
+	return s.repos(ctx).Projects().ListIncomingTransfers(ctx, userId)
+}
+
+func findPendingTransfer(ctx context.Context, projects repositories.ProjectRepository, transferId uint, userId uint) (*models.ProjectTransfer, error) {
+	transfer, err := projects.FindTransfer(ctx, transferId, userId)
+	if err != nil {
+		return nil, ErrTransferNotFound
+	}
+	if transfer.Status != models.TransferPending {
+		return nil, ErrTransferNotPending
+	}
+	return transfer, nil
+}
+
+// AcceptTransfer convierte al destinatario en el nuevo dueño del proyecto.
+// Si era co-dueño deja de serlo, ya que pasa a ser el dueño principal.
+func (s *ProjectService) AcceptTransfer(ctx context.Context, transferId uint, userId uint) (*models.Project, error) {
+	var project *models.Project
+	err := repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		transfer, err := findPendingTransfer(ctx, store.Projects(), transferId, userId)
+		if err != nil {
+			return err
+		}
+
+		project, err = store.Projects().FindByID(ctx, transfer.ProjectID)
+		if err != nil {
+			return notFoundAs(err, ErrProjectNotFound)
+		}
+		// El dueño cambió por otro camino desde que se propuso la transferencia
+		if project.OwnerID != transfer.FromUserID {
+			return ErrTransferNotPending
+		}
+
+		if err := store.Projects().SetOwner(ctx, project.ID, userId); err != nil {
+			return err
+		}
+		if err := store.Projects().UpdateTransferStatus(ctx, transfer, models.TransferAccepted); err != nil {
+			return err
+		}
+
+		// Se recarga dentro de la transacción para devolver al nuevo dueño
+		project, err = store.Projects().FindByID(ctx, project.ID)
+		return notFoundAs(err, ErrProjectNotFound)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return project, nil
+}
+
+func (s *ProjectService) DeclineTransfer(ctx context.Context, transferId uint, userId uint) error {
+	return repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		transfer, err := findPendingTransfer(ctx, store.Projects(), transferId, userId)
+		if err != nil {
+			return err
+		}
+		return store.Projects().UpdateTransferStatus(ctx, transfer, models.TransferDeclined)
+	})
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimit es un token bucket: admite ráfagas de hasta Requests pedidos y se
+// recarga a razón de Requests por Window
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// RateLimitResult es el estado del bucket después de consumir un pedido
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter es cuánto falta para tener un token disponible (0 si se permitió)
+	RetryAfter time.Duration
+	// Reset es cuánto falta para que el bucket vuelva a estar lleno
+	Reset time.Duration
+}
+
+// RateLimitStore guarda los buckets; con varias réplicas tiene que ser compartido (Redis)
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// ParseRateLimit lee límites con el formato "cantidad/ventana", por ejemplo "120/1m"
+func ParseRateLimit(value string) (RateLimit, error) {
+	requests, window, found := strings.Cut(value, "/")
+	if !found {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, expected requests/window", value)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || n <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: bad request count", value)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: bad window", value)
+	}
+	return RateLimit{Requests: n, Window: d}, nil
+}
+
+// RateLimitFromEnv lee el límite de la variable o usa fallback (también si es inválido)
+func RateLimitFromEnv(key string, fallback RateLimit) RateLimit {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	limit, err := ParseRateLimit(value)
+	if err != nil {
+		log.Printf("%v, using default for %s", err, key)
+		return fallback
+	}
+	return limit
+}
+
+// perMillisecond es la velocidad de recarga del bucket en tokens por milisegundo
+func (l RateLimit) perMillisecond() float64 {
+	return float64(l.Requests) / float64(l.Window.Milliseconds())
+}
+
+// result arma el resultado a partir de los tokens que quedaron en el bucket
+func (l RateLimit) result(allowed bool, tokens float64) RateLimitResult {
+	rate := l.perMillisecond()
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(l.Requests)-tokens)/rate) * time.Millisecond,
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration(math.Ceil((1-tokens)/rate)) * time.Millisecond
+	}
+	return result
+}
+
+// NewRateLimitStoreFromEnv usa Redis si está configurado y si no la memoria del proceso
+func NewRateLimitStoreFromEnv() RateLimitStore {
+	if config.Redis != nil {
+		return NewRedisRateLimitStore(config.Redis)
+	}
+	return NewMemoryRateLimitStore()
+}
+
+type memoryBucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+	window  time.Duration
+}
+
+// MemoryRateLimitStore sirve con una sola réplica
+type MemoryRateLimitStore struct {
+	mu sync.Mutex
+	// order va del bucket usado hace más tiempo al más reciente
+	order   *list.List
+	buckets map[string]*list.Element
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{order: list.New(), buckets: map[string]*list.Element{}}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	capacity := float64(limit.Requests)
+	var bucket *memoryBucket
+	if element, ok := s.buckets[key]; ok {
+		bucket = element.Value.(*memoryBucket)
+		s.order.MoveToBack(element)
+	} else {
+		bucket = &memoryBucket{key: key, tokens: capacity, updated: now, window: limit.Window}
+		s.buckets[key] = s.order.PushBack(bucket)
+	}
+
+	elapsed := float64(now.Sub(bucket.updated).Milliseconds())
+	bucket.tokens = math.Min(capacity, bucket.tokens+elapsed*limit.perMillisecond())
+	bucket.updated = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+
+	s.evictIdle(now)
+	return limit.result(allowed, bucket.tokens), nil
+}
+
+// evictIdle descarta los buckets sin uso durante una ventana completa, que ya
+// están llenos. Recorre desde el usado hace más tiempo y para en el primero
+// que sigue en uso, así cada pedido no recorre todo el mapa.
+func (s *MemoryRateLimitStore) evictIdle(now time.Time) {
+	for element := s.order.Front(); element != nil; element = s.order.Front() {
+		bucket := element.Value.(*memoryBucket)
+		if now.Sub(bucket.updated) <= bucket.window {
+			return
+		}
+		s.order.Remove(element)
+		delete(s.buckets, bucket.key)
+	}
+}
+
+// tokenBucketScript actualiza el bucket de forma atómica usando el reloj de Redis,
+// así todas las réplicas ven el mismo tiempo
+var tokenBucketScript = redis.NewScript(`
+redis.replicate_commands()
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1])
+local updated = tonumber(bucket[2])
+if tokens == nil then
+  tokens = capacity
+  updated = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisRateLimitStore comparte los buckets entre réplicas
+type RedisRateLimitStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisRateLimitStore(client *redis.Client) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client, prefix: "rate_limit:"}
+}
+
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	values, err := tokenBucketScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Requests, strconv.FormatFloat(limit.perMillisecond(), 'f', -1, 64), limit.Window.Milliseconds(),
+	).Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if len(values) != 2 {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit script result: %v", values)
+	}
+
+	allowed, _ := values[0].(int64)
+	tokens, err := strconv.ParseFloat(fmt.Sprint(values[1]), 64)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return limit.result(allowed == 1, tokens), nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimitResultMath(t *testing.T) {
+	limit := RateLimit{Requests: 10, Window: 10 * time.Second}
+
+	// Se recarga un token por segundo: con medio token falta medio segundo
+	denied := limit.result(false, 0.5)
+	if denied.Allowed || denied.Remaining != 0 || denied.RetryAfter != 500*time.Millisecond || denied.Reset != 9500*time.Millisecond {
+		t.Fatalf("unexpected denied result %+v", denied)
+	}
+	allowed := limit.result(true, 7.25)
+	if !allowed.Allowed || allowed.Remaining != 7 || allowed.RetryAfter != 0 || allowed.Reset != 2750*time.Millisecond {
+		t.Fatalf("unexpected allowed result %+v", allowed)
+	}
+}
+
+func TestMemoryRateLimitStoreTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRateLimitStore()
+	limit := RateLimit{Requests: 3, Window: 3 * time.Second}
+
+	// La ráfaga admite tantos pedidos como la capacidad del bucket
+	for want := 2; want >= 0; want-- {
+		result, err := store.Take(ctx, "ip:1", limit)
+		if err != nil || !result.Allowed || result.Remaining != want {
+			t.Fatalf("expected an allowed request with %d remaining, got %+v (%v)", want, result, err)
+		}
+	}
+	result, _ := store.Take(ctx, "ip:1", limit)
+	if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+		t.Fatalf("expected the fourth request to wait up to a second, got %+v", result)
+	}
+
+	// Otra clave tiene su propio bucket
+	if result, _ := store.Take(ctx, "ip:2", limit); !result.Allowed || result.Remaining != 2 {
+		t.Fatalf("expected a separate bucket for another key, got %+v", result)
+	}
+
+	// Pasado un segundo se recarga un token, sin superar la capacidad
+	store.buckets["ip:1"].Value.(*memoryBucket).updated = time.Now().Add(-time.Second)
+	if result, _ := store.Take(ctx, "ip:1", limit); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("expected one refilled token, got %+v", result)
+	}
+	store.buckets["ip:1"].Value.(*memoryBucket).updated = time.Now().Add(-time.Hour)
+	if result, _ := store.Take(ctx, "ip:1", limit); !result.Allowed || result.Remaining != 2 {
+		t.Fatalf("expected a full bucket after a long pause, got %+v", result)
+	}
+}
+
+func TestMemoryRateLimitStoreEvictsIdleBuckets(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRateLimitStore()
+	limit := RateLimit{Requests: 5, Window: time.Minute}
+
+	for _, key := range []string{"ip:1", "ip:2", "ip:3"} {
+		if _, err := store.Take(ctx, key, limit); err != nil {
+			t.Fatalf("Take: %v", err)
+		}
+	}
+	// ip:1 e ip:2 pasaron una ventana sin uso; ip:3 sigue en uso
+	store.buckets["ip:1"].Value.(*memoryBucket).updated = time.Now().Add(-2 * time.Minute)
+	store.buckets["ip:2"].Value.(*memoryBucket).updated = time.Now().Add(-2 * time.Minute)
+
+	if _, err := store.Take(ctx, "ip:4", limit); err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if _, ok := store.buckets["ip:1"]; ok {
+		t.Fatal("expected the idle bucket ip:1 to be evicted")
+	}
+	if _, ok := store.buckets["ip:2"]; ok {
+		t.Fatal("expected the idle bucket ip:2 to be evicted")
+	}
+	if len(store.buckets) != 2 || store.order.Len() != 2 {
+		t.Fatalf("expected ip:3 and ip:4 to remain, got %d buckets", len(store.buckets))
+	}
+}
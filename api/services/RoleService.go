@@ -1,64 +1,71 @@
 package services
 
 import (
-	"github.com/lucapierini/project-go-task_manager/config"
+	"context"
+
 	"github.com/lucapierini/project-go-task_manager/dto"
 	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
 )
 
 type RoleInterface interface {
-	CreateRole(roleDto dto.RoleDto) (*models.Role, error)
-	GetRoleById(id uint) (*models.Role, error)
-	UpdateRole(id uint, roleDto dto.RoleDto) (*models.Role, error)
-	DeleteRole(id uint) error
-	ListRoles() ([]models.Role, error)
+	CreateRole(ctx context.Context, roleDto dto.RoleDto) (*models.Role, error)
+	GetRoleById(ctx context.Context, id uint) (*models.Role, error)
+	UpdateRole(ctx context.Context, id uint, version uint, roleDto dto.RoleDto) (*models.Role, error)
+	DeleteRole(ctx context.Context, id uint) error
+	ListRoles(ctx context.Context) ([]models.Role, error)
 	}
 
-type RoleService struct{}
+type RoleService struct{
+	store repositories.Store
+}
+
+func NewRoleService(store repositories.Store) *RoleService {
+	return &RoleService{store: store}
+}
 
-func NewRoleService() *RoleService {
-	return &RoleService{}
+// roles usa la transacción de ctx si la hay
+func (s *RoleService) roles(ctx context.Context) repositories.RoleRepository {
+	return repositories.StoreFrom(ctx, s.store).Roles()
 }
 
-func (s *RoleService) CreateRole(roleDto dto.RoleDto) (*models.Role, error){
+func (s *RoleService) CreateRole(ctx context.Context, roleDto dto.RoleDto) (*models.Role, error){
 	role := models.Role{Name: roleDto.Name}
-	if err := config.DB.Create(&role).Error; err != nil {
+	if err := s.roles(ctx).Create(ctx, &role); err != nil {
 		return nil, err
 	}
 	return &role, nil
 }
 
-func (s *RoleService) GetRoleById(id uint) (*models.Role, error){
-	var role models.Role
-	if err := config.DB.First(&role, id).Error; err != nil {
-		return nil, err
-	}
-	return &role, nil
+func (s *RoleService) GetRoleById(ctx context.Context, id uint) (*models.Role, error){
+	role, err := s.roles(ctx).FindByID(ctx, id)
+	return role, notFoundAs(err, ErrRoleNotFound)
 }
 
-func (s *RoleService) UpdateRole(id uint, roleDto dto.RoleDto) (*models.Role, error){
-	role, err := s.GetRoleById(id)
+func (s *RoleService) UpdateRole(ctx context.Context, id uint, version uint, roleDto dto.RoleDto) (*models.Role, error){
+	var role *models.Role
+	err := repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		var err error
+		role, err = store.Roles().FindByID(ctx, id)
+		if err != nil {
+			return notFoundAs(err, ErrRoleNotFound)
+		}
+		if err := checkVersion(role.Version, version); err != nil {
+			return err
+		}
+		role.Name = roleDto.Name
+		return store.Roles().Save(ctx, role)
+	})
 	if err != nil {
 		return nil, err
 	}
-	role.Name = roleDto.Name
-	if err := config.DB.Save(&role).Error; err != nil {
-		return nil, err
-	}
 	return role, nil
 }
 
-func (s *RoleService) DeleteRole(id uint) error {
-	if err := config.DB.Delete(&models.Role{},id).Error; err != nil {
-		return err
-	}
-	return nil
+func (s *RoleService) DeleteRole(ctx context.Context, id uint) error {
+	return s.roles(ctx).Delete(ctx, id)
 }
 
-func (s *RoleService) ListRoles()([]models.Role, error){
-	var roles []models.Role
-	if err := config.DB.Find(&roles).Error; err != nil {
-		return nil, err
-	}
-	return roles, nil
+func (s *RoleService) ListRoles(ctx context.Context)([]models.Role, error){
+	return s.roles(ctx).List(ctx)
 }
\ No newline at end of file
@@ -0,0 +1,19 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// LogSecurityEvent registra un evento de seguridad en una línea con pares clave=valor,
+// por ejemplo LogSecurityEvent("login_failed", "email", email, "ip", ip).
+// Nunca se deben pasar contraseñas, tokens ni códigos.
+func LogSecurityEvent(event string, fields ...interface{}) {
+	var line strings.Builder
+	line.WriteString("security event=" + event)
+	for i := 0; i+1 < len(fields); i += 2 {
+		fmt.Fprintf(&line, " %v=%q", fields[i], fmt.Sprint(fields[i+1]))
+	}
+	log.Println(line.String())
+}
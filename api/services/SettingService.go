@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/lucapierini/project-go-task_manager/repositories"
+)
+
+// Claves de las opciones guardadas en la tabla settings
+const (
+	SettingRequireAdmin2FA = "require_admin_2fa"
+)
+
+type SettingInterface interface {
+	GetBool(ctx context.Context, key string, fallback bool) bool
+	SetBool(ctx context.Context, key string, value bool) error
+}
+
+type SettingService struct {
+	store repositories.Store
+}
+
+func NewSettingService(store repositories.Store) *SettingService {
+	return &SettingService{store: store}
+}
+
+func (s *SettingService) repos(ctx context.Context) repositories.Store {
+	return repositories.StoreFrom(ctx, s.store)
+}
+
+// GetBool devuelve el valor de la opción o fallback si no está definida
+func (s *SettingService) GetBool(ctx context.Context, key string, fallback bool) bool {
+	return getBoolSetting(ctx, s.repos(ctx).Settings(), key, fallback)
+}
+
+func (s *SettingService) SetBool(ctx context.Context, key string, value bool) error {
+	return s.repos(ctx).Settings().Set(ctx, key, strconv.FormatBool(value))
+}
+
+func getBoolSetting(ctx context.Context, settings repositories.SettingRepository, key string, fallback bool) bool {
+	stored, err := settings.Get(ctx, key)
+	if err != nil {
+		return fallback
+	}
+
+	value, err := strconv.ParseBool(stored)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,399 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/lucapierini/project-go-task_manager/config"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+)
+
+var (
+	ErrUnknownSigningKey     = errors.New("unknown signing key")
+	ErrUnsupportedSigningAlg = errors.New("unsupported signing algorithm")
+	ErrInvalidEncryptionKey  = errors.New("SIGNING_KEY_ENCRYPTION_KEY must be 32 bytes encoded in base64")
+)
+
+const (
+	rsaKeyBits = 2048
+	// Un kid desconocido obliga a recargar las claves (otra instancia pudo rotarlas),
+	// pero no más seguido que esto
+	signingKeyReloadInterval = 30 * time.Second
+	signingKeyCheckInterval  = time.Hour
+	// Prefijo de las claves privadas cifradas en signing_keys
+	encryptedSigningKeyPrefix = "aes-gcm:"
+)
+
+// signingKey es una clave ya parseada, lista para firmar y verificar
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	public    crypto.PublicKey
+	createdAt time.Time
+	retired   bool
+}
+
+// keyRing guarda en memoria las claves vigentes de la tabla signing_keys y el
+// store del que se leen, que se fija en LoadSigningKeys
+var keyRing = struct {
+	sync.RWMutex
+	store    repositories.Store
+	active   *signingKey
+	keys     map[string]*signingKey
+	loadedAt time.Time
+}{keys: map[string]*signingKey{}}
+
+// signingAlgorithm es el algoritmo de las claves nuevas: RS256 (por defecto) o EdDSA
+func signingAlgorithm() string {
+	alg := os.Getenv("JWT_SIGNING_ALG")
+	if alg == "" {
+		return "RS256"
+	}
+	return alg
+}
+
+// signingKeyGracePeriod es cuánto se sigue aceptando una clave después de rotarla.
+// Tiene que cubrir el token firmado más largo (refresh token o invitación).
+func signingKeyGracePeriod() time.Duration {
+	return config.GetEnvDuration("JWT_KEY_GRACE_PERIOD", refreshTokenDuration+24*time.Hour)
+}
+
+// legacyJWTSecret devuelve JWT_SECRET si sigue configurado, para aceptar los
+// tokens HS256 emitidos antes de pasar a claves asimétricas
+func legacyJWTSecret() []byte {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return nil
+}
+
+func generateSigningKey(alg string) (*models.SigningKey, error) {
+	var privateKey crypto.Signer
+	var err error
+	switch alg {
+	case "RS256":
+		privateKey, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case "EdDSA":
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, ErrUnsupportedSigningAlg
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := generateRandomToken(12)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := encryptSigningKey(kid, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		KID:        kid,
+		Algorithm:  alg,
+		PrivateKey: encrypted,
+	}, nil
+}
+
+// signingKeyCipher arma el AES-GCM con la clave de SIGNING_KEY_ENCRYPTION_KEY
+// (32 bytes en base64), que cifra las claves privadas guardadas en la base
+func signingKeyCipher() (cipher.AEAD, error) {
+	kek, err := base64.StdEncoding.DecodeString(os.Getenv("SIGNING_KEY_ENCRYPTION_KEY"))
+	if err != nil || len(kek) != 32 {
+		return nil, ErrInvalidEncryptionKey
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSigningKey cifra el PEM de la clave privada. El kid va como dato
+// asociado para que el cifrado no se pueda copiar a otra fila.
+func encryptSigningKey(kid string, plaintext []byte) (string, error) {
+	gcm, err := signingKeyCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(kid))
+	return encryptedSigningKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSigningKey devuelve el PEM de una clave guardada; las que no están cifradas se rechazan
+func decryptSigningKey(key *models.SigningKey) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(key.PrivateKey, encryptedSigningKeyPrefix)
+	if !ok {
+		return nil, errors.New("private key is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := signingKeyCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("encrypted private key is too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(key.KID))
+}
+
+func parseSigningKey(key *models.SigningKey) (*signingKey, error) {
+	decrypted, err := decryptSigningKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", key.KID, err)
+	}
+	block, _ := pem.Decode(decrypted)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s: invalid PEM", key.KID)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", key.KID, err)
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s: %w", key.KID, ErrUnsupportedSigningAlg)
+	}
+
+	var method jwt.SigningMethod
+	switch key.Algorithm {
+	case "RS256":
+		method = jwt.SigningMethodRS256
+	case "EdDSA":
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("signing key %s: %w", key.KID, ErrUnsupportedSigningAlg)
+	}
+
+	return &signingKey{
+		kid:       key.KID,
+		method:    method,
+		private:   signer,
+		public:    signer.Public(),
+		createdAt: key.CreatedAt,
+		retired:   key.RetiredAt != nil,
+	}, nil
+}
+
+func signingKeyStore() repositories.Store {
+	keyRing.RLock()
+	defer keyRing.RUnlock()
+	return keyRing.store
+}
+
+// reloadSigningKeys vuelve a leer de la base las claves que todavía no expiraron
+func reloadSigningKeys(ctx context.Context) error {
+	store := signingKeyStore()
+	if store == nil {
+		return ErrUnknownSigningKey
+	}
+	stored, err := store.SigningKeys().ListValid(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]*signingKey{}
+	var active *signingKey
+	for i := range stored {
+		key, err := parseSigningKey(&stored[i])
+		if err != nil {
+			log.Printf("Error loading %v\n", err)
+			continue
+		}
+		keys[key.kid] = key
+		// Si dos instancias rotaron a la vez firma la más nueva
+		if !key.retired {
+			active = key
+		}
+	}
+
+	keyRing.Lock()
+	defer keyRing.Unlock()
+	keyRing.keys = keys
+	keyRing.active = active
+	keyRing.loadedAt = time.Now()
+	return nil
+}
+
+// LoadSigningKeys carga las claves de store al arrancar y crea una nueva si no hay
+// ninguna activa o si la activa no usa el algoritmo configurado en JWT_SIGNING_ALG.
+// Sin SIGNING_KEY_ENCRYPTION_KEY no arranca.
+func LoadSigningKeys(ctx context.Context, store repositories.Store) error {
+	if _, err := signingKeyCipher(); err != nil {
+		return err
+	}
+
+	keyRing.Lock()
+	keyRing.store = store
+	keyRing.Unlock()
+
+	if err := reloadSigningKeys(ctx); err != nil {
+		return err
+	}
+
+	keyRing.RLock()
+	active := keyRing.active
+	keyRing.RUnlock()
+
+	if active == nil || active.method.Alg() != signingAlgorithm() {
+		_, err := RotateSigningKey(ctx)
+		return err
+	}
+	return nil
+}
+
+// RotateSigningKey crea una clave nueva para firmar y retira las anteriores,
+// que se siguen aceptando durante signingKeyGracePeriod
+func RotateSigningKey(ctx context.Context) (*models.SigningKey, error) {
+	key, err := generateSigningKey(signingAlgorithm())
+	if err != nil {
+		return nil, err
+	}
+
+	store := signingKeyStore()
+	now := time.Now()
+	err = repositories.RunInTransaction(ctx, store, func(ctx context.Context, tx repositories.Store) error {
+		if err := tx.SigningKeys().Retire(ctx, now, now.Add(signingKeyGracePeriod())); err != nil {
+			return err
+		}
+		return tx.SigningKeys().Create(ctx, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := store.SigningKeys().DeleteExpired(ctx, now); err != nil {
+		log.Printf("Error deleting expired signing keys: %v\n", err)
+	}
+
+	log.Printf("Rotated JWT signing key, new kid %s (%s)\n", key.KID, key.Algorithm)
+	return key, reloadSigningKeys(ctx)
+}
+
+// StartSigningKeyRotationJob rota la clave activa cuando supera rotationInterval
+// y recarga periódicamente las claves. Pensado para correr en su propia goroutine.
+func StartSigningKeyRotationJob(rotationInterval time.Duration) {
+	ticker := time.NewTicker(signingKeyCheckInterval)
+	defer ticker.Stop()
+
+	ctx := context.Background()
+	for range ticker.C {
+		if err := reloadSigningKeys(ctx); err != nil {
+			log.Printf("Error reloading signing keys: %v\n", err)
+			continue
+		}
+
+		keyRing.RLock()
+		active := keyRing.active
+		keyRing.RUnlock()
+
+		if active == nil || time.Since(active.createdAt) >= rotationInterval {
+			if _, err := RotateSigningKey(ctx); err != nil {
+				log.Printf("Error rotating signing key: %v\n", err)
+			}
+		}
+	}
+}
+
+func currentSigningKey() (*signingKey, error) {
+	keyRing.RLock()
+	defer keyRing.RUnlock()
+	if keyRing.active == nil {
+		return nil, ErrUnknownSigningKey
+	}
+	return keyRing.active, nil
+}
+
+// verificationKey busca la clave del kid; si no la conoce recarga por si otra instancia rotó
+func verificationKey(kid string) (*signingKey, error) {
+	keyRing.RLock()
+	key, ok := keyRing.keys[kid]
+	loadedAt := keyRing.loadedAt
+	keyRing.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if kid == "" || time.Since(loadedAt) < signingKeyReloadInterval {
+		return nil, ErrUnknownSigningKey
+	}
+	if err := reloadSigningKeys(context.Background()); err != nil {
+		return nil, err
+	}
+
+	keyRing.RLock()
+	defer keyRing.RUnlock()
+	if key, ok := keyRing.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+// JWKS devuelve las claves públicas vigentes en formato JSON Web Key Set
+func JWKS() map[string]interface{} {
+	keyRing.RLock()
+	keys := make([]*signingKey, 0, len(keyRing.keys))
+	for _, key := range keyRing.keys {
+		keys = append(keys, key)
+	}
+	keyRing.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].createdAt.After(keys[j].createdAt) })
+
+	jwks := []map[string]string{}
+	for _, key := range keys {
+		jwk := map[string]string{
+			"kid": key.kid,
+			"alg": key.method.Alg(),
+			"use": "sig",
+		}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+
+	return map[string]interface{}{"keys": jwks}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func signTestClaims(t *testing.T) string {
+	t.Helper()
+	token, err := signClaims(&jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("signClaims: %v", err)
+	}
+	return token
+}
+
+func tokenKID(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, &jwt.StandardClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func jwksKIDs() []string {
+	kids := []string{}
+	for _, key := range JWKS()["keys"].([]map[string]string) {
+		kids = append(kids, key["kid"])
+	}
+	return kids
+}
+
+func TestSigningKeysAreEncryptedAtRest(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	stored, err := store.SigningKeys().ListValid(ctx, time.Now())
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("expected one stored key, got %d (%v)", len(stored), err)
+	}
+	key := stored[0]
+	if !strings.HasPrefix(key.PrivateKey, encryptedSigningKeyPrefix) || strings.Contains(key.PrivateKey, "PRIVATE KEY") {
+		t.Fatalf("the private key is stored in clear: %q", key.PrivateKey)
+	}
+	if _, err := parseSigningKey(&key); err != nil {
+		t.Fatalf("parseSigningKey: %v", err)
+	}
+
+	// El cifrado queda atado al kid de la fila
+	moved := key
+	moved.KID = "other"
+	if _, err := parseSigningKey(&moved); err == nil {
+		t.Fatal("a private key copied to another kid must not decrypt")
+	}
+
+	t.Setenv("SIGNING_KEY_ENCRYPTION_KEY", "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+	if _, err := parseSigningKey(&key); err == nil {
+		t.Fatal("the private key must not decrypt with another encryption key")
+	}
+
+	t.Setenv("SIGNING_KEY_ENCRYPTION_KEY", "")
+	if err := LoadSigningKeys(ctx, store); !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Fatalf("expected ErrInvalidEncryptionKey without an encryption key, got %v", err)
+	}
+}
+
+func TestRotateSigningKeyKeepsOldKeyInJWKS(t *testing.T) {
+	newTestStore(t)
+	before := signTestClaims(t)
+	oldKID := tokenKID(t, before)
+
+	rotated, err := RotateSigningKey(context.Background())
+	if err != nil {
+		t.Fatalf("RotateSigningKey: %v", err)
+	}
+	if rotated.KID == oldKID {
+		t.Fatal("rotation must create a new kid")
+	}
+
+	// Los tokens nuevos se firman con la clave nueva y los viejos se siguen aceptando
+	if kid := tokenKID(t, signTestClaims(t)); kid != rotated.KID {
+		t.Fatalf("expected new tokens signed with %s, got %s", rotated.KID, kid)
+	}
+	if err := parseClaims(before, &jwt.StandardClaims{}); err != nil {
+		t.Fatalf("a token signed before the rotation must still validate: %v", err)
+	}
+
+	kids := jwksKIDs()
+	if len(kids) != 2 || kids[0] != rotated.KID || kids[1] != oldKID {
+		t.Fatalf("expected the JWKS to publish [%s %s], got %v", rotated.KID, oldKID, kids)
+	}
+	for _, key := range JWKS()["keys"].([]map[string]string) {
+		if key["kty"] != "RSA" || key["alg"] != "RS256" || key["n"] == "" || key["e"] == "" || key["d"] != "" {
+			t.Fatalf("unexpected JWK %v", key)
+		}
+	}
+}
+
+func TestUnknownKIDReloadsSigningKeys(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	// Otra instancia rota la clave directamente en la base
+	key, err := generateSigningKey("RS256")
+	if err != nil {
+		t.Fatalf("generateSigningKey: %v", err)
+	}
+	if err := store.SigningKeys().Create(ctx, key); err != nil {
+		t.Fatalf("creating key: %v", err)
+	}
+	parsed, err := parseSigningKey(key)
+	if err != nil {
+		t.Fatalf("parseSigningKey: %v", err)
+	}
+	token := jwt.NewWithClaims(parsed.method, &jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	token.Header["kid"] = key.KID
+	signed, err := token.SignedString(parsed.private)
+	if err != nil {
+		t.Fatalf("signing: %v", err)
+	}
+
+	// Recién cargadas no se vuelven a leer: un kid inventado no puede forzar lecturas a la base
+	if err := parseClaims(signed, &jwt.StandardClaims{}); err == nil {
+		t.Fatal("expected the unknown kid to be rejected within the reload interval")
+	}
+
+	keyRing.Lock()
+	keyRing.loadedAt = time.Now().Add(-signingKeyReloadInterval)
+	keyRing.Unlock()
+	if err := parseClaims(signed, &jwt.StandardClaims{}); err != nil {
+		t.Fatalf("expected the key to be reloaded for the unknown kid: %v", err)
+	}
+	if kids := jwksKIDs(); len(kids) != 2 {
+		t.Fatalf("expected the reloaded key in the JWKS, got %v", kids)
+	}
+}
@@ -1,26 +1,54 @@
 package services
 
 import (
-	"github.com/lucapierini/project-go-task_manager/config"
+	"context"
+
 	"github.com/lucapierini/project-go-task_manager/dto"
 	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
 )
 
 type TaskInterface interface {
-	CreateTask(taskDto dto.TaskDto) (*models.Task, error)
-	GetTaskById(id uint) (*models.Task, error)
-	ListTasks() ([]models.Task, error)
-	UpdateTask(id uint, taskDto dto.TaskDto) (*models.Task, error)
-	DeleteTask(id uint) error
+	CreateTask(ctx context.Context, taskDto dto.TaskDto) (*models.Task, error)
+	GetTaskById(ctx context.Context, id uint) (*models.Task, error)
+	ListTasks(ctx context.Context) ([]models.Task, error)
+	UpdateTask(ctx context.Context, id uint, version uint, taskDto dto.TaskDto) (*models.Task, error)
+	DeleteTask(ctx context.Context, id uint) error
+	BulkTasks(ctx context.Context, actorId uint, mode string, operations []dto.BulkTaskOperationDto) ([]BulkTaskResult, error)
 }
 
-type TaskService struct {}
+const (
+	BulkModeAtomic     = "atomic"
+	BulkModeBestEffort = "best_effort"
+)
+
+var (
+	ErrNotTaskOwner         = NewError(KindForbidden, "NOT_TASK_OWNER", "only the task owner can do this")
+	ErrInvalidBulkOperation = NewError(KindValidation, "INVALID_BULK_OPERATION", "invalid bulk operation")
+	ErrBulkAborted          = NewError(KindFailedDependency, "BULK_ABORTED", "not applied because another operation in the batch failed")
+)
 
-func NewTaskService() *TaskService {
-	return &TaskService{}
+// BulkTaskResult es el resultado de una operación de BulkTasks; Task es la
+// tarea como quedó (nil si se borró o si la operación falló)
+type BulkTaskResult struct {
+	Task *models.Task
+	Err  error
 }
 
-func (s *TaskService) CreateTask(taskDto dto.TaskDto) (*models.Task, error) {
+type TaskService struct {
+	store repositories.Store
+}
+
+func NewTaskService(store repositories.Store) *TaskService {
+	return &TaskService{store: store}
+}
+
+// tasks usa la transacción de ctx si la hay
+func (s *TaskService) tasks(ctx context.Context) repositories.TaskRepository {
+	return repositories.StoreFrom(ctx, s.store).Tasks()
+}
+
+func (s *TaskService) CreateTask(ctx context.Context, taskDto dto.TaskDto) (*models.Task, error) {
 
 	task := models.Task{
 		Name: taskDto.Name,
@@ -28,54 +56,232 @@ func (s *TaskService) CreateTask(taskDto dto.TaskDto) (*models.Task, error) {
 		OwnerID: taskDto.OwnerID,
 	}
 
-	if err := config.DB.Create(&task).Error; err != nil {
+	if err := s.tasks(ctx).Create(ctx, &task); err != nil {
 		return nil, err
 	}
 	return &task, nil
 }
 
-func (s *TaskService) GetTaskById(id uint) (*models.Task, error) {
-	var task models.Task
-	if err := config.DB.Preload("Owner").First(&task, id).Error; err != nil {
+func (s *TaskService) GetTaskById(ctx context.Context, id uint) (*models.Task, error) {
+	task, err := s.tasks(ctx).FindByID(ctx, id)
+	return task, notFoundAs(err, ErrTaskNotFound)
+}
+
+func (s *TaskService) ListTasks(ctx context.Context) ([]models.Task, error) {
+	return s.tasks(ctx).List(ctx)
+}
+
+
+func (s *TaskService) UpdateTask(ctx context.Context, id uint, version uint, taskDto dto.TaskDto) (*models.Task, error) {
+	var task *models.Task
+	err := repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		var err error
+		task, err = store.Tasks().FindByID(ctx, id)
+		if err != nil {
+			return notFoundAs(err, ErrTaskNotFound)
+		}
+		if err := checkVersion(task.Version, version); err != nil {
+			return err
+		}
+
+		task.Name = taskDto.Name
+		task.Description = taskDto.Description
+		task.OwnerID = taskDto.OwnerID
+		// Sin el dueño precargado para que Save no lo vuelva a escribir
+		task.Owner = models.User{}
+
+		return store.Tasks().Save(ctx, task)
+	})
+	if err != nil {
 		return nil, err
 	}
-	return &task, nil
+	return task, nil
 }
 
-func (s *TaskService) ListTasks() ([]models.Task, error) {
-	var tasks []models.Task
-	if err := config.DB.Preload("Owner").Find(&tasks).Error; err != nil {
-		return nil, err
+func (s *TaskService) DeleteTask(ctx context.Context, id uint) error {
+	return repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		if _, err := store.Tasks().FindByID(ctx, id); err != nil {
+			return notFoundAs(err, ErrTaskNotFound)
+		}
+		return store.Tasks().Delete(ctx, id)
+	})
+}
+
+// BulkTasks aplica varias operaciones sobre tareas y devuelve un resultado por
+// operación, en el mismo orden. En modo atomic se aplican todas o ninguna: la
+// primera que falla deshace las anteriores, el resto queda con ErrBulkAborted y
+// se devuelve su error. En best_effort cada una va en su propia transacción.
+// actorId igual a 0 es un administrador; si no, cada operación se permite solo
+// al dueño de la tarea (y, al mover, a quien puede modificar el proyecto destino
+// y los proyectos de los que sale).
+func (s *TaskService) BulkTasks(ctx context.Context, actorId uint, mode string, operations []dto.BulkTaskOperationDto) ([]BulkTaskResult, error) {
+	results := make([]BulkTaskResult, len(operations))
+
+	if mode == BulkModeBestEffort {
+		for i, operation := range operations {
+			results[i].Err = repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+				var err error
+				results[i].Task, err = applyBulkOperation(ctx, store, actorId, operation)
+				return err
+			})
+			if results[i].Err != nil {
+				results[i].Task = nil
+			}
+		}
+		return results, nil
+	}
+
+	failed := -1
+	err := repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		for i, operation := range operations {
+			task, err := applyBulkOperation(ctx, store, actorId, operation)
+			if err != nil {
+				failed = i
+				return err
+			}
+			results[i].Task = task
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range results {
+			results[i] = BulkTaskResult{Err: ErrBulkAborted}
+		}
+		if failed >= 0 {
+			results[failed].Err = err
+		}
+		return results, err
 	}
-	return tasks, nil
+	return results, nil
 }
 
+func applyBulkOperation(ctx context.Context, store repositories.Store, actorId uint, operation dto.BulkTaskOperationDto) (*models.Task, error) {
+	if operation.Op == dto.BulkCreate {
+		if operation.Task == nil {
+			return nil, ErrInvalidBulkOperation
+		}
+		// Quien no es administrador solo crea tareas propias
+		if actorId != 0 && operation.Task.OwnerID != actorId {
+			return nil, ErrNotTaskOwner
+		}
+		if err := checkTaskOwnerExists(ctx, store, operation.Task.OwnerID); err != nil {
+			return nil, err
+		}
+		task := models.Task{
+			Name:        operation.Task.Name,
+			Description: operation.Task.Description,
+			OwnerID:     operation.Task.OwnerID,
+		}
+		if err := store.Tasks().Create(ctx, &task); err != nil {
+			return nil, err
+		}
+		return &task, nil
+	}
 
-func (s *TaskService) UpdateTask(id uint, taskDto dto.TaskDto) (*models.Task, error) {
-	var task models.Task
-	if err := config.DB.First(&task, id).Error; err != nil {
+	task, err := store.Tasks().FindByID(ctx, operation.TaskID)
+	if err != nil {
+		return nil, notFoundAs(err, ErrTaskNotFound)
+	}
+	if actorId != 0 && task.OwnerID != actorId {
+		return nil, ErrNotTaskOwner
+	}
+	if err := checkVersion(task.Version, operation.Version); err != nil {
 		return nil, err
 	}
+	// Sin el dueño precargado para que Save no lo vuelva a escribir
+	task.Owner = models.User{}
 
-	task.Name = taskDto.Name
-	task.Description = taskDto.Description
-	task.OwnerID = taskDto.OwnerID
+	switch operation.Op {
+	case dto.BulkUpdate:
+		if operation.Task == nil {
+			return nil, ErrInvalidBulkOperation
+		}
+		if err := checkTaskOwnerExists(ctx, store, operation.Task.OwnerID); err != nil {
+			return nil, err
+		}
+		task.Name = operation.Task.Name
+		task.Description = operation.Task.Description
+		task.OwnerID = operation.Task.OwnerID
 
-	if err := config.DB.Save(&task).Error; err != nil {
+	case dto.BulkDelete:
+		return nil, store.Tasks().Delete(ctx, task.ID)
+
+	case dto.BulkMove:
+		project, err := checkProjectOwner(ctx, store, operation.ProjectID, actorId)
+		if err != nil {
+			return nil, err
+		}
+
+		// La tarea sale de los proyectos en los que estaba y queda solo en el
+		// destino, así que también hay que poder modificar cada uno de ellos
+		projectIds, err := store.Projects().IDsWithTask(ctx, task.ID)
+		if err != nil {
+			return nil, err
+		}
+		alreadyIn := false
+		sources := []uint{}
+		for _, projectId := range projectIds {
+			if projectId == project.ID {
+				alreadyIn = true
+				continue
+			}
+			if _, err := checkProjectOwner(ctx, store, projectId, actorId); err != nil {
+				return nil, err
+			}
+			sources = append(sources, projectId)
+		}
+		for _, projectId := range sources {
+			if err := store.Projects().RemoveTask(ctx, projectId, task.ID); err != nil {
+				return nil, err
+			}
+		}
+		if !alreadyIn {
+			if err := store.Projects().AddTask(ctx, project.ID, task); err != nil {
+				return nil, err
+			}
+		}
+		return task, nil
+
+	case dto.BulkReassign:
+		if err := checkTaskOwnerExists(ctx, store, operation.OwnerID); err != nil {
+			return nil, err
+		}
+		task.OwnerID = operation.OwnerID
+
+	default:
+		return nil, ErrInvalidBulkOperation
+	}
+
+	if err := store.Tasks().Save(ctx, task); err != nil {
 		return nil, err
 	}
-	return &task, nil
+	return task, nil
 }
 
-func (s *TaskService) DeleteTask(id uint) error {
-	var task models.Task
-	if err := config.DB.First(&task, id).Error; err != nil {
-		return err
-	}
-	if err := config.DB.Delete(&task).Error; err != nil {
-		return err
+// checkTaskOwnerExists verifica que exista el usuario que va a quedar como dueño de la tarea
+func checkTaskOwnerExists(ctx context.Context, store repositories.Store, ownerId uint) error {
+	if _, err := store.Users().FindByID(ctx, ownerId); err != nil {
+		return notFoundAs(err, ErrUserNotFound)
 	}
 	return nil
 }
 
-
+// checkProjectOwner devuelve el proyecto si actorId es su dueño o co-dueño
+// (0 es un administrador); si no, ErrNotProjectOwner
+func checkProjectOwner(ctx context.Context, store repositories.Store, projectId uint, actorId uint) (*models.Project, error) {
+	project, err := store.Projects().FindByID(ctx, projectId)
+	if err != nil {
+		return nil, notFoundAs(err, ErrProjectNotFound)
+	}
+	if actorId == 0 || project.OwnerID == actorId {
+		return project, nil
+	}
+	coOwner, err := store.Projects().IsCoOwner(ctx, project.ID, actorId)
+	if err != nil {
+		return nil, err
+	}
+	if !coOwner {
+		return nil, ErrNotProjectOwner
+	}
+	return project, nil
+}
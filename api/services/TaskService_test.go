@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+)
+
+func createTestTask(t *testing.T, store repositories.Store, name string, ownerId uint) *models.Task {
+	t.Helper()
+	task, err := NewTaskService(store).CreateTask(context.Background(), dto.TaskDto{Name: name, OwnerID: ownerId})
+	if err != nil {
+		t.Fatalf("creating task %s: %v", name, err)
+	}
+	return task
+}
+
+func updateOperation(task *models.Task, name string) dto.BulkTaskOperationDto {
+	return dto.BulkTaskOperationDto{
+		Op:      dto.BulkUpdate,
+		TaskID:  task.ID,
+		Version: task.Version,
+		Task:    &dto.TaskDto{Name: name, OwnerID: task.OwnerID},
+	}
+}
+
+func TestBulkTasksAtomicRollsBack(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	task := createTestTask(t, store, "Write docs", owner.ID)
+	service := NewTaskService(store)
+
+	results, err := service.BulkTasks(ctx, owner.ID, BulkModeAtomic, []dto.BulkTaskOperationDto{
+		updateOperation(task, "Renamed"),
+		{Op: dto.BulkDelete, TaskID: 999, Version: 1},
+		updateOperation(task, "Never applied"),
+	})
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("expected ErrTaskNotFound, got %v", err)
+	}
+	if !errors.Is(results[0].Err, ErrBulkAborted) || !errors.Is(results[1].Err, ErrTaskNotFound) || !errors.Is(results[2].Err, ErrBulkAborted) {
+		t.Fatalf("expected the failed operation and ErrBulkAborted for the rest, got %+v", results)
+	}
+	for i, result := range results {
+		if result.Task != nil {
+			t.Fatalf("operation %d must not return a task, got %+v", i, result.Task)
+		}
+	}
+
+	stored, err := service.GetTaskById(ctx, task.ID)
+	if err != nil || stored.Name != "Write docs" {
+		t.Fatalf("the first update must be rolled back, got %+v (%v)", stored, err)
+	}
+}
+
+func TestBulkTasksBestEffortAppliesEachOperation(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	other := registerTestUser(t, store, "other", "other@example.com")
+	renamed := createTestTask(t, store, "Write docs", owner.ID)
+	foreign := createTestTask(t, store, "Other task", other.ID)
+	deleted := createTestTask(t, store, "Old task", owner.ID)
+	service := NewTaskService(store)
+
+	// Dentro de la transacción del request cada operación va en su savepoint
+	var results []BulkTaskResult
+	err := repositories.RunInTransaction(ctx, store, func(ctx context.Context, _ repositories.Store) error {
+		var err error
+		results, err = service.BulkTasks(ctx, owner.ID, BulkModeBestEffort, []dto.BulkTaskOperationDto{
+			updateOperation(renamed, "Renamed"),
+			updateOperation(foreign, "Stolen"),
+			{Op: dto.BulkDelete, TaskID: deleted.ID, Version: deleted.Version},
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("BulkTasks: %v", err)
+	}
+	if results[0].Err != nil || results[0].Task == nil || results[0].Task.Name != "Renamed" {
+		t.Fatalf("expected the first update to apply, got %+v", results[0])
+	}
+	if !errors.Is(results[1].Err, ErrNotTaskOwner) || results[1].Task != nil {
+		t.Fatalf("expected ErrNotTaskOwner for another user's task, got %+v", results[1])
+	}
+	if results[2].Err != nil {
+		t.Fatalf("expected the delete to apply, got %v", results[2].Err)
+	}
+
+	if stored, err := service.GetTaskById(ctx, foreign.ID); err != nil || stored.Name != "Other task" {
+		t.Fatalf("the failed operation must not change the task, got %+v (%v)", stored, err)
+	}
+	if _, err := service.GetTaskById(ctx, deleted.ID); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("expected the task to be deleted, got %v", err)
+	}
+}
+
+func TestBulkMoveChecksSourceProjects(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	mover := registerTestUser(t, store, "mover", "mover@example.com")
+	source := createTestProject(t, store, "Apollo", owner.ID)
+	target := createTestProject(t, store, "Gemini", mover.ID)
+	task := createTestTask(t, store, "Write docs", mover.ID)
+	projects := NewProjectService(store)
+	if err := projects.AddTaskToProject(ctx, source.ID, task.ID); err != nil {
+		t.Fatalf("AddTaskToProject: %v", err)
+	}
+	service := NewTaskService(store)
+	move := []dto.BulkTaskOperationDto{{Op: dto.BulkMove, TaskID: task.ID, Version: AnyVersion, ProjectID: target.ID}}
+
+	// Ser dueño de la tarea y del destino no alcanza para sacarla de un proyecto ajeno
+	if _, err := service.BulkTasks(ctx, mover.ID, BulkModeAtomic, move); !errors.Is(err, ErrNotProjectOwner) {
+		t.Fatalf("expected ErrNotProjectOwner, got %v", err)
+	}
+	ids, err := store.Projects().IDsWithTask(ctx, task.ID)
+	if err != nil || len(ids) != 1 || ids[0] != source.ID {
+		t.Fatalf("the task must stay in the source project, got %v (%v)", ids, err)
+	}
+
+	// Como co-dueño del origen sí puede moverla
+	if err := projects.AddCoOwnerToProject(ctx, source.ID, mover.ID, owner.ID); err != nil {
+		t.Fatalf("AddCoOwnerToProject: %v", err)
+	}
+	if _, err := service.BulkTasks(ctx, mover.ID, BulkModeAtomic, move); err != nil {
+		t.Fatalf("BulkTasks: %v", err)
+	}
+	ids, err = store.Projects().IDsWithTask(ctx, task.ID)
+	if err != nil || len(ids) != 1 || ids[0] != target.ID {
+		t.Fatalf("expected the task only in the target project, got %v (%v)", ids, err)
+	}
+}
+
+func TestBulkUpdateRejectsUnknownOwner(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	task := createTestTask(t, store, "Write docs", owner.ID)
+	service := NewTaskService(store)
+
+	operation := updateOperation(task, "Renamed")
+	operation.Task.OwnerID = 999
+	if _, err := service.BulkTasks(ctx, 0, BulkModeAtomic, []dto.BulkTaskOperationDto{operation}); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+	if stored, err := service.GetTaskById(ctx, task.ID); err != nil || stored.OwnerID != owner.ID {
+		t.Fatalf("the owner must not change, got %+v (%v)", stored, err)
+	}
+}
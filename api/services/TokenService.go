@@ -1,62 +1,123 @@
 package services
 
 import (
-	"errors"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
 )
 
+// TokenInterface emite los tokens de sesión y verifica que sigan vigentes.
+// Los claims dependen de la base (opciones de 2FA, versión de sesión), por
+// eso estas funciones usan el store; el resto de los tokens solo necesita las claves.
+type TokenInterface interface {
+    GenerateTokenPair(ctx context.Context, user *models.User) (*models.TokenPair, error)
+    GenerateMFAPendingToken(ctx context.Context, user *models.User) (string, error)
+    CheckSession(ctx context.Context, claims *models.Claims) error
+}
+
+type TokenService struct {
+    store repositories.Store
+}
+
+func NewTokenService(store repositories.Store) *TokenService {
+    return &TokenService{store: store}
+}
+
+func (s *TokenService) repos(ctx context.Context) repositories.Store {
+    return repositories.StoreFrom(ctx, s.store)
+}
+
 
 var (
-    jwtSecret        = []byte(os.Getenv("JWT_SECRET"))
-    ErrInvalidToken  = errors.New("invalid token")
-    ErrExpiredToken  = errors.New("token has expired")
-    ErrUnauthorized  = errors.New("unauthorized")
+    ErrInvalidToken  = NewError(KindUnauthorized, "INVALID_TOKEN", "invalid token")
+    ErrExpiredToken  = NewError(KindUnauthorized, "TOKEN_EXPIRED", "token has expired")
+    ErrUnauthorized  = NewError(KindUnauthorized, "UNAUTHORIZED", "unauthorized")
+    ErrSessionRevoked = NewError(KindUnauthorized, "SESSION_REVOKED", "session has been revoked")
 )
 
 const (
     accessTokenDuration  = 15 * time.Minute
     refreshTokenDuration = 7 * 24 * time.Hour
+    mfaPendingTokenDuration = 5 * time.Minute
 )
 
 func ValidateToken(tokenString string) (*models.Claims, error) {
-    token, err := jwt.ParseWithClaims(tokenString, &models.Claims{}, func(token *jwt.Token) (interface{}, error) {
-        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-            return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+    claims := &models.Claims{}
+    if err := parseClaims(tokenString, claims); err != nil {
+        return nil, err
+    }
+    return claims, nil
+}
+
+// parseClaims verifica la firma y la expiración del token y carga sus claims.
+// La clave se elige por el kid del header entre las de signing_keys.
+func parseClaims(tokenString string, claims jwt.Claims) error {
+    token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+        switch token.Method.(type) {
+        case *jwt.SigningMethodRSA, *jwt.SigningMethodEd25519:
+            kid, _ := token.Header["kid"].(string)
+            key, err := verificationKey(kid)
+            if err != nil {
+                return nil, err
+            }
+            if key.method.Alg() != token.Method.Alg() {
+                return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+            }
+            return key.public, nil
+        case *jwt.SigningMethodHMAC:
+            // Tokens emitidos antes de las claves asimétricas, solo si JWT_SECRET sigue definido
+            if secret := legacyJWTSecret(); secret != nil {
+                return secret, nil
+            }
         }
-        return jwtSecret, nil
+        return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
     })
 
     if err != nil {
         if ve, ok := err.(*jwt.ValidationError); ok {
             if ve.Errors&jwt.ValidationErrorExpired != 0 {
-                return nil, ErrExpiredToken
+                return ErrExpiredToken
             }
         }
-        return nil, ErrInvalidToken
+        return ErrInvalidToken
     }
 
-    claims, ok := token.Claims.(*models.Claims)
-    if !ok || !token.Valid {
-        return nil, ErrInvalidToken
+    if !token.Valid {
+        return ErrInvalidToken
     }
+    return nil
+}
 
-    return claims, nil
+// signClaims firma los claims con la clave activa e indica su kid en el header
+func signClaims(claims jwt.Claims) (string, error) {
+    key, err := currentSigningKey()
+    if err != nil {
+        return "", err
+    }
+    token := jwt.NewWithClaims(key.method, claims)
+    token.Header["kid"] = key.kid
+    return token.SignedString(key.private)
 }
 
-func GenerateTokenPair(user *models.User) (*models.TokenPair, error) {
+func (s *TokenService) GenerateTokenPair(ctx context.Context, user *models.User) (*models.TokenPair, error) {
+    mfaEnrollmentRequired := requiresMFAEnrollment(ctx, s.repos(ctx).Settings(), user)
+
     // Generate access token
-    accessToken, err := generateToken(user, "access", accessTokenDuration)
+    accessToken, err := generateToken(user, "access", accessTokenDuration, mfaEnrollmentRequired)
     if err != nil {
         return nil, fmt.Errorf("error generating access token: %w", err)
     }
 
     // Generate refresh token
-    refreshToken, err := generateToken(user, "refresh", refreshTokenDuration)
+    refreshToken, err := generateToken(user, "refresh", refreshTokenDuration, mfaEnrollmentRequired)
     if err != nil {
         return nil, fmt.Errorf("error generating refresh token: %w", err)
     }
@@ -67,7 +128,7 @@ func GenerateTokenPair(user *models.User) (*models.TokenPair, error) {
     }, nil
 }
 
-func generateToken(user *models.User, tokenType string, duration time.Duration) (string, error) {
+func generateToken(user *models.User, tokenType string, duration time.Duration, mfaEnrollmentRequired bool) (string, error) {
     var roleNames []string
     for _, role := range user.Roles {
         roleNames = append(roleNames, role.Name)
@@ -77,12 +138,132 @@ func generateToken(user *models.User, tokenType string, duration time.Duration)
         UserID: user.ID,
         Roles:  roleNames,
         TokenType: tokenType,
+        EmailVerified: user.EmailVerified,
+        SessionVersion: user.SessionVersion,
+        MFAEnrollmentRequired: mfaEnrollmentRequired,
+        PasswordChangeRequired: PasswordChangeRequired(user),
         StandardClaims: jwt.StandardClaims{
             ExpiresAt: time.Now().Add(duration).Unix(),
             IssuedAt:  time.Now().Unix(),
         },
     }
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString(jwtSecret)
+    return signClaims(claims)
+}
+
+// GenerateImpersonationToken firma un access token del usuario con el claim "act"
+// del administrador; no tiene refresh token, vence con la suplantación
+func GenerateImpersonationToken(user *models.User, impersonation *models.Impersonation) (string, error) {
+    var roleNames []string
+    for _, role := range user.Roles {
+        roleNames = append(roleNames, role.Name)
+    }
+
+    claims := models.Claims{
+        UserID: user.ID,
+        Roles:  roleNames,
+        TokenType: "access",
+        EmailVerified: user.EmailVerified,
+        SessionVersion: user.SessionVersion,
+        Act: &models.Actor{
+            UserID:          impersonation.AdminID,
+            ImpersonationID: impersonation.ID,
+        },
+        StandardClaims: jwt.StandardClaims{
+            ExpiresAt: impersonation.ExpiresAt.Unix(),
+            IssuedAt:  time.Now().Unix(),
+        },
+    }
+
+    return signClaims(claims)
+}
+
+// GenerateMFAPendingToken firma el token de corta duración que entrega el login
+// cuando el usuario tiene 2FA; solo sirve para canjearlo en /api/auth/2fa/verify
+func (s *TokenService) GenerateMFAPendingToken(ctx context.Context, user *models.User) (string, error) {
+    return generateToken(user, "mfa_pending", mfaPendingTokenDuration, requiresMFAEnrollment(ctx, s.repos(ctx).Settings(), user))
+}
+
+// GenerateInvitationToken firma el token que se envía por email con la invitación
+func GenerateInvitationToken(invitation *models.ProjectInvitation) (string, error) {
+    claims := models.InvitationClaims{
+        InvitationID: invitation.ID,
+        Email:        invitation.Email,
+        TokenType:    "invitation",
+        StandardClaims: jwt.StandardClaims{
+            ExpiresAt: invitation.ExpiresAt.Unix(),
+            IssuedAt:  time.Now().Unix(),
+        },
+    }
+    return signClaims(claims)
+}
+
+func ValidateInvitationToken(tokenString string) (*models.InvitationClaims, error) {
+    claims := &models.InvitationClaims{}
+    if err := parseClaims(tokenString, claims); err != nil {
+        return nil, err
+    }
+    if claims.TokenType != "invitation" {
+        return nil, ErrInvalidToken
+    }
+    return claims, nil
+}
+
+// GenerateEmailVerificationToken firma el token del enlace de verificación de email
+func GenerateEmailVerificationToken(user *models.User, duration time.Duration) (string, error) {
+    claims := models.VerificationClaims{
+        UserID:    user.ID,
+        Email:     user.Email,
+        TokenType: "email_verification",
+        StandardClaims: jwt.StandardClaims{
+            ExpiresAt: time.Now().Add(duration).Unix(),
+            IssuedAt:  time.Now().Unix(),
+        },
+    }
+    return signClaims(claims)
+}
+
+func ValidateEmailVerificationToken(tokenString string) (*models.VerificationClaims, error) {
+    claims := &models.VerificationClaims{}
+    if err := parseClaims(tokenString, claims); err != nil {
+        return nil, err
+    }
+    if claims.TokenType != "email_verification" {
+        return nil, ErrInvalidToken
+    }
+    return claims, nil
+}
+
+// CheckSession verifica que el usuario del token siga existiendo y que sus
+// sesiones no hayan sido invalidadas después de emitirlo. De paso carga en
+// claims el idioma preferido del usuario.
+func (s *TokenService) CheckSession(ctx context.Context, claims *models.Claims) error {
+    return checkSession(ctx, s.repos(ctx).Users(), claims)
+}
+
+func checkSession(ctx context.Context, users repositories.UserRepository, claims *models.Claims) error {
+    user, err := users.FindByID(ctx, claims.UserID)
+    if err != nil {
+        return ErrSessionRevoked
+    }
+    if user.SessionVersion != claims.SessionVersion {
+        return ErrSessionRevoked
+    }
+    claims.Locale = user.Locale
+    return nil
+}
+
+// generateRandomToken devuelve un token aleatorio de size bytes codificado en base64 URL
+func generateRandomToken(size int) (string, error) {
+    buffer := make([]byte, size)
+    if _, err := rand.Read(buffer); err != nil {
+        return "", err
+    }
+    return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+// hashToken es el hash que se guarda en la base para los tokens de un solo uso
+func hashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/repositories"
+	"gorm.io/gorm"
+)
+
+type TrashInterface interface {
+	ListTrash(ctx context.Context, resource string, ownerId uint) (interface{}, error)
+	Restore(ctx context.Context, resource string, id uint, ownerId uint) (interface{}, error)
+	Purge(ctx context.Context, resource string, id uint) error
+	PurgeExpired(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+type TrashService struct {
+	store repositories.Store
+}
+
+func NewTrashService(store repositories.Store) *TrashService {
+	return &TrashService{store: store}
+}
+
+func (s *TrashService) repos(ctx context.Context) repositories.Store {
+	return repositories.StoreFrom(ctx, s.store)
+}
+
+var (
+	ErrUnknownResource   = NewError(KindNotFound, "UNKNOWN_RESOURCE_TYPE", "unknown resource type")
+	ErrResourceForbidden = NewError(KindForbidden, "RESOURCE_TYPE_FORBIDDEN", "resource type not available")
+	ErrNotInTrash        = NewError(KindNotFound, "NOT_IN_TRASH", "item not found in trash")
+	ErrRestoreConflict   = NewError(KindConflict, "RESTORE_CONFLICT", "an active item with the same unique values already exists")
+	ErrUserOwnsResources = NewError(KindConflict, "USER_OWNS_RESOURCES", "user still owns projects or tasks")
+)
+
+// Recursos que se pueden listar, restaurar y purgar desde la papelera
+var trashResources = map[string]bool{
+	"users":    true,
+	"roles":    true,
+	"projects": true,
+	"tasks":    true,
+}
+
+// Solo proyectos y tareas tienen dueño; usuarios y roles son exclusivos del administrador
+func ownedResource(resource string) bool {
+	return resource == "projects" || resource == "tasks"
+}
+
+func checkTrashResource(resource string, ownerId uint) error {
+	if !trashResources[resource] {
+		return ErrUnknownResource
+	}
+	if ownerId != 0 && !ownedResource(resource) {
+		return ErrResourceForbidden
+	}
+	return nil
+}
+
+// ListTrash devuelve los elementos borrados de un tipo de recurso.
+// Si ownerId es distinto de 0 solo se devuelven los elementos de ese usuario.
+func (s *TrashService) ListTrash(ctx context.Context, resource string, ownerId uint) (interface{}, error) {
+	if err := checkTrashResource(resource, ownerId); err != nil {
+		return nil, err
+	}
+	return s.repos(ctx).Trash().List(ctx, resource, ownerId)
+}
+
+// Restore quita la marca de borrado de un elemento. Las filas de las tablas
+// intermedias se conservan mientras el elemento está en la papelera, por lo
+// que sus roles, miembros y tareas vuelven con él; los elementos relacionados
+// que también estén en la papelera siguen allí.
+func (s *TrashService) Restore(ctx context.Context, resource string, id uint, ownerId uint) (interface{}, error) {
+	if err := checkTrashResource(resource, ownerId); err != nil {
+		return nil, err
+	}
+
+	repos := s.repos(ctx)
+	if _, err := repos.Trash().Find(ctx, resource, id, ownerId); err != nil {
+		return nil, notFoundAs(err, ErrNotInTrash)
+	}
+	if err := repos.Trash().Restore(ctx, resource, id); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrRestoreConflict
+		}
+		return nil, notFoundAs(err, ErrNotInTrash)
+	}
+
+	switch resource {
+	case "users":
+		return repos.Users().FindByID(ctx, id)
+	case "roles":
+		return repos.Roles().FindByID(ctx, id)
+	case "projects":
+		return repos.Projects().FindByID(ctx, id)
+	default:
+		return repos.Tasks().FindByID(ctx, id)
+	}
+}
+
+// Purge elimina definitivamente un elemento que ya está en la papelera,
+// junto con sus filas en las tablas intermedias.
+func (s *TrashService) Purge(ctx context.Context, resource string, id uint) error {
+	if err := checkTrashResource(resource, 0); err != nil {
+		return err
+	}
+
+	return repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, tx repositories.Store) error {
+		if _, err := tx.Trash().Find(ctx, resource, id, 0); err != nil {
+			return notFoundAs(err, ErrNotInTrash)
+		}
+		if resource == "users" {
+			owns, err := tx.Trash().OwnsResources(ctx, id)
+			if err != nil {
+				return err
+			}
+			if owns {
+				return ErrUserOwnsResources
+			}
+		}
+		return tx.Trash().Purge(ctx, resource, id)
+	})
+}
+
+// PurgeExpired elimina definitivamente todo lo que lleva en la papelera más
+// tiempo que retention. Devuelve la cantidad de elementos eliminados.
+func (s *TrashService) PurgeExpired(ctx context.Context, retention time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-retention)
+	var purged int64
+
+	// Primero tareas y proyectos, así los usuarios dejan de ser dueños de algo
+	for _, resource := range []string{"tasks", "projects", "roles", "users"} {
+		ids, err := s.repos(ctx).Trash().DeletedBefore(ctx, resource, cutoff)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, id := range ids {
+			if err := s.Purge(ctx, resource, id); err != nil {
+				log.Printf("Error purging %s from trash: %v\n", resource, err)
+				continue
+			}
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// StartTrashRetentionJob purga periódicamente los elementos que superaron el
+// período de retención. Pensado para correr en su propia goroutine.
+func StartTrashRetentionJob(trashService TrashInterface, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := trashService.PurgeExpired(context.Background(), retention)
+		if err != nil {
+			log.Printf("Error running trash retention job: %v\n", err)
+		} else if purged > 0 {
+			log.Printf("Trash retention job purged %d items\n", purged)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/models"
+)
+
+func TestTrashRestoreAndPurgeProject(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	project := createTestProject(t, store, "Apollo", owner.ID)
+	projects := NewProjectService(store)
+	service := NewTrashService(store)
+
+	if _, err := projects.DeleteProject(ctx, project.ID, DeletionPolicyDetach); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+
+	items, err := service.ListTrash(ctx, "projects", owner.ID)
+	if err != nil {
+		t.Fatalf("ListTrash: %v", err)
+	}
+	if trashed := *items.(*[]models.Project); len(trashed) != 1 || trashed[0].ID != project.ID {
+		t.Fatalf("expected project %d in the trash, got %+v", project.ID, trashed)
+	}
+
+	// Otro usuario no ve ni restaura la papelera ajena
+	other := registerTestUser(t, store, "other", "other@example.com")
+	if _, err := service.Restore(ctx, "projects", project.ID, other.ID); !errors.Is(err, ErrNotInTrash) {
+		t.Fatalf("expected ErrNotInTrash for another owner, got %v", err)
+	}
+
+	if _, err := service.Restore(ctx, "projects", project.ID, owner.ID); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if _, err := projects.GetProjectById(ctx, project.ID); err != nil {
+		t.Fatalf("expected the restored project to be active: %v", err)
+	}
+
+	if _, err := projects.DeleteProject(ctx, project.ID, DeletionPolicyDetach); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	if err := service.Purge(ctx, "projects", project.ID); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if _, err := service.Restore(ctx, "projects", project.ID, 0); !errors.Is(err, ErrNotInTrash) {
+		t.Fatalf("expected the purged project to be gone, got %v", err)
+	}
+}
+
+func TestTrashRestoreConflict(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	project := createTestProject(t, store, "Apollo", owner.ID)
+
+	if _, err := NewProjectService(store).DeleteProject(ctx, project.ID, DeletionPolicyDetach); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	createTestProject(t, store, "Apollo", owner.ID)
+
+	if _, err := NewTrashService(store).Restore(ctx, "projects", project.ID, owner.ID); !errors.Is(err, ErrRestoreConflict) {
+		t.Fatalf("expected ErrRestoreConflict, got %v", err)
+	}
+}
+
+func TestTrashPurgeKeepsUsersWithResources(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	owner := registerTestUser(t, store, "owner", "owner@example.com")
+	project := createTestProject(t, store, "Apollo", owner.ID)
+	service := NewTrashService(store)
+
+	if _, err := newTestUserService(store, &fakeMailer{}).DeleteUser(ctx, owner.ID, DeletionPolicyCascade, 0); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	// Los usuarios son solo del administrador
+	if _, err := service.ListTrash(ctx, "users", owner.ID); !errors.Is(err, ErrResourceForbidden) {
+		t.Fatalf("expected ErrResourceForbidden, got %v", err)
+	}
+	if _, err := service.ListTrash(ctx, "comments", 0); !errors.Is(err, ErrUnknownResource) {
+		t.Fatalf("expected ErrUnknownResource, got %v", err)
+	}
+
+	// Mientras su proyecto siga en la papelera el usuario no se purga
+	if err := service.Purge(ctx, "users", owner.ID); !errors.Is(err, ErrUserOwnsResources) {
+		t.Fatalf("expected ErrUserOwnsResources, got %v", err)
+	}
+
+	// Nada superó la retención todavía
+	if purged, err := service.PurgeExpired(ctx, time.Hour); err != nil || purged != 0 {
+		t.Fatalf("expected nothing purged, got %d (%v)", purged, err)
+	}
+	// El proyecto se purga antes que su dueño
+	if purged, err := service.PurgeExpired(ctx, 0); err != nil || purged != 2 {
+		t.Fatalf("expected the project and the user purged, got %d (%v)", purged, err)
+	}
+	if _, err := service.Restore(ctx, "projects", project.ID, 0); !errors.Is(err, ErrNotInTrash) {
+		t.Fatalf("expected the purged project to be gone, got %v", err)
+	}
+	if _, err := service.Restore(ctx, "users", owner.ID, 0); !errors.Is(err, ErrNotInTrash) {
+		t.Fatalf("expected the purged user to be gone, got %v", err)
+	}
+}
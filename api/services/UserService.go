@@ -1,76 +1,127 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
-	"github.com/lucapierini/project-go-task_manager/config"
 	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/i18n"
 	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
 	// "github.com/lucapierini/project-go-task_manager/utils"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UserInterface interface {
-    RegisterUser(userDto dto.UserDto) (*models.User, error)
-    LoginUser(loginDto dto.LoginDto) (*models.User, error)
-    GetUserById(id uint) (*models.User, error)
-    GetUserByEmail(email string) (*models.User, error)
-    ListUsers() ([]models.User, error)
-    UpdateUser(id uint, userDto dto.UserDto) (*models.User, error)
-    DeleteUser(id uint) error
-	AssignRoleToUser(userId uint, roleId uint) error
-	UnassignRoleToUser(userId uint, roleId uint) error
+    RegisterUser(ctx context.Context, userDto dto.UserDto) (*models.User, error)
+    LoginUser(ctx context.Context, loginDto dto.LoginDto) (*models.User, error)
+    GetUserById(ctx context.Context, id uint) (*models.User, error)
+    GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+    ListUsers(ctx context.Context) ([]models.User, error)
+    UpdateUser(ctx context.Context, id uint, version uint, userDto dto.UserDto) (*models.User, error)
+    DeleteUser(ctx context.Context, id uint, policy string, successorId uint) (*models.UserDeletionImpact, error)
+    PlanUserDeletion(ctx context.Context, id uint, policy string, successorId uint) (*models.UserDeletionImpact, error)
+	AssignRoleToUser(ctx context.Context, userId uint, roleId uint) error
+	UnassignRoleToUser(ctx context.Context, userId uint, roleId uint) error
+	ChangePassword(ctx context.Context, userId uint, currentPassword string, newPassword string) (*models.User, error)
+	ExpirePassword(ctx context.Context, userId uint) error
 }
 
-type UserService struct{}
+type UserService struct {
+	store         repositories.Store
+	verification  VerificationInterface
+	authProviders []AuthProvider
+}
+
+// NewUserService recibe los proveedores de autenticación en el orden en que
+// LoginUser los prueba; sin proveedores solo se usa la contraseña local.
+// verification envía el enlace cuando un usuario cambia su email.
+func NewUserService(store repositories.Store, verification VerificationInterface, authProviders ...AuthProvider) *UserService {
+	if len(authProviders) == 0 {
+		authProviders = []AuthProvider{NewLocalAuthProvider(store.Users())}
+	}
+	return &UserService{store: store, verification: verification, authProviders: authProviders}
+}
 
-func NewUserService() *UserService {
-	return &UserService{}
+// repos devuelve los repositorios de la transacción de ctx si la hay
+func (s *UserService) repos(ctx context.Context) repositories.Store {
+	return repositories.StoreFrom(ctx, s.store)
 }
 
 var (
-	ErrEmailAlreadyRegistered = errors.New("email already registered")
-	ErrInvalidData            = errors.New("invalid data provided")
+	ErrEmailAlreadyRegistered = NewError(KindConflict, "EMAIL_ALREADY_REGISTERED", "email already registered")
+	ErrInvalidData            = NewError(KindValidation, "INVALID_DATA", "invalid data provided")
+	ErrRoleAlreadyAssigned    = NewError(KindConflict, "ROLE_ALREADY_ASSIGNED", "role already assigned to user")
+	ErrRoleNotAssigned        = NewError(KindNotFound, "ROLE_NOT_ASSIGNED", "role not assigned to user")
+	ErrUnsupportedLocale      = NewError(KindValidation, "UNSUPPORTED_LOCALE", "unsupported language")
 )
 
-func (s *UserService) RegisterUser(userDto dto.UserDto) (*models.User, error) {
-	// Check if email already exists
-	var existingUser models.User
-	if result := config.DB.Where("email = ?", userDto.Email).First(&existingUser); result.Error == nil {
-		return nil, errors.New("email already registered")
+// normalizeLocale valida el idioma preferido y lo reduce a su código ("es-AR" queda "es")
+func normalizeLocale(locale string) (string, error) {
+	if locale == "" {
+		return "", nil
 	}
-
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(userDto.Password), bcrypt.DefaultCost)
-	if err != nil {
-		return nil, err
+	language, ok := i18n.Normalize(locale)
+	if !ok {
+		supported := i18n.Supported()
+		return "", ErrUnsupportedLocale.WithFields(FieldError{Field: "locale", Code: "oneof", Param: strings.Join(supported, " "), Message: "must be one of: " + strings.Join(supported, ", ")})
 	}
+	return language, nil
+}
 
-	// assign default role
-	var defaultRole models.Role
-	if err := config.DB.First(&defaultRole, "name = ?", "Usuario").Error; err != nil {
-		return nil, err
-	}
+func (s *UserService) RegisterUser(ctx context.Context, userDto dto.UserDto) (*models.User, error) {
+	var user models.User
+	err := repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		// Check if email already exists
+		if _, err := store.Users().FindByEmail(ctx, userDto.Email); err == nil {
+			return ErrEmailAlreadyRegistered
+		}
+		locale, err := normalizeLocale(userDto.Locale)
+		if err != nil {
+			return err
+		}
 
-	// Create user
-	user := models.User{
-		Username: userDto.Username,
-		Email:    userDto.Email,
-		Password: string(hashedPassword),
-		Roles: []models.Role{defaultRole},
-	}
+		// Hash password (antes se valida contra la política)
+		hashedPassword, err := hashNewPassword(ctx, store.Users(), &models.User{Username: userDto.Username, Email: userDto.Email}, userDto.Password)
+		if err != nil {
+			return err
+		}
 
-	// Add roles if specified
-	if len(userDto.RoleIds) > 0 {
-		var roles []models.Role
-		if err := config.DB.Find(&roles, userDto.RoleIds).Error; err != nil {
-			return nil, err
+		// assign default role
+		defaultRole, err := store.Roles().FindByName(ctx, "Usuario")
+		if err != nil {
+			return err
+		}
+
+		// Create user
+		now := time.Now()
+		user = models.User{
+			Username: userDto.Username,
+			Email:    userDto.Email,
+			Password: hashedPassword,
+			AuthProvider: models.AuthProviderLocal,
+			PasswordPolicyVersion: CurrentPasswordPolicy().Version,
+			PasswordChangedAt: &now,
+			Locale: locale,
+			Roles: []models.Role{*defaultRole},
+		}
+
+		// Add roles if specified
+		if len(userDto.RoleIds) > 0 {
+			roles, err := store.Roles().FindByIDs(ctx, userDto.RoleIds)
+			if err != nil {
+				return err
+			}
+			user.Roles = append(user.Roles, roles...)
 		}
-		user.Roles = append(user.Roles, roles...)
-	}
 
-	if err := config.DB.Create(&user).Error; err != nil {
+		return store.Users().Create(ctx, &user)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -78,107 +129,242 @@ func (s *UserService) RegisterUser(userDto dto.UserDto) (*models.User, error) {
 }
 
 
-func (s *UserService) LoginUser(loginDto dto.LoginDto) (*models.User, error) {
-	var user models.User
-	if err := config.DB.Preload("Roles").Where("email = ?", loginDto.Email).First(&user).Error; err != nil {
-		fmt.Println("invalid credentials")
-		return nil, errors.New("invalid credentials")
+func (s *UserService) LoginUser(ctx context.Context, loginDto dto.LoginDto) (*models.User, error) {
+	for _, provider := range s.authProviders {
+		user, err := provider.Authenticate(ctx, loginDto)
+		if errors.Is(err, ErrUnknownAccount) {
+			continue
+		}
+		if errors.Is(err, ErrInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		// Una falla del proveedor (base o LDAP caídos) no son credenciales inválidas
+		if err != nil {
+			return nil, fmt.Errorf("%s provider: %w", provider.Name(), err)
+		}
+		return user, nil
 	}
+	return nil, ErrInvalidCredentials
+}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginDto.Password)); err != nil {
-		fmt.Println("invalid password")
-		return nil, errors.New("invalid credentials")
-	}
 
-	return &user, nil
+func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	user, err := s.repos(ctx).Users().FindByEmail(ctx, email)
+	return user, notFoundAs(err, ErrUserNotFound)
 }
 
+func (s *UserService) GetUserById(ctx context.Context, id uint) (*models.User, error) {
+    user, err := s.repos(ctx).Users().FindByID(ctx, id)
+    return user, notFoundAs(err, ErrUserNotFound)
+}
 
-func (s *UserService) GetUserByEmail(email string) (*models.User, error) {
-	var user models.User
-	if err := config.DB.Preload("Roles").Where("email = ?", email).First(&user).Error; err != nil {
+func (s *UserService) UpdateUser(ctx context.Context, id uint, version uint, userDto dto.UserDto) (*models.User, error) {
+	var user *models.User
+	// Los roles, la contraseña y el resto de los datos se guardan juntos o no se guarda nada
+	err := repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		var err error
+		user, err = store.Users().FindByID(ctx, id)
+		if err != nil {
+			return notFoundAs(err, ErrUserNotFound)
+		}
+		if err := checkVersion(user.Version, version); err != nil {
+			return err
+		}
+
+		user.Username = userDto.Username
+		if user.Locale, err = normalizeLocale(userDto.Locale); err != nil {
+			return err
+		}
+		// Un email nuevo tiene que volver a verificarse; el enlace sale recién
+		// cuando se confirma el cambio
+		if user.Email != userDto.Email {
+			user.EmailVerified = false
+			user.EmailVerifiedAt = nil
+			repositories.AfterCommit(ctx, func() {
+				if err := s.verification.SendVerification(user); err != nil {
+					log.Printf("Error sending verification email to user %d: %v\n", user.ID, err)
+				}
+			})
+		}
+		user.Email = userDto.Email
+
+		// Update roles if specified
+		if len(userDto.RoleIds) > 0 {
+			roles, err := store.Roles().FindByIDs(ctx, userDto.RoleIds)
+			if err != nil {
+				return err
+			}
+			user.Roles = roles
+		}
+
+		if userDto.Password != "" {
+			if user.AuthProvider != models.AuthProviderLocal {
+				return ErrPasswordManagedExternally
+			}
+			hashedPassword, err := hashNewPassword(ctx, store.Users(), user, userDto.Password)
+			if err != nil {
+				return err
+			}
+			if err := savePassword(ctx, store.Users(), user, hashedPassword, false); err != nil {
+				return err
+			}
+		}
+		return store.Users().Save(ctx, user)
+	})
+	if err != nil {
 		return nil, err
 	}
-	return &user, nil
-}
 
-func (s *UserService) GetUserById(id uint) (*models.User, error) {
-    var user models.User
-    if err := config.DB.Preload("Roles").Where("id = ?", id).First(&user).Error; err != nil {
-        return nil, err
-    }
-    return &user, nil
+	return user, nil
 }
 
-func (s *UserService) UpdateUser(id uint, userDto dto.UserDto) (*models.User, error) {
-	user, err := s.GetUserById(id)
+// ChangePassword cambia la contraseña del propio usuario verificando la actual.
+// Invalida las demás sesiones; el usuario devuelto sirve para emitir tokens nuevos.
+func (s *UserService) ChangePassword(ctx context.Context, userId uint, currentPassword string, newPassword string) (*models.User, error) {
+	err := repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		user, err := store.Users().FindByID(ctx, userId)
+		if err != nil {
+			return notFoundAs(err, ErrUserNotFound)
+		}
+		if user.AuthProvider != models.AuthProviderLocal {
+			return ErrPasswordManagedExternally
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)); err != nil {
+			return ErrInvalidCredentials
+		}
+
+		hashedPassword, err := hashNewPassword(ctx, store.Users(), user, newPassword)
+		if err != nil {
+			return err
+		}
+		return savePassword(ctx, store.Users(), user, hashedPassword, true)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	user.Username = userDto.Username
-	user.Email = userDto.Email
+	return s.GetUserById(ctx, userId)
+}
 
-	if userDto.Password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(userDto.Password), bcrypt.DefaultCost)
-		if err != nil {
-			return nil, err
-		}
-		user.Password = string(hashedPassword)
+// ExpirePassword obliga al usuario a cambiar la contraseña en el próximo login
+func (s *UserService) ExpirePassword(ctx context.Context, userId uint) error {
+	return s.repos(ctx).Users().ExpirePassword(ctx, userId)
+}
+
+
+
+func (s *UserService) ListUsers(ctx context.Context) ([]models.User, error) {
+	return s.repos(ctx).Users().List(ctx)
+}
+
+// PlanUserDeletion calcula qué afectaría borrar el usuario con la política indicada, sin modificar nada
+func (s *UserService) PlanUserDeletion(ctx context.Context, id uint, policy string, successorId uint) (*models.UserDeletionImpact, error) {
+	user, err := s.GetUserById(ctx, id)
+	if err != nil {
+		return nil, notFoundAs(err, ErrUserNotFound)
 	}
 
-	// Update roles if specified
-	if len(userDto.RoleIds) > 0 {
-		var roles []models.Role
-		if err := config.DB.Find(&roles, userDto.RoleIds).Error; err != nil {
-			return nil, err
+	impact := models.UserDeletionImpact{UserID: id, Policy: policy}
+	switch policy {
+	case DeletionPolicyRestrict, DeletionPolicyCascade:
+	case DeletionPolicyTransfer:
+		if successorId == 0 || successorId == id {
+			return nil, ErrSuccessorRequired
 		}
-		user.Roles = roles
+		if _, err := s.GetUserById(ctx, successorId); err != nil {
+			return nil, ErrSuccessorRequired
+		}
+		impact.SuccessorID = successorId
+	default:
+		return nil, ErrInvalidDeletionPolicy
 	}
 
-	if err := config.DB.Save(user).Error; err != nil {
+	store := s.repos(ctx)
+	if impact.OwnedProjects, err = store.Projects().IDsOwnedBy(ctx, id); err != nil {
+		return nil, err
+	}
+	if impact.OwnedTasks, err = store.Tasks().IDsOwnedBy(ctx, id); err != nil {
+		return nil, err
+	}
+	if impact.ProjectMemberships, err = store.Projects().IDsWithMember(ctx, id); err != nil {
 		return nil, err
 	}
+	if impact.CoOwnedProjects, err = store.Projects().IDsCoOwnedBy(ctx, id); err != nil {
+		return nil, err
+	}
+	impact.Roles = []uint{}
+	for _, role := range user.Roles {
+		impact.Roles = append(impact.Roles, role.ID)
+	}
 
-	return user, nil
+	return &impact, nil
 }
 
+// DeleteUser borra el usuario aplicando la política indicada sobre sus proyectos y tareas.
+// Con restrict devuelve ErrDeletionRestricted (junto con el impacto) si todavía es dueño de algo.
+func (s *UserService) DeleteUser(ctx context.Context, id uint, policy string, successorId uint) (*models.UserDeletionImpact, error) {
+	var impact *models.UserDeletionImpact
+	// El impacto se calcula dentro de la misma transacción, así no cambia antes del borrado
+	err := repositories.RunInTransaction(ctx, s.store, func(ctx context.Context, store repositories.Store) error {
+		var err error
+		impact, err = s.PlanUserDeletion(ctx, id, policy, successorId)
+		if err != nil {
+			return err
+		}
+
+		if policy == DeletionPolicyRestrict && (len(impact.OwnedProjects) > 0 || len(impact.OwnedTasks) > 0) {
+			return ErrDeletionRestricted
+		}
 
+		switch policy {
+		case DeletionPolicyTransfer:
+			// También cambia de dueño lo que está en la papelera
+			if err := store.Projects().ReassignOwner(ctx, id, successorId); err != nil {
+				return err
+			}
+			if err := store.Tasks().ReassignOwner(ctx, id, successorId); err != nil {
+				return err
+			}
+		case DeletionPolicyCascade:
+			if err := store.Tasks().Delete(ctx, impact.OwnedTasks...); err != nil {
+				return err
+			}
+			if err := store.Projects().Delete(ctx, impact.OwnedProjects...); err != nil {
+				return err
+			}
+		}
 
-func (s *UserService) ListUsers() ([]models.User, error) {
-	var users []models.User
-	if err := config.DB.Preload("Roles").Find(&users).Error; err != nil {
+		return store.Users().Delete(ctx, id)
+	})
+	if errors.Is(err, ErrDeletionRestricted) {
+		return impact, err
+	}
+	if err != nil {
 		return nil, err
 	}
-	return users, nil
-}
 
-func (s *UserService) DeleteUser (id uint) error {
-    if err := config.DB.Delete(&models.User{}, id).Error; err != nil {
-        return err
-    }
-    return nil
+	return impact, nil
 }
 
-func (s *UserService) AssignRoleToUser(userId uint, roleId uint) error {
-	var user models.User
-	if err := config.DB.Preload("Roles").Where("id = ?", userId).First(&user).Error; err != nil {
-		return err
+func (s *UserService) AssignRoleToUser(ctx context.Context, userId uint, roleId uint) error {
+	user, err := s.GetUserById(ctx, userId)
+	if err != nil {
+		return notFoundAs(err, ErrUserNotFound)
 	}
 
 		// Check if role is already assigned to the user
 	for _, r := range user.Roles {
 		if r.ID == roleId {
-			return errors.New("role already assigned to user")
+			return ErrRoleAlreadyAssigned
 		}
 	}
 
-	var role models.Role
-	if err := config.DB.Where("id = ?", roleId).First(&role).Error; err != nil {
-		return err
+	role, err := s.repos(ctx).Roles().FindByID(ctx, roleId)
+	if err != nil {
+		return notFoundAs(err, ErrRoleNotFound)
 	}
 
-	err := config.DB.Model(&user).Association("Roles").Append(&role)
+	err = s.repos(ctx).Users().AddRole(ctx, user.ID, role)
 
 	if err != nil {
 		return err
@@ -187,10 +373,10 @@ func (s *UserService) AssignRoleToUser(userId uint, roleId uint) error {
 	return nil
 }
 
-func (s *UserService) UnassignRoleToUser(userId uint, roleId uint) error {
-	var user models.User
-	if err := config.DB.Preload("Roles").Where("id = ?", userId).First(&user).Error; err != nil {
-		return err
+func (s *UserService) UnassignRoleToUser(ctx context.Context, userId uint, roleId uint) error {
+	user, err := s.GetUserById(ctx, userId)
+	if err != nil {
+		return notFoundAs(err, ErrUserNotFound)
 	}
 
 		// Check if role is already assigned to the user
@@ -204,15 +390,10 @@ func (s *UserService) UnassignRoleToUser(userId uint, roleId uint) error {
 	}
 
 	if !found {
-		return errors.New("role not assigned to user")
-	}
-
-	var role models.Role
-	if err := config.DB.Where("id = ?", roleId).First(&role).Error; err != nil {
-		return err
+		return ErrRoleNotAssigned
 	}
 
-	err := config.DB.Model(&user).Association("Roles").Delete(&role)
+	err = s.repos(ctx).Users().RemoveRole(ctx, user.ID, roleId)
 
 	if err != nil {
 		return err
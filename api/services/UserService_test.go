@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+)
+
+func TestUpdateUserEmailSendsVerification(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	user := registerTestUser(t, store, "alice", "alice@example.com")
+	mailer := &fakeMailer{}
+	service := newTestUserService(store, mailer)
+
+	// Sin cambiar el email no sale ningún correo
+	if _, err := service.UpdateUser(ctx, user.ID, AnyVersion, dto.UserDto{Username: "alice2", Email: "alice@example.com"}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if len(mailer.sent) != 0 {
+		t.Fatalf("expected no mail without an email change, got %+v", mailer.sent)
+	}
+
+	updated, err := service.UpdateUser(ctx, user.ID, AnyVersion, dto.UserDto{Username: "alice2", Email: "new@example.com"})
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if updated.EmailVerified || updated.EmailVerifiedAt != nil {
+		t.Fatalf("the new email must be unverified, got %+v", updated)
+	}
+	mail := mailer.last(t)
+	if len(mailer.sent) != 1 || mail.to != "new@example.com" {
+		t.Fatalf("expected one verification mail to the new email, got %+v", mailer.sent)
+	}
+	if !strings.Contains(mail.body, mailer.mailToken(t)) {
+		t.Fatalf("the mail does not contain the verification link:\n%s", mail.body)
+	}
+}
+
+func TestUpdateUserEmailWaitsForCommit(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	user := registerTestUser(t, store, "alice", "alice@example.com")
+	mailer := &fakeMailer{}
+	service := newTestUserService(store, mailer)
+
+	// Si la transacción del request se deshace el correo no sale
+	rollback := errors.New("rollback")
+	err := repositories.RunInTransaction(ctx, store, func(ctx context.Context, _ repositories.Store) error {
+		if _, err := service.UpdateUser(ctx, user.ID, AnyVersion, dto.UserDto{Username: "alice", Email: "new@example.com"}); err != nil {
+			return err
+		}
+		if len(mailer.sent) != 0 {
+			t.Fatal("the mail must wait for the commit")
+		}
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatalf("expected the rollback error, got %v", err)
+	}
+	if len(mailer.sent) != 0 {
+		t.Fatalf("expected no mail after the rollback, got %+v", mailer.sent)
+	}
+
+	err = repositories.RunInTransaction(ctx, store, func(ctx context.Context, _ repositories.Store) error {
+		_, err := service.UpdateUser(ctx, user.ID, AnyVersion, dto.UserDto{Username: "alice", Email: "new@example.com"})
+		return err
+	})
+	if err != nil || len(mailer.sent) != 1 {
+		t.Fatalf("expected one mail after the commit, got %+v (%v)", mailer.sent, err)
+	}
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lucapierini/project-go-task_manager/config"
+	"github.com/lucapierini/project-go-task_manager/models"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+)
+
+type VerificationInterface interface {
+	SendVerification(user *models.User) error
+	ResendVerification(ctx context.Context, userId uint) error
+	VerifyEmail(ctx context.Context, token string) (*models.User, error)
+	SetEmailVerified(ctx context.Context, userId uint, verified bool) (*models.User, error)
+}
+
+type VerificationService struct {
+	store  repositories.Store
+	mailer Mailer
+}
+
+func NewVerificationService(store repositories.Store, mailer Mailer) *VerificationService {
+	return &VerificationService{store: store, mailer: mailer}
+}
+
+func (s *VerificationService) repos(ctx context.Context) repositories.Store {
+	return repositories.StoreFrom(ctx, s.store)
+}
+
+var (
+	ErrAlreadyVerified          = NewError(KindConflict, "EMAIL_ALREADY_VERIFIED", "email already verified")
+	ErrInvalidVerificationToken = NewError(KindValidation, "INVALID_VERIFICATION_TOKEN", "invalid or expired verification link")
+)
+
+// SendVerification envía al usuario el enlace para verificar su email
+func (s *VerificationService) SendVerification(user *models.User) error {
+	ttl := config.GetEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+	token, err := GenerateEmailVerificationToken(user, ttl)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link:\n%s/api/auth/verify-email?token=%s\n\n"+
+		"The link expires in %s.",
+		user.Username, appBaseURL(), token, ttl)
+	return s.mailer.Send(user.Email, "Verify your email address", body)
+}
+
+func (s *VerificationService) ResendVerification(ctx context.Context, userId uint) error {
+	user, err := s.repos(ctx).Users().FindByID(ctx, userId)
+	if err != nil {
+		return notFoundAs(err, ErrUserNotFound)
+	}
+	if user.EmailVerified {
+		return ErrAlreadyVerified
+	}
+	return s.SendVerification(user)
+}
+
+func (s *VerificationService) VerifyEmail(ctx context.Context, token string) (*models.User, error) {
+	claims, err := ValidateEmailVerificationToken(token)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	users := s.repos(ctx).Users()
+	user, err := users.FindByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	// El email cambió desde que se envió el enlace
+	if user.Email != claims.Email {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if !user.EmailVerified {
+		if err := markEmailVerified(ctx, users, user, true); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// SetEmailVerified permite a un administrador marcar o desmarcar un email como verificado
+func (s *VerificationService) SetEmailVerified(ctx context.Context, userId uint, verified bool) (*models.User, error) {
+	users := s.repos(ctx).Users()
+	user, err := users.FindByID(ctx, userId)
+	if err != nil {
+		return nil, notFoundAs(err, ErrUserNotFound)
+	}
+	if err := markEmailVerified(ctx, users, user, verified); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func markEmailVerified(ctx context.Context, users repositories.UserRepository, user *models.User, verified bool) error {
+	previous, previousAt := user.EmailVerified, user.EmailVerifiedAt
+	user.EmailVerified = verified
+	user.EmailVerifiedAt = nil
+	if verified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	if err := users.Save(ctx, user); err != nil {
+		user.EmailVerified, user.EmailVerifiedAt = previous, previousAt
+		return err
+	}
+	return nil
+}
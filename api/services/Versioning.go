@@ -0,0 +1,15 @@
+package services
+
+// ErrVersionMismatch indica que el recurso cambió desde que el cliente lo leyó
+var ErrVersionMismatch = NewError(KindPreconditionFailed, "VERSION_MISMATCH", "resource has been modified since it was read")
+
+// AnyVersion acepta cualquier versión del recurso, como If-Match: *
+const AnyVersion uint = 0
+
+// checkVersion compara la versión guardada con la que el cliente dice haber leído
+func checkVersion(current uint, expected uint) error {
+	if expected != AnyVersion && current != expected {
+		return ErrVersionMismatch
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lucapierini/project-go-task_manager/dto"
+	"github.com/lucapierini/project-go-task_manager/repositories"
+)
+
+// versionedStores corre el test sobre el store en memoria y sobre SQLite
+var versionedStores = map[string]func(t *testing.T) repositories.Store{
+	"memory": func(t *testing.T) repositories.Store { return newTestStore(t) },
+	"sqlite": newSQLiteStore,
+}
+
+func TestSaveRejectsStaleVersion(t *testing.T) {
+	for name, newStore := range versionedStores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			owner := registerTestUser(t, store, "owner", "owner@example.com")
+			created := createTestTask(t, store, "Write docs", owner.ID)
+
+			first, err := store.Tasks().FindByID(ctx, created.ID)
+			if err != nil {
+				t.Fatalf("FindByID: %v", err)
+			}
+			second, err := store.Tasks().FindByID(ctx, created.ID)
+			if err != nil {
+				t.Fatalf("FindByID: %v", err)
+			}
+			read := second.Version
+
+			first.Name = "First"
+			if err := store.Tasks().Save(ctx, first); err != nil || first.Version != read+1 {
+				t.Fatalf("expected the first save to bump the version to %d, got %d (%v)", read+1, first.Version, err)
+			}
+			// La segunda copia se leyó antes: no pisa el cambio y conserva su versión
+			second.Name = "Second"
+			if err := store.Tasks().Save(ctx, second); !errors.Is(err, repositories.ErrStaleVersion) || second.Version != read {
+				t.Fatalf("expected ErrStaleVersion keeping version %d, got %d (%v)", read, second.Version, err)
+			}
+
+			// Por el servicio la versión vieja es un 412
+			_, err = NewTaskService(store).UpdateTask(ctx, created.ID, read, dto.TaskDto{Name: "Third", OwnerID: owner.ID})
+			if !errors.Is(err, ErrVersionMismatch) {
+				t.Fatalf("expected ErrVersionMismatch, got %v", err)
+			}
+			stored, err := store.Tasks().FindByID(ctx, created.ID)
+			if err != nil || stored.Name != "First" {
+				t.Fatalf("expected only the first save to apply, got %+v (%v)", stored, err)
+			}
+		})
+	}
+}
+
+func TestAssociationChangesBumpVersion(t *testing.T) {
+	for name, newStore := range versionedStores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			owner := registerTestUser(t, store, "owner", "owner@example.com")
+			member := registerTestUser(t, store, "member", "member@example.com")
+			project := createTestProject(t, store, "Apollo", owner.ID)
+			task := createTestTask(t, store, "Write docs", owner.ID)
+			projects := NewProjectService(store)
+
+			version := func() uint {
+				t.Helper()
+				stored, err := store.Projects().FindByID(ctx, project.ID)
+				if err != nil {
+					t.Fatalf("FindByID: %v", err)
+				}
+				return stored.Version
+			}
+
+			before := version()
+			if err := projects.AddUserToProject(ctx, project.ID, member.ID); err != nil {
+				t.Fatalf("AddUserToProject: %v", err)
+			}
+			if err := projects.AddTaskToProject(ctx, project.ID, task.ID); err != nil {
+				t.Fatalf("AddTaskToProject: %v", err)
+			}
+			if err := projects.RemoveUserFromProject(ctx, project.ID, member.ID); err != nil {
+				t.Fatalf("RemoveUserFromProject: %v", err)
+			}
+			if after := version(); after != before+3 {
+				t.Fatalf("expected each association change to bump the version from %d to %d, got %d", before, before+3, after)
+			}
+
+			// Un If-Match con la versión anterior ya no sirve
+			if _, err := projects.UpdateProject(ctx, project.ID, before, dto.ProjectDto{Name: "Apollo", Budget: 100, OwnerID: owner.ID}); !errors.Is(err, ErrVersionMismatch) {
+				t.Fatalf("expected ErrVersionMismatch, got %v", err)
+			}
+
+			user, err := store.Users().FindByID(ctx, member.ID)
+			if err != nil {
+				t.Fatalf("FindByID: %v", err)
+			}
+			roles, err := store.Roles().FindByIDs(ctx, []uint{user.Roles[0].ID})
+			if err != nil {
+				t.Fatalf("FindByIDs: %v", err)
+			}
+			if err := store.Users().ReplaceRoles(ctx, member.ID, roles); err != nil {
+				t.Fatalf("ReplaceRoles: %v", err)
+			}
+			updated, err := store.Users().FindByID(ctx, member.ID)
+			if err != nil || updated.Version != user.Version+1 {
+				t.Fatalf("expected replacing the roles to bump the user version, got %+v (%v)", updated, err)
+			}
+		})
+	}
+}